@@ -99,6 +99,89 @@ pub struct Opts {
     /// Configure the autodropping of borrows in exported functions.
     #[cfg_attr(feature = "clap", arg(long, default_value_t = Enabled::default()))]
     pub autodrop_borrows: Enabled,
+
+    /// Declare `<func>_post_return` functions in the header instead of
+    /// freeing the results of exports with `free`, leaving the cleanup to
+    /// the embedder. Only set by the Go generator.
+    #[cfg_attr(feature = "clap", arg(skip))]
+    #[doc(hidden)]
+    pub extern_post_return: bool,
+
+    /// Along with `extern_post_return`, request the return area of each call
+    /// of an export from the embedder with `<func>_return_area` instead of
+    /// sharing a static buffer between all exports, so that it stays intact
+    /// until the post-return call even if other exports are called meanwhile.
+    /// Only set by the Go generator.
+    #[cfg_attr(feature = "clap", arg(skip))]
+    #[doc(hidden)]
+    pub extern_return_area: bool,
+
+    /// Customize the names of the core wasm imports and exports. Only set by
+    /// the Go generator, for embedders which don't link them by their
+    /// canonical names.
+    #[cfg_attr(feature = "clap", arg(skip))]
+    #[doc(hidden)]
+    pub core_names: CoreNames,
+}
+
+/// Customizations of the names of the core wasm imports and exports of the
+/// functions and resources of the world.
+#[derive(Default, Debug, Clone)]
+pub struct CoreNames {
+    /// Prefix of the module names of the imports.
+    pub import_prefix: Option<String>,
+    /// The single module all functions are imported from, as
+    /// `<interface>#<function>`, or `<function>` for the world's own imports.
+    pub import_module: Option<String>,
+    /// Prefix of the names of the exports.
+    pub export_prefix: Option<String>,
+    /// Whether to strip the versions of the packages from the names.
+    pub unversioned: bool,
+}
+
+impl CoreNames {
+    /// Returns the module and name of the core wasm import of `name` from the
+    /// module `module`.
+    pub fn import(&self, module: &str, name: &str) -> (String, String) {
+        let module = if self.unversioned {
+            unversioned(module)
+        } else {
+            module.to_string()
+        };
+        let (module, name) = match &self.import_module {
+            Some(single) if module == "$root" => (single.clone(), name.to_string()),
+            Some(single) => (single.clone(), format!("{module}#{name}")),
+            None => (module, name.to_string()),
+        };
+        match &self.import_prefix {
+            Some(prefix) => (format!("{prefix}{module}"), name),
+            None => (module, name),
+        }
+    }
+
+    /// Returns the name of the core wasm export `name`.
+    pub fn export(&self, name: &str) -> String {
+        let name = if self.unversioned {
+            unversioned(name)
+        } else {
+            name.to_string()
+        };
+        match &self.export_prefix {
+            Some(prefix) => format!("{prefix}{name}"),
+            None => name,
+        }
+    }
+}
+
+/// Removes the version of the package from the core wasm name `name`, such
+/// as `wasi:clocks/wall-clock@0.2.0#now`.
+fn unversioned(name: &str) -> String {
+    let mut name = name.to_string();
+    if let Some(at) = name.find('@') {
+        let end = name[at..].find('#').map_or(name.len(), |i| at + i);
+        name.replace_range(at..end, "");
+    }
+    name
 }
 
 #[cfg(feature = "clap")]
@@ -780,8 +863,20 @@ pub fn push_ty_name(resolve: &Resolve, ty: &Type, src: &mut String) {
                     src.push_str("list_");
                     push_ty_name(resolve, ty, src);
                 }
-                TypeDefKind::Future(_) => todo!(),
-                TypeDefKind::Stream(_) => todo!(),
+                TypeDefKind::Future(t) => {
+                    src.push_str("future_");
+                    match t {
+                        Some(ty) => push_ty_name(resolve, ty, src),
+                        None => src.push_str("void"),
+                    }
+                }
+                TypeDefKind::Stream(t) => {
+                    src.push_str("stream_");
+                    match t {
+                        Some(ty) => push_ty_name(resolve, ty, src),
+                        None => src.push_str("void"),
+                    }
+                }
                 TypeDefKind::ErrorContext => todo!(),
                 TypeDefKind::Handle(Handle::Own(resource)) => {
                     src.push_str("own_");
@@ -960,7 +1055,11 @@ impl Return {
             TypeDefKind::Type(t) => return self.return_single(resolve, t, orig_ty, sig_flattening),
 
             // Flags are returned as their bare values, and enums and handles are scalars
-            TypeDefKind::Flags(_) | TypeDefKind::Enum(_) | TypeDefKind::Handle(_) => {
+            TypeDefKind::Flags(_)
+            | TypeDefKind::Enum(_)
+            | TypeDefKind::Handle(_)
+            | TypeDefKind::Future(_)
+            | TypeDefKind::Stream(_) => {
                 self.scalar = Some(Scalar::Type(*orig_ty));
                 return;
             }
@@ -997,8 +1096,6 @@ impl Return {
             | TypeDefKind::List(_)
             | TypeDefKind::Variant(_) => {}
 
-            TypeDefKind::Future(_) => todo!("return_single for future"),
-            TypeDefKind::Stream(_) => todo!("return_single for stream"),
             TypeDefKind::ErrorContext => todo!("return_single for error-context"),
             TypeDefKind::Resource => todo!("return_single for resource"),
             TypeDefKind::Unknown => unreachable!(),
@@ -1058,11 +1155,16 @@ extern void {ns}_{snake}_drop_own({own} handle);
             format!("[export]{module}")
         };
 
+        let (import_module, drop_name) = self
+            .gen
+            .opts
+            .core_names
+            .import(&import_module, &format!("[resource-drop]{name}"));
         let drop_fn = format!("__wasm_import_{ns}_{snake}_drop");
 
         self.src.c_helpers(&format!(
             r#"
-__attribute__((__import_module__("{import_module}"), __import_name__("[resource-drop]{name}")))
+__attribute__((__import_module__("{import_module}"), __import_name__("{drop_name}")))
 extern void {drop_fn}(int32_t handle);
 
 void {ns}_{snake}_drop_own({own} handle) {{
@@ -1153,12 +1255,19 @@ void {ns}_{snake}_destructor({ty_name} *rep);
                 "
             ));
 
+            let core_names = &self.gen.opts.core_names;
+            let export_module = format!("[export]{module}");
+            let (new_module, new_name) =
+                core_names.import(&export_module, &format!("[resource-new]{name}"));
+            let (rep_module, rep_name) =
+                core_names.import(&export_module, &format!("[resource-rep]{name}"));
+            let dtor_name = core_names.export(&format!("{module}#[dtor]{snake}"));
             self.src.c_helpers(&format!(
                 r#"
-__attribute__(( __import_module__("[export]{module}"), __import_name__("[resource-new]{name}")))
+__attribute__(( __import_module__("{new_module}"), __import_name__("{new_name}")))
 extern int32_t __wasm_import_{ns}_{snake}_new(int32_t);
 
-__attribute__((__import_module__("[export]{module}"), __import_name__("[resource-rep]{name}")))
+__attribute__((__import_module__("{rep_module}"), __import_name__("{rep_name}")))
 extern int32_t __wasm_import_{ns}_{snake}_rep(int32_t);
 
 {own} {ns}_{snake}_new({ty_name} *rep) {{
@@ -1169,7 +1278,7 @@ extern int32_t __wasm_import_{ns}_{snake}_rep(int32_t);
     return ({ns}_{snake}_t*) __wasm_import_{ns}_{snake}_rep(handle.__handle);
 }}
 
-__attribute__((__export_name__("{module}#[dtor]{snake}")))
+__attribute__((__export_name__("{dtor_name}")))
 void __wasm_export_{ns}_{snake}_dtor({ns}_{snake}_t* arg) {{
     {ns}_{snake}_destructor(arg);
 }}
@@ -1348,13 +1457,21 @@ void __wasm_export_{ns}_{snake}_dtor({ns}_{snake}_t* arg) {{
     }
 
     fn type_future(&mut self, id: TypeId, name: &str, ty: &Option<Type>, docs: &Docs) {
-        _ = (id, name, ty, docs);
-        todo!()
+        _ = (name, ty);
+        // Futures are passed around as the bare handle of one of their ends.
+        self.src.h_defs("\n");
+        self.docs(docs, SourceType::HDefs);
+        self.src.h_defs("typedef uint32_t ");
+        self.print_typedef_target(id);
     }
 
     fn type_stream(&mut self, id: TypeId, name: &str, ty: &Option<Type>, docs: &Docs) {
-        _ = (id, name, ty, docs);
-        todo!()
+        _ = (name, ty);
+        // Streams are passed around as the bare handle of one of their ends.
+        self.src.h_defs("\n");
+        self.docs(docs, SourceType::HDefs);
+        self.src.h_defs("typedef uint32_t ");
+        self.print_typedef_target(id);
     }
 
     fn type_error_context(&mut self, id: TypeId, name: &str, docs: &Docs) {
@@ -1446,12 +1563,14 @@ impl<'a> wit_bindgen_core::AnonymousTypeGenerator<'a> for InterfaceGenerator<'a>
         self.print_typedef_target(id);
     }
 
-    fn anonymous_type_future(&mut self, _id: TypeId, _ty: &Option<Type>, _docs: &Docs) {
-        todo!("print_anonymous_type for future");
+    fn anonymous_type_future(&mut self, id: TypeId, _ty: &Option<Type>, _docs: &Docs) {
+        self.src.h_defs("\ntypedef uint32_t ");
+        self.print_typedef_target(id);
     }
 
-    fn anonymous_type_stream(&mut self, _id: TypeId, _ty: &Option<Type>, _docs: &Docs) {
-        todo!("print_anonymous_type for stream");
+    fn anonymous_type_stream(&mut self, id: TypeId, _ty: &Option<Type>, _docs: &Docs) {
+        self.src.h_defs("\ntypedef uint32_t ");
+        self.print_typedef_target(id);
     }
 
     fn anonymous_type_error_context(&mut self) {
@@ -1630,8 +1749,7 @@ impl InterfaceGenerator<'_> {
                 }
                 self.src.c_helpers("}\n");
             }
-            TypeDefKind::Future(_) => todo!("print_dtor for future"),
-            TypeDefKind::Stream(_) => todo!("print_dtor for stream"),
+            TypeDefKind::Future(_) | TypeDefKind::Stream(_) => {}
             TypeDefKind::ErrorContext => todo!("print_dtor for error-context"),
             TypeDefKind::Resource => {}
             TypeDefKind::Handle(Handle::Borrow(id) | Handle::Own(id)) => {
@@ -1695,14 +1813,14 @@ impl InterfaceGenerator<'_> {
         // In the private C file, print a function declaration which is the
         // actual wasm import that we'll be calling, and this has the raw wasm
         // signature.
+        let module = match interface_name {
+            Some(name) => self.resolve.name_world_key(name),
+            None => "$root".to_string(),
+        };
+        let (module, core_name) = self.gen.opts.core_names.import(&module, &func.name);
         uwriteln!(
             self.src.c_fns,
-            "__attribute__((__import_module__(\"{}\"), __import_name__(\"{}\")))",
-            match interface_name {
-                Some(name) => self.resolve.name_world_key(name),
-                None => "$root".to_string(),
-            },
-            func.name
+            "__attribute__((__import_module__(\"{module}\"), __import_name__(\"{core_name}\")))"
         );
         let name = self.c_func_name(interface_name, func);
         let import_name = self.gen.names.tmp(&format!("__wasm_import_{name}",));
@@ -1808,6 +1926,7 @@ impl InterfaceGenerator<'_> {
 
         let core_module_name = interface_name.map(|s| self.resolve.name_world_key(s));
         let export_name = func.legacy_core_export_name(core_module_name.as_deref());
+        let export_name = self.gen.opts.core_names.export(&export_name);
 
         // Print the actual header for this function into the header file, and
         // it's what we'll be calling.
@@ -1823,6 +1942,17 @@ impl InterfaceGenerator<'_> {
         let import_name = self.gen.names.tmp(&format!("__wasm_export_{name}"));
 
         let mut f = FunctionBindgen::new(self, h_sig, &import_name);
+        let extern_return_area = f.gen.gen.opts.extern_post_return
+            && f.gen.gen.opts.extern_return_area
+            && sig.retptr
+            && abi::guest_export_needs_post_return(f.gen.resolve, func);
+        if extern_return_area {
+            uwriteln!(
+                f.gen.src.h_fns,
+                "void *{name}_return_area(size_t size, size_t align);"
+            );
+            f.return_area = Some(format!("{name}_return_area"));
+        }
         match sig.results.len() {
             0 => f.gen.src.c_adapters("void"),
             1 => f.gen.src.c_adapters(wasm_type(sig.results[0])),
@@ -1857,7 +1987,25 @@ impl InterfaceGenerator<'_> {
         self.src.c_adapters(&src);
         self.src.c_adapters("}\n");
 
-        if abi::guest_export_needs_post_return(self.resolve, func) {
+        if abi::guest_export_needs_post_return(self.resolve, func)
+            && self.gen.opts.extern_post_return
+        {
+            let params = sig
+                .results
+                .iter()
+                .enumerate()
+                .map(|(i, result)| format!("{} arg{i}", wasm_type(*result)))
+                .collect::<Vec<_>>()
+                .join(", ");
+            uwriteln!(self.src.h_fns, "void {name}_post_return(void);");
+            uwriteln!(
+                self.src.c_fns,
+                "__attribute__((__export_name__(\"cabi_post_{export_name}\")))
+                void {import_name}_post_return({params}) {{
+                    {name}_post_return();
+                }}"
+            );
+        } else if abi::guest_export_needs_post_return(self.resolve, func) {
             uwriteln!(
                 self.src.c_fns,
                 "__attribute__((__weak__, __export_name__(\"cabi_post_{export_name}\")))"
@@ -2145,6 +2293,10 @@ struct FunctionBindgen<'a, 'b> {
 
     /// Forward declarations for temporary storage of borrow copies.
     borrow_decls: wit_bindgen_core::Source,
+
+    /// The embedder's function allocating the return area of an export, used
+    /// instead of `RET_AREA` with `extern_return_area`.
+    return_area: Option<String>,
 }
 
 impl<'a, 'b> FunctionBindgen<'a, 'b> {
@@ -2169,6 +2321,7 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
             import_return_pointer_area_align: 0,
             borrow_decls: Default::default(),
             borrows: Vec::new(),
+            return_area: None,
         }
     }
 
@@ -2250,7 +2403,12 @@ impl Bindgen for FunctionBindgen<'_, '_> {
 
         // Use a stack-based return area for imports, because exports need
         // their return area to be live until the post-return call.
-        if self.gen.in_import {
+        if let Some(return_area) = &self.return_area {
+            uwriteln!(
+                self.src,
+                "uint8_t *{ptr} = (uint8_t *) {return_area}({size}, {align});"
+            );
+        } else if self.gen.in_import {
             self.import_return_pointer_area_size = self.import_return_pointer_area_size.max(size);
             self.import_return_pointer_area_align =
                 self.import_return_pointer_area_align.max(align);
@@ -2706,6 +2864,11 @@ impl Bindgen for FunctionBindgen<'_, '_> {
             Instruction::EnumLower { .. } => results.push(format!("(int32_t) {}", operands[0])),
             Instruction::EnumLift { .. } => results.push(operands.pop().unwrap()),
 
+            Instruction::FutureLower { .. } => results.push(format!("(int32_t) {}", operands[0])),
+            Instruction::FutureLift { .. } => results.push(format!("(uint32_t) {}", operands[0])),
+            Instruction::StreamLower { .. } => results.push(format!("(int32_t) {}", operands[0])),
+            Instruction::StreamLift { .. } => results.push(format!("(uint32_t) {}", operands[0])),
+
             Instruction::ListCanonLower { .. } | Instruction::StringLower { .. } => {
                 results.push(format!("(uint8_t *) ({}).ptr", operands[0]));
                 results.push(format!("({}).len", operands[0]));
@@ -3168,8 +3331,7 @@ pub fn is_arg_by_pointer(resolve: &Resolve, ty: &Type) -> bool {
             TypeDefKind::Flags(_) => false,
             TypeDefKind::Handle(_) => false,
             TypeDefKind::Tuple(_) | TypeDefKind::Record(_) | TypeDefKind::List(_) => true,
-            TypeDefKind::Future(_) => todo!("is_arg_by_pointer for future"),
-            TypeDefKind::Stream(_) => todo!("is_arg_by_pointer for stream"),
+            TypeDefKind::Future(_) | TypeDefKind::Stream(_) => false,
             TypeDefKind::ErrorContext => todo!("is_arg_by_pointer for error-context"),
             TypeDefKind::Resource => todo!("is_arg_by_pointer for resource"),
             TypeDefKind::Unknown => unreachable!(),
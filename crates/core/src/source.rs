@@ -1,11 +1,12 @@
 use std::collections::btree_map::Entry;
-use std::collections::BTreeMap;
+use std::collections::{BTreeMap, BTreeSet};
 use std::fmt::{self, Write};
 use std::ops::Deref;
 
 #[derive(Default)]
 pub struct Files {
     files: BTreeMap<String, Vec<u8>>,
+    skeletons: BTreeSet<String>,
 }
 
 impl Files {
@@ -20,6 +21,18 @@ impl Files {
         }
     }
 
+    /// Adds a file meant to be edited by hand, such as a skeleton
+    /// implementation, which isn't overwritten if it already exists.
+    pub fn push_skeleton(&mut self, name: &str, contents: &[u8]) {
+        self.push(name, contents);
+        self.skeletons.insert(name.to_owned());
+    }
+
+    /// Returns whether `name` was added with `push_skeleton`.
+    pub fn is_skeleton(&self, name: &str) -> bool {
+        self.skeletons.contains(name)
+    }
+
     pub fn get_size(&mut self, name: &str) -> Option<usize> {
         self.files.get(name).map(|data| data.len())
     }
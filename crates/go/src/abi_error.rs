@@ -0,0 +1,67 @@
+use wit_bindgen_core::uwriteln;
+
+use crate::bindgen::FunctionBindgen;
+
+/// The error reported for the malformed values lifted with `--abi-errors`.
+pub(crate) const ABI_ERROR: &str = r##"
+// `ABIError` describes a malformed value received across the component
+// boundary, such as a string of invalid UTF-8 or an out-of-range enum
+// discriminant.
+type ABIError struct {
+	// `Interface` and `Function` are the WIT names of the function whose
+	// arguments or results were malformed.
+	Interface, Function string
+	Reason              string
+}
+
+func (e *ABIError) Error() string {
+	return e.Interface + "#" + e.Function + ": " + e.Reason
+}
+
+var cabiABIErrorHandler func(err *ABIError)
+
+// `SetABIErrorHandler` sets the function called with each malformed value
+// lifted from the other side of the component boundary, which is then
+// replaced with the zero value of its type. Without a handler, the error is
+// raised as a panic. Passing `nil` removes it.
+func SetABIErrorHandler(handler func(err *ABIError)) {
+	cabiABIErrorHandler = handler
+}
+
+func cabiABIError(iface, fn, reason string) {
+	err := &ABIError{Interface: iface, Function: fn, Reason: reason}
+	if cabiABIErrorHandler == nil {
+		panic(err)
+	}
+	cabiABIErrorHandler(err)
+}
+"##;
+
+impl FunctionBindgen<'_, '_> {
+    /// Prints the check reporting the lifted value as malformed for `reason`
+    /// when `cond` holds, running `recover` to replace it.
+    pub(crate) fn check_lifted(&mut self, cond: &str, reason: &str, recover: &str) {
+        if !self.interface.gen.opts.abi_errors {
+            return;
+        }
+        let iface = self.interface.wit_name();
+        let func = self.func.map_or("", |func| func.name.as_str());
+        uwriteln!(
+            self.lift_src,
+            "if {cond} {{
+                cabiABIError(\"{iface}\", \"{func}\", \"{reason}\")
+                {recover}
+            }}"
+        );
+    }
+
+    /// Prints the check of the pointer of the lifted string or list `param`,
+    /// emptying it if it's null.
+    pub(crate) fn check_lifted_ptr(&mut self, param: &str) {
+        self.check_lifted(
+            &format!("{param}.len > 0 && {param}.ptr == nil"),
+            "null pointer",
+            &format!("{param}.len = 0"),
+        );
+    }
+}
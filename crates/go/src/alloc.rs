@@ -0,0 +1,168 @@
+/// The allocator hooks used for the memory handed across the component
+/// boundary, which default to the libc heap.
+///
+/// The weak `cabi_realloc` emitted by the C generator is overridden so that
+/// the allocations made by the host also go through the hooks.
+pub(crate) const ALLOCATOR: &str = r#"
+// Alloc allocates `size` bytes aligned to `align`.
+type Alloc func(size, align uintptr) unsafe.Pointer
+
+// Realloc resizes an allocation of `oldSize` bytes aligned to `align` to
+// `newSize` bytes.
+type Realloc func(ptr unsafe.Pointer, oldSize, align, newSize uintptr) unsafe.Pointer
+
+// Free releases an allocation made by an Alloc or a Realloc.
+type Free func(ptr unsafe.Pointer)
+
+var (
+	cabiAlloc Alloc = func(size, align uintptr) unsafe.Pointer {
+		return C.malloc(C.size_t(size))
+	}
+	cabiRealloc Realloc = func(ptr unsafe.Pointer, oldSize, align, newSize uintptr) unsafe.Pointer {
+		return C.realloc(ptr, C.size_t(newSize))
+	}
+	cabiFree Free = func(ptr unsafe.Pointer) {
+		C.free(ptr)
+	}
+)
+
+// SetAllocator routes the allocations of the values passed across the
+// component boundary through the given functions instead of the libc heap.
+// It must be called before any such value is allocated, typically from an
+// init() function.
+func SetAllocator(alloc Alloc, realloc Realloc, free Free) {
+	cabiAlloc = alloc
+	cabiRealloc = realloc
+	cabiFree = free
+}
+
+// cabiString copies `s` into memory allocated with `alloc`.
+func cabiString(alloc Alloc, s string) unsafe.Pointer {
+	if len(s) == 0 {
+		return nil
+	}
+	ptr := alloc(uintptr(len(s)), 1)
+	copy(unsafe.Slice((*byte)(ptr), len(s)), s)
+	return ptr
+}
+
+const (
+	cabiArenaChunkSize = 4096
+	// the first word of a chunk links it to the previous chunk of its arena
+	cabiChunkHeader = 8
+	// the number of released chunks kept for reuse, beyond which they're freed
+	cabiChunkPoolSize = 16
+)
+
+// cabiChunkPool holds the chunks released by arenas, handed out again to the
+// next arenas so that steady-state calls allocate nothing.
+var cabiChunkPool struct {
+	chunks [cabiChunkPoolSize]unsafe.Pointer
+	len    int
+}
+
+func cabiTakeChunk() unsafe.Pointer {
+	p := &cabiChunkPool
+	if p.len == 0 {
+		return cabiAlloc(cabiArenaChunkSize, 8)
+	}
+	p.len--
+	return p.chunks[p.len]
+}
+
+func cabiPutChunk(chunk unsafe.Pointer) {
+	p := &cabiChunkPool
+	if p.len == len(p.chunks) {
+		cabiFree(chunk)
+		return
+	}
+	p.chunks[p.len] = chunk
+	p.len++
+}
+
+// cabiArena hands out the memory of the values lowered for a single call
+// from a few large chunks, all of which are released together once the host
+// is done with them. The chunks are linked through their first word rather
+// than a slice, and recycled through cabiChunkPool, so that only the values
+// too large for a chunk are allocated on each call. The zero value is ready
+// to use.
+type cabiArena struct {
+	large []unsafe.Pointer
+	chunk unsafe.Pointer
+	used  uintptr
+}
+
+func (a *cabiArena) alloc(size, align uintptr) unsafe.Pointer {
+	if size > cabiArenaChunkSize/4 {
+		ptr := cabiAlloc(size, align)
+		a.large = append(a.large, ptr)
+		return ptr
+	}
+	offset := (a.used + align - 1) &^ (align - 1)
+	if a.chunk == nil || offset+size > cabiArenaChunkSize {
+		chunk := cabiTakeChunk()
+		*(*unsafe.Pointer)(chunk) = a.chunk
+		a.chunk = chunk
+		offset = (cabiChunkHeader + align - 1) &^ (align - 1)
+	}
+	a.used = offset + size
+	return unsafe.Add(a.chunk, offset)
+}
+
+func (a *cabiArena) release() {
+	for _, ptr := range a.large {
+		cabiFree(ptr)
+	}
+	for chunk := a.chunk; chunk != nil; {
+		prev := *(*unsafe.Pointer)(chunk)
+		cabiPutChunk(chunk)
+		chunk = prev
+	}
+	*a = cabiArena{}
+}
+
+//export cabi_realloc
+func cabi_realloc(ptr unsafe.Pointer, oldSize, align, newSize C.size_t) unsafe.Pointer {
+	if newSize == 0 {
+		return unsafe.Add(nil, align)
+	}
+	var ret unsafe.Pointer
+	if ptr == nil {
+		ret = cabiAlloc(uintptr(newSize), uintptr(align))
+	} else {
+		ret = cabiRealloc(ptr, uintptr(oldSize), uintptr(align), uintptr(newSize))
+	}
+	if ret == nil {
+		panic("cabi_realloc: out of memory")
+	}
+	return ret
+}
+"#;
+
+/// The release functions of the values lifted over linear memory with
+/// `--explicit-free`.
+pub(crate) const EXPLICIT_FREE: &str = r#"
+// FreeList releases a list of numbers returned by an import, which must not
+// be used afterwards.
+func FreeList[T any](l []T) {
+	if len(l) > 0 {
+		cabiFree(unsafe.Pointer(unsafe.SliceData(l)))
+	}
+}
+"#;
+
+pub(crate) const FREE_STRING: &str = r#"
+// FreeString releases a string returned by an import, which must not be used
+// afterwards.
+func FreeString(s string) {
+	if len(s) > 0 {
+		cabiFree(unsafe.Pointer(unsafe.StringData(s)))
+	}
+}
+"#;
+
+/// Transcoded strings live in the Go heap, so there is nothing to release.
+pub(crate) const FREE_TRANSCODED_STRING: &str = r#"
+// FreeString does nothing since strings are transcoded into the Go heap.
+func FreeString(s string) {}
+"#;
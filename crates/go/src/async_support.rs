@@ -0,0 +1,363 @@
+/// The Go side of the component model async intrinsics shared by futures
+/// and streams.
+///
+/// Reads and writes are lowered to the async intrinsics declared per function
+/// and per future or stream, blocking on `task.wait` until the other end made
+/// progress.
+pub(crate) const ASYNC_RUNTIME: &str = r#"
+const (
+	asyncBlocked  = 0xffff_ffff
+	asyncClosed   = 0x8000_0000
+	asyncCanceled = 0
+
+	eventStreamRead  = 5
+	eventStreamWrite = 6
+	eventFutureRead  = 7
+	eventFutureWrite = 8
+)
+
+// asyncResult returns the number of values transferred by the operation
+// which completed with `code`, along with io.EOF if the other end was closed,
+// possibly after some of the values were transferred.
+func asyncResult(code uint32) (int, error) {
+	if code&asyncClosed != 0 || code == asyncCanceled {
+		return int(code &^ asyncClosed), io.EOF
+	}
+	return int(code), nil
+}
+"#;
+
+/// Waits for the progress of the operations of a single goroutine at a time.
+pub(crate) const ASYNC_WAIT: &str = r#"
+// the progress reported by `task.wait` of the operations not waited for yet,
+// by handle and event
+var asyncEvents = map[[2]uint32]uint32{}
+
+// asyncWait blocks until the operation on `handle` which returned `code`
+// completes, returning the number of values transferred.
+func asyncWait(handle uint32, code uint32, event int32) (int, error) {
+	key := [2]uint32{handle, uint32(event)}
+	for code == asyncBlocked {
+		if c, ok := asyncEvents[key]; ok {
+			delete(asyncEvents, key)
+			code = c
+			break
+		}
+		var payload [2]int32
+		got := wasmTaskWait(unsafe.Pointer(&payload))
+		if got == event && uint32(payload[0]) == handle {
+			code = uint32(payload[1])
+		} else {
+			asyncEvents[[2]uint32{uint32(payload[0]), uint32(got)}] = uint32(payload[1])
+		}
+	}
+	return asyncResult(code)
+}
+"#;
+
+/// Waits for the progress of operations on behalf of several goroutines with
+/// `--goroutine-safe`, where the progress reported by `task.wait` may be for
+/// another goroutine's operation.
+pub(crate) const ASYNC_WAIT_GOROUTINE_SAFE: &str = r#"
+var (
+	asyncEventsMu sync.Mutex
+	// the progress reported of the operations waited for by other goroutines,
+	// by handle and event
+	asyncEvents = map[[2]uint32]uint32{}
+)
+
+// asyncWait blocks until the operation on `handle` which returned `code`
+// completes, returning the number of values transferred.
+//
+// Other goroutines get to run before the whole instance blocks on
+// `task.wait`, such as the one on the other end of the operation.
+func asyncWait(handle uint32, code uint32, event int32) (int, error) {
+	key := [2]uint32{handle, uint32(event)}
+	for code == asyncBlocked {
+		runtime.Gosched()
+		asyncEventsMu.Lock()
+		if c, ok := asyncEvents[key]; ok {
+			delete(asyncEvents, key)
+			code = c
+		}
+		asyncEventsMu.Unlock()
+		if code != asyncBlocked {
+			break
+		}
+		var payload [2]int32
+		got := wasmTaskWait(unsafe.Pointer(&payload))
+		if got == event && uint32(payload[0]) == handle {
+			code = uint32(payload[1])
+		} else {
+			asyncEventsMu.Lock()
+			asyncEvents[[2]uint32{uint32(payload[0]), uint32(got)}] = uint32(payload[1])
+			asyncEventsMu.Unlock()
+		}
+	}
+	return asyncResult(code)
+}
+"#;
+
+/// Streams of values, transferred in chunks.
+pub(crate) const STREAM_RUNTIME: &str = r#"
+// streamChunkLen bounds the number of values transferred by a single
+// canonical ABI read or write.
+const streamChunkLen = 64 * 1024
+
+type streamVtable struct {
+	read          func(handle uint32, ptr unsafe.Pointer, n uint32) uint32
+	write         func(handle uint32, ptr unsafe.Pointer, n uint32) uint32
+	closeReadable func(handle uint32)
+	closeWritable func(handle uint32, err uint32)
+}
+
+// StreamReader is the readable end of a `stream<T>`.
+//
+// A *StreamReader[uint8] implements io.ReadCloser.
+type StreamReader[T any] struct {
+	handle uint32
+	vtable *streamVtable
+}
+
+// Read reads up to len(p) values, blocking until at least one is available.
+// It returns io.EOF once the writer closed the stream, along with the last
+// values read if the stream was closed after they were written.
+func (r *StreamReader[T]) Read(p []T) (int, error) {
+	if r.handle == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(p) > streamChunkLen {
+		p = p[:streamChunkLen]
+	}
+	code := r.vtable.read(r.handle, unsafe.Pointer(&p[0]), uint32(len(p)))
+	return asyncWait(r.handle, code, eventStreamRead)
+}
+
+// Close closes the readable end of the stream.
+func (r *StreamReader[T]) Close() error {
+	if r.handle != 0 {
+		r.vtable.closeReadable(r.handle)
+		r.handle = 0
+	}
+	return nil
+}
+
+// takeHandle transfers the ownership of the stream to the callee.
+func (r *StreamReader[T]) takeHandle() uint32 {
+	handle := r.handle
+	if handle == 0 {
+		panic("stream has already been closed or transferred")
+	}
+	r.handle = 0
+	return handle
+}
+
+// StreamWriter is the writable end of a `stream<T>`.
+//
+// A *StreamWriter[uint8] implements io.WriteCloser.
+type StreamWriter[T any] struct {
+	handle uint32
+	vtable *streamVtable
+	// the values written but not flushed yet with SetBuffer, which never
+	// grow beyond its limit
+	buf   []T
+	limit int
+	// the callback notified once the full buffer was flushed
+	onWritable func()
+}
+
+// Write writes all of p, blocking until the reader consumed them unless they
+// fit in the buffer set with SetBuffer. It returns io.ErrClosedPipe if the
+// reader closed the stream.
+func (w *StreamWriter[T]) Write(p []T) (int, error) {
+	if w.handle == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	if w.limit == 0 {
+		return w.write(p)
+	}
+	total := 0
+	for total < len(p) {
+		// a producer faster than the reader blocks here rather than buffering
+		// more values
+		if len(w.buf) == w.limit {
+			if err := w.Flush(); err != nil {
+				return total, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):w.limit], p[total:])
+		w.buf = w.buf[:len(w.buf)+n]
+		total += n
+	}
+	return total, nil
+}
+
+// write writes all of p in chunks, blocking until the reader consumed them.
+func (w *StreamWriter[T]) write(p []T) (int, error) {
+	total := 0
+	for total < len(p) {
+		chunk := p[total:]
+		if len(chunk) > streamChunkLen {
+			chunk = chunk[:streamChunkLen]
+		}
+		code := w.vtable.write(w.handle, unsafe.Pointer(&chunk[0]), uint32(len(chunk)))
+		n, err := asyncWait(w.handle, code, eventStreamWrite)
+		total += n
+		if err == io.EOF {
+			return total, io.ErrClosedPipe
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// SetBuffer makes Write buffer up to n values, which are written once the
+// buffer is full or by Flush and Close, rather than blocking on every call
+// until the reader consumed them. The values already buffered are flushed
+// first. A buffer of 0 values, the default, disables buffering.
+func (w *StreamWriter[T]) SetBuffer(n int) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.limit = n
+	w.buf = make([]T, 0, n)
+	return nil
+}
+
+// Buffered returns the number of values written but not flushed yet.
+func (w *StreamWriter[T]) Buffered() int {
+	return len(w.buf)
+}
+
+// Writable reports whether Write accepts a value without blocking until the
+// reader consumed the buffered ones.
+func (w *StreamWriter[T]) Writable() bool {
+	return w.handle != 0 && len(w.buf) < w.limit
+}
+
+// OnWritable sets the function called each time the buffer, once full, was
+// flushed and accepts values again, such as to resume the goroutines
+// producing the values with `--goroutine-safe`.
+func (w *StreamWriter[T]) OnWritable(f func()) {
+	w.onWritable = f
+}
+
+// Flush writes the buffered values, blocking until the reader consumed them.
+// The values are dropped if the reader closed the stream, and it returns
+// io.ErrClosedPipe.
+func (w *StreamWriter[T]) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if w.handle == 0 {
+		return io.ErrClosedPipe
+	}
+	full := len(w.buf) == w.limit
+	_, err := w.write(w.buf)
+	w.buf = w.buf[:0]
+	if full && err == nil && w.onWritable != nil {
+		w.onWritable()
+	}
+	return err
+}
+
+// Close flushes the buffered values and closes the writable end of the
+// stream, signaling the end of the values to the reader.
+func (w *StreamWriter[T]) Close() error {
+	if w.handle == 0 {
+		return nil
+	}
+	err := w.Flush()
+	w.vtable.closeWritable(w.handle, 0)
+	w.handle = 0
+	return err
+}
+"#;
+
+/// Futures resolving to a single value.
+pub(crate) const FUTURE_RUNTIME: &str = r#"
+type futureVtable struct {
+	read          func(handle uint32, ptr unsafe.Pointer) uint32
+	write         func(handle uint32, ptr unsafe.Pointer) uint32
+	closeReadable func(handle uint32)
+	closeWritable func(handle uint32, err uint32)
+}
+
+// FutureReader is the readable end of a `future<T>`.
+type FutureReader[T any] struct {
+	handle uint32
+	vtable *futureVtable
+}
+
+// Read blocks until the value of the future is available and returns it.
+// The future is closed afterwards. It returns io.ErrUnexpectedEOF if the
+// writer closed the future without writing a value.
+func (r *FutureReader[T]) Read() (T, error) {
+	var value T
+	if r.handle == 0 {
+		return value, io.ErrClosedPipe
+	}
+	defer r.Close()
+	code := r.vtable.read(r.handle, unsafe.Pointer(&value))
+	// the writer may have closed the future right after writing the value
+	if n, _ := asyncWait(r.handle, code, eventFutureRead); n == 0 {
+		return value, io.ErrUnexpectedEOF
+	}
+	return value, nil
+}
+
+// Close closes the readable end of the future.
+func (r *FutureReader[T]) Close() error {
+	if r.handle != 0 {
+		r.vtable.closeReadable(r.handle)
+		r.handle = 0
+	}
+	return nil
+}
+
+// takeHandle transfers the ownership of the future to the callee.
+func (r *FutureReader[T]) takeHandle() uint32 {
+	handle := r.handle
+	if handle == 0 {
+		panic("future has already been closed or transferred")
+	}
+	r.handle = 0
+	return handle
+}
+
+// FutureWriter is the writable end of a `future<T>`.
+type FutureWriter[T any] struct {
+	handle uint32
+	vtable *futureVtable
+}
+
+// Write resolves the future to `value`, blocking until the reader received
+// it. The future is closed afterwards. It returns io.ErrClosedPipe if the
+// reader closed the future.
+func (w *FutureWriter[T]) Write(value T) error {
+	if w.handle == 0 {
+		return io.ErrClosedPipe
+	}
+	defer w.Close()
+	code := w.vtable.write(w.handle, unsafe.Pointer(&value))
+	// the reader may have closed the future right after reading the value
+	if n, _ := asyncWait(w.handle, code, eventFutureWrite); n == 0 {
+		return io.ErrClosedPipe
+	}
+	return nil
+}
+
+// Close closes the writable end of the future.
+func (w *FutureWriter[T]) Close() error {
+	if w.handle != 0 {
+		w.vtable.closeWritable(w.handle, 0)
+		w.handle = 0
+	}
+	return nil
+}
+"#;
@@ -0,0 +1,156 @@
+use std::fmt::Write as _;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Function, FunctionKind, Type, TypeDefKind};
+
+use super::local_name;
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Prints `<Function>Batcher` with `--call-batching` for each of the
+    /// imported `funcs` that has a batched variant among them, queuing the
+    /// calls of the function to make them with a single call of the variant.
+    pub(crate) fn print_batchers(&mut self, funcs: &[&Function]) {
+        if !self.gen.opts.call_batching {
+            return;
+        }
+        for func in funcs {
+            let batched = format!("{}-batch", func.name);
+            let Some(batch) = funcs.iter().find(|func| func.name == batched) else {
+                continue;
+            };
+            if let Some(elem) = self.batch_elem(func, batch) {
+                self.print_batcher(func, batch, &elem);
+            }
+        }
+    }
+
+    /// Returns the type of the elements of the list taken by `batch` if it's
+    /// a batched variant of `func`: both are freestanding functions without
+    /// results, and `batch` takes a list of the arguments of `func`, either
+    /// as is for a single parameter or as tuples for several. Only plain
+    /// data is supported, since the calls are delayed until the batcher is
+    /// flushed, by which time a borrowed handle could have been dropped.
+    fn batch_elem(&self, func: &Function, batch: &Function) -> Option<Type> {
+        let freestanding = |func: &Function| {
+            matches!(func.kind, FunctionKind::Freestanding)
+                && func.results.len() == 0
+                && !self.skips(func)
+        };
+        if !freestanding(func) || !freestanding(batch) || batch.params.len() != 1 {
+            return None;
+        }
+        let Type::Id(list) = batch.params[0].1 else {
+            return None;
+        };
+        let TypeDefKind::List(elem) = self.resolve.types[list].kind else {
+            return None;
+        };
+        let params = func.params.iter().map(|(_, ty)| *ty).collect::<Vec<_>>();
+        let matches = match params.as_slice() {
+            [] => false,
+            [param] => elem == *param,
+            _ => match elem {
+                Type::Id(id) => matches!(
+                    &self.resolve.types[id].kind,
+                    TypeDefKind::Tuple(t) if t.types == params
+                ),
+                _ => false,
+            },
+        };
+        (matches && self.is_plain_data(&elem)).then_some(elem)
+    }
+
+    fn print_batcher(&mut self, func: &Function, batch: &Function, elem: &Type) {
+        let ns = self.namespace();
+        let name = format!("{ns}{}Batcher", self.func_name(func));
+        let call = format!("{ns}{}", self.func_name(batch));
+        let elem_ty = self.get_ty(elem);
+        let (ctx_param, ctx) = if self.gen.opts.context && !self.gen.opts.host {
+            ("ctx context.Context", "ctx")
+        } else {
+            ("", "")
+        };
+
+        let mut params = Vec::new();
+        let mut values = Vec::new();
+        for (param, ty) in func.params.iter() {
+            let param = local_name(&param.to_snake_case());
+            params.push(format!("{param} {}", self.param_ty(ty)));
+            if self.param_by_pointer(ty) {
+                values.push(format!("*{param}"));
+            } else {
+                values.push(param);
+            }
+        }
+        let value = match (elem, values.as_slice()) {
+            (_, [value]) => value.clone(),
+            (Type::Id(id), _) => {
+                let TypeDefKind::Tuple(tuple) = &self.resolve.types[*id].kind else {
+                    unreachable!()
+                };
+                let fields = values
+                    .iter()
+                    .enumerate()
+                    .map(|(i, value)| format!("{}: {value}", self.tuple_key(tuple, i)))
+                    .collect::<Vec<_>>()
+                    .join(", ");
+                format!("{elem_ty}{{{fields}}}")
+            }
+            _ => unreachable!(),
+        };
+        let add_params = if ctx.is_empty() {
+            params.join(", ")
+        } else {
+            format!("{ctx_param}, {}", params.join(", "))
+        };
+        let call_args = if ctx.is_empty() {
+            "self.calls".to_string()
+        } else {
+            format!("{ctx}, self.calls")
+        };
+
+        uwriteln!(
+            self.src,
+            "// `{name}` queues calls of `{func_name}` to make them with a single call
+            // of `{batch_name}`, saving the crossings of the component boundary of the
+            // calls made in tight loops. The calls are made once `size` of them are
+            // queued, or when the batcher is flushed, which the caller should do once
+            // done. It isn't safe for concurrent use.
+            type {name} struct {{
+                size  int
+                calls []{elem_ty}
+            }}
+
+            // `New{name}` returns a batcher making the calls `size` at a time.
+            func New{name}(size int) *{name} {{
+                if size < 1 {{
+                    size = 1
+                }}
+                return &{name}{{size: size, calls: make([]{elem_ty}, 0, size)}}
+            }}
+
+            // `Add` queues a call of `{func_name}`, flushing the batcher if it's full.
+            func (self *{name}) Add({add_params}) {{
+                self.calls = append(self.calls, {value})
+                if len(self.calls) >= self.size {{
+                    self.Flush({ctx})
+                }}
+            }}
+
+            // `Flush` makes the queued calls, if any.
+            func (self *{name}) Flush({ctx_param}) {{
+                if len(self.calls) == 0 {{
+                    return
+                }}
+                {call}({call_args})
+                // the import is done with the calls once it returns
+                self.calls = self.calls[:0]
+            }}
+            ",
+            func_name = func.name,
+            batch_name = batch.name,
+        );
+    }
+}
@@ -0,0 +1,285 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::{ToLowerCamelCase, ToSnakeCase, ToUpperCamelCase};
+use wit_bindgen_c::is_arg_by_pointer;
+use wit_bindgen_core::wit_parser::{Function, FunctionKind, Resolve, Type, TypeDefKind};
+use wit_bindgen_core::{abi, uwriteln, Direction, Files, Source};
+
+use super::{bindgen, local_name, TinyGo};
+use crate::interface::{variant_case_value, InterfaceGenerator};
+
+/// An exported function benchmarked by `<world>_bench_test.go`.
+pub(crate) struct Benchmark {
+    // the Go interface the function belongs to
+    interface: String,
+    // the Go method implementing the function
+    method: String,
+    // the harness lowering the arguments before calling the export
+    harness: String,
+    // the type and sample value of each argument, and whether it's passed by
+    // pointer
+    args: Vec<(String, String, bool)>,
+    // the sample values returned by the stubbed implementation
+    results: Vec<String>,
+}
+
+impl TinyGo {
+    /// Writes `<world>_bench_test.go`, benchmarking the lifting and lowering
+    /// of each benchmarked export against a stubbed implementation returning
+    /// sample values.
+    pub(crate) fn finish_benchmarks(&mut self, files: &mut Files) {
+        if self.benchmarks.is_empty() {
+            return;
+        }
+        let benchmarks = mem::take(&mut self.benchmarks);
+
+        let mut body = Source::default();
+        for (name, decls) in &self.export_interfaces {
+            let stub = format!("cabiBenchStub{name}");
+            uwriteln!(
+                body,
+                "// `{stub}` implements `{name}` by returning sample values
+                // without doing any work of its own.
+                type {stub} struct{{}}
+                "
+            );
+            for decl in decls {
+                let method = decl.split('(').next().unwrap();
+                let bench = benchmarks
+                    .iter()
+                    .find(|b| &b.interface == name && b.method == method);
+                let stmt = match bench {
+                    Some(b) if b.results.is_empty() => String::new(),
+                    Some(b) => format!("return {}", b.results.join(", ")),
+                    None => format!("panic(\"{name}.{method} isn't benchmarked\")"),
+                };
+                uwriteln!(body, "func ({stub}) {decl} {{\n{stmt}\n}}\n");
+            }
+        }
+
+        for b in &benchmarks {
+            let mut vars = String::new();
+            let mut args = Vec::new();
+            for (i, (ty, value, by_pointer)) in b.args.iter().enumerate() {
+                uwriteln!(vars, "var arg{i} {ty} = {value}");
+                args.push(format!("{}arg{i}", if *by_pointer { "&" } else { "" }));
+            }
+            uwriteln!(
+                body,
+                "func Benchmark{iface}{method}(b *testing.B) {{
+                    Set{iface}(cabiBenchStub{iface}{{}})
+                    {vars}
+                    b.ReportAllocs()
+                    b.ResetTimer()
+                    for i := 0; i < b.N; i++ {{
+                        {harness}({args})
+                    }}
+                }}
+                ",
+                iface = b.interface,
+                method = b.method,
+                harness = b.harness,
+                args = args.join(", "),
+            );
+        }
+
+        let mut src = Source::default();
+        wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+        src.push_str("//go:build witbench\n\n");
+        uwriteln!(src, "package {}\n", self.package_name());
+        src.push_str("import (\n");
+        if body.contains("context.Context") {
+            src.push_str("\"context\"\n");
+        }
+        src.push_str("\"testing\"\n");
+        let uses_types = ["Option[", "Result[", "Some[", "Ok["]
+            .iter()
+            .any(|t| body.contains(t));
+        if let (Some(path), true) = (&self.opts.runtime_package, uses_types) {
+            uwriteln!(src, ". \"{path}\"");
+        }
+        src.push_str(")\n\n");
+        src.push_str(&body);
+
+        let bindings = mem::replace(&mut self.src, src);
+        if self.opts.gofmt {
+            self.gofmt();
+        }
+        let src = mem::replace(&mut self.src, bindings);
+        let name = format!("{}_bench_test.go", self.world.to_snake_case());
+        files.push(&name, src.as_bytes());
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns the harness benchmarking the exported `func`, which lowers its
+    /// arguments the way the host would before calling the export, or an
+    /// empty string if `func` isn't benchmarked.
+    ///
+    /// Functions of resources and functions taking or returning handles,
+    /// futures or streams aren't benchmarked, since the sample values would
+    /// need a live resource or a host on the other end.
+    pub(crate) fn bench_harness(&mut self, resolve: &Resolve, func: &Function) -> String {
+        if !self.gen.opts.benchmarks
+            || !matches!(func.kind, FunctionKind::Freestanding)
+            || !func
+                .params
+                .iter()
+                .map(|(_, ty)| ty)
+                .chain(func.results.iter_types())
+                .all(|ty| self.is_plain_data(ty))
+        {
+            return String::new();
+        }
+
+        // the arguments are lowered as by an import, from a per-call arena
+        let mut bindgen = bindgen::FunctionBindgen::new(self, func).with_arena("cabi_arena");
+        for (name, ty) in func.params.iter() {
+            bindgen.lower(&local_name(&name.to_snake_case()), ty);
+        }
+        let uses_arena = bindgen.uses_arena;
+        let lower_src = bindgen.lower_src;
+
+        let interface = self.namespace();
+        let method = self.func_name(func);
+        let harness = format!("cabiBench{interface}{method}");
+        let mut sig = String::new();
+        let mut args = Vec::new();
+        for (i, (name, ty)) in func.params.iter().enumerate() {
+            self.get_func_params_common(i, &mut sig, name, ty);
+            let ty_name = self.get_ty(ty);
+            let value = self.bench_value(ty);
+            args.push((ty_name, value, self.param_by_pointer(ty)));
+        }
+
+        let mut src = Source::default();
+        uwriteln!(
+            src,
+            "
+            // `{harness}` lowers its arguments like the host would before calling
+            // the export of `{wit}`, for `Benchmark{interface}{method}`.
+            func {harness}({sig}) {{",
+            wit = self.wit_name(),
+        );
+        if uses_arena {
+            src.push_str("var cabi_arena cabiArena\ndefer cabi_arena.release()\n");
+        }
+        src.push_str(&lower_src);
+
+        let mut call = Source::default();
+        call.push_str(&format!("{interface}{method}").to_lower_camel_case());
+        call.push_str("(");
+        self.c_func_params(&mut call, func, Direction::Import);
+        self.c_func_returns(&mut call, resolve, func, Direction::Import);
+        match func.results.len() {
+            0 => uwriteln!(src, "{}", &*call),
+            1 => {
+                let ty = func.results.iter_types().next().unwrap();
+                if is_arg_by_pointer(self.resolve, ty) {
+                    let c_ty = self.gen.get_c_ty(ty);
+                    uwriteln!(src, "var ret {c_ty}\n{}", &*call);
+                } else {
+                    uwriteln!(src, "_ = {}", &*call);
+                }
+            }
+            _ => {
+                for (i, ty) in func.results.iter_types().enumerate() {
+                    let c_ty = self.gen.get_c_ty(ty);
+                    uwriteln!(src, "var ret{i} {c_ty}");
+                }
+                uwriteln!(src, "{}", &*call);
+            }
+        }
+        if abi::guest_export_needs_post_return(resolve, func) {
+            uwriteln!(src, "{}_post_return()", self.export_c_func_name(func));
+        }
+        src.push_str("}\n");
+
+        let results = match self.error_result(func) {
+            Some((Some(ok), _)) => vec![self.bench_value(&ok), "nil".to_string()],
+            Some((None, _)) => vec!["nil".to_string()],
+            None => func
+                .results
+                .iter_types()
+                .map(|ty| self.bench_value(ty))
+                .collect(),
+        };
+        self.gen.benchmarks.push(Benchmark {
+            interface,
+            method,
+            harness,
+            args,
+            results,
+        });
+        src.to_string()
+    }
+
+    /// Returns a sample value of `ty`, non-zero so that numbers, strings and
+    /// lists all take their full lowering path.
+    fn bench_value(&mut self, ty: &Type) -> String {
+        let id = match ty {
+            Type::Bool => return "true".to_string(),
+            Type::Char => return "'x'".to_string(),
+            Type::F32 | Type::F64 => return "1.5".to_string(),
+            Type::String => return "\"wit-bindgen\"".to_string(),
+            Type::Id(id) => *id,
+            _ => return "42".to_string(),
+        };
+        let name = self.get_ty(ty);
+        let resolve = self.resolve;
+        match &resolve.types[id].kind {
+            TypeDefKind::Type(t) => self.bench_value(t),
+            TypeDefKind::Record(r) => {
+                let fields = r
+                    .fields
+                    .iter()
+                    .map(|f| format!("{}: {}", self.field_name(f), self.bench_value(&f.ty)))
+                    .collect::<Vec<_>>();
+                format!("{name}{{{}}}", fields.join(", "))
+            }
+            TypeDefKind::Tuple(t) => {
+                let fields = t
+                    .types
+                    .iter()
+                    .enumerate()
+                    .map(|(i, ty)| format!("{}: {}", self.tuple_key(t, i), self.bench_value(ty)))
+                    .collect::<Vec<_>>();
+                format!("{name}{{{}}}", fields.join(", "))
+            }
+            TypeDefKind::List(t) => {
+                let elem = self.bench_value(t);
+                format!("{name}{{{elem}, {elem}, {elem}}}")
+            }
+            TypeDefKind::Option(t) => {
+                let value = self.bench_value(t);
+                self.option_value(t, Some(value.as_str()))
+            }
+            TypeDefKind::Result(r) => {
+                let ok = self.optional_ty(r.ok.as_ref());
+                let err = self.optional_ty(r.err.as_ref());
+                let value = match &r.ok {
+                    Some(t) => self.bench_value(t),
+                    None => "struct{}{}".to_string(),
+                };
+                format!("Ok[{ok}, {err}]({value})")
+            }
+            TypeDefKind::Variant(v) => {
+                let case = &v.cases[0];
+                let payload = case.ty.as_ref().map(|t| self.bench_value(t));
+                variant_case_value(
+                    self.variant_sealed(v),
+                    &name,
+                    &self.case_name(&case.name),
+                    payload.as_deref(),
+                )
+            }
+            TypeDefKind::Enum(e) => format!("{name}{}()", self.case_name(&e.cases[0].name)),
+            TypeDefKind::Flags(f) => match f.flags.first() {
+                Some(flag) => format!("{name}_{}", flag.name.to_upper_camel_case()),
+                None => format!("{name}(0)"),
+            },
+            _ => unreachable!(),
+        }
+    }
+}
@@ -0,0 +1,486 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Int, Type, TypeDefKind, TypeId};
+
+use crate::interface::{variant_case_value, InterfaceGenerator};
+
+/// `encoding.BinaryMarshaler` support with `--binary-marshaler`, encoding
+/// values with their canonical ABI layout in linear memory.
+///
+/// Only types whose layout is self-contained are supported, which excludes
+/// types holding strings, lists or handles, since those point elsewhere into
+/// linear memory.
+impl InterfaceGenerator<'_> {
+    /// Prints `MarshalBinary` and `UnmarshalBinary` for the type `id` named
+    /// `name`, if the binary encoding is enabled and supported by the type.
+    pub(crate) fn print_binary_marshaler(&mut self, id: TypeId, name: &str) {
+        let ty = Type::Id(id);
+        if !self.gen.opts.binary_marshaler || !self.has_canonical_layout(&ty) {
+            return;
+        }
+        self.gen.with_fmt_import(true);
+        let size = self.gen.sizes.size(&ty).size_wasm32();
+        let interface = matches!(
+            self.resolve.types[id].kind,
+            TypeDefKind::Variant(v) if self.variant_sealed(v)
+        );
+        let store = self.store_canonical("v", &ty, 0, true);
+        // the fields of records are assigned through the pointer
+        let target = match self.resolve.types[id].kind {
+            TypeDefKind::Record(_) => "v",
+            _ => "*v",
+        };
+        let load = self.load_canonical(target, &ty, 0, 0, true);
+
+        if interface {
+            // sealed variants are interfaces, which can't have methods
+            uwriteln!(
+                self.src,
+                "// Marshal{name}Binary encodes `v` with its canonical ABI layout.
+                func Marshal{name}Binary(v {name}) ([]byte, error) {{
+                    buf := make([]byte, {size})
+                    storeCanonical{name}(buf, v)
+                    return buf, nil
+                }}
+
+                // Unmarshal{name}Binary decodes a {name} encoded with its canonical ABI
+                // layout.
+                func Unmarshal{name}Binary(data []byte) ({name}, error) {{
+                    if len(data) != {size} {{
+                        return nil, fmt.Errorf(\"{name}: invalid size %d, want {size}\", len(data))
+                    }}
+                    var v {name}
+                    if err := loadCanonical{name}(data, &v); err != nil {{
+                        return nil, err
+                    }}
+                    return v, nil
+                }}
+                "
+            );
+        } else {
+            uwriteln!(
+                self.src,
+                "// MarshalBinary encodes the value with its canonical ABI layout.
+                func (v {name}) MarshalBinary() ([]byte, error) {{
+                    buf := make([]byte, {size})
+                    storeCanonical{name}(buf, v)
+                    return buf, nil
+                }}
+
+                // UnmarshalBinary decodes a value encoded with its canonical ABI layout.
+                func (v *{name}) UnmarshalBinary(data []byte) error {{
+                    if len(data) != {size} {{
+                        return fmt.Errorf(\"{name}: invalid size %d, want {size}\", len(data))
+                    }}
+                    return loadCanonical{name}(data, v)
+                }}
+                "
+            );
+        }
+        uwriteln!(
+            self.src,
+            "func storeCanonical{name}(buf []byte, v {name}) {{
+                {store}
+            }}
+
+            func loadCanonical{name}(buf []byte, v *{name}) error {{
+                {load}
+                return nil
+            }}
+            "
+        );
+    }
+
+    /// Returns whether the values of `ty` are fully contained in their
+    /// canonical ABI layout.
+    fn has_canonical_layout(&self, ty: &Type) -> bool {
+        let id = match ty {
+            Type::String => return false,
+            Type::Id(id) => *id,
+            _ => return true,
+        };
+        match &self.resolve.types[id].kind {
+            TypeDefKind::Record(r) => r.fields.iter().all(|f| self.has_canonical_layout(&f.ty)),
+            TypeDefKind::Tuple(t) => t.types.iter().all(|ty| self.has_canonical_layout(ty)),
+            TypeDefKind::Variant(v) => v
+                .cases
+                .iter()
+                .filter_map(|c| c.ty.as_ref())
+                .all(|ty| self.has_canonical_layout(ty)),
+            TypeDefKind::Option(ty) => self.has_canonical_layout(ty),
+            TypeDefKind::Result(r) => {
+                r.ok.iter()
+                    .chain(&r.err)
+                    .all(|ty| self.has_canonical_layout(ty))
+            }
+            TypeDefKind::Type(ty) => self.has_canonical_layout(ty),
+            TypeDefKind::Enum(_) | TypeDefKind::Flags(_) => true,
+            _ => false,
+        }
+    }
+
+    /// Returns the statements storing `value` of type `ty` at `offset` of
+    /// `buf`. Named types are stored by their own function, except for the
+    /// type being defined (`root`).
+    fn store_canonical(&mut self, value: &str, ty: &Type, offset: usize, root: bool) -> String {
+        let id = match ty {
+            Type::Id(id) => *id,
+            Type::Bool => return format!("if {value} {{\nbuf[{offset}] = 1\n}}\n"),
+            Type::U8 | Type::S8 => return format!("buf[{offset}] = byte({value})\n"),
+            Type::U16 | Type::S16 => return self.put_uint(value, 16, offset),
+            Type::U32 | Type::S32 | Type::Char => return self.put_uint(value, 32, offset),
+            Type::U64 | Type::S64 => return self.put_uint(value, 64, offset),
+            Type::F32 => {
+                self.gen.with_math_import(true);
+                return self.put_uint(&format!("math.Float32bits({value})"), 32, offset);
+            }
+            Type::F64 => {
+                self.gen.with_math_import(true);
+                return self.put_uint(&format!("math.Float64bits({value})"), 64, offset);
+            }
+            Type::String => unreachable!(),
+        };
+        let resolve = self.resolve;
+        let ty_def = &resolve.types[id];
+        let named = matches!(
+            ty_def.kind,
+            TypeDefKind::Record(_)
+                | TypeDefKind::Variant(_)
+                | TypeDefKind::Enum(_)
+                | TypeDefKind::Flags(_)
+        );
+        if named && !root {
+            let name = self.gen.type_names[&id].clone();
+            return format!("storeCanonical{name}(buf[{offset}:], {value})\n");
+        }
+
+        let mut src = String::new();
+        match &ty_def.kind {
+            TypeDefKind::Record(r) => {
+                let offsets = self.gen.sizes.field_offsets(r.fields.iter().map(|f| &f.ty));
+                for ((field_offset, ty), field) in offsets.into_iter().zip(&r.fields) {
+                    let value = format!("{value}.{}", self.gen.go_ident(&field.name));
+                    let offset = offset + field_offset.size_wasm32();
+                    src.push_str(&self.store_canonical(&value, ty, offset, false));
+                }
+            }
+            TypeDefKind::Tuple(t) => {
+                let offsets = self.gen.sizes.field_offsets(t.types.iter());
+                for (i, (field_offset, ty)) in offsets.into_iter().enumerate() {
+                    let offset = offset + field_offset.size_wasm32();
+                    src.push_str(&self.store_canonical(
+                        &self.tuple_field(t, value, i),
+                        ty,
+                        offset,
+                        false,
+                    ));
+                }
+            }
+            TypeDefKind::Flags(_) => {
+                let bits = self.gen.sizes.size(ty).size_wasm32() * 8;
+                src.push_str(&self.put_uint(value, bits, offset));
+            }
+            TypeDefKind::Enum(e) => {
+                src.push_str(&self.put_int(&format!("{value}.kind"), e.tag(), offset));
+            }
+            TypeDefKind::Variant(v) => {
+                let name = self.gen.type_names[&id].clone();
+                let payload_offset = offset
+                    + self
+                        .gen
+                        .sizes
+                        .payload_offset(v.tag(), v.cases.iter().map(|c| c.ty.as_ref()))
+                        .size_wasm32();
+                uwriteln!(src, "switch {value}.Kind() {{");
+                for (i, case) in v.cases.iter().enumerate() {
+                    let case_name = self.case_name(&case.name);
+                    uwriteln!(src, "case {name}Kind{case_name}:");
+                    src.push_str(&self.put_int(&i.to_string(), v.tag(), offset));
+                    if let Some(ty) = &case.ty {
+                        let payload = self.variant_case_payload(value, &name, &case_name);
+                        src.push_str(&self.store_canonical(&payload, ty, payload_offset, false));
+                    }
+                }
+                src.push_str("}\n");
+            }
+            TypeDefKind::Option(t) => {
+                let payload_offset = offset
+                    + self
+                        .gen
+                        .sizes
+                        .payload_offset(Int::U8, [None, Some(t)])
+                        .size_wasm32();
+                let store =
+                    self.store_canonical(&self.option_unwrap(t, value), t, payload_offset, false);
+                let is_some = self.option_is_some(t, value);
+                uwriteln!(src, "if {is_some} {{\nbuf[{offset}] = 1\n{store}}}");
+            }
+            TypeDefKind::Result(r) => {
+                let payload_offset = offset
+                    + self
+                        .gen
+                        .sizes
+                        .payload_offset(Int::U8, [r.ok.as_ref(), r.err.as_ref()])
+                        .size_wasm32();
+                let ok = match &r.ok {
+                    Some(ty) => self.store_canonical(
+                        &format!("{value}.Unwrap()"),
+                        ty,
+                        payload_offset,
+                        false,
+                    ),
+                    None => String::new(),
+                };
+                let err = match &r.err {
+                    Some(ty) => self.store_canonical(
+                        &format!("{value}.UnwrapErr()"),
+                        ty,
+                        payload_offset,
+                        false,
+                    ),
+                    None => String::new(),
+                };
+                uwriteln!(
+                    src,
+                    "if {value}.IsErr() {{\nbuf[{offset}] = 1\n{err}}} else {{\n{ok}}}"
+                );
+            }
+            TypeDefKind::Type(t) => src.push_str(&self.store_canonical(value, t, offset, false)),
+            _ => unreachable!(),
+        }
+        src
+    }
+
+    /// Returns the statements loading the value of type `ty` at `offset` of
+    /// `buf` into `target`, returning an error for invalid discriminants.
+    /// Temporaries are suffixed with `depth` to keep them unique.
+    fn load_canonical(
+        &mut self,
+        target: &str,
+        ty: &Type,
+        offset: usize,
+        depth: usize,
+        root: bool,
+    ) -> String {
+        let id = match ty {
+            Type::Id(id) => *id,
+            Type::Bool => return format!("{target} = buf[{offset}] != 0\n"),
+            Type::U8 => return format!("{target} = buf[{offset}]\n"),
+            Type::S8 => return format!("{target} = int8(buf[{offset}])\n"),
+            Type::U16 => return format!("{target} = {}\n", self.get_uint(16, offset)),
+            Type::S16 => return format!("{target} = int16({})\n", self.get_uint(16, offset)),
+            Type::U32 => return format!("{target} = {}\n", self.get_uint(32, offset)),
+            Type::S32 => return format!("{target} = int32({})\n", self.get_uint(32, offset)),
+            Type::Char => return format!("{target} = rune({})\n", self.get_uint(32, offset)),
+            Type::U64 => return format!("{target} = {}\n", self.get_uint(64, offset)),
+            Type::S64 => return format!("{target} = int64({})\n", self.get_uint(64, offset)),
+            Type::F32 => {
+                self.gen.with_math_import(true);
+                let bits = self.get_uint(32, offset);
+                return format!("{target} = math.Float32frombits({bits})\n");
+            }
+            Type::F64 => {
+                self.gen.with_math_import(true);
+                let bits = self.get_uint(64, offset);
+                return format!("{target} = math.Float64frombits({bits})\n");
+            }
+            Type::String => unreachable!(),
+        };
+        let resolve = self.resolve;
+        let ty_def = &resolve.types[id];
+        let named = matches!(
+            ty_def.kind,
+            TypeDefKind::Record(_)
+                | TypeDefKind::Variant(_)
+                | TypeDefKind::Enum(_)
+                | TypeDefKind::Flags(_)
+        );
+        if named && !root {
+            let name = self.gen.type_names[&id].clone();
+            return format!(
+                "if err := loadCanonical{name}(buf[{offset}:], &{target}); err != nil {{
+                    return err
+                }}
+                "
+            );
+        }
+
+        let mut src = String::new();
+        let tmp = format!("p{depth}");
+        match &ty_def.kind {
+            TypeDefKind::Record(r) => {
+                let offsets = self.gen.sizes.field_offsets(r.fields.iter().map(|f| &f.ty));
+                for ((field_offset, ty), field) in offsets.into_iter().zip(&r.fields) {
+                    let target = format!("{target}.{}", self.gen.go_ident(&field.name));
+                    let offset = offset + field_offset.size_wasm32();
+                    src.push_str(&self.load_canonical(&target, ty, offset, depth, false));
+                }
+            }
+            TypeDefKind::Tuple(t) => {
+                let offsets = self.gen.sizes.field_offsets(t.types.iter());
+                for (i, (field_offset, ty)) in offsets.into_iter().enumerate() {
+                    let target = self.tuple_field(t, target, i);
+                    let offset = offset + field_offset.size_wasm32();
+                    src.push_str(&self.load_canonical(&target, ty, offset, depth, false));
+                }
+            }
+            TypeDefKind::Flags(_) => {
+                let name = self.gen.type_names[&id].clone();
+                let bits = self.gen.sizes.size(ty).size_wasm32() * 8;
+                let value = match bits {
+                    8 => format!("buf[{offset}]"),
+                    _ => self.get_uint(bits, offset),
+                };
+                uwriteln!(src, "{target} = {name}({value})");
+            }
+            TypeDefKind::Enum(e) => {
+                let name = self.gen.type_names[&id].clone();
+                let count = e.cases.len();
+                let disc = self.get_int(e.tag(), offset);
+                uwriteln!(
+                    src,
+                    "if d := {disc}; d < {count} {{
+                        {target} = {name}{{kind: {name}Kind(d)}}
+                    }} else {{
+                        return fmt.Errorf(\"invalid {name} discriminant %d\", d)
+                    }}"
+                );
+            }
+            TypeDefKind::Variant(v) => {
+                let name = self.gen.type_names[&id].clone();
+                let sealed = self.variant_sealed(v);
+                let payload_offset = offset
+                    + self
+                        .gen
+                        .sizes
+                        .payload_offset(v.tag(), v.cases.iter().map(|c| c.ty.as_ref()))
+                        .size_wasm32();
+                let disc = self.get_int(v.tag(), offset);
+                uwriteln!(src, "switch d := {disc}; d {{");
+                for (i, case) in v.cases.iter().enumerate() {
+                    let case_name = self.case_name(&case.name);
+                    uwriteln!(src, "case {i}:");
+                    let payload = match &case.ty {
+                        Some(ty) => {
+                            let go_ty = self.get_ty(ty);
+                            let load =
+                                self.load_canonical(&tmp, ty, payload_offset, depth + 1, false);
+                            uwriteln!(src, "var {tmp} {go_ty}\n{load}");
+                            Some(tmp.as_str())
+                        }
+                        None => None,
+                    };
+                    let value = variant_case_value(sealed, &name, &case_name, payload);
+                    uwriteln!(src, "{target} = {value}");
+                }
+                uwriteln!(
+                    src,
+                    "default:
+                        return fmt.Errorf(\"invalid {name} discriminant %d\", d)
+                    }}"
+                );
+            }
+            TypeDefKind::Option(t) => {
+                let payload_offset = offset
+                    + self
+                        .gen
+                        .sizes
+                        .payload_offset(Int::U8, [None, Some(t)])
+                        .size_wasm32();
+                let go_ty = self.get_ty(t);
+                let load = self.load_canonical(&tmp, t, payload_offset, depth + 1, false);
+                let unset = if self.option_pointer(t) {
+                    format!("{target} = nil")
+                } else {
+                    format!("{target}.Unset()")
+                };
+                let set = self.option_set(t, target, &tmp);
+                uwriteln!(
+                    src,
+                    "switch buf[{offset}] {{
+                    case 0:
+                        {unset}
+                    case 1:
+                        var {tmp} {go_ty}
+                        {load}
+                        {set}
+                    default:
+                        return fmt.Errorf(\"invalid option discriminant %d\", buf[{offset}])
+                    }}"
+                );
+            }
+            TypeDefKind::Result(r) => {
+                let payload_offset = offset
+                    + self
+                        .gen
+                        .sizes
+                        .payload_offset(Int::U8, [r.ok.as_ref(), r.err.as_ref()])
+                        .size_wasm32();
+                let mut load_case = |ty: Option<&Type>, set: &str| match ty {
+                    Some(ty) => {
+                        let go_ty = self.get_ty(ty);
+                        let load = self.load_canonical(&tmp, ty, payload_offset, depth + 1, false);
+                        format!("var {tmp} {go_ty}\n{load}{target}.{set}({tmp})")
+                    }
+                    None => format!("{target}.{set}(struct{{}}{{}})"),
+                };
+                let ok = load_case(r.ok.as_ref(), "Set");
+                let err = load_case(r.err.as_ref(), "SetErr");
+                uwriteln!(
+                    src,
+                    "switch buf[{offset}] {{
+                    case 0:
+                        {ok}
+                    case 1:
+                        {err}
+                    default:
+                        return fmt.Errorf(\"invalid result discriminant %d\", buf[{offset}])
+                    }}"
+                );
+            }
+            TypeDefKind::Type(t) => {
+                src.push_str(&self.load_canonical(target, t, offset, depth, false));
+            }
+            _ => unreachable!(),
+        }
+        src
+    }
+
+    /// Returns the statement storing the unsigned integer `value` of `bits`
+    /// bits at `offset`.
+    fn put_uint(&mut self, value: &str, bits: usize, offset: usize) -> String {
+        if bits == 8 {
+            return format!("buf[{offset}] = byte({value})\n");
+        }
+        self.gen.with_binary_import(true);
+        format!("binary.LittleEndian.PutUint{bits}(buf[{offset}:], uint{bits}({value}))\n")
+    }
+
+    /// Returns the expression loading an unsigned integer of `bits` bits at
+    /// `offset`.
+    fn get_uint(&mut self, bits: usize, offset: usize) -> String {
+        self.gen.with_binary_import(true);
+        format!("binary.LittleEndian.Uint{bits}(buf[{offset}:])")
+    }
+
+    fn put_int(&mut self, value: &str, repr: Int, offset: usize) -> String {
+        self.put_uint(value, int_bits(repr), offset)
+    }
+
+    fn get_int(&mut self, repr: Int, offset: usize) -> String {
+        match int_bits(repr) {
+            8 => format!("int(buf[{offset}])"),
+            bits => format!("int({})", self.get_uint(bits, offset)),
+        }
+    }
+}
+
+fn int_bits(repr: Int) -> usize {
+    match repr {
+        Int::U8 => 8,
+        Int::U16 => 16,
+        Int::U32 => 32,
+        Int::U64 => 64,
+    }
+}
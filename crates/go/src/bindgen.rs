@@ -1,21 +1,30 @@
 use std::fmt::Write as _;
 
-use heck::{ToSnakeCase, ToUpperCamelCase};
-use wit_bindgen_c::{flags_repr, int_repr};
+use heck::ToSnakeCase;
+use wit_bindgen_c::{flags_repr, int_repr, is_arg_by_pointer};
 use wit_bindgen_core::wit_parser::Handle::{Borrow, Own};
 use wit_bindgen_core::wit_parser::{Field, Function, Type, TypeDefKind};
 use wit_bindgen_core::{dealias, uwriteln, Direction, Source};
+use wit_component::StringEncoding;
 
-use super::avoid_keyword;
-use crate::interface;
+use super::{avoid_keyword, local_name};
+use crate::interface::{self, variant_case_value};
+use crate::outline::HELPER;
 
 pub(crate) struct FunctionBindgen<'a, 'b> {
     pub(crate) interface: &'a mut interface::InterfaceGenerator<'b>,
-    pub(crate) func: &'a Function,
+    // the function whose arguments and results are lifted and lowered, unless
+    // the values are round-tripped on their own
+    pub(crate) func: Option<&'a Function>,
     pub(crate) c_args: Vec<String>,
     pub(crate) args: Vec<String>,
     pub(crate) lower_src: Source,
     pub(crate) lift_src: Source,
+    pub(crate) uses_arena: bool,
+    arena: String,
+    // whether the linear memory of lifted values is owned, and released once
+    // they are copied into the Go heap
+    owns_lifted: bool,
 }
 
 impl<'a, 'b> FunctionBindgen<'a, 'b> {
@@ -23,38 +32,116 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
         interface: &'a mut interface::InterfaceGenerator<'b>,
         func: &'a Function,
     ) -> Self {
+        let arena = match interface.direction {
+            Direction::Import => "cabi_arena".to_string(),
+            Direction::Export => format!("{}_arena", interface.export_c_func_name(func)),
+        };
         Self {
             interface,
-            func,
+            func: Some(func),
             c_args: Vec::new(),
             args: Vec::new(),
             lower_src: Source::default(),
             lift_src: Source::default(),
+            uses_arena: false,
+            arena,
+            owns_lifted: true,
         }
     }
 
-    pub(crate) fn process_args(&mut self) {
+    /// Returns a bindgen lowering and lifting values outside of any function,
+    /// from the arena `arena`, which keeps owning the memory of the values it
+    /// lifts.
+    pub(crate) fn values(
+        interface: &'a mut interface::InterfaceGenerator<'b>,
+        arena: &str,
+    ) -> Self {
+        Self {
+            interface,
+            func: None,
+            c_args: Vec::new(),
+            args: Vec::new(),
+            lower_src: Source::default(),
+            lift_src: Source::default(),
+            uses_arena: false,
+            arena: arena.to_string(),
+            owns_lifted: false,
+        }
+    }
+
+    /// Returns the function whose futures and streams are lifted, whose
+    /// intrinsics they use. The values lifted outside of any function are
+    /// plain data, which holds neither.
+    fn async_func(&self) -> &'a Function {
         self.func
-            .params
-            .iter()
-            .for_each(|(name, ty)| match self.interface.direction {
-                Direction::Import => self.lower(&avoid_keyword(&name.to_snake_case()), ty),
-                Direction::Export => self.lift(&avoid_keyword(&name.to_snake_case()), ty),
-            });
+            .expect("futures and streams are only lifted along with their function")
+    }
+
+    /// Allocates the lowered values from the arena `arena` instead, such as
+    /// when lowering the arguments of an export for a benchmark.
+    pub(crate) fn with_arena(mut self, arena: &str) -> Self {
+        self.arena = arena.to_string();
+        self
+    }
+
+    /// Releases the linear memory of `param` once it has been copied into the
+    /// Go heap.
+    fn free_lifted(&mut self, param: &str) {
+        if self.owns_lifted {
+            uwriteln!(
+                self.lift_src,
+                "if {param}.len > 0 {{
+                    cabiFree(unsafe.Pointer({param}.ptr))
+                }}"
+            );
+        }
+    }
+
+    /// Returns the allocator for the memory of lowered values.
+    ///
+    /// Arguments of imported functions are only needed for the duration of
+    /// the call and are allocated from a per-call arena. Results of exported
+    /// functions are allocated from an arena that is released once the host
+    /// calls the `cabi_post_*` function of the export.
+    fn alloc(&mut self) -> String {
+        self.uses_arena = true;
+        format!("{}.alloc", self.arena)
+    }
+
+    pub(crate) fn process_args(&mut self) {
+        let func = self.func.expect("values have no arguments");
+        func.params.iter().for_each(|(name, ty)| {
+            let name = local_name(&name.to_snake_case());
+            match self.interface.direction {
+                Direction::Import => self.lower(&name, ty),
+                // the parameters the C bindings pass by pointer are
+                // dereferenced for the shared helpers
+                Direction::Export
+                    if self.interface.outlines(ty)
+                        && is_arg_by_pointer(self.interface.resolve, ty) =>
+                {
+                    let lift_name = format!("lift_{name}");
+                    self.lift_value(&format!("(*{name})"), ty, &lift_name);
+                    self.args.push(lift_name);
+                }
+                Direction::Export => self.lift(&name, ty),
+            }
+        });
     }
 
     pub(crate) fn process_returns(&mut self) {
-        match self.func.results.len() {
+        let func = self.func.expect("values have no results");
+        match func.results.len() {
             0 => {}
             1 => {
-                let ty = self.func.results.iter_types().next().unwrap();
+                let ty = func.results.iter_types().next().unwrap();
                 match self.interface.direction {
                     Direction::Import => self.lift("ret", ty),
                     Direction::Export => self.lower("result", ty),
                 }
             }
             _ => {
-                for (i, ty) in self.func.results.iter_types().enumerate() {
+                for (i, ty) in func.results.iter_types().enumerate() {
                     match self.interface.direction {
                         Direction::Import => self.lift(&format!("ret{i}"), ty),
                         Direction::Export => self.lower(&format!("result{i}"), ty),
@@ -84,8 +171,36 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
         self.c_args.push(lower_name);
     }
 
+    /// Returns whether the lists of `ty` are passed to the host in place with
+    /// `--zero-copy-lists`, which is the case of the lists of numbers passed
+    /// to imports, whose Go and C layouts are the same. The host only reads
+    /// them during the call, while the Go value is still reachable from the
+    /// arguments of the import. Lists of floats are copied nonetheless with
+    /// `--canonicalize-nans`, rather than canonicalized behind the caller's
+    /// back.
+    fn lowers_in_place(&self, ty: &Type) -> bool {
+        self.interface.gen.opts.zero_copy_lists
+            && self.func.is_some()
+            && matches!(self.interface.direction, Direction::Import)
+            && is_numeric(ty)
+            && !(self.interface.gen.opts.canonicalize_nans && matches!(ty, Type::F32 | Type::F64))
+    }
+
     pub(crate) fn lower_list_value(&mut self, param: &str, l: &Type, lower_name: &str) {
         let list_ty = self.interface.gen.get_c_ty(l);
+        if self.lowers_in_place(l) {
+            uwriteln!(
+                self.lower_src,
+                "if len({param}) == 0 {{
+                    {lower_name}.ptr = nil
+                }} else {{
+                    {lower_name}.ptr = (*{list_ty})(unsafe.Pointer(unsafe.SliceData({param})))
+                }}
+                {lower_name}.len = C.size_t(len({param}))"
+            );
+            return;
+        }
+        let alloc = self.alloc();
         uwriteln!(
                 self.lower_src,
                 "if len({param}) == 0 {{
@@ -93,7 +208,7 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                 {lower_name}.len = 0
             }} else {{
                 var empty_{lower_name} {list_ty}
-                {lower_name}.ptr = (*{list_ty})(C.malloc(C.size_t(len({param})) * C.size_t(unsafe.Sizeof(empty_{lower_name}))))
+                {lower_name}.ptr = (*{list_ty})({alloc}(uintptr(len({param}))*unsafe.Sizeof(empty_{lower_name}), unsafe.Alignof(empty_{lower_name})))
                 {lower_name}.len = C.size_t(len({param}))"
             );
 
@@ -170,6 +285,40 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
     /// * `ty` - A reference to a `Type` that specifies the type of the value.
     /// * `lower_name` - A reference to a string that represents the name to be used for the lower value.
     pub(crate) fn lower_value(&mut self, param: &str, ty: &Type, lower_name: &str) {
+        if !self.interface.outlines(ty) {
+            return self.lower_value_inline(param, ty, lower_name);
+        }
+        let (helper, uses_arena) = self.outline_lower(ty);
+        if uses_arena {
+            self.uses_arena = true;
+            let arena = &self.arena;
+            uwriteln!(
+                self.lower_src,
+                "{lower_name} := {helper}(&{arena}, {param})"
+            );
+        } else {
+            uwriteln!(self.lower_src, "{lower_name} := {helper}({param})");
+        }
+    }
+
+    /// Returns the helper lowering the values of `ty` with `--opt-size`, and
+    /// whether it allocates from the arena passed to it.
+    fn outline_lower(&mut self, ty: &Type) -> (String, bool) {
+        let go_ty = self.interface.get_ty(ty);
+        let c_ty = self.interface.gen.get_c_ty(ty);
+        let mut bindgen = FunctionBindgen::values(self.interface, "(*arena)");
+        bindgen.lower_value_inline("v", ty, "lower_v");
+        let uses_arena = bindgen.uses_arena;
+        let arena = if uses_arena { "arena *cabiArena, " } else { "" };
+        let def = format!(
+            "func {HELPER}({arena}v {go_ty}) {c_ty} {{\n{}return lower_v\n}}\n",
+            &*bindgen.lower_src
+        );
+        let helper = self.interface.gen.outline("cabiLower", def);
+        (helper, uses_arena)
+    }
+
+    fn lower_value_inline(&mut self, param: &str, ty: &Type, lower_name: &str) {
         match ty {
             Type::Bool => {
                 uwriteln!(self.lower_src, "{lower_name} := {param}",);
@@ -181,13 +330,67 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                     "var {lower_name} {value}",
                     value = self.interface.gen.get_c_ty(ty),
                 );
-                uwriteln!(
-                    self.lower_src,
-                    "
-                    // use unsafe.Pointer to avoid copy
-                    {lower_name}.ptr = (*uint8)(unsafe.Pointer(C.CString({param})))
+                let transcoded;
+                let param = if self.interface.gen.opts.string_transcoder {
+                    transcoded = format!("{lower_name}_s");
+                    uwriteln!(
+                        self.lower_src,
+                        "{transcoded} := cabiTranscode({param}, TranscodeLower)"
+                    );
+                    transcoded.as_str()
+                } else {
+                    param
+                };
+                let alloc = self.alloc();
+                if self.interface.gen.opts.intern_strings {
+                    let ptr_ty = match self.interface.gen.opts.string_encoding {
+                        StringEncoding::UTF16 => "uint16",
+                        _ => "uint8",
+                    };
+                    uwriteln!(
+                        self.lower_src,
+                        "if ptr, n, ok := cabiInternedLookup({param}); ok {{
+                            {lower_name}.ptr = (*{ptr_ty})(ptr)
+                            {lower_name}.len = C.size_t(n)
+                        }} else {{"
+                    );
+                }
+                match self.interface.gen.opts.string_encoding {
+                    StringEncoding::UTF8 if self.interface.gen.opts.strings_as_bytes => uwriteln!(
+                        self.lower_src,
+                        "
+                    {lower_name}.ptr = (*uint8)(cabiString({alloc}, unsafe.String(unsafe.SliceData({param}), len({param}))))
                     {lower_name}.len = C.size_t(len({param}))"
-                );
+                    ),
+                    StringEncoding::UTF8 => uwriteln!(
+                        self.lower_src,
+                        "
+                    {lower_name}.ptr = (*uint8)(cabiString({alloc}, {param}))
+                    {lower_name}.len = C.size_t(len({param}))"
+                    ),
+                    StringEncoding::UTF16 => {
+                        self.interface.gen.with_utf16(true);
+                        uwriteln!(
+                            self.lower_src,
+                            "{lower_name}_ptr, {lower_name}_len := encodeUTF16({alloc}, {param})
+                            {lower_name}.ptr = (*uint16)({lower_name}_ptr)
+                            {lower_name}.len = C.size_t({lower_name}_len)"
+                        );
+                    }
+                    StringEncoding::CompactUTF16 => {
+                        self.interface.gen.with_utf16(true);
+                        self.interface.gen.with_compact_utf16(true);
+                        uwriteln!(
+                            self.lower_src,
+                            "{lower_name}_ptr, {lower_name}_len := encodeCompactUTF16({alloc}, {param})
+                            {lower_name}.ptr = (*uint8)({lower_name}_ptr)
+                            {lower_name}.len = C.size_t({lower_name}_len)"
+                        );
+                    }
+                }
+                if self.interface.gen.opts.intern_strings {
+                    self.lower_src.push_str("}\n");
+                }
             }
             Type::Id(id) => {
                 let ty = &self.interface.resolve.types[*id]; // receive type
@@ -221,7 +424,7 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                         uwriteln!(self.lower_src, "var {lower_name} {c_typedef_target}");
                         for (i, ty) in t.types.iter().enumerate() {
                             self.lower_value(
-                                &format!("{param}.F{i}"),
+                                &self.interface.tuple_field(t, param, i),
                                 ty,
                                 &format!("{lower_name}_f{i}"),
                             );
@@ -231,9 +434,10 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                     TypeDefKind::Option(o) => {
                         let c_typedef_target = self.interface.gen.get_c_ty(&Type::Id(*id));
                         uwriteln!(self.lower_src, "var {lower_name} {c_typedef_target}");
-                        uwriteln!(self.lower_src, "if {param}.IsSome() {{");
+                        let is_some = self.interface.option_is_some(o, param);
+                        uwriteln!(self.lower_src, "if {is_some} {{");
                         self.lower_value(
-                            &format!("{param}.Unwrap()"),
+                            &self.interface.option_unwrap(o, param),
                             o,
                             &format!("{lower_name}_val"),
                         );
@@ -278,11 +482,13 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                         let ty = self.interface.get_ty(&Type::Id(*id));
                         uwriteln!(self.lower_src, "var {lower_name} {c_typedef_target}");
                         for (i, case) in v.cases.iter().enumerate() {
-                            let case_name = case.name.to_upper_camel_case();
+                            let case_name = self.interface.case_name(&case.name);
                             uwriteln!(
                                 self.lower_src,
                                 "if {param}.Kind() == {ty}Kind{case_name} {{"
                             );
+                            let payload =
+                                self.interface.variant_case_payload(param, &ty, &case_name);
                             if let Some(ty) = case.ty.as_ref() {
                                 let name = self.interface.gen.get_c_ty(ty);
                                 uwriteln!(
@@ -291,11 +497,7 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                                     {lower_name}.tag = {i}
                                     {lower_name}_ptr := (*{name})(unsafe.Pointer(&{lower_name}.val))"
                                     );
-                                self.lower_value(
-                                    &format!("{param}.Get{case_name}()"),
-                                    ty,
-                                    &format!("{lower_name}_val"),
-                                );
+                                self.lower_value(&payload, ty, &format!("{lower_name}_val"));
                                 uwriteln!(self.lower_src, "*{lower_name}_ptr = {lower_name}_val");
                             } else {
                                 uwriteln!(self.lower_src, "{lower_name}.tag = {i}");
@@ -308,7 +510,7 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                         let ty = self.interface.get_ty(&Type::Id(*id));
                         uwriteln!(self.lower_src, "var {lower_name} {c_typedef_target}");
                         for (i, case) in e.cases.iter().enumerate() {
-                            let case_name = case.name.to_upper_camel_case();
+                            let case_name = self.interface.case_name(&case.name);
                             uwriteln!(
                                 self.lower_src,
                                 "if {param}.Kind() == {ty}Kind{case_name} {{"
@@ -317,8 +519,14 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                             self.lower_src.push_str("}\n");
                         }
                     }
-                    TypeDefKind::Future(_) => todo!("impl future"),
-                    TypeDefKind::Stream(_) => todo!("impl stream"),
+                    TypeDefKind::Future(_) | TypeDefKind::Stream(_) => {
+                        // the handle of the readable end is handed over to the callee
+                        let c_typedef_target = self.interface.gen.get_c_ty(&Type::Id(*id));
+                        uwriteln!(
+                            self.lower_src,
+                            "{lower_name} := {c_typedef_target}({param}.takeHandle())"
+                        );
+                    }
                     TypeDefKind::ErrorContext => todo!("impl error-context"),
                     TypeDefKind::Resource => todo!("impl resource"),
                     TypeDefKind::Handle(h) => {
@@ -359,10 +567,11 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                                     uwriteln!(self.lower_src,
                                             "{private_type_name}_mu.Lock()
                                         {private_type_name}_next_id += 1
-                                        {private_type_name}_pointers[{private_type_name}_next_id] = {param}
+                                        {lower_name}_id := {private_type_name}_next_id
+                                        {private_type_name}_pointers[{lower_name}_id] = {param}
                                         {private_type_name}_mu.Unlock()
-                                        {lower_name}_c := (*{c_typedef_target})(unsafe.Pointer(C.malloc(C.size_t(unsafe.Sizeof({c_typedef_target}{{}})))))
-                                        {lower_name}_c.__handle = C.int32_t({private_type_name}_next_id)
+                                        {lower_name}_c := (*{c_typedef_target})(cabiAlloc(unsafe.Sizeof({c_typedef_target}{{}}), unsafe.Alignof({c_typedef_target}{{}})))
+                                        {lower_name}_c.__handle = C.int32_t({lower_name}_id)
                                         {lower_name} := C.{ns}_{snake}_new({lower_name}_c) // pass the pointer directly
                                         set{ty_name}OwningHandler({param}, int32({lower_name}.__handle))"
                                         );
@@ -397,12 +606,25 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                     TypeDefKind::Unknown => unreachable!(),
                 }
             }
+            Type::Char => {
+                // the host traps on chars which aren't Unicode scalar values
+                self.interface.gen.with_utf8_import(true);
+                self.interface.gen.with_fmt_import(true);
+                uwriteln!(
+                    self.lower_src,
+                    "if !utf8.ValidRune({param}) {{
+                        panic(fmt.Sprintf(\"invalid char %#x\", {param}))
+                    }}
+                    {lower_name} := {c_type_name}({param})",
+                    c_type_name = self.interface.gen.get_c_ty(ty),
+                );
+            }
             a => {
                 uwriteln!(
                     self.lower_src,
                     "{lower_name} := {c_type_name}({param_name})",
                     c_type_name = self.interface.gen.get_c_ty(a),
-                    param_name = param,
+                    param_name = self.interface.canonical_nan(a, param),
                 );
             }
         }
@@ -415,19 +637,114 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
     }
 
     pub(crate) fn lift_value(&mut self, param: &str, ty: &Type, lift_name: &str) {
+        if !self.interface.outlines(ty) {
+            return self.lift_value_inline(param, ty, lift_name);
+        }
+        let go_ty = self.interface.get_ty(ty);
+        let c_ty = self.interface.gen.get_c_ty(ty);
+        let owns_lifted = self.owns_lifted;
+        let mut bindgen = FunctionBindgen::values(self.interface, "");
+        bindgen.owns_lifted = owns_lifted;
+        bindgen.lift_value_inline("v", ty, "lift_v");
+        let def = format!(
+            "func {HELPER}(v {c_ty}) {go_ty} {{\n{}return lift_v\n}}\n",
+            &*bindgen.lift_src
+        );
+        let helper = self.interface.gen.outline("cabiLift", def);
+        uwriteln!(self.lift_src, "{lift_name} := {helper}({param})");
+    }
+
+    fn lift_value_inline(&mut self, param: &str, ty: &Type, lift_name: &str) {
         match ty {
             Type::Bool => {
                 uwriteln!(self.lift_src, "{lift_name} := {param}");
             }
             Type::String => {
                 self.interface.gen.with_import_unsafe(true);
-                uwriteln!(
+                self.check_lifted_ptr(param);
+                if matches!(
+                    self.interface.gen.opts.string_encoding,
+                    StringEncoding::UTF16
+                ) {
+                    self.interface.gen.with_utf16(true);
+                    uwriteln!(
+                        self.lift_src,
+                        "{lift_name} := decodeUTF16(unsafe.Pointer({param}.ptr), int({param}.len))"
+                    );
+                    self.free_lifted(param);
+                } else if matches!(
+                    self.interface.gen.opts.string_encoding,
+                    StringEncoding::CompactUTF16
+                ) {
+                    self.interface.gen.with_utf16(true);
+                    self.interface.gen.with_compact_utf16(true);
+                    uwriteln!(
+                        self.lift_src,
+                        "{lift_name} := decodeCompactUTF16(unsafe.Pointer({param}.ptr), uint32({param}.len))"
+                    );
+                    self.free_lifted(param);
+                } else if self.interface.gen.opts.strings_as_bytes {
+                    if self.interface.gen.opts.zero_copy_strings
+                        && matches!(self.interface.direction, Direction::Export)
+                    {
+                        uwriteln!(
+                            self.lift_src,
+                            "{lift_name} := unsafe.Slice((*byte)(unsafe.Pointer({param}.ptr)), int({param}.len))"
+                        );
+                    } else {
+                        uwriteln!(
+                            self.lift_src,
+                            "{lift_name} := C.GoBytes(unsafe.Pointer({param}.ptr), C.int({param}.len))"
+                        );
+                        self.free_lifted(param);
+                    }
+                } else if self.interface.gen.opts.explicit_free
+                    || (self.interface.gen.opts.zero_copy_strings
+                        && matches!(self.interface.direction, Direction::Export))
+                {
+                    // parameters of exported functions stay alive for the duration of
+                    // the call, and explicitly freed values until they are released,
+                    // so they can be aliased instead of copied.
+                    uwriteln!(
+                        self.lift_src,
+                        "{lift_name} := unsafe.String((*byte)(unsafe.Pointer({param}.ptr)), int({param}.len))"
+                    );
+                } else {
+                    uwriteln!(
                         self.lift_src,
                         "var {name} {value}
                     {lift_name} = C.GoStringN((*C.char)(unsafe.Pointer({param}.ptr)), C.int({param}.len))",
                         name = lift_name,
                         value = self.interface.get_ty(ty),
                     );
+                    self.free_lifted(param);
+                }
+                // transcoded before the validation, so that the transcoder can
+                // repair invalid strings
+                if self.interface.gen.opts.string_transcoder {
+                    uwriteln!(
+                        self.lift_src,
+                        "{lift_name} = cabiTranscode({lift_name}, TranscodeLift)"
+                    );
+                }
+                if matches!(
+                    self.interface.gen.opts.string_encoding,
+                    StringEncoding::UTF8
+                ) && self.interface.gen.opts.abi_errors
+                    && !self.interface.gen.opts.skip_utf8_validation
+                {
+                    self.interface.gen.with_utf8_import(true);
+                    let (valid, empty) = if self.interface.gen.opts.strings_as_bytes {
+                        ("utf8.Valid", "nil")
+                    } else {
+                        ("utf8.ValidString", "\"\"")
+                    };
+                    self.check_lifted(
+                        &format!("!{valid}({lift_name})"),
+                        "invalid UTF-8 string",
+                        &format!("{lift_name} = {empty}"),
+                    );
+                }
             }
             Type::Id(id) => {
                 let ty = &self.interface.resolve.types[*id]; // receive type
@@ -476,7 +793,8 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                                 t,
                                 &format!("{lift_name}_F{i}"),
                             );
-                            uwriteln!(self.lift_src, "{lift_name}.F{i} = {lift_name}_F{i}");
+                            let field = self.interface.tuple_field(t, lift_name, i);
+                            uwriteln!(self.lift_src, "{field} = {lift_name}_F{i}");
                         }
                     }
                     TypeDefKind::Option(o) => {
@@ -485,9 +803,14 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                         uwriteln!(self.lift_src, "if {param}.is_some {{");
                         self.lift_value(&format!("{param}.val"), o, &format!("{lift_name}_val"));
 
-                        uwriteln!(self.lift_src, "{lift_name}.Set({lift_name}_val)");
-                        self.lift_src.push_str("} else {\n");
-                        uwriteln!(self.lift_src, "{lift_name}.Unset()");
+                        let set =
+                            self.interface
+                                .option_set(o, lift_name, &format!("{lift_name}_val"));
+                        uwriteln!(self.lift_src, "{set}");
+                        if !self.interface.option_pointer(o) {
+                            self.lift_src.push_str("} else {\n");
+                            uwriteln!(self.lift_src, "{lift_name}.Unset()");
+                        }
                         self.lift_src.push_str("}\n");
                     }
                     TypeDefKind::Result(_) => {
@@ -525,8 +848,46 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                         }
                         uwriteln!(self.lift_src, "}}");
                     }
+                    TypeDefKind::List(l) if is_numeric(l) => {
+                        self.interface.gen.with_import_unsafe(true);
+                        self.check_lifted_ptr(param);
+                        let list_ty = self.interface.get_ty(&Type::Id(*id));
+                        let elem_ty = self.interface.get_ty(l);
+                        let memory = format!(
+                            "unsafe.Slice((*{elem_ty})(unsafe.Pointer({param}.ptr)), int({param}.len))"
+                        );
+                        // parameters of exported functions stay alive for the duration of
+                        // the call, and explicitly freed values until they are released,
+                        // so they can be aliased instead of copied.
+                        if self.interface.gen.opts.explicit_free
+                            || (self.interface.gen.opts.zero_copy_lists
+                                && matches!(self.interface.direction, Direction::Export))
+                        {
+                            uwriteln!(self.lift_src, "{lift_name} := {list_ty}({memory})");
+                        } else {
+                            uwriteln!(
+                                self.lift_src,
+                                "{lift_name} := make({list_ty}, {param}.len)
+                                if {param}.len > 0 {{
+                                    copy({lift_name}, {memory})
+                                }}"
+                            );
+                            self.free_lifted(param);
+                        }
+                        let elem = format!("{lift_name}_e");
+                        let canonical = self.interface.canonical_nan(l, &elem);
+                        if canonical != elem {
+                            uwriteln!(
+                                self.lift_src,
+                                "for {lift_name}_i, {elem} := range {lift_name} {{
+                                    {lift_name}[{lift_name}_i] = {canonical}
+                                }}"
+                            );
+                        }
+                    }
                     TypeDefKind::List(l) => {
                         self.interface.gen.with_import_unsafe(true);
+                        self.check_lifted_ptr(param);
                         let list_ty = self.interface.get_ty(&Type::Id(*id));
                         let c_ty_name = self.interface.gen.get_c_ty(l);
                         uwriteln!(self.lift_src, "var {lift_name} {list_ty}",);
@@ -557,8 +918,8 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                             "{lift_name}[{lift_name}_i] = list_{lift_name}"
                         );
                         self.lift_src.push_str("}\n");
+                        self.free_lifted(param);
                         self.lift_src.push_str("}\n");
-                        // TODO: don't forget to free `ret`
                     }
                     TypeDefKind::Type(t) => {
                         uwriteln!(
@@ -574,7 +935,7 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                         let ty_name: String = self.interface.get_ty(&Type::Id(*id));
                         uwriteln!(self.lift_src, "var {lift_name} {ty_name}");
                         for (i, case) in v.cases.iter().enumerate() {
-                            let case_name = case.name.to_upper_camel_case();
+                            let case_name = self.interface.case_name(&case.name);
                             self.lift_src
                                 .push_str(&format!("if {param}.tag == {i} {{\n"));
                             if let Some(ty) = case.ty.as_ref() {
@@ -588,28 +949,63 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                                     ty,
                                     &format!("{lift_name}_val"),
                                 );
-                                uwriteln!(
-                                    self.lift_src,
-                                    "{lift_name} = {ty_name}{case_name}({lift_name}_val)"
-                                )
+                                let value = variant_case_value(
+                                    self.interface.variant_sealed(v),
+                                    &ty_name,
+                                    &case_name,
+                                    Some(&format!("{lift_name}_val")),
+                                );
+                                uwriteln!(self.lift_src, "{lift_name} = {value}")
                             } else {
-                                uwriteln!(self.lift_src, "{lift_name} = {ty_name}{case_name}()");
+                                let value = variant_case_value(
+                                    self.interface.variant_sealed(v),
+                                    &ty_name,
+                                    &case_name,
+                                    None,
+                                );
+                                uwriteln!(self.lift_src, "{lift_name} = {value}");
                             }
                             self.lift_src.push_str("}\n");
                         }
+                        self.check_lifted(
+                            &format!("{param}.tag >= {}", v.cases.len()),
+                            &format!("invalid discriminant of {ty_name}"),
+                            "",
+                        );
                     }
                     TypeDefKind::Enum(e) => {
                         let ty_name = self.interface.get_ty(&Type::Id(*id));
                         uwriteln!(self.lift_src, "var {lift_name} {ty_name}");
                         for (i, case) in e.cases.iter().enumerate() {
-                            let case_name = case.name.to_upper_camel_case();
+                            let case_name = self.interface.case_name(&case.name);
                             uwriteln!(self.lift_src, "if {param} == {i} {{");
                             uwriteln!(self.lift_src, "{lift_name} = {ty_name}{case_name}()");
                             self.lift_src.push_str("}\n");
                         }
+                        self.check_lifted(
+                            &format!("{param} >= {}", e.cases.len()),
+                            &format!("invalid discriminant of {ty_name}"),
+                            "",
+                        );
+                    }
+                    TypeDefKind::Future(payload) => {
+                        let payload_ty = self.interface.async_payload(payload.as_ref());
+                        let func = self.async_func();
+                        let suffix = self.interface.async_intrinsics(func, *id);
+                        uwriteln!(
+                            self.lift_src,
+                            "{lift_name} := &FutureReader[{payload_ty}]{{handle: uint32({param}), vtable: futureVtable{suffix}}}"
+                        );
+                    }
+                    TypeDefKind::Stream(payload) => {
+                        let payload_ty = self.interface.async_payload(payload.as_ref());
+                        let func = self.async_func();
+                        let suffix = self.interface.async_intrinsics(func, *id);
+                        uwriteln!(
+                            self.lift_src,
+                            "{lift_name} := &StreamReader[{payload_ty}]{{handle: uint32({param}), vtable: streamVtable{suffix}}}"
+                        );
                     }
-                    TypeDefKind::Future(_) => todo!("impl future"),
-                    TypeDefKind::Stream(_) => todo!("impl stream"),
                     TypeDefKind::ErrorContext => todo!("impl error-context"),
                     TypeDefKind::Resource => todo!("impl resource"),
                     TypeDefKind::Handle(h) => {
@@ -664,13 +1060,32 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
                                     }
                                     uwriteln!(
                                             self.lift_src,
-                                            "{lift_name}, ok := {resource_name}_pointers[{lift_name}_handle]
-                                        if !ok {{
-                                            panic(\"internal error: invalid handle\")
-                                        }}"
+                                            "{resource_name}_mu.Lock()
+                                        {lift_name}, ok := {resource_name}_pointers[{lift_name}_handle]
+                                        {resource_name}_mu.Unlock()"
                                         );
+                                    if self.interface.gen.opts.abi_errors {
+                                        let ty_name = self.interface.get_ty(&Type::Id(resource));
+                                        self.check_lifted(
+                                            "!ok",
+                                            &format!("invalid handle of {ty_name}"),
+                                            "",
+                                        );
+                                    } else {
+                                        uwriteln!(
+                                            self.lift_src,
+                                            "if !ok {{
+                                                panic(\"internal error: invalid handle\")
+                                            }}"
+                                        );
+                                    }
                                 } else {
-                                    let resource_name = self.interface.get_ty(&Type::Id(resource));
+                                    let resource_name = match h {
+                                        Borrow(_) if self.interface.borrows_imported(resource) => {
+                                            self.interface.get_ty(&Type::Id(*id))
+                                        }
+                                        _ => self.interface.get_ty(&Type::Id(resource)),
+                                    };
                                     uwriteln!(
                                         self.lift_src,
                                         "{lift_name} := {resource_name}({param}.__handle)",
@@ -685,8 +1100,28 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
             a => {
                 let target_name = self.interface.get_ty(a);
 
+                let value = self
+                    .interface
+                    .canonical_nan(a, &format!("{target_name}({param})"));
                 uwriteln!(self.lift_src, "var {lift_name} {target_name}",);
-                uwriteln!(self.lift_src, "{lift_name} = {target_name}({param})",);
+                uwriteln!(self.lift_src, "{lift_name} = {value}",);
+                if matches!(a, Type::Char) {
+                    self.interface.gen.with_utf8_import(true);
+                    if self.interface.gen.opts.abi_errors {
+                        self.check_lifted(
+                            &format!("!utf8.ValidRune({lift_name})"),
+                            "invalid char",
+                            &format!("{lift_name} = 0"),
+                        );
+                    } else {
+                        uwriteln!(
+                            self.lift_src,
+                            "if !utf8.ValidRune({lift_name}) {{
+                                panic(\"internal error: invalid char\")
+                            }}"
+                        );
+                    }
+                }
             }
         }
     }
@@ -701,3 +1136,21 @@ impl<'a, 'b> FunctionBindgen<'a, 'b> {
         avoid_keyword(name)
     }
 }
+
+/// Returns whether values of `ty` have the same representation in Go and
+/// in linear memory, so that lists of them can be transferred in bulk.
+pub(crate) fn is_numeric(ty: &Type) -> bool {
+    matches!(
+        ty,
+        Type::U8
+            | Type::U16
+            | Type::U32
+            | Type::U64
+            | Type::S8
+            | Type::S16
+            | Type::S32
+            | Type::S64
+            | Type::F32
+            | Type::F64
+    )
+}
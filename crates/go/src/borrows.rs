@@ -0,0 +1,84 @@
+use std::fmt::Write as _;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::wit_parser::{Function, FunctionKind, Type, TypeId};
+use wit_bindgen_core::{dealias, uwriteln};
+
+use super::local_name;
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Returns whether `borrow<resource>` is bound to a `<Resource>Borrow`
+    /// type of its own with `--borrow-handles`, which is the case of the
+    /// imported resources. Borrows of exported resources are the Go values
+    /// implementing them.
+    pub(crate) fn borrows_imported(&self, resource: TypeId) -> bool {
+        self.gen.opts.borrow_handles
+            && !self
+                .gen
+                .exported_resources
+                .contains(&dealias(self.resolve, resource))
+    }
+
+    /// Prints the `<Resource>Borrow` type of the imported resource `name`,
+    /// bound to the Go type `type_name`.
+    pub(crate) fn print_borrow_type(&mut self, type_name: &str, name: &str) {
+        if !self.gen.opts.borrow_handles {
+            return;
+        }
+        uwriteln!(
+            self.src,
+            "// {type_name}Borrow is a handle to imported resource {name} borrowed for the
+            // duration of a call, which mustn't be retained once the call returned.
+            // Unlike {type_name}, it can't be dropped, nor passed where the ownership of
+            // the resource is transferred.
+            type {type_name}Borrow int32
+
+            // Borrow lends the handle for the duration of a call.
+            func (self {type_name}) Borrow() {type_name}Borrow {{
+                return {type_name}Borrow(self)
+            }}
+            "
+        );
+        self.facade_type(name, "Borrow");
+    }
+
+    /// Prints the method of `<Resource>Borrow` forwarding to the method
+    /// `func` of the imported resource, whose receiver is a borrow.
+    pub(crate) fn print_borrow_method(&mut self, func: &Function) {
+        let FunctionKind::Method(id) = func.kind else {
+            return;
+        };
+        if !self.gen.opts.borrow_handles {
+            return;
+        }
+        let type_name = self.get_ty(&Type::Id(id));
+        let mut args = func
+            .params
+            .iter()
+            .skip(1)
+            .map(|(name, _)| local_name(&name.to_snake_case()))
+            .collect::<Vec<_>>();
+        if self.gen.opts.context {
+            args.insert(0, "ctx".to_string());
+        }
+        let call = format!(
+            "{type_name}(self).{}({})",
+            self.func_name(func),
+            args.join(", ")
+        );
+        let call = if func.results.len() > 0 {
+            format!("return {call}")
+        } else {
+            call
+        };
+        let sig = self.func_sig_with_no_namespace(func);
+        uwriteln!(
+            self.src,
+            "func (self {type_name}Borrow) {sig} {{
+                {call}
+            }}
+            "
+        );
+    }
+}
@@ -0,0 +1,81 @@
+/// The cancellation check of the guest with `--cancellation`.
+///
+/// Exports can't be called while another one is running, so rather than
+/// exporting a function setting a flag, the guest polls the `canceled` core
+/// import of `wit-bindgen-go`, which the generated host bindings define.
+pub(crate) const CANCEL_HOOK: &str = r#"
+//go:wasmimport wit-bindgen-go canceled
+func cabiCanceled() int32
+
+// `Canceled` reports whether the host asked to abort the export being called.
+// Long-running exports should check it periodically and return early once it
+// reports true, since the host has no other way to stop them short of killing
+// the instance.
+func Canceled() bool {
+	return cabiCanceled() != 0
+}
+"#;
+
+/// The context passed to exports with both `--cancellation` and `--context`,
+/// reporting the cancellation by the host through `Err`.
+pub(crate) const CANCEL_CONTEXT: &str = r#"
+// `cabiCancelContext` reports the cancellation of the export by the host
+// through `Err`. The guest runs on a single thread, so `Done` isn't closed
+// when the host cancels the call, and exports need to poll `Err` instead.
+type cabiCancelContext struct {
+	context.Context
+}
+
+func (c cabiCancelContext) Err() error {
+	if Canceled() {
+		return context.Canceled
+	}
+	return c.Context.Err()
+}
+
+func cabiCancelable(ctx context.Context) context.Context {
+	return cabiCancelContext{ctx}
+}
+"#;
+
+/// Defines the `canceled` import of the guests generated with
+/// `--cancellation` for the wazero host bindings.
+pub(crate) const WAZERO_CANCEL: &str = r#"
+// `AddCancellationToRuntime` instantiates the host module `wit-bindgen-go`,
+// reporting to guests generated with `--cancellation` that the export being
+// called is canceled once the context passed to it is done.
+// This function needs to be called before the guest is instantiated.
+func AddCancellationToRuntime(ctx context.Context, r wazero.Runtime) error {
+	_, err := r.NewHostModuleBuilder("wit-bindgen-go").
+		NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			stack[0] = 0
+			if ctx.Err() != nil {
+				stack[0] = 1
+			}
+		}), nil, []api.ValueType{api.ValueTypeI32}).
+		Export("canceled").
+		Instantiate(ctx)
+	return err
+}
+"#;
+
+/// Defines the `canceled` import of the guests generated with
+/// `--cancellation` for the wasmtime host bindings.
+pub(crate) const WASMTIME_CANCEL: &str = r#"
+// `AddCancellationToLinker` defines the function `canceled` of
+// `wit-bindgen-go` in the linker, reporting to guests generated with
+// `--cancellation` that the export being called is canceled once `canceled`
+// returns true. It's called from the goroutine calling the export, while the
+// cancellation is typically requested from another one, so it needs to be
+// safe for concurrent use, e.g. by checking the `Err` of a context.
+// This function needs to be called before the guest is instantiated.
+func AddCancellationToLinker(linker *wasmtime.Linker, canceled func() bool) error {
+	return linker.FuncWrap("wit-bindgen-go", "canceled", func() int32 {
+		if canceled() {
+			return 1
+		}
+		return 0
+	})
+}
+"#;
@@ -0,0 +1,87 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::ToUpperCamelCase;
+use wit_bindgen_core::uwriteln;
+
+use super::HostRuntime;
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Records the method `decl` of the client of this interface, calling
+    /// the instance method `method` with `args`.
+    pub(crate) fn host_client_method(&mut self, decl: String, method: &str, args: &str) {
+        let body = format!("return i.instance.{method}({args})");
+        self.export_funcs.push((decl, body));
+    }
+
+    /// Prints the client of the functions exported by the guest for this
+    /// interface, with a method per function named as in the WIT rather than
+    /// prefixed with the interface, along with the Go interface it implements
+    /// so that embedders can substitute a local implementation of the
+    /// exports.
+    pub(crate) fn host_finish_exports(&mut self) {
+        if self.export_funcs.is_empty() {
+            return;
+        }
+        let ns = self.namespace();
+        let world = self.gen.world.to_upper_camel_case();
+        let wit_name = match self.interface {
+            Some(_) => format!("`{}`", self.wit_name()),
+            None => format!("the `{}` world", self.gen.world),
+        };
+        let funcs = mem::take(&mut self.export_funcs);
+
+        uwriteln!(
+            self.src,
+            "// `{ns}Exports` holds the functions exported by the guest for {wit_name}.
+            type {ns}Exports interface {{"
+        );
+        for (decl, _) in &funcs {
+            uwriteln!(self.src, "{decl}");
+        }
+        uwriteln!(
+            self.src,
+            "}}
+
+            // `{ns}Client` calls the functions exported by the guest for {wit_name}
+            // on the instance it owns.
+            type {ns}Client struct {{
+                instance *{world}Instance
+            }}
+
+            var _ {ns}Exports = (*{ns}Client)(nil)
+
+            // `New{ns}Client` returns a client calling the exports of `instance`,
+            // which it takes ownership of.
+            func New{ns}Client(instance *{world}Instance) *{ns}Client {{
+                return &{ns}Client{{instance: instance}}
+            }}
+
+            // `Instance` returns the instance the client calls.
+            func (i *{ns}Client) Instance() *{world}Instance {{
+                return i.instance
+            }}
+            "
+        );
+        if let HostRuntime::Wazero = self.gen.opts.host_runtime {
+            uwriteln!(
+                self.src,
+                "// `Close` closes the instance of the client.
+                func (i *{ns}Client) Close(ctx context.Context) error {{
+                    return i.instance.Close(ctx)
+                }}
+                "
+            );
+        }
+        for (decl, body) in funcs {
+            uwriteln!(
+                self.src,
+                "func (i *{ns}Client) {decl} {{
+                    {body}
+                }}
+                "
+            );
+        }
+    }
+}
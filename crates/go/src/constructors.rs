@@ -0,0 +1,64 @@
+use std::fmt::Write as _;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Enum, Record};
+
+use super::local_name;
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Prints `New<Record>` for the record `name` with `--constructors`,
+    /// taking every field of the record so that a field added to it breaks
+    /// the callers instead of being silently left unset.
+    pub(crate) fn print_record_constructor(&mut self, name: &str, record: &Record) {
+        if !self.gen.opts.constructors {
+            return;
+        }
+        self.facade_value("var", name, |name| format!("New{name}"));
+        let name = self.type_name(name, true);
+        let mut params = Vec::new();
+        let mut fields = Vec::new();
+        for field in record.fields.iter() {
+            let param = local_name(&field.name.to_snake_case());
+            params.push(format!("{param} {}", self.get_ty(&field.ty)));
+            fields.push(format!("{}: {param},", self.field_name(field)));
+        }
+        uwriteln!(
+            self.src,
+            "// New{name} returns a {name} with all of its fields set.
+            func New{name}({params}) {name} {{
+                return {name}{{
+                    {fields}
+                }}
+            }}
+            ",
+            params = params.join(", "),
+            fields = fields.join("\n"),
+        );
+    }
+
+    /// Prints `New<Enum>` for the enum `name` with `--constructors`,
+    /// returning the case of the enum of a kind only if it's within range.
+    pub(crate) fn print_enum_constructor(&mut self, name: &str, enum_: &Enum) {
+        if !self.gen.opts.constructors {
+            return;
+        }
+        self.facade_value("var", name, |name| format!("New{name}"));
+        let name = self.type_name(name, true);
+        self.gen.with_fmt_import(true);
+        let count = enum_.cases.len();
+        uwriteln!(
+            self.src,
+            "// New{name} returns the case of {name} of the given kind, or an error if
+            // there's no such case.
+            func New{name}(kind {name}Kind) ({name}, error) {{
+                if kind < 0 || kind >= {count} {{
+                    return {name}{{}}, fmt.Errorf(\"invalid {name}Kind: %d\", kind)
+                }}
+                return {name}{{kind: kind}}, nil
+            }}
+            "
+        );
+    }
+}
@@ -0,0 +1,19 @@
+/// The hook creating the `context.Context` passed to exported functions with
+/// `--context`.
+pub(crate) const CONTEXT_HOOK: &str = r#"
+var cabiContextHook func() context.Context
+
+// `SetContextHook` sets the function creating the `context.Context` passed to
+// each call of an exported function, e.g. to carry a deadline or values set
+// by the host. Without a hook, exports are passed `context.Background()`.
+func SetContextHook(hook func() context.Context) {
+	cabiContextHook = hook
+}
+
+func cabiContext() context.Context {
+	if cabiContextHook == nil {
+		return context.Background()
+	}
+	return cabiContextHook()
+}
+"#;
@@ -0,0 +1,99 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::Int;
+
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Prints the constants of the canonical ABI discriminants of `cases`,
+    /// the cases of the enum or variant `wit_name` bound to `name`, along
+    /// with its `Discriminant` method.
+    ///
+    /// The discriminants are the values stored in linear memory for the
+    /// cases, which don't depend on the Go representation of the type, and
+    /// so can be persisted or exchanged outside of the canonical ABI.
+    pub(crate) fn print_discriminants(
+        &mut self,
+        wit_name: &str,
+        name: &str,
+        repr: Int,
+        cases: &[&str],
+        sealed: bool,
+    ) {
+        let ty = discriminant_type(repr);
+        let mut constants = String::new();
+        for (i, case) in cases.iter().enumerate() {
+            let case_name = self.case_name(case);
+            self.facade_value("const", wit_name, |name| {
+                format!("{name}Discriminant{case_name}")
+            });
+            uwriteln!(constants, "{name}Discriminant{case_name} {ty} = {i}");
+        }
+        uwriteln!(
+            self.src,
+            "// The canonical ABI discriminants of the cases of {name}.
+            const (
+                {constants}
+            )
+            "
+        );
+        if !sealed {
+            uwriteln!(
+                self.src,
+                "// Discriminant returns the canonical ABI discriminant of the case of `n`.
+                func (n {name}) Discriminant() {ty} {{
+                    return {ty}(n.kind)
+                }}
+                "
+            );
+            return;
+        }
+        for case in cases {
+            let case_name = self.case_name(case);
+            uwriteln!(
+                self.src,
+                "func ({name}{case_name}) Discriminant() {ty} {{
+                    return {name}Discriminant{case_name}
+                }}
+                "
+            );
+        }
+    }
+
+    /// Prints `<Enum>FromDiscriminant`, returning the case of the enum `name`
+    /// with a canonical ABI discriminant, to restore the values persisted
+    /// with their `Discriminant`.
+    pub(crate) fn print_enum_from_discriminant(
+        &mut self,
+        wit_name: &str,
+        name: &str,
+        repr: Int,
+        count: usize,
+    ) {
+        self.facade_value("var", wit_name, |name| format!("{name}FromDiscriminant"));
+        let ty = discriminant_type(repr);
+        uwriteln!(
+            self.src,
+            "// {name}FromDiscriminant returns the case of {name} whose canonical ABI
+            // discriminant is `d`, and false if there's none.
+            func {name}FromDiscriminant(d {ty}) ({name}, bool) {{
+                if uint64(d) >= {count} {{
+                    return {name}{{}}, false
+                }}
+                return {name}{{kind: {name}Kind(d)}}, true
+            }}
+            "
+        );
+    }
+}
+
+/// Returns the Go type of the discriminants represented as `repr`.
+pub(crate) fn discriminant_type(repr: Int) -> &'static str {
+    match repr {
+        Int::U8 => "uint8",
+        Int::U16 => "uint16",
+        Int::U32 => "uint32",
+        Int::U64 => "uint64",
+    }
+}
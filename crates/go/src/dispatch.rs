@@ -0,0 +1,169 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Function, FunctionKind};
+
+use super::{local_name, HostRuntime};
+use crate::interface::InterfaceGenerator;
+
+/// An imported function dispatched through the import table of its
+/// interface with `--swappable-imports`.
+pub(crate) struct SwappableFunc {
+    name: String,
+    // the signature of the function, without its name
+    sig: String,
+    args: String,
+    has_results: bool,
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns the swappable function for the imported `func`, whose
+    /// declaration is `decl`.
+    fn swappable_func(&mut self, func: &Function, decl: &str) -> SwappableFunc {
+        let name = self.func_name(func);
+        let skip = usize::from(matches!(func.kind, FunctionKind::Method(_)));
+        let mut args = func
+            .params
+            .iter()
+            .skip(skip)
+            .map(|(param, _)| local_name(&param.to_snake_case()))
+            .collect::<Vec<_>>();
+        let opts = &self.gen.opts;
+        let has_ctx = if opts.host {
+            matches!(opts.host_runtime, HostRuntime::Wazero)
+        } else {
+            opts.context
+        };
+        if has_ctx {
+            args.insert(0, "ctx".to_string());
+        }
+        SwappableFunc {
+            sig: decl[name.len()..].to_string(),
+            name,
+            args: args.join(", "),
+            has_results: func.results.len() > 0,
+        }
+    }
+
+    /// Prints the signature of the imported `func` with
+    /// `--swappable-imports`, preceded by the function dispatching the calls
+    /// through the import table, and returns whether it did.
+    ///
+    /// The body of the import goes to `cabi<Interface><Func>`, the default
+    /// entry of the table, so that a replacement can still call it.
+    pub(crate) fn swappable_sig(&mut self, func: &Function) -> bool {
+        if !self.gen.opts.swappable_imports || !matches!(func.kind, FunctionKind::Freestanding) {
+            return false;
+        }
+        let ns = self.namespace();
+        let decl = self.func_sig_with_no_namespace(func);
+        let swappable = self.swappable_func(func, &decl);
+        let ret = if swappable.has_results { "return " } else { "" };
+        uwriteln!(
+            self.src,
+            "func {ns}{decl}{{
+                {ret}{ns}ImportFuncs.{name}Func({args})
+            }}
+
+            func cabi{ns}{decl}{{",
+            name = swappable.name,
+            args = swappable.args,
+        );
+        self.swappable_funcs.push(swappable);
+        true
+    }
+
+    /// Records the host import `func`, declared as `decl` in the Go interface
+    /// of the imports, for the import table of the interface.
+    pub(crate) fn host_swappable(&mut self, func: &Function, decl: &str) {
+        if self.gen.opts.swappable_imports {
+            let swappable = self.swappable_func(func, decl);
+            self.swappable_funcs.push(swappable);
+        }
+    }
+
+    /// Prints the table the imports of the guest dispatch through, whose
+    /// entries default to the imports themselves.
+    pub(crate) fn print_import_table(&mut self) {
+        if self.swappable_funcs.is_empty() {
+            return;
+        }
+        let ns = self.namespace();
+        let wit_name = self.wit_name();
+        let funcs = mem::take(&mut self.swappable_funcs);
+        uwriteln!(
+            self.src,
+            "// `{ns}ImportTable` holds the functions the functions imported from
+            // `{wit_name}` dispatch to. Replacing one, e.g. with a function injecting
+            // faults before calling the one it replaces, takes effect on the next
+            // call.
+            type {ns}ImportTable struct {{"
+        );
+        for func in &funcs {
+            uwriteln!(self.src, "{}Func func{}", func.name, func.sig);
+        }
+        uwriteln!(
+            self.src,
+            "}}
+
+            // `{ns}ImportFuncs` is the table the functions imported from `{wit_name}`
+            // dispatch through, which defaults to the imports themselves.
+            var {ns}ImportFuncs = {ns}ImportTable{{"
+        );
+        for func in &funcs {
+            uwriteln!(self.src, "{name}Func: cabi{ns}{name},", name = func.name);
+        }
+        self.src.push_str("}\n\n");
+    }
+
+    /// Prints the implementation of the Go interface of the imports of this
+    /// interface dispatching each function through a table, so that the host
+    /// can replace the functions individually while the guest runs.
+    pub(crate) fn print_host_import_table(&mut self) {
+        if self.swappable_funcs.is_empty() {
+            return;
+        }
+        let ns = self.namespace();
+        let funcs = mem::take(&mut self.swappable_funcs);
+        uwriteln!(
+            self.src,
+            "// `{ns}ImportTable` implements `{ns}` by dispatching each function to the
+            // matching `Func` field, so that the functions can be replaced one by one
+            // while the guest runs, e.g. to inject faults or to compare two
+            // implementations. The fields must not be replaced during a call.
+            type {ns}ImportTable struct {{"
+        );
+        for func in &funcs {
+            uwriteln!(self.src, "{}Func func{}", func.name, func.sig);
+        }
+        uwriteln!(
+            self.src,
+            "}}
+
+            var _ {ns} = (*{ns}ImportTable)(nil)
+
+            // `New{ns}ImportTable` returns a table dispatching to the methods of `impl`.
+            func New{ns}ImportTable(impl {ns}) *{ns}ImportTable {{
+                return &{ns}ImportTable{{"
+        );
+        for func in &funcs {
+            uwriteln!(self.src, "{name}Func: impl.{name},", name = func.name);
+        }
+        self.src.push_str("}\n}\n\n");
+        for func in &funcs {
+            let ret = if func.has_results { "return " } else { "" };
+            uwriteln!(
+                self.src,
+                "func (t *{ns}ImportTable) {name}{sig} {{
+                    {ret}t.{name}Func({args})
+                }}
+                ",
+                name = func.name,
+                sig = func.sig,
+                args = func.args,
+            );
+        }
+    }
+}
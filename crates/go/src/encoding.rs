@@ -0,0 +1,86 @@
+/// Transcoding between Go strings, which are UTF-8, and UTF-16 strings in
+/// linear memory.
+pub(crate) const UTF16_HELPERS: &str = r#"
+// encodeUTF16 transcodes `s` to UTF-16 into memory allocated with `alloc`,
+// returning the number of code units.
+func encodeUTF16(alloc Alloc, s string) (unsafe.Pointer, int) {
+	units := utf16.Encode([]rune(s))
+	if len(units) == 0 {
+		return nil, 0
+	}
+	ptr := alloc(uintptr(len(units))*2, 2)
+	copy(unsafe.Slice((*uint16)(ptr), len(units)), units)
+	return ptr, len(units)
+}
+
+// decodeUTF16 transcodes the `n` UTF-16 code units at `ptr` to a Go string.
+func decodeUTF16(ptr unsafe.Pointer, n int) string {
+	if n == 0 {
+		return ""
+	}
+	return string(utf16.Decode(unsafe.Slice((*uint16)(ptr), n)))
+}
+"#;
+
+/// Conversions between the `[]byte` of `list<u8>` and Go strings which share
+/// their memory rather than copying it.
+pub(crate) const BYTES_HELPERS: &str = r#"
+// BytesFromString returns the bytes of `s` without copying them, such as to
+// pass a string where a `list<u8>` is expected. The bytes must not be
+// modified.
+func BytesFromString(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// BytesToString returns the string of the bytes `b` without copying them,
+// such as to use a `list<u8>` where a string is expected. The bytes must not
+// be modified as long as the string is in use.
+func BytesToString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+"#;
+
+/// Transcoding between Go strings and the compact latin1+utf16 encoding,
+/// where strings are lowered as latin1 whenever all of their characters fit.
+pub(crate) const COMPACT_UTF16_HELPERS: &str = r#"
+// utf16Tag is set in the length of latin1+utf16 strings encoded as UTF-16.
+const utf16Tag = 1 << 31
+
+// encodeCompactUTF16 transcodes `s` to latin1 if possible and to UTF-16
+// otherwise into memory allocated with `alloc`, returning the tagged length.
+func encodeCompactUTF16(alloc Alloc, s string) (unsafe.Pointer, uint32) {
+	runes := []rune(s)
+	for _, r := range runes {
+		if r > 0xff {
+			ptr, n := encodeUTF16(alloc, s)
+			return ptr, uint32(n) | utf16Tag
+		}
+	}
+	if len(runes) == 0 {
+		return nil, 0
+	}
+	ptr := alloc(uintptr(len(runes)), 1)
+	latin1 := unsafe.Slice((*byte)(ptr), len(runes))
+	for i, r := range runes {
+		latin1[i] = byte(r)
+	}
+	return ptr, uint32(len(runes))
+}
+
+// decodeCompactUTF16 transcodes the latin1 or UTF-16 string at `ptr` with
+// the tagged length `n` to a Go string.
+func decodeCompactUTF16(ptr unsafe.Pointer, n uint32) string {
+	if n&utf16Tag != 0 {
+		return decodeUTF16(ptr, int(n&^utf16Tag))
+	}
+	if n == 0 {
+		return ""
+	}
+	latin1 := unsafe.Slice((*byte)(ptr), n)
+	runes := make([]rune, len(latin1))
+	for i, b := range latin1 {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+"#;
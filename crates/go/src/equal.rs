@@ -0,0 +1,193 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Type, TypeDefKind, Variant};
+
+use crate::interface::InterfaceGenerator;
+
+/// `Equal` methods deeply comparing the generated types, which can't always
+/// be compared with `==` since they may hold slices, or compare the dynamic
+/// payloads of variants by identity.
+impl InterfaceGenerator<'_> {
+    /// Returns the expression deeply comparing `a` and `b` of type `ty`.
+    pub(crate) fn equal_value(&mut self, a: &str, b: &str, ty: &Type, depth: usize) -> String {
+        let id = match ty {
+            Type::Id(id) => *id,
+            // the conversions are optimized away when comparing
+            Type::String if self.gen.opts.strings_as_bytes => {
+                return format!("string({a}) == string({b})")
+            }
+            _ => return format!("{a} == {b}"),
+        };
+        let resolve = self.resolve;
+        match &resolve.types[id].kind {
+            TypeDefKind::Type(t) => self.equal_value(a, b, t, depth),
+            TypeDefKind::Variant(v) if self.variant_as_enum(v) => format!("{a} == {b}"),
+            TypeDefKind::Variant(v) if self.variant_sealed(v) => {
+                format!("({a} == nil && {b} == nil || {a} != nil && {a}.Equal({b}))")
+            }
+            TypeDefKind::Record(_) | TypeDefKind::Variant(_) => format!("{a}.Equal({b})"),
+            TypeDefKind::Tuple(t) => {
+                if t.types.is_empty() {
+                    return "true".to_string();
+                }
+                let fields = t
+                    .types
+                    .iter()
+                    .enumerate()
+                    .map(|(i, ty)| {
+                        let (a, b) = (self.tuple_field(t, a, i), self.tuple_field(t, b, i));
+                        self.equal_value(&a, &b, ty, depth)
+                    })
+                    .collect::<Vec<_>>();
+                format!("({})", fields.join(" && "))
+            }
+            TypeDefKind::Option(t) => {
+                let (a_none, b_none) = (self.option_is_none(t, a), self.option_is_none(t, b));
+                let (a, b) = (self.option_unwrap(t, a), self.option_unwrap(t, b));
+                let some = self.equal_value(&a, &b, t, depth);
+                format!("(({a_none}) == ({b_none}) && ({a_none} || {some}))")
+            }
+            TypeDefKind::Result(r) => {
+                let ok = match &r.ok {
+                    Some(t) => self.equal_value(
+                        &format!("{a}.Unwrap()"),
+                        &format!("{b}.Unwrap()"),
+                        t,
+                        depth,
+                    ),
+                    None => "true".to_string(),
+                };
+                let err = match &r.err {
+                    Some(t) => self.equal_value(
+                        &format!("{a}.UnwrapErr()"),
+                        &format!("{b}.UnwrapErr()"),
+                        t,
+                        depth,
+                    ),
+                    None => "true".to_string(),
+                };
+                format!(
+                    "({a}.IsOk() == {b}.IsOk() && ({a}.IsOk() && {ok} || {a}.IsErr() && {err}))"
+                )
+            }
+            TypeDefKind::List(t) => {
+                let i = format!("i{depth}");
+                let elem =
+                    self.equal_value(&format!("{a}[{i}]"), &format!("{b}[{i}]"), t, depth + 1);
+                format!(
+                    "func() bool {{
+                        if len({a}) != len({b}) {{
+                            return false
+                        }}
+                        for {i} := range {a} {{
+                            if !({elem}) {{
+                                return false
+                            }}
+                        }}
+                        return true
+                    }}()"
+                )
+            }
+            // enums and flags are comparable, while handles, futures and
+            // streams are compared by identity
+            _ => format!("{a} == {b}"),
+        }
+    }
+
+    /// Prints the `Equal` method of the record or tuple `name`, comparing the
+    /// fields `(selector, type)`, the selector being `.Field`, or `[i]` for
+    /// tuples bound to arrays.
+    pub(crate) fn print_struct_equal(&mut self, name: &str, fields: &[(String, Type)]) {
+        // the method would collide with a field of the same name
+        if fields.iter().any(|(field, _)| field == ".Equal") {
+            return;
+        }
+        let mut cmp = fields
+            .iter()
+            .map(|(field, ty)| {
+                self.equal_value(&format!("v{field}"), &format!("other{field}"), ty, 0)
+            })
+            .collect::<Vec<_>>()
+            .join(" &&\n");
+        if cmp.is_empty() {
+            cmp.push_str("true");
+        }
+        uwriteln!(
+            self.src,
+            "// Equal reports whether `v` and `other` hold deeply equal fields.
+            func (v {name}) Equal(other {name}) bool {{
+                return {cmp}
+            }}
+            "
+        );
+    }
+
+    /// Prints the `Equal` method of the variant `name`, comparing the payloads
+    /// of values of the same case.
+    pub(crate) fn print_variant_equal(&mut self, name: &str, variant: &Variant) {
+        let mut cases = String::new();
+        for case in variant.cases.iter() {
+            let Some(ty) = &case.ty else {
+                continue;
+            };
+            let case_name = self.case_name(&case.name);
+            let cmp = self.equal_value("a", "b", ty, 0);
+            if cmp == "true" {
+                continue;
+            }
+            let ty = self.get_ty(ty);
+            // the payload is missing from the zero value of the variant
+            uwriteln!(
+                cases,
+                "case {name}Kind{case_name}:
+                    a, _ := v.val.({ty})
+                    b, _ := other.val.({ty})
+                    return {cmp}"
+            );
+        }
+        if !cases.is_empty() {
+            cases = format!("switch v.kind {{\n{cases}}}\n");
+        }
+        uwriteln!(
+            self.src,
+            "// Equal reports whether `v` and `other` are of the same case, holding
+            // deeply equal payloads.
+            func (v {name}) Equal(other {name}) bool {{
+                if v.kind != other.kind {{
+                    return false
+                }}
+                {cases}return true
+            }}
+            "
+        );
+    }
+
+    /// Prints the `Equal` method of the case `case_name` of the sealed variant
+    /// `name`, holding a payload of type `ty` if any.
+    pub(crate) fn print_sealed_case_equal(
+        &mut self,
+        name: &str,
+        case_name: &str,
+        ty: Option<&Type>,
+    ) {
+        let cmp = match ty {
+            Some(ty) => self.equal_value("v.Value", "o.Value", ty, 0),
+            None => "true".to_string(),
+        };
+        let (o, cmp) = match cmp.as_str() {
+            "true" => ("_", "ok".to_string()),
+            _ => ("o", format!("ok && {cmp}")),
+        };
+        uwriteln!(
+            self.src,
+            "// Equal reports whether `other` is of the same case, holding a deeply
+            // equal payload.
+            func (v {name}{case_name}) Equal(other {name}) bool {{
+                {o}, ok := other.({name}{case_name})
+                return {cmp}
+            }}
+            "
+        );
+    }
+}
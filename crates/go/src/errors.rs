@@ -0,0 +1,176 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::wit_parser::{Record, Resolve, Type, TypeDefKind, TypeId, Variant};
+use wit_bindgen_core::{dealias, uwriteln, Direction};
+
+use super::TinyGo;
+use crate::interface::InterfaceGenerator;
+
+impl TinyGo {
+    /// Collects the records, variants and enums used as the `err` case of a
+    /// result, which implement `error` so that they can be handled like any
+    /// other Go error once returned through a `ResultError`.
+    pub(crate) fn collect_error_types(&mut self, resolve: &Resolve) {
+        for (_, ty) in resolve.types.iter() {
+            let TypeDefKind::Result(r) = &ty.kind else {
+                continue;
+            };
+            if let Some(Type::Id(id)) = r.err {
+                let id = dealias(resolve, id);
+                if matches!(
+                    resolve.types[id].kind,
+                    TypeDefKind::Record(_) | TypeDefKind::Variant(_) | TypeDefKind::Enum(_)
+                ) {
+                    self.error_types.insert(id);
+                }
+            }
+        }
+    }
+
+    /// Returns whether the `err` case `err` of a result is recovered by
+    /// `ResultErrorPayload` from any error: strings are taken from the message
+    /// of the error, and the records, variants and enums implementing `error`
+    /// are found in the chain of wrapped errors.
+    pub(crate) fn converts_from_error(&self, resolve: &Resolve, err: Option<&Type>) -> bool {
+        match err {
+            None | Some(Type::String) => true,
+            Some(Type::Id(id)) => match &resolve.types[dealias(resolve, *id)].kind {
+                TypeDefKind::Type(Type::String) => true,
+                // the method would collide with a field of the same name
+                TypeDefKind::Record(r) => {
+                    r.fields.iter().all(|f| self.go_ident(&f.name) != "Error")
+                }
+                TypeDefKind::Variant(_) | TypeDefKind::Enum(_) => true,
+                _ => false,
+            },
+            Some(_) => false,
+        }
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns the Go type of the error returned in place of the `err` case
+    /// `err` of a result.
+    ///
+    /// The exports whose `err` case can't be recovered from any `error`
+    /// return a `*ResultError[E]`, so that their implementations can't return
+    /// errors the bindings would fail to convert back.
+    pub(crate) fn error_ty(&mut self, err: Option<&Type>) -> String {
+        if matches!(self.direction, Direction::Export)
+            && !self.gen.converts_from_error(self.resolve, err)
+        {
+            format!("*ResultError[{}]", self.optional_ty(err))
+        } else {
+            "error".to_string()
+        }
+    }
+
+    /// Prints the `Error` method of `name`, the Go type of `id`, with the
+    /// statements `body` formatting `v` into `b`, if the type is the error of
+    /// a result.
+    fn print_error_method(&mut self, id: TypeId, name: &str, body: &str) {
+        if !self.gen.error_types.contains(&id) {
+            return;
+        }
+        self.gen.with_strings_import(true);
+        uwriteln!(
+            self.src,
+            "// Error formats `v` as an error, as which it's returned by the functions
+            // returning it in the `err` case of a result.
+            func (v {name}) Error() string {{
+                b := &strings.Builder{{}}
+                {body}return b.String()
+            }}
+            "
+        );
+    }
+
+    /// Prints the `Error` method of the record `name`, listing its fields.
+    pub(crate) fn print_record_error(
+        &mut self,
+        id: TypeId,
+        wit_name: &str,
+        name: &str,
+        record: &Record,
+    ) {
+        let mut body = format!("b.WriteString(\"{wit_name}\")\n");
+        for (i, field) in record.fields.iter().enumerate() {
+            let field_name = self.field_name(field);
+            // the method would collide with a field of the same name
+            if field_name == "Error" {
+                return;
+            }
+            let sep = if i > 0 { ", " } else { ": " };
+            uwriteln!(body, "b.WriteString(\"{sep}{}=\")", field.name);
+            body.push_str(&self.format_value(&format!("v.{field_name}"), &field.ty, 0));
+        }
+        self.print_error_method(id, name, &body);
+    }
+
+    /// Prints the `Error` method of the variant `name`, naming the case along
+    /// with its payload if any.
+    pub(crate) fn print_variant_error(
+        &mut self,
+        id: TypeId,
+        wit_name: &str,
+        name: &str,
+        variant: &Variant,
+    ) {
+        let mut cases = String::new();
+        for case in variant.cases.iter() {
+            let case_name = self.case_name(&case.name);
+            let payload = match &case.ty {
+                Some(ty) => {
+                    let value = self.variant_case_payload("v", name, &case_name);
+                    let payload = self.format_value(&value, ty, 0);
+                    format!("b.WriteString(\": \")\n{payload}")
+                }
+                None => String::new(),
+            };
+            uwriteln!(
+                cases,
+                "case {name}Kind{case_name}:
+                    b.WriteString(\"{wit_name}: {}\")
+                    {payload}",
+                case.name
+            );
+        }
+        let body = format!(
+            "switch v.kind {{
+            {cases}default:
+                fmt.Fprintf(b, \"{wit_name}: unknown case %d\", v.kind)
+            }}
+            "
+        );
+        self.print_error_method(id, name, &body);
+    }
+
+    /// Prints the `Error` method of the case `case_name`, named `wit_case` in
+    /// the WIT, of the sealed variant `name`, so that `errors.As` finds the
+    /// variant by its interface.
+    pub(crate) fn print_sealed_case_error(
+        &mut self,
+        id: TypeId,
+        wit_name: &str,
+        name: &str,
+        wit_case: &str,
+        ty: Option<&Type>,
+    ) {
+        let payload = match ty {
+            Some(ty) => {
+                let payload = self.format_value("v.Value", ty, 0);
+                format!("b.WriteString(\": \")\n{payload}")
+            }
+            None => String::new(),
+        };
+        let case_name = self.case_name(wit_case);
+        let body = format!("b.WriteString(\"{wit_name}: {wit_case}\")\n{payload}");
+        self.print_error_method(id, &format!("{name}{case_name}"), &body);
+    }
+
+    /// Prints the `Error` method of the enum `name`, naming the case.
+    pub(crate) fn print_enum_error(&mut self, id: TypeId, wit_name: &str, name: &str) {
+        let body = format!("b.WriteString(\"{wit_name}: \")\nb.WriteString(v.String())\n");
+        self.print_error_method(id, name, &body);
+    }
+}
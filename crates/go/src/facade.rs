@@ -0,0 +1,225 @@
+use std::collections::BTreeMap;
+use std::fmt::Write as _;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::wit_parser::{
+    Function, FunctionKind, InterfaceId, Resolve, Type, TypeId, TypeOwner, WorldKey,
+};
+use wit_bindgen_core::{uwriteln, Direction, Files, Source};
+
+use super::{avoid_keyword, TinyGo};
+use crate::interface::InterfaceGenerator;
+
+/// A package re-exporting the bindings of a single interface from the
+/// generated package under short names, with `--interface-aliases`.
+///
+/// The bindings are only aliased: types are re-exported with type aliases and
+/// functions and constructors with variables, while their declarations stay in
+/// the generated package, which also holds the types shared between
+/// interfaces.
+pub(crate) struct Facade {
+    pub(crate) dir: String,
+    // the packages of other interfaces whose types are re-exported, by name
+    pub(crate) imports: BTreeMap<String, String>,
+    pub(crate) src: Source,
+}
+
+/// Returns the directory of the package re-exporting the interface `id`,
+/// named `key` in the world. The directories of versioned packages hold a
+/// directory per version, so that several versions of an interface can be
+/// bound in the same world.
+fn facade_dir(
+    gen: &TinyGo,
+    resolve: &Resolve,
+    id: InterfaceId,
+    key: &WorldKey,
+    direction: Direction,
+) -> String {
+    let dir = match key {
+        WorldKey::Name(name) => name.to_snake_case(),
+        WorldKey::Interface(_) => {
+            let iface = &resolve.interfaces[id];
+            let package = &resolve.packages[iface.package.unwrap()].name;
+            let mut dir = format!(
+                "{}/{}/",
+                package.namespace.to_snake_case(),
+                package.name.to_snake_case(),
+            );
+            if let Some(version) = gen.version_dir(package) {
+                dir.push_str(&version);
+                dir.push('/');
+            }
+            dir.push_str(&iface.name.as_deref().unwrap().to_snake_case());
+            dir
+        }
+    };
+    match direction {
+        Direction::Import => dir,
+        Direction::Export => format!("exports/{dir}"),
+    }
+}
+
+impl TinyGo {
+    /// Returns the import path of the generated package.
+    pub(crate) fn import_path(&self) -> String {
+        let module = self.module_path();
+        if self.opts.scaffold {
+            format!("{module}/gen")
+        } else {
+            module
+        }
+    }
+
+    pub(crate) fn push_facade(
+        &mut self,
+        dir: String,
+        imports: BTreeMap<String, String>,
+        src: Source,
+    ) {
+        if self.opts.interface_aliases && src.len() > 0 {
+            self.facades.push(Facade { dir, imports, src });
+        }
+    }
+
+    pub(crate) fn finish_facades(&mut self, files: &mut Files) {
+        let root = self.package_name();
+        let path = self.import_path();
+        for facade in std::mem::take(&mut self.facades) {
+            let package = avoid_keyword(&facade.dir.rsplit('/').next().unwrap().to_snake_case());
+            let mut src = Source::default();
+            wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+            uwriteln!(src, "package {package}\n");
+            uwriteln!(src, "import (\n{root} \"{path}\"");
+            for (name, dir) in &facade.imports {
+                uwriteln!(src, "{name} \"{path}/{dir}\"");
+            }
+            src.push_str(")\n\n");
+            src.push_str(&facade.src);
+
+            let src = std::mem::replace(&mut self.src, src);
+            if self.opts.gofmt {
+                self.gofmt();
+            }
+            let src = std::mem::replace(&mut self.src, src);
+            files.push(&format!("{}/{package}.go", facade.dir), src.as_bytes());
+        }
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns the directory of the package re-exporting this interface.
+    pub(crate) fn facade_dir(&self) -> Option<String> {
+        let (id, key) = self.interface?;
+        Some(facade_dir(self.gen, self.resolve, id, key, self.direction))
+    }
+
+    fn facade_enabled(&self) -> bool {
+        self.gen.opts.interface_aliases && self.interface.is_some()
+    }
+
+    /// Re-exports the generated type of the WIT type `name`, suffixed by
+    /// `suffix`.
+    pub(crate) fn facade_type(&mut self, name: &str, suffix: &str) {
+        if self.facade_enabled() {
+            let root = self.gen.package_name();
+            let short = self.gen.go_ident(name);
+            let full = self.type_name(name, true);
+            uwriteln!(self.facade, "type {short}{suffix} = {root}.{full}{suffix}");
+        }
+    }
+
+    /// Re-exports the alias `name` of `ty`. Types used from other interfaces
+    /// are re-exported from the package of the interface owning them, so
+    /// that the packages share a single definition of each type.
+    pub(crate) fn facade_alias(&mut self, name: &str, ty: &Type) {
+        if !self.facade_enabled() {
+            return;
+        }
+        let used = match ty {
+            Type::Id(id) => self.used_type(*id),
+            _ => None,
+        };
+        let Some((package, dir, owned)) = used else {
+            return self.facade_type(name, "");
+        };
+        let short = self.gen.go_ident(name);
+        uwriteln!(self.facade, "type {short} = {package}.{owned}");
+        self.facade_imports.insert(package, dir);
+    }
+
+    /// Returns the name and directory of the package re-exporting the type
+    /// `id` if it's owned by another interface of the world, along with the
+    /// name of the type in that package.
+    fn used_type(&self, id: TypeId) -> Option<(String, String, String)> {
+        let ty = &self.resolve.types[id];
+        let (TypeOwner::Interface(owner), Some(name)) = (ty.owner, &ty.name) else {
+            return None;
+        };
+        if self.interface.map(|(id, _)| id) == Some(owner) {
+            return None;
+        }
+        let key = self.gen.interface_names.get(&owner)?;
+        let world = &self.resolve.worlds[self.gen.world_id?];
+        // types are defined along with the import of an interface that is
+        // both imported and exported
+        let direction = if world.imports.contains_key(key) {
+            Direction::Import
+        } else {
+            Direction::Export
+        };
+        let dir = facade_dir(self.gen, self.resolve, owner, key, direction);
+        let package = dir.replace('/', "_");
+        Some((package, dir, self.gen.go_ident(name)))
+    }
+
+    /// Re-exports the generated constant or function of the WIT type `name`
+    /// whose name is formed with `f` from the name of the type.
+    pub(crate) fn facade_value(&mut self, kind: &str, name: &str, f: impl Fn(&str) -> String) {
+        if self.facade_enabled() {
+            let root = self.gen.package_name();
+            let short = f(&self.gen.go_ident(name));
+            let full = f(&self.type_name(name, true));
+            uwriteln!(self.facade, "{kind} {short} = {root}.{full}");
+        }
+    }
+
+    /// Re-exports the imported function `func`.
+    pub(crate) fn facade_func(&mut self, func: &Function) {
+        if !self.facade_enabled() {
+            return;
+        }
+        let root = self.gen.package_name();
+        let name = self.func_name(func);
+        match func.kind {
+            FunctionKind::Freestanding => {
+                let namespace = self.namespace();
+                uwriteln!(self.facade, "var {name} = {root}.{namespace}{name}");
+            }
+            FunctionKind::Static(_) | FunctionKind::Constructor(_) => {
+                uwriteln!(self.facade, "var {name} = {root}.{name}");
+            }
+            // methods are re-exported along with their resource
+            _ => {}
+        }
+    }
+
+    /// Re-exports the interface implementing the exports and its setter.
+    pub(crate) fn facade_exports(&mut self) {
+        if self.facade_enabled() {
+            let root = self.gen.package_name();
+            let namespace = self.namespace();
+            uwriteln!(
+                self.facade,
+                "type Interface = {root}.{namespace}
+                var Set = {root}.Set{namespace}"
+            );
+            // lets implementations in other packages embed the default one
+            if self.gen.opts.partial_exports {
+                uwriteln!(
+                    self.facade,
+                    "type Unimplemented = {root}.Unimplemented{namespace}"
+                );
+            }
+        }
+    }
+}
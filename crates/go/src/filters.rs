@@ -0,0 +1,78 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::abi::{self, AbiVariant};
+use wit_bindgen_core::wit_parser::{Function, FunctionKind, Resolve};
+use wit_bindgen_core::{uwriteln, Direction};
+
+use super::TinyGo;
+use crate::interface::InterfaceGenerator;
+
+impl TinyGo {
+    /// Returns whether the function `func` of the interface `interface`, if
+    /// any, is left out with `--skip` and `--only`.
+    ///
+    /// Filters name either a function, alone or qualified with its interface
+    /// as in `<interface>#<function>`, or a whole interface.
+    pub(crate) fn skips(&self, interface: Option<&str>, func: &str) -> bool {
+        let matches = |filters: &[String]| {
+            filters.iter().any(|filter| {
+                filter == func
+                    || interface.is_some_and(|interface| {
+                        filter == interface || *filter == format!("{interface}#{func}")
+                    })
+            })
+        };
+        matches(&self.opts.skip) || (!self.opts.only.is_empty() && !matches(&self.opts.only))
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns whether `func` is left out with `--skip` and `--only`. The
+    /// functions of resources are always generated, since the resources
+    /// can't be used without them.
+    pub(crate) fn skips(&self, func: &Function) -> bool {
+        if !matches!(func.kind, FunctionKind::Freestanding) {
+            return false;
+        }
+        let interface = self
+            .interface
+            .map(|(_, key)| self.resolve.name_world_key(key));
+        self.gen.skips(interface.as_deref(), &func.name)
+    }
+
+    /// Returns the statement trapping in place of the skipped `func`, so
+    /// that the bindings still provide all the functions of the world.
+    pub(crate) fn skipped_trap(&self, func: &Function) -> String {
+        format!("panic(\"`{}` is left out of the bindings\")\n", func.name)
+    }
+
+    /// Prints the export of the skipped `func`, trapping when called, along
+    /// with the post-return functions the C bindings expect for it.
+    pub(crate) fn skipped_export(&mut self, resolve: &Resolve, func: &Function) {
+        let name = self.export_c_func_name(func);
+        let sig = self.c_func_sig(resolve, func, Direction::Export);
+        let trap = self.skipped_trap(func);
+        let mut src = format!("//export {name}\n{sig} {{\n{trap}}}\n");
+        if abi::guest_export_needs_post_return(resolve, func) {
+            uwriteln!(
+                src,
+                "
+                //export {name}_post_return
+                func {name}_post_return() {{}}"
+            );
+            if resolve.wasm_signature(AbiVariant::GuestExport, func).retptr {
+                uwriteln!(
+                    src,
+                    "
+                    //export {name}_return_area
+                    func {name}_return_area(size, align C.size_t) unsafe.Pointer {{
+                        return nil
+                    }}"
+                );
+            }
+        }
+        src.push('\n');
+        // the skipped function isn't part of the interface the guest implements
+        self.export_funcs.push((String::new(), src));
+    }
+}
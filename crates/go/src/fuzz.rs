@@ -0,0 +1,339 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::wit_parser::{Type, TypeDefKind, TypeId};
+use wit_bindgen_core::{uwriteln, Files, Source};
+
+use super::{bindgen, TinyGo};
+use crate::interface::{variant_case_value, InterfaceGenerator};
+
+/// Makes up values out of the bytes of a fuzzing input. Floats are never NaN,
+/// which doesn't compare equal to itself, and lists and strings are kept
+/// short so that the fuzzer explores shapes rather than sizes.
+pub(crate) const FUZZ_READER: &str = r#"
+// cabiFuzzReader makes up values out of the bytes of a fuzzing input, reading
+// zeros once they run out.
+type cabiFuzzReader struct {
+	data []byte
+}
+
+func (r *cabiFuzzReader) byte() byte {
+	if len(r.data) == 0 {
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *cabiFuzzReader) uint64() uint64 {
+	var b [8]byte
+	n := copy(b[:], r.data)
+	r.data = r.data[n:]
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (r *cabiFuzzReader) bool() bool {
+	return r.byte()&1 == 1
+}
+
+func (r *cabiFuzzReader) intn(n int) int {
+	return int(r.uint64() % uint64(n))
+}
+
+func (r *cabiFuzzReader) len() int {
+	return int(r.byte() % 8)
+}
+
+func (r *cabiFuzzReader) float32() float32 {
+	f := math.Float32frombits(uint32(r.uint64()))
+	if f != f {
+		return 0
+	}
+	return f
+}
+
+func (r *cabiFuzzReader) float64() float64 {
+	f := math.Float64frombits(r.uint64())
+	if f != f {
+		return 0
+	}
+	return f
+}
+
+func (r *cabiFuzzReader) rune() rune {
+	c := rune(r.uint64() % (utf8.MaxRune + 1))
+	if !utf8.ValidRune(c) {
+		return utf8.RuneError
+	}
+	return c
+}
+
+func (r *cabiFuzzReader) string() string {
+	s := make([]rune, r.len())
+	for i := range s {
+		s[i] = r.rune()
+	}
+	return string(s)
+}
+"#;
+
+/// A type round-tripped by `<world>_fuzz_test.go`, or by the self-test of
+/// `--self-test`.
+pub(crate) struct FuzzTarget {
+    // the Go name of the type
+    pub(crate) name: String,
+    // the expression making up a value of the type out of a `cabiFuzzReader`
+    pub(crate) value: String,
+}
+
+impl TinyGo {
+    /// Writes `<world>_fuzz_test.go`, with a fuzz target per type checking
+    /// that arbitrary values of the type are preserved by lowering and
+    /// lifting them.
+    pub(crate) fn finish_fuzz_targets(&mut self, files: &mut Files) {
+        if self.fuzz_targets.is_empty() {
+            return;
+        }
+
+        let mut body = Source::default();
+        for FuzzTarget { name, value } in mem::take(&mut self.fuzz_targets) {
+            uwriteln!(
+                body,
+                "func FuzzRoundTrip{name}(f *testing.F) {{
+                    f.Add([]byte{{}})
+                    f.Fuzz(func(t *testing.T, data []byte) {{
+                        r := &cabiFuzzReader{{data: data}}
+                        v := {value}
+                        if !cabiRoundTrip{name}(v) {{
+                            t.Fatalf(\"%+v isn't preserved by lowering and lifting\", v)
+                        }}
+                    }})
+                }}
+                "
+            );
+        }
+
+        let mut src = Source::default();
+        wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+        src.push_str("//go:build witfuzz\n\n");
+        uwriteln!(src, "package {}\n", self.package_name());
+        // the reader is part of the bindings along with the self-test
+        let reader = !self.opts.self_test;
+        if reader {
+            src.push_str(
+                "import (\n\"encoding/binary\"\n\"math\"\n\"testing\"\n\"unicode/utf8\"\n",
+            );
+        } else {
+            src.push_str("import (\n\"testing\"\n");
+        }
+        let uses_types = ["Some[", "Ok["].iter().any(|t| body.contains(t));
+        if let (Some(path), true) = (&self.opts.runtime_package, uses_types) {
+            uwriteln!(src, ". \"{path}\"");
+        }
+        src.push_str(")\n");
+        if reader {
+            src.push_str(FUZZ_READER);
+        }
+        src.push_str("\n");
+        src.push_str(&body);
+
+        let bindings = mem::replace(&mut self.src, src);
+        if self.opts.gofmt {
+            self.gofmt();
+        }
+        let src = mem::replace(&mut self.src, bindings);
+        let name = format!("{}_fuzz_test.go", self.world.to_snake_case());
+        files.push(&name, src.as_bytes());
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Prints `cabiRoundTrip<Type>`, which lowers a value of the type `id` and
+    /// lifts it back, reporting whether the lifted value is equal to the
+    /// original, for the fuzz target of the type and the self-test.
+    ///
+    /// Types holding handles, futures or streams aren't fuzzed. Neither are
+    /// aliases, lists, options and results, which have no Go type of their
+    /// own, but they are fuzzed as part of the types holding them.
+    pub(crate) fn fuzz_round_trip(&mut self, id: TypeId) {
+        let ty = Type::Id(id);
+        let named = matches!(
+            self.resolve.types[id].kind,
+            TypeDefKind::Record(_)
+                | TypeDefKind::Tuple(_)
+                | TypeDefKind::Variant(_)
+                | TypeDefKind::Enum(_)
+                | TypeDefKind::Flags(_)
+        );
+        // the host bindings check the self-test of the guest instead
+        let self_test = self.gen.opts.self_test && !self.gen.opts.host;
+        if !(self.gen.opts.fuzz || self_test)
+            || !named
+            || !self.is_plain_data(&ty)
+            // nothing would be lowered
+            || self.gen.sizes.size(&ty).size_wasm32() == 0
+        {
+            return;
+        }
+
+        let mut bindgen = bindgen::FunctionBindgen::values(self, "cabi_arena");
+        bindgen.lower("v", &ty);
+        bindgen.lift_value("lower_v", &ty, "lift_v");
+        let uses_arena = bindgen.uses_arena;
+        let lower_src = bindgen.lower_src;
+        let lift_src = bindgen.lift_src;
+
+        let name = self.get_ty(&ty);
+        let arena = if uses_arena {
+            "var cabi_arena cabiArena\ndefer cabi_arena.release()\n"
+        } else {
+            ""
+        };
+        let equal = self.equal_value("v", "lift_v", &ty, 0);
+        uwriteln!(
+            self.src,
+            "// `cabiRoundTrip{name}` lowers `v` and lifts it back, reporting whether
+            // the lifted value is equal to `v`.
+            func cabiRoundTrip{name}(v {name}) bool {{
+                {arena}{lower_src}{lift_src}return {equal}
+            }}
+            ",
+            lower_src = &*lower_src,
+            lift_src = &*lift_src,
+        );
+
+        let value = self.fuzz_value(&ty);
+        if self_test {
+            self.gen.self_tests.push(FuzzTarget {
+                name: name.clone(),
+                value: value.clone(),
+            });
+        }
+        if self.gen.opts.fuzz {
+            self.gen.fuzz_targets.push(FuzzTarget { name, value });
+        }
+    }
+
+    /// Returns the expression making up a value of `ty` out of the
+    /// `cabiFuzzReader` named `r`.
+    fn fuzz_value(&mut self, ty: &Type) -> String {
+        let id = match ty {
+            Type::Bool => return "r.bool()".to_string(),
+            Type::Char => return "r.rune()".to_string(),
+            Type::F32 => return "r.float32()".to_string(),
+            Type::F64 => return "r.float64()".to_string(),
+            Type::String => return "r.string()".to_string(),
+            Type::Id(id) => *id,
+            _ => return format!("{}(r.uint64())", self.get_ty(ty)),
+        };
+        let name = self.get_ty(ty);
+        let resolve = self.resolve;
+        match &resolve.types[id].kind {
+            TypeDefKind::Type(t) => format!("{name}({})", self.fuzz_value(t)),
+            TypeDefKind::Record(r) => {
+                let fields = r
+                    .fields
+                    .iter()
+                    .map(|f| format!("{}: {}", self.field_name(f), self.fuzz_value(&f.ty)))
+                    .collect::<Vec<_>>();
+                format!("{name}{{{}}}", fields.join(", "))
+            }
+            TypeDefKind::Tuple(t) => {
+                let fields = t
+                    .types
+                    .iter()
+                    .enumerate()
+                    .map(|(i, ty)| format!("{}: {}", self.tuple_key(t, i), self.fuzz_value(ty)))
+                    .collect::<Vec<_>>();
+                format!("{name}{{{}}}", fields.join(", "))
+            }
+            TypeDefKind::List(t) => {
+                let elem = self.fuzz_value(t);
+                format!(
+                    "func() {name} {{
+                        l := make({name}, r.len())
+                        for i := range l {{
+                            l[i] = {elem}
+                        }}
+                        return l
+                    }}()"
+                )
+            }
+            TypeDefKind::Option(t) => {
+                let value = self.fuzz_value(t);
+                let some = self.option_value(t, Some(value.as_str()));
+                let none = self.option_value(t, None);
+                format!(
+                    "func() {name} {{
+                        if r.bool() {{
+                            return {some}
+                        }}
+                        return {none}
+                    }}()"
+                )
+            }
+            TypeDefKind::Result(r) => {
+                let ok = self.optional_ty(r.ok.as_ref());
+                let err = self.optional_ty(r.err.as_ref());
+                let mut value = |ty: &Option<Type>| match ty {
+                    Some(t) => self.fuzz_value(t),
+                    None => "struct{}{}".to_string(),
+                };
+                let (ok_value, err_value) = (value(&r.ok), value(&r.err));
+                format!(
+                    "func() {name} {{
+                        if r.bool() {{
+                            return Ok[{ok}, {err}]({ok_value})
+                        }}
+                        return Err[{ok}, {err}]({err_value})
+                    }}()"
+                )
+            }
+            TypeDefKind::Variant(v) => {
+                let sealed = self.variant_sealed(v);
+                let cases = v
+                    .cases
+                    .iter()
+                    .map(|case| {
+                        let payload = case.ty.as_ref().map(|t| self.fuzz_value(t));
+                        let case_name = self.case_name(&case.name);
+                        variant_case_value(sealed, &name, &case_name, payload.as_deref())
+                    })
+                    .collect::<Vec<_>>();
+                pick_case(&name, &cases)
+            }
+            TypeDefKind::Enum(e) => {
+                let cases = e
+                    .cases
+                    .iter()
+                    .map(|case| format!("{name}{}()", self.case_name(&case.name)))
+                    .collect::<Vec<_>>();
+                pick_case(&name, &cases)
+            }
+            TypeDefKind::Flags(f) if f.flags.is_empty() => format!("{name}(0)"),
+            TypeDefKind::Flags(f) => {
+                let mask = u64::MAX >> (64 - f.flags.len().min(64));
+                format!("{name}(r.uint64() & {mask:#x})")
+            }
+            _ => unreachable!(),
+        }
+    }
+}
+
+/// Returns the expression picking one of the values `cases` of type `name`.
+fn pick_case(name: &str, cases: &[String]) -> String {
+    let Some((last, cases)) = cases.split_last() else {
+        unreachable!("variants and enums have at least one case")
+    };
+    if cases.is_empty() {
+        return last.clone();
+    }
+    let mut src = format!("func() {name} {{\nswitch r.intn({}) {{\n", cases.len() + 1);
+    for (i, case) in cases.iter().enumerate() {
+        uwriteln!(src, "case {i}:\nreturn {case}");
+    }
+    uwriteln!(src, "}}\nreturn {last}\n}}()");
+    src
+}
@@ -0,0 +1,25 @@
+use crate::interface::InterfaceGenerator;
+
+/// The mutex serializing the calls of imports across goroutines with
+/// `--goroutine-safe`.
+pub(crate) const CALL_MUTEX: &str = r#"
+// cabiCallMu serializes the calls of imports across goroutines. Lowering and
+// lifting never yield to the scheduler on their own, but the allocator, trace,
+// metrics and context hooks may, which would otherwise let another goroutine
+// call an import in the middle of the call.
+//
+// The hooks must not call imports themselves, which would deadlock, and
+// exports are never called concurrently since only the host calls them.
+var cabiCallMu sync.Mutex
+"#;
+
+impl InterfaceGenerator<'_> {
+    /// Returns the statements holding `cabiCallMu` for the rest of the call
+    /// of an import with `--goroutine-safe`.
+    pub(crate) fn lock_call(&self) -> &'static str {
+        if !self.gen.opts.goroutine_safe {
+            return "";
+        }
+        "cabiCallMu.Lock()\ndefer cabiCallMu.Unlock()\n"
+    }
+}
@@ -0,0 +1,2037 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use anyhow::{bail, Result};
+use heck::{ToSnakeCase, ToUpperCamelCase};
+use wit_bindgen_core::abi::{self, AbiVariant, Bindgen, Bitcast, Instruction, LiftLower, WasmType};
+use wit_bindgen_core::wit_parser::{
+    Function, LiveTypes, Resolve, SizeAlign, Type, TypeDefKind, TypeOwner, WorldId,
+};
+use wit_bindgen_core::{uwrite, uwriteln, Direction, Files, Ns};
+
+use super::{cancel, local_name, nans, optional, transcode, traps, HostRuntime, TinyGo};
+use crate::interface::{variant_case_value, InterfaceGenerator};
+use crate::options::pointer_to;
+
+/// Names used by the generated glue which must not be shadowed by
+/// parameters or temporaries.
+const RESERVED: [&str; 14] = [
+    "ctx", "i", "err", "raw", "guest", "impl", "mod", "stack", "post", "builder", "linker",
+    "caller", "args", "trap",
+];
+
+struct Block {
+    body: String,
+    results: Vec<String>,
+    element: String,
+    base: String,
+}
+
+struct BlockStorage {
+    body: String,
+    element: String,
+    base: String,
+}
+
+/// Generates the host side of a single function using the canonical ABI
+/// instructions from `wit_bindgen_core::abi`.
+///
+/// For `Direction::Export` this is the host calling a function exported by
+/// the guest, and for `Direction::Import` this is the host implementing a
+/// function imported by the guest.
+pub(crate) struct FunctionBindgen<'a, 'b> {
+    interface: &'a mut InterfaceGenerator<'b>,
+    func: &'a Function,
+    runtime: HostRuntime,
+    core_name: String,
+    params: Vec<String>,
+    src: String,
+    locals: Ns,
+    block_storage: Vec<BlockStorage>,
+    blocks: Vec<Block>,
+    payloads: Vec<String>,
+    // whether the generated body needs access to the guest's memory
+    needs_guest: bool,
+}
+
+impl<'a, 'b> FunctionBindgen<'a, 'b> {
+    fn new(
+        interface: &'a mut InterfaceGenerator<'b>,
+        func: &'a Function,
+        core_name: String,
+    ) -> Self {
+        let mut locals = Ns::default();
+        for name in RESERVED {
+            locals.insert(name).unwrap();
+        }
+        let runtime = interface.gen.opts.host_runtime;
+        Self {
+            interface,
+            func,
+            runtime,
+            core_name,
+            params: Vec::new(),
+            src: String::new(),
+            locals,
+            block_storage: Vec::new(),
+            blocks: Vec::new(),
+            payloads: Vec::new(),
+            needs_guest: false,
+        }
+    }
+
+    fn guest(&mut self) -> &'static str {
+        self.needs_guest = true;
+        "guest"
+    }
+
+    fn load(&mut self, f: &str, operands: &[String], offset: i32) -> String {
+        let guest = self.guest();
+        format!("{guest}.{f}({})", address(&operands[0], offset))
+    }
+
+    fn store(&mut self, f: &str, value: &str, operands: &[String], offset: i32) {
+        let guest = self.guest();
+        uwriteln!(
+            self.src,
+            "{guest}.{f}({}, {value})",
+            address(&operands[1], offset)
+        );
+    }
+
+    fn lower_variant(
+        &mut self,
+        cases: &[(String, Option<Type>)],
+        lowered_types: &[WasmType],
+        op: &str,
+        results: &mut Vec<String>,
+        condition: impl Fn(usize) -> String,
+        payload: impl Fn(usize) -> String,
+        is_if: bool,
+    ) {
+        let blocks = self
+            .blocks
+            .drain(self.blocks.len() - cases.len()..)
+            .collect::<Vec<_>>();
+        let payloads = self
+            .payloads
+            .drain(self.payloads.len() - cases.len()..)
+            .collect::<Vec<_>>();
+
+        let lowered = lowered_types
+            .iter()
+            .map(|ty| {
+                let name = self.locals.tmp("lowered");
+                uwriteln!(self.src, "var {name} {}", wasm_go_type(*ty));
+                name
+            })
+            .collect::<Vec<_>>();
+
+        if !is_if {
+            uwriteln!(self.src, "switch {op}.Kind() {{");
+        }
+        for (i, (((_, ty), block), name)) in cases.iter().zip(blocks).zip(payloads).enumerate() {
+            if is_if {
+                if i == 0 {
+                    uwriteln!(self.src, "if {} {{", condition(i));
+                } else {
+                    uwriteln!(self.src, "}} else {{");
+                }
+            } else {
+                uwriteln!(self.src, "case {}:", condition(i));
+            }
+            if ty.is_some()
+                && (mentions(&block.body, &name)
+                    || block.results.iter().any(|r| mentions(r, &name)))
+            {
+                uwriteln!(self.src, "{name} := {}", payload(i));
+            }
+            self.src.push_str(&block.body);
+            for (lowered, result) in lowered.iter().zip(&block.results) {
+                uwriteln!(self.src, "{lowered} = {result}");
+            }
+        }
+        uwriteln!(self.src, "}}");
+        results.extend(lowered);
+    }
+
+    fn lift_variant(
+        &mut self,
+        ty: &Type,
+        cases: &[Option<Type>],
+        op: &str,
+        results: &mut Vec<String>,
+        construct: impl Fn(usize, Option<&str>) -> String,
+    ) {
+        let blocks = self
+            .blocks
+            .drain(self.blocks.len() - cases.len()..)
+            .collect::<Vec<_>>();
+        let ty = self.interface.get_ty(ty);
+        let lifted = self.locals.tmp("lifted");
+        uwriteln!(self.src, "var {lifted} {ty}");
+        uwriteln!(self.src, "switch {op} {{");
+        for (i, (case, block)) in cases.iter().zip(blocks).enumerate() {
+            uwriteln!(self.src, "case {i}:");
+            self.src.push_str(&block.body);
+            let payload = match case {
+                Some(_) => Some(block.results[0].as_str()),
+                None => None,
+            };
+            uwriteln!(self.src, "{lifted}{}", construct(i, payload));
+        }
+        uwriteln!(
+            self.src,
+            "default:
+                fault(\"invalid discriminant %d for {ty}\", {op})
+            }}"
+        );
+        results.push(lifted);
+    }
+}
+
+impl Bindgen for FunctionBindgen<'_, '_> {
+    type Operand = String;
+
+    fn emit(
+        &mut self,
+        resolve: &Resolve,
+        inst: &Instruction<'_>,
+        operands: &mut Vec<String>,
+        results: &mut Vec<String>,
+    ) {
+        match inst {
+            Instruction::GetArg { nth } => results.push(self.params[*nth].clone()),
+            Instruction::I32Const { val } => results.push(format!("int32({val})")),
+            Instruction::ConstZero { tys } => {
+                results.extend(tys.iter().map(|ty| format!("{}(0)", wasm_go_type(*ty))))
+            }
+            Instruction::Bitcasts { casts } => {
+                for (cast, op) in casts.iter().zip(operands.iter()) {
+                    if needs_math(cast) {
+                        self.interface.gen.with_math_import(true);
+                    }
+                    results.push(perform_cast(op, cast));
+                }
+            }
+
+            Instruction::I32FromS32
+            | Instruction::I64FromS64
+            | Instruction::S32FromI32
+            | Instruction::S64FromI64 => results.push(operands[0].clone()),
+            Instruction::CoreF32FromF32 | Instruction::F32FromCoreF32 => {
+                results.push(self.interface.canonical_nan(&Type::F32, &operands[0]))
+            }
+            Instruction::CoreF64FromF64 | Instruction::F64FromCoreF64 => {
+                results.push(self.interface.canonical_nan(&Type::F64, &operands[0]))
+            }
+
+            Instruction::I32FromChar => results.push(format!("int32(checkChar({}))", operands[0])),
+            Instruction::I32FromU32
+            | Instruction::I32FromU16
+            | Instruction::I32FromS16
+            | Instruction::I32FromU8
+            | Instruction::I32FromS8 => results.push(format!("int32({})", operands[0])),
+            Instruction::I64FromU64 => results.push(format!("int64({})", operands[0])),
+
+            Instruction::S8FromI32 => results.push(format!("int8({})", operands[0])),
+            Instruction::U8FromI32 => results.push(format!("uint8({})", operands[0])),
+            Instruction::S16FromI32 => results.push(format!("int16({})", operands[0])),
+            Instruction::U16FromI32 => results.push(format!("uint16({})", operands[0])),
+            Instruction::U32FromI32 => results.push(format!("uint32({})", operands[0])),
+            Instruction::U64FromI64 => results.push(format!("uint64({})", operands[0])),
+            Instruction::CharFromI32 => results.push(format!("checkChar(rune({}))", operands[0])),
+
+            Instruction::BoolFromI32 => results.push(format!("({} != 0)", operands[0])),
+            Instruction::I32FromBool => {
+                let lowered = self.locals.tmp("lowered");
+                uwriteln!(
+                    self.src,
+                    "var {lowered} int32
+                    if {} {{
+                        {lowered} = 1
+                    }}",
+                    operands[0]
+                );
+                results.push(lowered);
+            }
+
+            Instruction::FlagsLower { flags, .. } => {
+                let op = &operands[0];
+                for i in 0..flags.repr().count() {
+                    if i == 0 {
+                        results.push(format!("int32(uint32({op}))"));
+                    } else {
+                        results.push(format!("int32(uint32({op} >> {}))", i * 32));
+                    }
+                }
+            }
+            Instruction::FlagsLift { ty, .. } => {
+                let ty = self.interface.get_ty(&Type::Id(*ty));
+                let value = if operands.is_empty() {
+                    "0".to_string()
+                } else {
+                    operands
+                        .iter()
+                        .enumerate()
+                        .map(|(i, op)| {
+                            if i == 0 {
+                                format!("uint64(uint32({op}))")
+                            } else {
+                                format!("uint64(uint32({op}))<<{}", i * 32)
+                            }
+                        })
+                        .collect::<Vec<_>>()
+                        .join(" | ")
+                };
+                results.push(format!("{ty}({value})"));
+            }
+
+            Instruction::HandleLower { .. } | Instruction::HandleLift { .. } => {
+                unreachable!("resources are rejected by `check_host_types`")
+            }
+
+            Instruction::RecordLower { record, .. } => {
+                let op = &operands[0];
+                for field in record.fields.iter() {
+                    let name = self.interface.field_name(field);
+                    results.push(format!("{op}.{name}"));
+                }
+            }
+            Instruction::RecordLift { record, ty, .. } => {
+                let ty = self.interface.get_ty(&Type::Id(*ty));
+                let fields = record
+                    .fields
+                    .iter()
+                    .zip(operands.iter())
+                    .map(|(field, op)| {
+                        let name = self.interface.field_name(field);
+                        format!("{name}: {op}")
+                    })
+                    .collect::<Vec<_>>()
+                    .join(", ");
+                results.push(format!("{ty}{{{fields}}}"));
+            }
+
+            Instruction::TupleLower { tuple, .. } => {
+                let op = &operands[0];
+                for i in 0..tuple.types.len() {
+                    results.push(self.interface.tuple_field(tuple, op, i));
+                }
+            }
+            Instruction::TupleLift { tuple, ty } => {
+                let ty = self.interface.get_ty(&Type::Id(*ty));
+                let fields = operands
+                    .iter()
+                    .enumerate()
+                    .map(|(i, op)| format!("{}: {op}", self.interface.tuple_key(tuple, i)))
+                    .collect::<Vec<_>>()
+                    .join(", ");
+                results.push(format!("{ty}{{{fields}}}"));
+            }
+
+            Instruction::VariantPayloadName => {
+                let payload = self.locals.tmp("payload");
+                results.push(payload.clone());
+                self.payloads.push(payload);
+            }
+
+            Instruction::VariantLower {
+                variant,
+                ty,
+                results: lowered_types,
+                ..
+            } => {
+                let ty = self.interface.get_ty(&Type::Id(*ty));
+                let cases = variant
+                    .cases
+                    .iter()
+                    .map(|case| (self.interface.case_name(&case.name), case.ty))
+                    .collect::<Vec<_>>();
+                let payloads = cases
+                    .iter()
+                    .map(|(case, _)| self.interface.variant_case_payload(&operands[0], &ty, case))
+                    .collect::<Vec<_>>();
+                self.lower_variant(
+                    &cases,
+                    lowered_types,
+                    &operands[0],
+                    results,
+                    |i| format!("{ty}Kind{}", cases[i].0),
+                    |i| payloads[i].clone(),
+                    false,
+                );
+            }
+            Instruction::VariantLift { variant, ty, .. } => {
+                let name = self.interface.get_ty(&Type::Id(*ty));
+                let cases = variant.cases.iter().map(|c| c.ty).collect::<Vec<_>>();
+                let case_names = variant
+                    .cases
+                    .iter()
+                    .map(|c| self.interface.case_name(&c.name))
+                    .collect::<Vec<_>>();
+                let sealed = self.interface.variant_sealed(variant);
+                self.lift_variant(
+                    &Type::Id(*ty),
+                    &cases,
+                    &operands[0],
+                    results,
+                    |i, payload| {
+                        let case = &case_names[i];
+                        format!(" = {}", variant_case_value(sealed, &name, case, payload))
+                    },
+                );
+            }
+
+            Instruction::OptionLower {
+                payload,
+                results: lowered_types,
+                ..
+            } => {
+                let cases = [
+                    ("None".to_string(), None),
+                    ("Some".to_string(), Some(**payload)),
+                ];
+                let is_none = self.interface.option_is_none(payload, &operands[0]);
+                let unwrap = self.interface.option_unwrap(payload, &operands[0]);
+                self.lower_variant(
+                    &cases,
+                    lowered_types,
+                    &operands[0],
+                    results,
+                    |_| is_none.clone(),
+                    |_| unwrap.clone(),
+                    true,
+                );
+            }
+            Instruction::OptionLift { payload, ty } => {
+                let cases = [None, Some(**payload)];
+                let pointer = self.interface.option_pointer(payload);
+                let payload_ty = self.interface.get_ty(payload);
+                self.lift_variant(
+                    &Type::Id(*ty),
+                    &cases,
+                    &operands[0],
+                    results,
+                    |_, payload| match (pointer, payload) {
+                        (true, Some(payload)) => format!(" = {}", pointer_to(&payload_ty, payload)),
+                        (true, None) => " = nil".to_string(),
+                        (false, Some(payload)) => format!(".Set({payload})"),
+                        (false, None) => ".Unset()".to_string(),
+                    },
+                );
+            }
+
+            Instruction::ResultLower {
+                result,
+                results: lowered_types,
+                ..
+            } => {
+                let cases = [
+                    ("Ok".to_string(), result.ok),
+                    ("Err".to_string(), result.err),
+                ];
+                self.lower_variant(
+                    &cases,
+                    lowered_types,
+                    &operands[0],
+                    results,
+                    |_| format!("{}.IsOk()", operands[0]),
+                    |i| {
+                        if i == 0 {
+                            format!("{}.Unwrap()", operands[0])
+                        } else {
+                            format!("{}.UnwrapErr()", operands[0])
+                        }
+                    },
+                    true,
+                );
+            }
+            Instruction::ResultLift { result, ty } => {
+                let cases = [result.ok, result.err];
+                self.lift_variant(
+                    &Type::Id(*ty),
+                    &cases,
+                    &operands[0],
+                    results,
+                    |i, payload| {
+                        let payload = payload.unwrap_or("struct{}{}");
+                        if i == 0 {
+                            format!(".Set({payload})")
+                        } else {
+                            format!(".SetErr({payload})")
+                        }
+                    },
+                );
+            }
+
+            Instruction::EnumLower { .. } => results.push(format!("int32({}.Kind())", operands[0])),
+            Instruction::EnumLift { enum_, ty, .. } => {
+                let ty = self.interface.get_ty(&Type::Id(*ty));
+                let op = &operands[0];
+                uwriteln!(
+                    self.src,
+                    "if uint32({op}) >= {} {{
+                        fault(\"invalid discriminant %d for {ty}\", {op})
+                    }}",
+                    enum_.cases.len()
+                );
+                // the cases are built with their constructors, since the type
+                // may be defined in another package with `--shared-types`
+                let cases = enum_
+                    .cases
+                    .iter()
+                    .map(|case| format!("{ty}{}()", self.interface.case_name(&case.name)))
+                    .collect::<Vec<_>>()
+                    .join(", ");
+                results.push(format!("[...]{ty}{{{cases}}}[{op}]"));
+            }
+
+            Instruction::ListCanonLower { .. } => {
+                let guest = self.guest();
+                let ptr = self.locals.tmp("ptr");
+                let length = self.locals.tmp("length");
+                uwriteln!(
+                    self.src,
+                    "{ptr}, {length} := {guest}.storeBytes({})",
+                    operands[0]
+                );
+                results.push(ptr);
+                results.push(length);
+            }
+            Instruction::ListCanonLift { .. } => {
+                let guest = self.guest();
+                results.push(format!(
+                    "{guest}.loadBytes({}, {})",
+                    operands[0], operands[1]
+                ));
+            }
+
+            Instruction::StringLower { .. } => {
+                let guest = self.guest();
+                let ptr = self.locals.tmp("ptr");
+                let length = self.locals.tmp("length");
+                let value = if self.interface.gen.opts.string_transcoder {
+                    format!("cabiTranscode({}, TranscodeLower)", operands[0])
+                } else {
+                    operands[0].clone()
+                };
+                uwriteln!(self.src, "{ptr}, {length} := {guest}.storeString({value})");
+                results.push(ptr);
+                results.push(length);
+            }
+            Instruction::StringLift => {
+                let guest = self.guest();
+                let value = format!("{guest}.loadString({}, {})", operands[0], operands[1]);
+                if self.interface.gen.opts.string_transcoder {
+                    results.push(format!("cabiTranscode({value}, TranscodeLift)"));
+                } else {
+                    results.push(value);
+                }
+            }
+
+            Instruction::ListLower { element, .. } => {
+                let Block {
+                    body,
+                    results: block_results,
+                    element: block_element,
+                    base,
+                } = self.blocks.pop().unwrap();
+                assert!(block_results.is_empty());
+
+                let guest = self.guest();
+                let size = self.interface.gen.sizes.size(element).size_wasm32();
+                let align = self.interface.gen.sizes.align(element).align_wasm32();
+                let vec = self.locals.tmp("vec");
+                let ptr = self.locals.tmp("ptr");
+                let length = self.locals.tmp("length");
+                let index = self.locals.tmp("index");
+                let block_element = if mentions(&body, &block_element) {
+                    block_element
+                } else {
+                    "_".to_string()
+                };
+                let uses_base = mentions(&body, &base);
+                uwriteln!(
+                    self.src,
+                    "{vec} := {op}
+                    {length} := uint32(len({vec}))
+                    {ptr} := {guest}.alloc({length}*{size}, {align})",
+                    op = operands[0],
+                );
+                match (uses_base, block_element.as_str()) {
+                    (false, "_") => uwriteln!(self.src, "for range {vec} {{"),
+                    (false, _) => uwriteln!(self.src, "for _, {block_element} := range {vec} {{"),
+                    (true, _) => {
+                        uwriteln!(self.src, "for {index}, {block_element} := range {vec} {{")
+                    }
+                }
+                if uses_base {
+                    uwriteln!(self.src, "{base} := {ptr} + uint32({index})*{size}");
+                }
+                self.src.push_str(&body);
+                uwriteln!(self.src, "}}");
+                results.push(ptr);
+                results.push(length);
+            }
+            Instruction::ListLift { element, .. } => {
+                let Block {
+                    body,
+                    results: block_results,
+                    base,
+                    ..
+                } = self.blocks.pop().unwrap();
+                let guest = self.guest();
+                let size = self.interface.gen.sizes.size(element).size_wasm32();
+                let ty = self.interface.get_ty(element);
+                let ptr = self.locals.tmp("ptr");
+                let length = self.locals.tmp("length");
+                let lifted = self.locals.tmp("lifted");
+                let index = self.locals.tmp("index");
+                // the length comes from the guest, so it is checked against
+                // its memory before anything is allocated for it
+                uwriteln!(
+                    self.src,
+                    "{ptr}, {length} := {}, {}
+                    {guest}.checkList({ptr}, {length}, {size})
+                    {lifted} := make([]{ty}, {length})
+                    for {index} := range {lifted} {{",
+                    operands[0],
+                    operands[1],
+                );
+                if mentions(&body, &base) || block_results.iter().any(|r| mentions(r, &base)) {
+                    uwriteln!(self.src, "{base} := {ptr} + uint32({index})*{size}");
+                } else {
+                    uwriteln!(self.src, "_ = {ptr}");
+                }
+                self.src.push_str(&body);
+                uwriteln!(self.src, "{lifted}[{index}] = {}", block_results[0]);
+                uwriteln!(self.src, "}}");
+                results.push(lifted);
+            }
+
+            Instruction::IterElem { .. } => {
+                results.push(self.block_storage.last().unwrap().element.clone())
+            }
+            Instruction::IterBasePointer => {
+                results.push(self.block_storage.last().unwrap().base.clone())
+            }
+
+            Instruction::I32Load { offset } => {
+                let load = self.load("loadU32", operands, *offset);
+                results.push(format!("int32({load})"));
+            }
+            Instruction::I32Load8U { offset } => {
+                let load = self.load("loadU8", operands, *offset);
+                results.push(format!("int32({load})"));
+            }
+            Instruction::I32Load8S { offset } => {
+                let load = self.load("loadU8", operands, *offset);
+                results.push(format!("int32(int8({load}))"));
+            }
+            Instruction::I32Load16U { offset } => {
+                let load = self.load("loadU16", operands, *offset);
+                results.push(format!("int32({load})"));
+            }
+            Instruction::I32Load16S { offset } => {
+                let load = self.load("loadU16", operands, *offset);
+                results.push(format!("int32(int16({load}))"));
+            }
+            Instruction::I64Load { offset } => {
+                let load = self.load("loadU64", operands, *offset);
+                results.push(format!("int64({load})"));
+            }
+            Instruction::F32Load { offset } => {
+                let load = self.load("loadF32", operands, *offset);
+                results.push(load);
+            }
+            Instruction::F64Load { offset } => {
+                let load = self.load("loadF64", operands, *offset);
+                results.push(load);
+            }
+            Instruction::PointerLoad { offset } | Instruction::LengthLoad { offset } => {
+                let load = self.load("loadU32", operands, *offset);
+                results.push(load);
+            }
+
+            Instruction::I32Store { offset } => {
+                let value = format!("uint32({})", operands[0]);
+                self.store("storeU32", &value, operands, *offset);
+            }
+            Instruction::I32Store8 { offset } => {
+                let value = format!("uint8({})", operands[0]);
+                self.store("storeU8", &value, operands, *offset);
+            }
+            Instruction::I32Store16 { offset } => {
+                let value = format!("uint16({})", operands[0]);
+                self.store("storeU16", &value, operands, *offset);
+            }
+            Instruction::I64Store { offset } => {
+                let value = format!("uint64({})", operands[0]);
+                self.store("storeU64", &value, operands, *offset);
+            }
+            Instruction::F32Store { offset } => {
+                let value = operands[0].clone();
+                self.store("storeF32", &value, operands, *offset);
+            }
+            Instruction::F64Store { offset } => {
+                let value = operands[0].clone();
+                self.store("storeF64", &value, operands, *offset);
+            }
+            Instruction::PointerStore { offset } | Instruction::LengthStore { offset } => {
+                let value = operands[0].clone();
+                self.store("storeU32", &value, operands, *offset);
+            }
+
+            Instruction::Malloc { size, align, .. } => {
+                let guest = self.guest();
+                let ptr = self.locals.tmp("ptr");
+                uwriteln!(self.src, "{ptr} := {guest}.alloc({size}, {align})");
+                results.push(ptr);
+            }
+
+            Instruction::CallWasm { sig, .. } => {
+                let args = sig
+                    .params
+                    .iter()
+                    .zip(operands.iter())
+                    .map(|(ty, op)| self.runtime.encode_arg(*ty, op))
+                    .collect::<Vec<_>>();
+                let mut call_args = String::new();
+                for arg in args {
+                    call_args.push_str(", ");
+                    call_args.push_str(&arg);
+                }
+                let assign = if sig.results.is_empty()
+                    && !abi::guest_export_needs_post_return(resolve, self.func)
+                {
+                    "_, err ="
+                } else {
+                    "raw, err :="
+                };
+                let call = match self.runtime {
+                    HostRuntime::Wazero => {
+                        format!("i.export(\"{}\").Call(ctx{call_args})", self.core_name)
+                    }
+                    HostRuntime::Wasmtime => {
+                        let guest = self.guest();
+                        format!("{guest}.call(\"{}\"{call_args})", self.core_name)
+                    }
+                };
+                // a trapped instance can't be relied upon anymore
+                uwriteln!(
+                    self.src,
+                    "{assign} {call}
+                    if err != nil {{
+                        i.trapped = true
+                        err = trapError(\"{}\", err)
+                        return
+                    }}",
+                    self.core_name
+                );
+                for (i, ty) in sig.results.iter().enumerate() {
+                    let result = self.locals.tmp("result");
+                    let value = self.runtime.decode_result(*ty, i);
+                    uwriteln!(self.src, "{result} := {value}");
+                    results.push(result);
+                }
+            }
+
+            Instruction::CallInterface { func, .. } => {
+                let name = self.interface.func_name(func);
+                let mut args = match self.runtime {
+                    HostRuntime::Wazero => vec!["ctx".to_string()],
+                    HostRuntime::Wasmtime => Vec::new(),
+                };
+                args.extend(operands.iter().cloned());
+                let args = args.join(", ");
+                if func.results.len() == 0 {
+                    uwriteln!(self.src, "impl.{name}({args})");
+                } else {
+                    let assignments = func
+                        .results
+                        .iter_types()
+                        .map(|_| {
+                            let result = self.locals.tmp("result");
+                            results.push(result.clone());
+                            result
+                        })
+                        .collect::<Vec<_>>()
+                        .join(", ");
+                    uwriteln!(self.src, "{assignments} := impl.{name}({args})");
+                }
+            }
+
+            Instruction::Return { amt, func } => match self.interface.direction {
+                Direction::Export => {
+                    // Lifted values may still refer to guest memory, so they
+                    // are materialized before the post-return function
+                    // releases it.
+                    let mut values = String::new();
+                    for op in operands.iter() {
+                        let value = self.locals.tmp("value");
+                        uwriteln!(self.src, "{value} := {op}");
+                        values.push_str(&value);
+                        values.push_str(", ");
+                    }
+                    if abi::guest_export_needs_post_return(resolve, func) {
+                        match self.runtime {
+                            HostRuntime::Wazero => uwriteln!(
+                                self.src,
+                                "if post := i.module.ExportedFunction(\"cabi_post_{}\"); post != nil {{
+                                    if _, err = post.Call(ctx, raw...); err != nil {{
+                                        return
+                                    }}
+                                }}",
+                                self.core_name
+                            ),
+                            HostRuntime::Wasmtime => uwriteln!(
+                                self.src,
+                                "if err = guest.postReturn(\"cabi_post_{}\", raw...); err != nil {{
+                                    return
+                                }}",
+                                self.core_name
+                            ),
+                        }
+                    }
+                    uwriteln!(self.src, "return {values}nil");
+                }
+                Direction::Import => {
+                    let sig = resolve.wasm_signature(AbiVariant::GuestImport, func);
+                    assert_eq!(*amt, sig.results.len());
+                    match self.runtime {
+                        HostRuntime::Wazero => {
+                            for (i, (ty, op)) in sig.results.iter().zip(operands.iter()).enumerate()
+                            {
+                                uwriteln!(
+                                    self.src,
+                                    "stack[{i}] = api.Encode{}({op})",
+                                    ty_suffix(*ty)
+                                );
+                            }
+                        }
+                        HostRuntime::Wasmtime if sig.results.is_empty() => {
+                            uwriteln!(self.src, "return nil, nil");
+                        }
+                        HostRuntime::Wasmtime => {
+                            let vals = sig
+                                .results
+                                .iter()
+                                .zip(operands.iter())
+                                .map(|(ty, op)| wasmtime_val(*ty, op))
+                                .collect::<Vec<_>>()
+                                .join(", ");
+                            uwriteln!(self.src, "return []wasmtime.Val{{{vals}}}, nil");
+                        }
+                    }
+                }
+            },
+
+            Instruction::Flush { amt } => {
+                results.extend(operands.iter().take(*amt).cloned());
+            }
+
+            Instruction::GuestDeallocate { .. }
+            | Instruction::GuestDeallocateString
+            | Instruction::GuestDeallocateList { .. }
+            | Instruction::GuestDeallocateVariant { .. } => {
+                unreachable!("guest deallocation is never generated for host bindings")
+            }
+
+            Instruction::AsyncMalloc { .. }
+            | Instruction::AsyncPostCallInterface { .. }
+            | Instruction::AsyncCallReturn { .. }
+            | Instruction::AsyncCallWasm { .. } => {
+                unreachable!("the host bindings only call functions synchronously")
+            }
+
+            Instruction::FutureLower { .. }
+            | Instruction::FutureLift { .. }
+            | Instruction::StreamLower { .. }
+            | Instruction::StreamLift { .. }
+            | Instruction::ErrorContextLower { .. }
+            | Instruction::ErrorContextLift { .. } => {
+                unreachable!(
+                    "futures, streams and error contexts are rejected by `check_host_types`"
+                )
+            }
+        }
+    }
+
+    fn return_pointer(&mut self, _size: usize, _align: usize) -> String {
+        unreachable!("return pointers are always provided by the guest")
+    }
+
+    fn push_block(&mut self) {
+        let element = self.locals.tmp("elem");
+        let base = self.locals.tmp("base");
+        self.block_storage.push(BlockStorage {
+            body: mem::take(&mut self.src),
+            element,
+            base,
+        });
+    }
+
+    fn finish_block(&mut self, operands: &mut Vec<String>) {
+        let BlockStorage {
+            body,
+            element,
+            base,
+        } = self.block_storage.pop().unwrap();
+        self.blocks.push(Block {
+            body: mem::replace(&mut self.src, body),
+            results: mem::take(operands),
+            element,
+            base,
+        });
+    }
+
+    fn sizes(&self) -> &SizeAlign {
+        &self.interface.gen.sizes
+    }
+
+    fn is_list_canonical(&self, _resolve: &Resolve, element: &Type) -> bool {
+        matches!(element, Type::U8)
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns the statement selecting the memory and allocator exported by
+    /// the guest for the values exchanged by the functions of the current
+    /// interface, if set with `--memory`.
+    fn guest_memory(&self) -> String {
+        let name = self.wit_name();
+        let memory = self
+            .gen
+            .opts
+            .memory
+            .iter()
+            .rev()
+            .find(|(iface, ..)| *iface == name);
+        match memory {
+            Some((_, memory, realloc)) => {
+                format!("guest.memoryName, guest.reallocName = \"{memory}\", \"{realloc}\"\n")
+            }
+            None => String::new(),
+        }
+    }
+
+    /// Generates the host implementation of a function imported by the guest.
+    ///
+    /// The implementation is registered with the runtime in
+    /// `host_finish_imports`, dispatching to a Go interface implemented by
+    /// the embedder.
+    pub(crate) fn host_import(&mut self, func: &Function) {
+        let sig = self.resolve.wasm_signature(AbiVariant::GuestImport, func);
+        let skipped = self.skips(func);
+        let mut bindgen = FunctionBindgen::new(self, func, func.name.clone());
+        bindgen.params = sig
+            .params
+            .iter()
+            .enumerate()
+            .map(|(i, ty)| bindgen.runtime.decode_param(*ty, i))
+            .collect();
+        abi::call(
+            bindgen.interface.resolve,
+            AbiVariant::GuestImport,
+            LiftLower::LiftArgsLowerResults,
+            func,
+            &mut bindgen,
+            false,
+        );
+        let FunctionBindgen {
+            mut src,
+            mut needs_guest,
+            ..
+        } = bindgen;
+        // the guest may still import the skipped function, which traps
+        if skipped {
+            src = format!(
+                "panic(&ABIError{{msg: \"`{}` is left out of the host bindings\"}})\n",
+                func.name
+            );
+            needs_guest = false;
+        }
+
+        let mut params = self.func_params(func);
+        if !params.is_empty() {
+            params.insert_str(0, ", ");
+        }
+        let runtime = self.gen.opts.host_runtime;
+        let params = match runtime {
+            HostRuntime::Wazero => format!("ctx context.Context{params}"),
+            HostRuntime::Wasmtime => params.trim_start_matches(", ").to_string(),
+        };
+        let interface_method_decl = format!(
+            "{}({params}){}",
+            self.func_name(func),
+            self.func_results(func)
+        );
+        let interface_method_decl = if skipped {
+            String::new()
+        } else {
+            self.host_swappable(func, &interface_method_decl);
+            interface_method_decl
+        };
+
+        let mut register = String::new();
+        match runtime {
+            HostRuntime::Wazero => {
+                uwriteln!(
+                    register,
+                    "builder.NewFunctionBuilder().
+                        WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {{"
+                );
+                if needs_guest {
+                    uwriteln!(register, "guest := &guest{{ctx: ctx, module: mod}}");
+                    register.push_str(&self.guest_memory());
+                }
+                register.push_str(&src);
+                uwriteln!(
+                    register,
+                    "}}), {}, {}).
+                        Export(\"{}\")",
+                    wazero_value_types(&sig.params),
+                    wazero_value_types(&sig.results),
+                    func.name
+                );
+            }
+            HostRuntime::Wasmtime => {
+                let module = self.wasm_import_module.unwrap();
+                uwriteln!(
+                    register,
+                    "if err := linker.FuncNew(\"{module}\", \"{}\", wasmtime.NewFuncType({}, {}), func(caller *wasmtime.Caller, args []wasmtime.Val) (_ []wasmtime.Val, trap *wasmtime.Trap) {{
+                        defer catchTrap(&trap)",
+                    func.name,
+                    wasmtime_value_types(&sig.params),
+                    wasmtime_value_types(&sig.results),
+                );
+                if needs_guest {
+                    uwriteln!(
+                        register,
+                        "guest := &guest{{store: caller, export: caller.GetExport}}"
+                    );
+                    register.push_str(&self.guest_memory());
+                }
+                register.push_str(&src);
+                uwriteln!(
+                    register,
+                    "}}); err != nil {{
+                        return err
+                    }}"
+                );
+            }
+        }
+
+        self.export_funcs.push((interface_method_decl, register));
+    }
+
+    /// Prints the Go interface the embedder implements for the imports of
+    /// this interface along with the function registering it with a runtime.
+    pub(crate) fn host_finish_imports(&mut self) {
+        if self.export_funcs.is_empty() {
+            return;
+        }
+        let interface_name = self.namespace();
+        let module = self.wasm_import_module.unwrap();
+
+        self.print_export_interface();
+        self.print_host_import_table();
+        let methods = self
+            .export_funcs
+            .iter()
+            .filter(|(decl, _)| !decl.is_empty())
+            .map(|(decl, _)| decl.clone())
+            .collect();
+        self.gen
+            .host_imports
+            .push((interface_name.clone(), methods));
+        match self.gen.opts.host_runtime {
+            HostRuntime::Wazero => {
+                uwriteln!(
+                    self.src,
+                    "
+                    // `Add{interface_name}ToRuntime` instantiates the host module `{module}`
+                    // in the runtime, dispatching the guest's imports to `impl`.
+                    // This function needs to be called before the guest is instantiated.
+                    func Add{interface_name}ToRuntime(ctx context.Context, r wazero.Runtime, impl {interface_name}) error {{
+                        builder := r.NewHostModuleBuilder(\"{module}\")"
+                );
+                for (_, register) in mem::take(&mut self.export_funcs) {
+                    self.src.push_str(&register);
+                }
+                uwriteln!(
+                    self.src,
+                    "_, err := builder.Instantiate(ctx)
+                        return err
+                    }}
+                    "
+                );
+            }
+            HostRuntime::Wasmtime => {
+                uwriteln!(
+                    self.src,
+                    "
+                    // `Add{interface_name}ToLinker` defines the functions of `{module}`
+                    // in the linker, dispatching the guest's imports to `impl`.
+                    // This function needs to be called before the guest is instantiated.
+                    func Add{interface_name}ToLinker(linker *wasmtime.Linker, impl {interface_name}) error {{"
+                );
+                for (_, register) in mem::take(&mut self.export_funcs) {
+                    self.src.push_str(&register);
+                }
+                uwriteln!(
+                    self.src,
+                    "return nil
+                    }}
+                    "
+                );
+            }
+        }
+    }
+
+    /// Generates a method on the world's instance calling a function exported
+    /// by the guest.
+    pub(crate) fn host_export(&mut self, func: &Function) {
+        if self.skips(func) {
+            return;
+        }
+        let module = self
+            .interface
+            .map(|(_, key)| self.resolve.name_world_key(key));
+        let core_name = func.legacy_core_export_name(module.as_deref()).to_string();
+        let method = format!("{}{}", self.namespace(), self.func_name(func));
+        let world = self.gen.world.to_upper_camel_case();
+
+        let mut bindgen = FunctionBindgen::new(self, func, core_name);
+        let mut params = String::new();
+        for (name, ty) in func.params.iter() {
+            let name = bindgen.locals.tmp(&local_name(&name.to_snake_case()));
+            let ty = bindgen.interface.get_ty(ty);
+            uwrite!(params, ", {name} {ty}");
+            bindgen.params.push(name);
+        }
+        let mut results = String::new();
+        let mut result_names = Vec::new();
+        for (i, ty) in func.results.iter_types().enumerate() {
+            let name = bindgen.locals.tmp(&format!("result{i}"));
+            let ty = bindgen.interface.get_ty(ty);
+            uwrite!(results, "{name} {ty}, ");
+            result_names.push(name);
+        }
+        let mut args = bindgen.params.join(", ");
+        abi::call(
+            bindgen.interface.resolve,
+            AbiVariant::GuestExport,
+            LiftLower::LowerArgsLiftResults,
+            func,
+            &mut bindgen,
+            false,
+        );
+        let FunctionBindgen {
+            src, needs_guest, ..
+        } = bindgen;
+
+        let (params, guest) = match self.gen.opts.host_runtime {
+            HostRuntime::Wazero => (format!("ctx context.Context{params}"), "i.guest(ctx)"),
+            HostRuntime::Wasmtime => (params.trim_start_matches(", ").to_string(), "i.guest()"),
+        };
+        if let HostRuntime::Wazero = self.gen.opts.host_runtime {
+            args = if args.is_empty() {
+                "ctx".to_string()
+            } else {
+                format!("ctx, {args}")
+            };
+        }
+        let decl = format!("{}({params}) ({results}err error)", self.func_name(func));
+        self.host_per_call_method(&decl, &method, &args, &result_names);
+        self.host_client_method(decl, &method, &args);
+        self.src.push_str(&self.func_provenance(func));
+        uwriteln!(
+            self.src,
+            "// `{method}` calls the `{name}` function exported by the guest.",
+            name = func.name,
+        );
+        let name = if self.gen.opts.profiling {
+            self.host_profiled_export(func, &method, &params, &results, &result_names, &args);
+            format!("cabi{method}")
+        } else {
+            method
+        };
+        uwriteln!(
+            self.src,
+            "func (i *{world}Instance) {name}({params}) ({results}err error) {{
+                defer catchFault(&err)"
+        );
+        if needs_guest {
+            uwriteln!(self.src, "guest := {guest}");
+            self.src.push_str(&self.guest_memory());
+        }
+        self.src.push_str(&src);
+        uwriteln!(self.src, "}}\n");
+    }
+}
+
+impl TinyGo {
+    /// Rejects the worlds using types the host bindings can't lift and lower
+    /// yet, naming the first of them, before any code is generated.
+    pub(crate) fn check_host_types(&self, resolve: &Resolve, world: WorldId) -> Result<()> {
+        if !self.opts.host {
+            return Ok(());
+        }
+        let mut live = LiveTypes::default();
+        live.add_world(resolve, world);
+        for id in live.iter() {
+            let ty = &resolve.types[id];
+            let (kind, anonymous) = match &ty.kind {
+                TypeDefKind::Resource | TypeDefKind::Handle(_) => ("resources", "a handle"),
+                TypeDefKind::Future(_) => ("futures", "a future"),
+                TypeDefKind::Stream(_) => ("streams", "a stream"),
+                TypeDefKind::ErrorContext => ("error contexts", "an error context"),
+                _ => continue,
+            };
+            let what = match &ty.name {
+                Some(name) => format!("`{name}`"),
+                None => anonymous.to_string(),
+            };
+            let owner = match ty.owner {
+                TypeOwner::Interface(id) => resolve.interfaces[id].name.clone(),
+                TypeOwner::World(id) => Some(resolve.worlds[id].name.clone()),
+                TypeOwner::None => None,
+            };
+            let owner = owner
+                .map(|owner| format!(" in `{owner}`"))
+                .unwrap_or_default();
+            bail!("{kind} are not yet supported by the Go host generator, found {what}{owner}");
+        }
+        Ok(())
+    }
+
+    /// Assembles the host bindings for the world into `files`.
+    pub(crate) fn finish_host(&mut self, files: &mut Files) {
+        let src = mem::take(&mut self.src);
+        wit_bindgen_core::generated_preamble(&mut self.src, env!("CARGO_PKG_VERSION"));
+        self.print_stamp();
+        let snake = self.package_name();
+        uwriteln!(self.src, "package {snake}\n");
+        let runtime_import = self.generate_types(snake, files);
+        if let Some(runtime_import) = runtime_import {
+            self.src.push_str(&runtime_import);
+        }
+        match self.opts.host_runtime {
+            HostRuntime::Wazero => self.wazero_instance(),
+            HostRuntime::Wasmtime => self.wasmtime_instance(),
+        }
+        if self.opts.string_transcoder {
+            self.src.push_str(transcode::STRING_TRANSCODER);
+        }
+        self.print_world_hash();
+        self.src.push_str(&src);
+        self.print_add_imports();
+
+        let world_snake = self.world.to_snake_case();
+
+        if self.opts.gofmt {
+            self.gofmt();
+        }
+        files.push(&format!("{world_snake}.go"), self.src.as_bytes());
+    }
+
+    /// Prints the function registering a single Go value implementing the
+    /// interfaces of all the imports, such as a struct with a method per
+    /// imported function, so that a host implementing many interfaces
+    /// doesn't need to register each of them.
+    ///
+    /// The methods of the value are checked with type assertions against
+    /// the generated interfaces, so that it's dispatched to as directly as
+    /// if it were registered interface by interface.
+    fn print_add_imports(&mut self) {
+        if self.host_imports.is_empty() {
+            return;
+        }
+        let world = self.world.to_upper_camel_case();
+        let (suffix, params, args, target) = match self.opts.host_runtime {
+            HostRuntime::Wazero => (
+                "ToRuntime",
+                "ctx context.Context, r wazero.Runtime, ",
+                "ctx, r, ",
+                "runtime",
+            ),
+            HostRuntime::Wasmtime => (
+                "ToLinker",
+                "linker *wasmtime.Linker, ",
+                "linker, ",
+                "linker",
+            ),
+        };
+        let mut checks = String::new();
+        let mut adds = String::new();
+        for (interface, methods) in mem::take(&mut self.host_imports) {
+            for method in methods {
+                let method_name = &method[..method.find('(').unwrap()];
+                uwriteln!(
+                    checks,
+                    "if _, ok := impl.(interface{{ {method} }}); !ok {{
+                        missing = append(missing, \"{interface}.{method_name}\")
+                    }}"
+                );
+            }
+            uwriteln!(
+                adds,
+                "if err := Add{interface}{suffix}({args}impl.({interface})); err != nil {{
+                    return err
+                }}"
+            );
+        }
+        uwriteln!(
+            self.src,
+            "// `Add{world}Imports{suffix}` adds all the imports of the guest to the {target},
+            // dispatching them to the methods of `impl`, which has to implement the
+            // Go interfaces of all the imports, e.g. a single struct with a method
+            // per imported function. It reports the methods `impl` lacks before
+            // adding any import.
+            // This function needs to be called before the guest is instantiated.
+            func Add{world}Imports{suffix}({params}impl any) error {{
+                var missing []string
+                {checks}if len(missing) > 0 {{
+                    return fmt.Errorf(\"%T does not implement %v\", impl, missing)
+                }}
+                {adds}return nil
+            }}
+            "
+        );
+    }
+
+    fn wazero_instance(&mut self) {
+        // the traps are classified by their message
+        self.import_requirements.needs_strings_import = true;
+        self.src
+            .push_str("import (\n\"context\"\n\"errors\"\n\"fmt\"\n");
+        if self.import_requirements.needs_math_import {
+            self.src.push_str("\"math\"\n");
+        }
+        if self.import_requirements.needs_pprof_import {
+            self.src.push_str("\"runtime/pprof\"\n");
+        }
+        if self.import_requirements.needs_strings_import {
+            self.src.push_str("\"strings\"\n");
+        }
+        self.src.push_str(
+            "\n\"github.com/tetratelabs/wazero\"\n\"github.com/tetratelabs/wazero/api\"\n)\n\n",
+        );
+
+        let world = self.world.to_upper_camel_case();
+        let name = &self.world;
+        uwriteln!(
+            self.src,
+            "// `{world}Instance` is an instantiated guest module implementing the `{name}` world.
+            type {world}Instance struct {{
+                module  api.Module
+                trapped bool
+            }}
+
+            // `Instantiate{world}` instantiates the compiled guest module.
+            // The host modules for the world's imports need to be added to the
+            // runtime beforehand.
+            func Instantiate{world}(ctx context.Context, r wazero.Runtime, compiled wazero.CompiledModule, config wazero.ModuleConfig) (*{world}Instance, error) {{
+                module, err := r.InstantiateModule(ctx, compiled, config)
+                if err != nil {{
+                    return nil, err
+                }}
+                return &{world}Instance{{module: module}}, nil
+            }}
+
+            // `Module` returns the underlying guest module.
+            func (i *{world}Instance) Module() api.Module {{
+                return i.module
+            }}
+
+            // `Shutdown` calls the shutdown hook of the guest, if it exports one as
+            // `_shutdown`, so that it can release its state before being closed.
+            func (i *{world}Instance) Shutdown(ctx context.Context) error {{
+                f := i.module.ExportedFunction("_shutdown")
+                if f == nil {{
+                    return nil
+                }}
+                _, err := f.Call(ctx)
+                return err
+            }}
+
+            // `Close` closes the guest module.
+            func (i *{world}Instance) Close(ctx context.Context) error {{
+                return i.module.Close(ctx)
+            }}
+
+            func (i *{world}Instance) guest(ctx context.Context) *guest {{
+                return &guest{{ctx: ctx, module: i.module}}
+            }}
+
+            func (i *{world}Instance) export(name string) api.Function {{
+                f := i.module.ExportedFunction(name)
+                if f == nil {{
+                    fault(\"guest does not export %q\", name)
+                }}
+                return f
+            }}
+            "
+        );
+        self.src.push_str(ABI_ERROR);
+        self.src.push_str(traps::TRAP_ERROR);
+        self.src.push_str(traps::WAZERO_TRAP);
+        if self.import_requirements.needs_canonical_nans {
+            self.src.push_str(nans::NAN_HELPERS);
+        }
+        self.src.push_str(WAZERO_RUNTIME);
+        if self.opts.cancellation {
+            self.src.push_str(cancel::WAZERO_CANCEL);
+        }
+        if !self.opts.optional_imports.is_empty() {
+            self.src.push_str(optional::WAZERO_AVAILABILITY);
+        }
+        self.print_pool();
+        self.print_per_call();
+        self.print_self_test_host();
+    }
+
+    fn wasmtime_instance(&mut self) {
+        // the report of the self-test is split into lines
+        if self.opts.self_test {
+            self.import_requirements.needs_strings_import = true;
+        }
+        // the exports are labeled with a background context
+        let pprof = self.import_requirements.needs_pprof_import;
+        self.src.push_str("import (\n");
+        if pprof {
+            self.src.push_str("\"context\"\n");
+        }
+        self.src
+            .push_str("\"encoding/binary\"\n\"errors\"\n\"fmt\"\n\"math\"\n");
+        if pprof {
+            self.src.push_str("\"runtime/pprof\"\n");
+        }
+        if self.import_requirements.needs_strings_import {
+            self.src.push_str("\"strings\"\n");
+        }
+        self.src
+            .push_str("\n\"github.com/bytecodealliance/wasmtime-go/v25\"\n)\n\n");
+
+        let world = self.world.to_upper_camel_case();
+        let name = &self.world;
+        uwriteln!(
+            self.src,
+            "// `{world}Instance` is an instantiated guest module implementing the `{name}` world.
+            type {world}Instance struct {{
+                store    wasmtime.Storelike
+                instance *wasmtime.Instance
+                trapped  bool
+            }}
+
+            // `Instantiate{world}` instantiates the guest module in `store`.
+            // The functions for the world's imports need to be defined in the
+            // linker beforehand.
+            func Instantiate{world}(store wasmtime.Storelike, linker *wasmtime.Linker, module *wasmtime.Module) (*{world}Instance, error) {{
+                instance, err := linker.Instantiate(store, module)
+                if err != nil {{
+                    return nil, err
+                }}
+                return &{world}Instance{{store: store, instance: instance}}, nil
+            }}
+
+            // `Instance` returns the underlying guest instance.
+            func (i *{world}Instance) Instance() *wasmtime.Instance {{
+                return i.instance
+            }}
+
+            // `Shutdown` calls the shutdown hook of the guest, if it exports one as
+            // `_shutdown`, so that it can release its state before being dropped.
+            func (i *{world}Instance) Shutdown() error {{
+                f := i.instance.GetFunc(i.store, "_shutdown")
+                if f == nil {{
+                    return nil
+                }}
+                _, err := f.Call(i.store)
+                return err
+            }}
+
+            func (i *{world}Instance) guest() *guest {{
+                return &guest{{
+                    store: i.store,
+                    export: func(name string) *wasmtime.Extern {{
+                        return i.instance.GetExport(i.store, name)
+                    }},
+                }}
+            }}
+            "
+        );
+        self.src.push_str(ABI_ERROR);
+        self.src.push_str(traps::TRAP_ERROR);
+        self.src.push_str(traps::WASMTIME_TRAP);
+        if self.import_requirements.needs_canonical_nans {
+            self.src.push_str(nans::NAN_HELPERS);
+        }
+        self.src.push_str(WASMTIME_RUNTIME);
+        if self.opts.cancellation {
+            self.src.push_str(cancel::WASMTIME_CANCEL);
+        }
+        if !self.opts.optional_imports.is_empty() {
+            self.src.push_str(optional::WASMTIME_AVAILABILITY);
+        }
+        self.print_pool();
+        self.print_per_call();
+        self.print_self_test_host();
+    }
+}
+
+/// Error handling shared by the generated host functions of all runtimes.
+const ABI_ERROR: &str = r#"
+// `ABIError` reports a violation of the canonical ABI detected while exchanging
+// values with a guest, such as an out-of-bounds memory access.
+type ABIError struct {
+	msg string
+}
+
+func (e *ABIError) Error() string {
+	return e.msg
+}
+
+func fault(format string, args ...any) {
+	panic(&ABIError{msg: fmt.Sprintf(format, args...)})
+}
+
+// checkChar faults unless `r` is a Unicode scalar value, which is all a
+// `char` may be.
+func checkChar(r rune) rune {
+	if r < 0 || r > 0x10ffff || (r >= 0xd800 && r < 0xe000) {
+		fault("invalid char %#x", r)
+	}
+	return r
+}
+
+// catchFault converts an ABI violation raised while lifting or lowering
+// values into an error returned from the generated function.
+func catchFault(err *error) {
+	if r := recover(); r != nil {
+		if fault, ok := r.(*ABIError); ok {
+			*err = fault
+			return
+		}
+		panic(r)
+	}
+}
+"#;
+
+/// Guest memory access for bindings targeting wazero.
+const WAZERO_RUNTIME: &str = r#"
+// guest provides access to the linear memory and allocator of a guest module.
+type guest struct {
+	ctx    context.Context
+	module api.Module
+	// the exports of the memory and allocator of the values exchanged with
+	// the guest, if not the default ones
+	memoryName, reallocName string
+}
+
+func (g *guest) memory() api.Memory {
+	memory := g.module.Memory()
+	if g.memoryName != "" {
+		memory = g.module.ExportedMemory(g.memoryName)
+	}
+	if memory == nil {
+		fault("guest does not export a memory")
+	}
+	return memory
+}
+
+func (g *guest) outOfBounds(ptr uint32, size uint32) {
+	fault("out of bounds memory access of %d bytes at %d", size, ptr)
+}
+
+func (g *guest) loadU8(ptr uint32) uint8 {
+	v, ok := g.memory().ReadByte(ptr)
+	if !ok {
+		g.outOfBounds(ptr, 1)
+	}
+	return v
+}
+
+func (g *guest) loadU16(ptr uint32) uint16 {
+	v, ok := g.memory().ReadUint16Le(ptr)
+	if !ok {
+		g.outOfBounds(ptr, 2)
+	}
+	return v
+}
+
+func (g *guest) loadU32(ptr uint32) uint32 {
+	v, ok := g.memory().ReadUint32Le(ptr)
+	if !ok {
+		g.outOfBounds(ptr, 4)
+	}
+	return v
+}
+
+func (g *guest) loadU64(ptr uint32) uint64 {
+	v, ok := g.memory().ReadUint64Le(ptr)
+	if !ok {
+		g.outOfBounds(ptr, 8)
+	}
+	return v
+}
+
+func (g *guest) loadF32(ptr uint32) float32 {
+	v, ok := g.memory().ReadFloat32Le(ptr)
+	if !ok {
+		g.outOfBounds(ptr, 4)
+	}
+	return v
+}
+
+func (g *guest) loadF64(ptr uint32) float64 {
+	v, ok := g.memory().ReadFloat64Le(ptr)
+	if !ok {
+		g.outOfBounds(ptr, 8)
+	}
+	return v
+}
+
+func (g *guest) loadBytes(ptr uint32, length uint32) []byte {
+	v, ok := g.memory().Read(ptr, length)
+	if !ok {
+		g.outOfBounds(ptr, length)
+	}
+	return append([]byte(nil), v...)
+}
+
+func (g *guest) loadString(ptr uint32, length uint32) string {
+	v, ok := g.memory().Read(ptr, length)
+	if !ok {
+		g.outOfBounds(ptr, length)
+	}
+	return string(v)
+}
+
+// checkList faults unless the `length` elements of `size` bytes at `ptr` lie
+// within the guest's memory, so a list is never allocated on the host from a
+// length the guest made up.
+func (g *guest) checkList(ptr uint32, length uint32, size uint32) {
+	if uint64(ptr)+uint64(length)*uint64(size) > uint64(g.memory().Size()) {
+		g.outOfBounds(ptr, length*size)
+	}
+}
+
+func (g *guest) storeU8(ptr uint32, v uint8) {
+	if !g.memory().WriteByte(ptr, v) {
+		g.outOfBounds(ptr, 1)
+	}
+}
+
+func (g *guest) storeU16(ptr uint32, v uint16) {
+	if !g.memory().WriteUint16Le(ptr, v) {
+		g.outOfBounds(ptr, 2)
+	}
+}
+
+func (g *guest) storeU32(ptr uint32, v uint32) {
+	if !g.memory().WriteUint32Le(ptr, v) {
+		g.outOfBounds(ptr, 4)
+	}
+}
+
+func (g *guest) storeU64(ptr uint32, v uint64) {
+	if !g.memory().WriteUint64Le(ptr, v) {
+		g.outOfBounds(ptr, 8)
+	}
+}
+
+func (g *guest) storeF32(ptr uint32, v float32) {
+	if !g.memory().WriteFloat32Le(ptr, v) {
+		g.outOfBounds(ptr, 4)
+	}
+}
+
+func (g *guest) storeF64(ptr uint32, v float64) {
+	if !g.memory().WriteFloat64Le(ptr, v) {
+		g.outOfBounds(ptr, 8)
+	}
+}
+
+// alloc allocates memory in the guest through its `cabi_realloc` export.
+func (g *guest) alloc(size uint32, align uint32) uint32 {
+	if size == 0 {
+		return align
+	}
+	name := "cabi_realloc"
+	if g.reallocName != "" {
+		name = g.reallocName
+	}
+	realloc := g.module.ExportedFunction(name)
+	if realloc == nil {
+		fault("guest does not export %s", name)
+	}
+	results, err := realloc.Call(g.ctx, 0, 0, uint64(align), uint64(size))
+	if err != nil {
+		fault("%s failed: %v", name, err)
+	}
+	return api.DecodeU32(results[0])
+}
+
+func (g *guest) storeBytes(v []byte) (uint32, uint32) {
+	ptr := g.alloc(uint32(len(v)), 1)
+	if !g.memory().Write(ptr, v) {
+		g.outOfBounds(ptr, uint32(len(v)))
+	}
+	return ptr, uint32(len(v))
+}
+
+func (g *guest) storeString(v string) (uint32, uint32) {
+	ptr := g.alloc(uint32(len(v)), 1)
+	if !g.memory().WriteString(ptr, v) {
+		g.outOfBounds(ptr, uint32(len(v)))
+	}
+	return ptr, uint32(len(v))
+}
+
+"#;
+
+/// Guest memory access for bindings targeting wasmtime-go.
+const WASMTIME_RUNTIME: &str = r#"
+// catchTrap converts an ABI violation raised while lifting or lowering
+// values in a host function into a trap of the guest.
+func catchTrap(trap **wasmtime.Trap) {
+	if r := recover(); r != nil {
+		if fault, ok := r.(*ABIError); ok {
+			*trap = wasmtime.NewTrap(fault.Error())
+			return
+		}
+		panic(r)
+	}
+}
+
+func valTypes(kinds ...wasmtime.ValKind) []*wasmtime.ValType {
+	types := make([]*wasmtime.ValType, len(kinds))
+	for i, kind := range kinds {
+		types[i] = wasmtime.NewValType(kind)
+	}
+	return types
+}
+
+// guest provides access to the linear memory and exports of a guest instance.
+type guest struct {
+	store  wasmtime.Storelike
+	export func(name string) *wasmtime.Extern
+	// the exports of the memory and allocator of the values exchanged with
+	// the guest, if not the default ones
+	memoryName, reallocName string
+}
+
+func (g *guest) function(name string) *wasmtime.Func {
+	if export := g.export(name); export != nil {
+		if f := export.Func(); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+func (g *guest) call(name string, args ...any) ([]any, error) {
+	f := g.function(name)
+	if f == nil {
+		fault("guest does not export %q", name)
+	}
+	result, err := f.Call(g.store, args...)
+	if err != nil {
+		return nil, err
+	}
+	switch result := result.(type) {
+	case nil:
+		return nil, nil
+	case []wasmtime.Val:
+		raw := make([]any, len(result))
+		for i, v := range result {
+			raw[i] = v.Get()
+		}
+		return raw, nil
+	default:
+		return []any{result}, nil
+	}
+}
+
+func (g *guest) postReturn(name string, raw ...any) error {
+	f := g.function(name)
+	if f == nil {
+		return nil
+	}
+	_, err := f.Call(g.store, raw...)
+	return err
+}
+
+func (g *guest) memory(ptr uint32, size uint32) []byte {
+	name := "memory"
+	if g.memoryName != "" {
+		name = g.memoryName
+	}
+	var memory *wasmtime.Memory
+	if export := g.export(name); export != nil {
+		memory = export.Memory()
+	}
+	if memory == nil {
+		fault("guest does not export a memory")
+	}
+	data := memory.UnsafeData(g.store)
+	if uint64(ptr)+uint64(size) > uint64(len(data)) {
+		fault("out of bounds memory access of %d bytes at %d", size, ptr)
+	}
+	return data[ptr : ptr+size]
+}
+
+func (g *guest) loadU8(ptr uint32) uint8 {
+	return g.memory(ptr, 1)[0]
+}
+
+func (g *guest) loadU16(ptr uint32) uint16 {
+	return binary.LittleEndian.Uint16(g.memory(ptr, 2))
+}
+
+func (g *guest) loadU32(ptr uint32) uint32 {
+	return binary.LittleEndian.Uint32(g.memory(ptr, 4))
+}
+
+func (g *guest) loadU64(ptr uint32) uint64 {
+	return binary.LittleEndian.Uint64(g.memory(ptr, 8))
+}
+
+func (g *guest) loadF32(ptr uint32) float32 {
+	return math.Float32frombits(g.loadU32(ptr))
+}
+
+func (g *guest) loadF64(ptr uint32) float64 {
+	return math.Float64frombits(g.loadU64(ptr))
+}
+
+func (g *guest) loadBytes(ptr uint32, length uint32) []byte {
+	return append([]byte(nil), g.memory(ptr, length)...)
+}
+
+func (g *guest) loadString(ptr uint32, length uint32) string {
+	return string(g.memory(ptr, length))
+}
+
+// checkList faults unless the `length` elements of `size` bytes at `ptr` lie
+// within the guest's memory, so a list is never allocated on the host from a
+// length the guest made up.
+func (g *guest) checkList(ptr uint32, length uint32, size uint32) {
+	total := uint64(length) * uint64(size)
+	if total > math.MaxUint32 {
+		fault("out of bounds list of %d elements of %d bytes at %d", length, size, ptr)
+	}
+	g.memory(ptr, uint32(total))
+}
+
+func (g *guest) storeU8(ptr uint32, v uint8) {
+	g.memory(ptr, 1)[0] = v
+}
+
+func (g *guest) storeU16(ptr uint32, v uint16) {
+	binary.LittleEndian.PutUint16(g.memory(ptr, 2), v)
+}
+
+func (g *guest) storeU32(ptr uint32, v uint32) {
+	binary.LittleEndian.PutUint32(g.memory(ptr, 4), v)
+}
+
+func (g *guest) storeU64(ptr uint32, v uint64) {
+	binary.LittleEndian.PutUint64(g.memory(ptr, 8), v)
+}
+
+func (g *guest) storeF32(ptr uint32, v float32) {
+	g.storeU32(ptr, math.Float32bits(v))
+}
+
+func (g *guest) storeF64(ptr uint32, v float64) {
+	g.storeU64(ptr, math.Float64bits(v))
+}
+
+// alloc allocates memory in the guest through its `cabi_realloc` export.
+func (g *guest) alloc(size uint32, align uint32) uint32 {
+	if size == 0 {
+		return align
+	}
+	name := "cabi_realloc"
+	if g.reallocName != "" {
+		name = g.reallocName
+	}
+	results, err := g.call(name, int32(0), int32(0), int32(align), int32(size))
+	if err != nil {
+		fault("%s failed: %v", name, err)
+	}
+	return uint32(results[0].(int32))
+}
+
+func (g *guest) storeBytes(v []byte) (uint32, uint32) {
+	ptr := g.alloc(uint32(len(v)), 1)
+	copy(g.memory(ptr, uint32(len(v))), v)
+	return ptr, uint32(len(v))
+}
+
+func (g *guest) storeString(v string) (uint32, uint32) {
+	ptr := g.alloc(uint32(len(v)), 1)
+	copy(g.memory(ptr, uint32(len(v))), v)
+	return ptr, uint32(len(v))
+}
+
+"#;
+
+/// Returns the address expression `base + offset`.
+fn address(base: &str, offset: i32) -> String {
+    if offset == 0 {
+        base.to_string()
+    } else {
+        format!("{base} + {offset}")
+    }
+}
+
+/// Returns whether the identifier `ident` is referenced in `src`.
+fn mentions(src: &str, ident: &str) -> bool {
+    let is_ident = |c: char| c.is_alphanumeric() || c == '_';
+    src.match_indices(ident).any(|(i, _)| {
+        let before = src[..i].chars().next_back();
+        let after = src[i + ident.len()..].chars().next();
+        !before.is_some_and(is_ident) && !after.is_some_and(is_ident)
+    })
+}
+
+/// The Go type used for a core wasm value.
+fn wasm_go_type(ty: WasmType) -> &'static str {
+    match ty {
+        WasmType::I32 => "int32",
+        WasmType::I64 | WasmType::PointerOrI64 => "int64",
+        WasmType::F32 => "float32",
+        WasmType::F64 => "float64",
+        WasmType::Pointer | WasmType::Length => "uint32",
+    }
+}
+
+impl HostRuntime {
+    /// Converts a core wasm value into an argument of a guest export.
+    fn encode_arg(self, ty: WasmType, value: &str) -> String {
+        match self {
+            HostRuntime::Wazero => format!("api.Encode{}({value})", ty_suffix(ty)),
+            HostRuntime::Wasmtime => match ty {
+                WasmType::Pointer | WasmType::Length => format!("int32({value})"),
+                _ => value.to_string(),
+            },
+        }
+    }
+
+    /// Converts the `nth` result of a guest export into a core wasm value.
+    fn decode_result(self, ty: WasmType, nth: usize) -> String {
+        match (self, ty) {
+            (HostRuntime::Wazero, WasmType::I64 | WasmType::PointerOrI64) => {
+                format!("int64(raw[{nth}])")
+            }
+            (HostRuntime::Wazero, _) => format!("api.Decode{}(raw[{nth}])", ty_suffix(ty)),
+            (HostRuntime::Wasmtime, WasmType::Pointer | WasmType::Length) => {
+                format!("uint32(raw[{nth}].(int32))")
+            }
+            (HostRuntime::Wasmtime, _) => format!("raw[{nth}].({})", wasm_go_type(ty)),
+        }
+    }
+
+    /// Converts the `nth` parameter of a host function into a core wasm value.
+    fn decode_param(self, ty: WasmType, nth: usize) -> String {
+        match (self, ty) {
+            (HostRuntime::Wazero, WasmType::I64 | WasmType::PointerOrI64) => {
+                format!("int64(stack[{nth}])")
+            }
+            (HostRuntime::Wazero, _) => format!("api.Decode{}(stack[{nth}])", ty_suffix(ty)),
+            (HostRuntime::Wasmtime, WasmType::Pointer | WasmType::Length) => {
+                format!("uint32(args[{nth}].I32())")
+            }
+            (HostRuntime::Wasmtime, _) => format!("args[{nth}].{}()", ty_suffix(ty)),
+        }
+    }
+}
+
+/// The suffix of the runtime APIs handling a core wasm value, such as
+/// `api.EncodeI32` for wazero or `Val.I32` for wasmtime-go.
+fn ty_suffix(ty: WasmType) -> &'static str {
+    match ty {
+        WasmType::I32 => "I32",
+        WasmType::I64 | WasmType::PointerOrI64 => "I64",
+        WasmType::F32 => "F32",
+        WasmType::F64 => "F64",
+        WasmType::Pointer | WasmType::Length => "U32",
+    }
+}
+
+fn wasmtime_val(ty: WasmType, value: &str) -> String {
+    match ty {
+        WasmType::Pointer | WasmType::Length => format!("wasmtime.ValI32(int32({value}))"),
+        _ => format!("wasmtime.Val{}({value})", ty_suffix(ty)),
+    }
+}
+
+fn wazero_value_types(tys: &[WasmType]) -> String {
+    let tys = tys
+        .iter()
+        .map(|ty| match ty {
+            WasmType::I32 | WasmType::Pointer | WasmType::Length => "api.ValueTypeI32",
+            WasmType::I64 | WasmType::PointerOrI64 => "api.ValueTypeI64",
+            WasmType::F32 => "api.ValueTypeF32",
+            WasmType::F64 => "api.ValueTypeF64",
+        })
+        .collect::<Vec<_>>()
+        .join(", ");
+    format!("[]api.ValueType{{{tys}}}")
+}
+
+fn wasmtime_value_types(tys: &[WasmType]) -> String {
+    let tys = tys
+        .iter()
+        .map(|ty| match ty {
+            WasmType::I32 | WasmType::Pointer | WasmType::Length => "wasmtime.KindI32",
+            WasmType::I64 | WasmType::PointerOrI64 => "wasmtime.KindI64",
+            WasmType::F32 => "wasmtime.KindF32",
+            WasmType::F64 => "wasmtime.KindF64",
+        })
+        .collect::<Vec<_>>()
+        .join(", ");
+    format!("valTypes({tys})")
+}
+
+fn needs_math(cast: &Bitcast) -> bool {
+    match cast {
+        Bitcast::F32ToI32
+        | Bitcast::F64ToI64
+        | Bitcast::F32ToI64
+        | Bitcast::I32ToF32
+        | Bitcast::I64ToF64
+        | Bitcast::I64ToF32 => true,
+        Bitcast::Sequence(sequence) => sequence.iter().any(needs_math),
+        _ => false,
+    }
+}
+
+fn perform_cast(op: &str, cast: &Bitcast) -> String {
+    match cast {
+        Bitcast::I32ToF32 => format!("math.Float32frombits(uint32({op}))"),
+        Bitcast::F32ToI32 => format!("int32(math.Float32bits({op}))"),
+        Bitcast::I64ToF64 => format!("math.Float64frombits(uint64({op}))"),
+        Bitcast::F64ToI64 => format!("int64(math.Float64bits({op}))"),
+        Bitcast::F32ToI64 => format!("int64(math.Float32bits({op}))"),
+        Bitcast::I64ToF32 => format!("math.Float32frombits(uint32({op}))"),
+        Bitcast::I32ToI64 => format!("int64(uint32({op}))"),
+        Bitcast::I64ToI32 | Bitcast::LToI32 | Bitcast::PToI32 => format!("int32({op})"),
+        Bitcast::I64ToL | Bitcast::I32ToL | Bitcast::I32ToP | Bitcast::P64ToP => {
+            format!("uint32({op})")
+        }
+        Bitcast::LToI64 | Bitcast::PToP64 => format!("int64({op})"),
+        Bitcast::P64ToI64 | Bitcast::I64ToP64 | Bitcast::PToL | Bitcast::LToP | Bitcast::None => {
+            op.to_string()
+        }
+        Bitcast::Sequence(sequence) => {
+            let [first, second] = &**sequence;
+            perform_cast(&perform_cast(op, first), second)
+        }
+    }
+}
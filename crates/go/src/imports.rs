@@ -13,31 +13,176 @@ pub(crate) struct ImportRequirements {
     // whether the generated code needs to import "fmt"
     pub(crate) needs_fmt_import: bool,
 
+    // whether the generated code needs to import "context"
+    pub(crate) needs_context_import: bool,
+
+    // whether the generated code needs to import "encoding/binary"
+    pub(crate) needs_binary_import: bool,
+
+    // whether the generated code needs to import "encoding/json"
+    pub(crate) needs_json_import: bool,
+
+    // whether options and results implement `json.Marshaler`
+    pub(crate) result_option_json: bool,
+
+    // whether the strings used as the payload of `ResultError` are `[]byte`
+    pub(crate) result_error_bytes: bool,
+
+    // whether the generated code needs to import "time"
+    pub(crate) needs_time_import: bool,
+
+    // whether the generated code needs to import "io"
+    pub(crate) needs_io_import: bool,
+
     // whether the generated code needs to import "sync"
     pub(crate) needs_sync_import: bool,
 
+    // whether the generated code needs to import "runtime"
+    pub(crate) needs_runtime_import: bool,
+
+    // whether the generated code maps results to errors with `ResultError`
+    pub(crate) needs_result_error: bool,
+
+    // whether the generated host code needs to import "math"
+    pub(crate) needs_math_import: bool,
+
+    // whether the generated code needs to import "strings"
+    pub(crate) needs_strings_import: bool,
+
+    // whether the generated code needs to import "unicode/utf8"
+    pub(crate) needs_utf8_import: bool,
+
+    // whether the generated code transcodes strings from and to UTF-16
+    pub(crate) needs_utf16: bool,
+
+    // whether the generated code transcodes strings from and to latin1+utf16
+    pub(crate) needs_compact_utf16: bool,
+
+    // whether the generated code maps `list<u8>` to `[]byte`, which gets
+    // helpers converting it from and to strings
+    pub(crate) needs_bytes: bool,
+
+    // whether the generated code canonicalizes NaNs, which needs "math"
+    pub(crate) needs_canonical_nans: bool,
+
+    // whether the generated code uses futures, which need "errors" and "io"
+    pub(crate) needs_future: bool,
+
+    // whether the generated code uses streams, which need "errors" and "io"
+    pub(crate) needs_stream: bool,
+
+    // whether the generated code adapts WASI filesystems to `fs.FS`, which
+    // needs "io", "io/fs" and "path"
+    pub(crate) needs_fs_import: bool,
+
+    // whether the generated code needs to import "log/slog"
+    pub(crate) needs_slog_import: bool,
+
+    // whether the generated code labels the calls with "runtime/pprof"
+    pub(crate) needs_pprof_import: bool,
+
+    // whether the generated code writes to the standard error with "os"
+    pub(crate) needs_os_import: bool,
+
     pub(crate) src: Source,
 }
 
 impl ImportRequirements {
-    pub(crate) fn generate(&mut self, snake: String, files: &mut Files, file_name: String) {
+    /// Returns the packages to import, sorted as gofmt and goimports would
+    /// have them.
+    pub(crate) fn imports(&self) -> Vec<&'static str> {
+        let mut imports = Vec::new();
         if self.needs_import_unsafe {
-            self.src.push_str("import \"unsafe\"\n");
+            imports.push("unsafe");
         }
         if self.needs_fmt_import {
-            self.src.push_str("import \"fmt\"\n");
+            imports.push("fmt");
+        }
+        if self.needs_context_import {
+            imports.push("context");
+        }
+        if self.needs_binary_import {
+            imports.push("encoding/binary");
+        }
+        if self.needs_json_import {
+            imports.push("encoding/json");
+        }
+        if self.needs_slog_import {
+            imports.push("log/slog");
+        }
+        if self.needs_math_import {
+            imports.push("math");
         }
         if self.needs_sync_import {
-            self.src.push_str("import \"sync\"\n\n");
+            imports.push("sync");
+        }
+        if self.needs_os_import {
+            imports.push("os");
+        }
+        if self.needs_runtime_import {
+            imports.push("runtime");
+        }
+        if self.needs_pprof_import {
+            imports.push("runtime/pprof");
+        }
+        if self.needs_time_import {
+            imports.push("time");
+        }
+        if self.needs_io_import {
+            imports.push("io");
+        }
+        if self.needs_strings_import {
+            imports.push("strings");
+        }
+        if self.needs_utf16 {
+            imports.push("unicode/utf16");
+        }
+        if self.needs_utf8_import {
+            imports.push("unicode/utf8");
+        }
+        if self.needs_future || self.needs_stream {
+            imports.push("io");
+        }
+        if self.needs_fs_import {
+            imports.extend(["io", "io/fs", "path"]);
+        }
+        imports.sort_unstable();
+        imports.dedup();
+        imports
+    }
+
+    pub(crate) fn generate(&mut self, snake: String, files: &mut Files, file_name: String) {
+        let imports = self.imports();
+        if !imports.is_empty() {
+            self.src.push_str("import (\n");
+            for import in imports {
+                uwriteln!(self.src, "\"{import}\"");
+            }
+            self.src.push_str(")\n\n");
         }
 
         if self.needs_result_option {
             let mut result_option_src = Source::default();
+            uwriteln!(result_option_src, "package {snake}\n");
+            let mut imports = Vec::new();
+            if self.needs_result_error {
+                imports.extend(["errors", "fmt"]);
+            }
+            if self.result_option_json {
+                imports.extend(["encoding/json", "errors"]);
+            }
+            imports.sort_unstable();
+            imports.dedup();
+            if !imports.is_empty() {
+                result_option_src.push_str("import (\n");
+                for import in imports {
+                    uwriteln!(result_option_src, "\"{import}\"");
+                }
+                result_option_src.push_str(")\n\n");
+            }
             uwriteln!(
                 result_option_src,
-                "package {snake}
-
-            // inspired from https://github.com/moznion/go-optional
+                "// inspired from https://github.com/moznion/go-optional
 
             type optionKind int
 
@@ -166,7 +311,133 @@ impl ImportRequirements {
             }}
             "
             );
+            if self.needs_result_error {
+                // the strings lifted as bytes are still errors of their own
+                let (error_bytes, payload_bytes) = if self.result_error_bytes {
+                    (
+                        "if b, ok := any(e.Payload).([]byte); ok {
+                            return string(b)
+                        }\n",
+                        "case *[]byte:
+                        *p = []byte(err.Error())\n",
+                    )
+                } else {
+                    ("", "")
+                };
+                uwriteln!(
+                    result_option_src,
+                    "
+            // ResultError is the error of functions returning a `result`,
+            // wrapping the payload of the `err` case.
+            type ResultError[E any] struct {{
+                Payload E
+            }}
+
+            func (e *ResultError[E]) Error() string {{
+                {error_bytes}return fmt.Sprint(e.Payload)
+            }}
+
+            // Unwrap returns the payload if it's an error itself, as the records,
+            // variants and enums used as errors are, so that `errors.As` finds it.
+            func (e *ResultError[E]) Unwrap() error {{
+                err, _ := any(e.Payload).(error)
+                return err
+            }}
+
+            // ResultErrorPayload returns the payload of the `err` case for an error
+            // returned by an exported function. Errors other than `ResultError`
+            // are converted using their message if the payload is a string, or
+            // found in the chain of wrapped errors if the payload is an error
+            // itself.
+            func ResultErrorPayload[E any](err error) E {{
+                var resultErr *ResultError[E]
+                if errors.As(err, &resultErr) {{
+                    return resultErr.Payload
+                }}
+                for e := err; e != nil; e = errors.Unwrap(e) {{
+                    if payload, ok := any(e).(E); ok {{
+                        return payload
+                    }}
+                }}
+                var payload E
+                switch p := any(&payload).(type) {{
+                case *struct{{}}:
+                case *string:
+                    *p = err.Error()
+                {payload_bytes}default:
+                    panic(fmt.Sprintf(\"cannot convert error %q to %T\", err, payload))
+                }}
+                return payload
+            }}
+            "
+                );
+            }
+            if self.result_option_json {
+                result_option_src.push_str(RESULT_OPTION_JSON);
+            }
             files.push(&file_name, result_option_src.as_bytes());
         }
     }
 }
+
+const RESULT_OPTION_JSON: &str = r#"
+// MarshalJSON encodes None as null and Some as its value.
+func (o Option[T]) MarshalJSON() ([]byte, error) {
+	if o.kind == none {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.val)
+}
+
+// UnmarshalJSON decodes null as None and any other value as Some.
+func (o *Option[T]) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		o.Unset()
+		return nil
+	}
+	var val T
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+	o.Set(val)
+	return nil
+}
+
+// MarshalJSON encodes Ok as an object holding its value as `ok` and Err as
+// one holding its value as `err`.
+func (r Result[T, E]) MarshalJSON() ([]byte, error) {
+	if r.kind == resultErr {
+		return json.Marshal(struct {
+			Err E `json:"err"`
+		}{r.resultErr})
+	}
+	return json.Marshal(struct {
+		Ok T `json:"ok"`
+	}{r.resultOk})
+}
+
+// UnmarshalJSON decodes the result encoded by MarshalJSON.
+func (r *Result[T, E]) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if data, ok := raw["ok"]; ok {
+		var val T
+		if err := json.Unmarshal(data, &val); err != nil {
+			return err
+		}
+		r.Set(val)
+		return nil
+	}
+	if data, ok := raw["err"]; ok {
+		var val E
+		if err := json.Unmarshal(data, &val); err != nil {
+			return err
+		}
+		r.SetErr(val)
+		return nil
+	}
+	return errors.New("result has neither `ok` nor `err`")
+}
+"#;
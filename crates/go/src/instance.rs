@@ -0,0 +1,141 @@
+use std::collections::HashMap;
+use std::fmt::Write as _;
+
+use heck::{ToSnakeCase, ToUpperCamelCase};
+use wit_bindgen_core::uwriteln;
+
+use super::TinyGo;
+
+impl TinyGo {
+    /// Prints `New<World>`, which binds the implementations of all exported
+    /// interfaces at once to an instance that can be closed again, as an
+    /// alternative to the global `Set<Interface>` functions.
+    pub(crate) fn print_instance(&mut self) {
+        if self.export_interfaces.is_empty() {
+            return;
+        }
+        let world = self.world.to_upper_camel_case();
+        let var = format!("{}_instance", self.world.to_snake_case());
+        let wit_name = &self.world;
+
+        let mut fields = String::new();
+        let mut set = String::new();
+        let mut unset = String::new();
+        let mut state = String::new();
+        for (name, _) in &self.export_interfaces {
+            uwriteln!(fields, "{name} {name}");
+            uwriteln!(set, "Set{name}(exports.{name})");
+            uwriteln!(unset, "Set{name}(nil)");
+            uwriteln!(state, "{name}: state,");
+        }
+        let (constructor, bind) = if self.opts.export_state {
+            (
+                format!(
+                    "// `New{world}` binds the methods of `state` to the exports of the component,
+                    // so that the implementation carries its configuration and dependencies
+                    // in `state` rather than in package-level variables. Only one instance can
+                    // be bound at a time: it panics if the previous one wasn't closed.
+                    func New{world}[S {world}State](state S) *{world}Instance {{"
+                ),
+                format!("exports := {world}Exports{{\n{state}}}\n"),
+            )
+        } else {
+            (
+                format!(
+                    "// `New{world}` binds `exports` to the exports of the component, as an
+                    // alternative to calling each `Set` function. Only one instance can be
+                    // bound at a time: it panics if the previous one wasn't closed.
+                    func New{world}(exports {world}Exports) *{world}Instance {{"
+                ),
+                String::new(),
+            )
+        };
+
+        uwriteln!(
+            self.src,
+            "
+            // `{world}Exports` holds the implementations of the interfaces exported
+            // by the `{wit_name}` world.
+            type {world}Exports struct {{
+                {fields}
+            }}
+
+            // `{world}Instance` is an implementation of the `{wit_name}` world bound
+            // to the exports of the component by `New{world}`.
+            type {world}Instance struct {{
+                exports {world}Exports
+            }}
+
+            var {var} *{world}Instance
+
+            {constructor}
+                if {var} != nil {{
+                    panic(\"New{world}: another instance is still bound\")
+                }}
+                {bind}i := &{world}Instance{{exports: exports}}
+                {var} = i
+                {set}
+                return i
+            }}
+
+            // `Exports` returns the implementations bound by the instance.
+            func (i *{world}Instance) Exports() {world}Exports {{
+                return i.exports
+            }}
+
+            // `Close` unbinds the exports of the instance, after which calls to them
+            // panic until another instance is created. Closing an instance that
+            // isn't bound is a no-op.
+            func (i *{world}Instance) Close() {{
+                if {var} != i {{
+                    return
+                }}
+                {var} = nil
+                {unset}
+            }}"
+        );
+        if self.opts.export_state {
+            self.print_state_constraint();
+        }
+    }
+
+    /// Prints `<World>State` with `--export-state`, the constraint on the
+    /// state given to `New<World>`, whose methods implement all the exported
+    /// interfaces at once.
+    ///
+    /// A single type can't implement functions of the same name exported by
+    /// several interfaces with different signatures, which is reported here
+    /// rather than by the Go compiler.
+    fn print_state_constraint(&mut self) {
+        let world = self.world.to_upper_camel_case();
+        let mut methods = HashMap::new();
+        for (name, decls) in &self.export_interfaces {
+            for decl in decls {
+                let method = decl.split('(').next().unwrap();
+                if let Some((other, prev)) = methods.insert(method, (name, decl)) {
+                    if prev != decl {
+                        panic!(
+                            "the exported interfaces `{other}` and `{name}` both have a `{method}` \
+                            function with different signatures, which `--export-state` can't \
+                            implement with a single type"
+                        );
+                    }
+                }
+            }
+        }
+        let embedded = self
+            .export_interfaces
+            .iter()
+            .map(|(name, _)| format!("{name}\n"))
+            .collect::<String>();
+        uwriteln!(
+            self.src,
+            "
+            // `{world}State` is implemented by the state given to `New{world}`, whose
+            // methods implement all the interfaces exported by the world.
+            type {world}State interface {{
+                {embedded}
+            }}"
+        );
+    }
+}
@@ -1,4 +1,4 @@
-use std::collections::{HashMap, HashSet};
+use std::collections::{BTreeMap, BTreeSet, HashMap};
 use std::fmt::Write;
 
 use heck::{ToLowerCamelCase, ToSnakeCase, ToUpperCamelCase};
@@ -7,12 +7,16 @@ use wit_bindgen_c::{
     CTypeNameInfo,
 };
 use wit_bindgen_core::wit_parser::{
-    Docs, Enum, Field, Flags, Function, FunctionKind, Handle, InterfaceId, LiveTypes, Record,
-    Resolve, Result_, Tuple, Type, TypeDefKind, TypeId, TypeOwner, Variant, WorldKey,
+    AbiVariant, Docs, Enum, EnumCase, Field, Flags, Function, FunctionKind, Handle, InterfaceId,
+    LiveTypes, Record, Resolve, Result_, Tuple, Type, TypeDefKind, TypeId, TypeOwner, Variant,
+    WorldItem, WorldKey,
 };
-use wit_bindgen_core::{uwriteln, Direction, InterfaceGenerator as _, Source};
+use wit_bindgen_core::{
+    abi, dealias, uwrite, uwriteln, Direction, InterfaceGenerator as _, Source,
+};
+use wit_component::StringEncoding;
 
-use super::{avoid_keyword, bindgen, TinyGo};
+use super::{bindgen, discriminants, dispatch, local_name, mocks, TinyGo};
 
 pub(crate) struct InterfaceGenerator<'a> {
     pub(crate) src: Source,
@@ -27,8 +31,23 @@ pub(crate) struct InterfaceGenerator<'a> {
     // resource interface and the resource destructors
     // this interface-level tracking is needed to prevent duplicated
     // resource declaration which has been declared in other interfaces
-    pub(crate) exported_resources: HashSet<TypeId>,
+    pub(crate) exported_resources: BTreeSet<TypeId>,
     pub(crate) wasm_import_module: Option<&'a str>,
+    // the re-exports of the package of this interface
+    pub(crate) facade: Source,
+    // the packages of other interfaces imported by the re-exports
+    pub(crate) facade_imports: BTreeMap<String, String>,
+    // the imported functions that can be mocked
+    pub(crate) mock_funcs: Vec<mocks::MockFunc>,
+    // the imported functions dispatched through the import table
+    pub(crate) swappable_funcs: Vec<dispatch::SwappableFunc>,
+    // the declarations and names of the exports implemented by
+    // `Unimplemented<Interface>`
+    pub(crate) unimplemented_funcs: Vec<(String, String)>,
+    // the declarations and bodies of the methods of `<Interface>Loopback`
+    pub(crate) loopback_funcs: Vec<(String, String)>,
+    // the declarations and bodies of the methods of `<Interface>PerCallClient`
+    pub(crate) per_call_funcs: Vec<(String, String)>,
 }
 
 impl InterfaceGenerator<'_> {
@@ -72,13 +91,34 @@ impl InterfaceGenerator<'_> {
             let mut name = self.owner_namespace(ty);
             name.push_str(&self.ty_name(&Type::Id(ty)));
 
+            // distinct WIT names may collide once converted to Go
+            if let Some(wit_name) = &self.resolve.types[ty].name {
+                let other = self.gen.type_names.iter().find(|(_, n)| **n == name);
+                if let Some((other, _)) = other {
+                    let other = self.resolve.types[*other]
+                        .name
+                        .as_deref()
+                        .unwrap_or_default();
+                    panic!(
+                        "the WIT types `{other}` and `{wit_name}` are both named `{name}` in Go, \
+                        rename one of them with `--rename`"
+                    );
+                }
+            }
+
             let prev = self.gen.type_names.insert(ty, name.clone());
             assert!(prev.is_none());
 
             // define Go types
             match &self.resolve.types[ty].name {
-                Some(name) => self.define_type(name, ty),
-                None => self.anonymous_type(ty),
+                Some(name) => {
+                    self.define_shared(ty, |gen| {
+                        gen.print_type_provenance(ty);
+                        gen.define_type(name, ty)
+                    });
+                    self.fuzz_round_trip(ty);
+                }
+                None => self.define_shared(ty, |gen| gen.anonymous_type(ty)),
             }
         }
     }
@@ -116,6 +156,14 @@ impl InterfaceGenerator<'_> {
         )
     }
 
+    /// Returns the WIT name of the current interface, or of the world.
+    pub(crate) fn wit_name(&self) -> String {
+        match self.interface {
+            Some((_, key)) => self.resolve.name_world_key(key),
+            None => self.gen.world.clone(),
+        }
+    }
+
     /// Returns the namespace of the current interface.
     ///
     /// If self is not an interface, returns the namespace of the world.
@@ -133,7 +181,7 @@ impl InterfaceGenerator<'_> {
     /// Returns the identifier of the given interface.
     pub(crate) fn interface_identifier(&self, key: &WorldKey) -> String {
         match key {
-            WorldKey::Name(k) => k.to_upper_camel_case(),
+            WorldKey::Name(k) => self.gen.go_ident(k),
             WorldKey::Interface(id) => {
                 let mut name = String::new();
                 if matches!(self.direction, Direction::Export) {
@@ -143,12 +191,11 @@ impl InterfaceGenerator<'_> {
                 let pkg = &self.resolve.packages[iface.package.unwrap()];
                 name.push_str(&pkg.name.namespace.to_upper_camel_case());
                 name.push_str(&pkg.name.name.to_upper_camel_case());
-                if let Some(version) = &pkg.name.version {
-                    let version = version.to_string().replace(['.', '-', '+'], "_");
+                if let Some(version) = self.gen.version_ident(&pkg.name) {
                     name.push_str(&version);
                     name.push('_');
                 }
-                name.push_str(&iface.name.as_ref().unwrap().to_upper_camel_case());
+                name.push_str(&self.gen.go_ident(iface.name.as_ref().unwrap()));
                 name
             }
         }
@@ -157,16 +204,16 @@ impl InterfaceGenerator<'_> {
     /// Returns the function name of the given function.
     pub(crate) fn func_name(&self, func: &Function) -> String {
         match func.kind {
-            FunctionKind::Freestanding => func.name.to_upper_camel_case(),
+            FunctionKind::Freestanding => self.gen.go_ident(&func.name),
             FunctionKind::Static(_) => func.name.replace('.', " ").to_upper_camel_case(),
             FunctionKind::Method(_) => match self.direction {
-                Direction::Import => func.name.split('.').last().unwrap().to_upper_camel_case(),
+                Direction::Import => self.gen.go_ident(func.name.split('.').last().unwrap()),
                 Direction::Export => func.name.replace('.', " ").to_upper_camel_case(),
             },
             FunctionKind::Constructor(id) => match self.direction {
                 Direction::Import => {
                     let resource_name = self.resolve.types[id].name.as_deref().unwrap();
-                    format!("New{}", resource_name.to_upper_camel_case())
+                    format!("New{}", self.gen.go_ident(resource_name))
                 }
                 Direction::Export => func.name.replace('.', " ").to_upper_camel_case(),
             },
@@ -182,7 +229,7 @@ impl InterfaceGenerator<'_> {
         let mut name = String::new();
         let namespace = self.namespace();
         let ty_name = if convert {
-            ty_name.to_upper_camel_case()
+            self.gen.go_ident(ty_name)
         } else {
             ty_name.into()
         };
@@ -202,7 +249,8 @@ impl InterfaceGenerator<'_> {
     ///
     /// There are some special cases:
     ///    1. If the type is list, the type representation is `[]<element-type>`.
-    ///    2. If the type is option, the type representation is `Option[<element-type>]`.
+    ///    2. If the type is option, the type representation is `Option[<element-type>]`,
+    ///       or `*<element-type>` with `--option-pointers`.
     ///    3. If the type is result, the type representation is `Result[<ok-type>, <err-type>]`.
     ///
     /// For any other ID type, the type representation is the type name of the ID.
@@ -220,17 +268,19 @@ impl InterfaceGenerator<'_> {
             Type::F32 => "float32".into(),
             Type::F64 => "float64".into(),
             Type::Char => "rune".into(),
+            Type::String if self.gen.opts.strings_as_bytes => "[]byte".into(),
             Type::String => "string".into(),
             Type::Id(id) => {
                 let ty = &self.resolve().types[*id];
                 match &ty.kind {
+                    TypeDefKind::List(Type::U8) => {
+                        self.gen.with_bytes(true);
+                        "[]byte".into()
+                    }
                     TypeDefKind::List(ty) => {
                         format!("[]{}", self.get_ty(ty))
                     }
-                    TypeDefKind::Option(o) => {
-                        self.gen.with_result_option(true);
-                        format!("Option[{}]", self.get_ty(o))
-                    }
+                    TypeDefKind::Option(o) => self.option_ty(o),
                     TypeDefKind::Result(r) => {
                         self.gen.with_result_option(true);
                         format!(
@@ -239,6 +289,20 @@ impl InterfaceGenerator<'_> {
                             self.optional_ty(r.err.as_ref())
                         )
                     }
+                    TypeDefKind::Future(payload) => {
+                        let payload = self.async_payload(payload.as_ref());
+                        format!("*FutureReader[{payload}]")
+                    }
+                    TypeDefKind::Stream(payload) => {
+                        let payload = self.async_payload(payload.as_ref());
+                        format!("*StreamReader[{payload}]")
+                    }
+                    TypeDefKind::Handle(Handle::Borrow(resource))
+                        if self.borrows_imported(*resource) =>
+                    {
+                        let resource = dealias(self.resolve, *resource);
+                        format!("{}Borrow", self.get_ty(&Type::Id(resource)))
+                    }
                     _ => self.gen.type_names.get(id).unwrap().to_owned(),
                 }
             }
@@ -267,7 +331,7 @@ impl InterfaceGenerator<'_> {
                 let ty = &self.resolve.types[*id];
                 // if a type has name, return the name
                 if let Some(name) = &ty.name {
-                    return name.to_upper_camel_case();
+                    return self.gen.go_ident(name);
                 }
                 // otherwise, return the anonymous type name
                 match &ty.kind {
@@ -328,9 +392,9 @@ impl InterfaceGenerator<'_> {
                     }
                     TypeDefKind::ErrorContext => "ErrorContext".to_owned(),
                     TypeDefKind::Handle(Handle::Own(ty)) => {
-                        // Currently there is no different between Own and Borrow
-                        // in the Go code. They are just represented as
-                        // the name of the resource type.
+                        // Owned handles are represented as the name of the
+                        // resource type, and so are borrowed ones unless they
+                        // get a type of their own with `--borrow-handles`.
                         let mut src = String::new();
                         let ty = &self.resolve.types[*ty];
                         if let Some(name) = &ty.name {
@@ -338,12 +402,15 @@ impl InterfaceGenerator<'_> {
                         }
                         src
                     }
-                    TypeDefKind::Handle(Handle::Borrow(ty)) => {
+                    TypeDefKind::Handle(Handle::Borrow(id)) => {
                         let mut src = String::new();
-                        let ty = &self.resolve.types[*ty];
+                        let ty = &self.resolve.types[*id];
                         if let Some(name) = &ty.name {
                             src.push_str(&name.to_upper_camel_case());
                         }
+                        if self.borrows_imported(*id) {
+                            src.push_str("Borrow");
+                        }
                         src
                     }
                     TypeDefKind::Unknown => unreachable!(),
@@ -362,6 +429,12 @@ impl InterfaceGenerator<'_> {
 
     pub(crate) fn func_params(&mut self, func: &Function) -> String {
         let mut params = String::new();
+        if self.gen.opts.context && !self.gen.opts.host {
+            params.push_str("ctx context.Context");
+            if func.params.len() > usize::from(matches!(func.kind, FunctionKind::Method(_))) {
+                params.push_str(", ");
+            }
+        }
         match func.kind {
             FunctionKind::Method(_) => {
                 for (i, (name, param)) in func.params.iter().skip(1).enumerate() {
@@ -388,14 +461,45 @@ impl InterfaceGenerator<'_> {
         if i > 0 {
             params.push_str(", ");
         }
-        params.push_str(&avoid_keyword(&name.to_snake_case()));
+        params.push_str(&local_name(&name.to_snake_case()));
         params.push(' ');
-        params.push_str(&self.get_ty(param));
+        params.push_str(&self.param_ty(param));
+    }
+
+    /// Returns the `ok` and `err` types of the result returned by `func` if
+    /// the function is mapped to a Go function returning an `error`.
+    pub(crate) fn error_result(&mut self, func: &Function) -> Option<(Option<Type>, Option<Type>)> {
+        let opts = &self.gen.opts;
+        if !(opts.result_as_error || opts.unit_result_as_error) || opts.host {
+            return None;
+        }
+        if matches!(func.kind, FunctionKind::Constructor(_)) || func.results.len() != 1 {
+            return None;
+        }
+        let Type::Id(id) = func.results.iter_types().next().unwrap() else {
+            return None;
+        };
+        match &self.resolve.types[*id].kind {
+            TypeDefKind::Result(r) if r.ok.is_none() || self.gen.opts.result_as_error => {
+                self.gen.with_result_option(true);
+                self.gen.with_result_error(true);
+                Some((r.ok, r.err))
+            }
+            _ => None,
+        }
     }
 
     pub(crate) fn func_results(&mut self, func: &Function) -> String {
         let mut results = String::new();
         results.push(' ');
+        if let Some((ok, err)) = self.error_result(func) {
+            let err = self.error_ty(err.as_ref());
+            match ok {
+                Some(ok) => uwrite!(results, "({}, {err}) ", self.get_ty(&ok)),
+                None => uwrite!(results, "{err} "),
+            }
+            return results;
+        }
         match func.results.len() {
             0 => {}
             1 => {
@@ -470,12 +574,7 @@ impl InterfaceGenerator<'_> {
             if i > 0 {
                 params.push_str(", ");
             }
-            self.c_param(
-                params,
-                &avoid_keyword(&name.to_snake_case()),
-                param,
-                direction,
-            );
+            self.c_param(params, &local_name(&name.to_snake_case()), param, direction);
         }
     }
 
@@ -601,8 +700,37 @@ impl InterfaceGenerator<'_> {
         self.src.push_str("{\n");
     }
 
+    /// Returns whether the resource `id` has a method named `name`.
+    pub(crate) fn has_method(&self, id: TypeId, name: &str) -> bool {
+        let funcs = match self.resolve.types[id].owner {
+            TypeOwner::Interface(iface) => self.resolve.interfaces[iface]
+                .functions
+                .values()
+                .collect::<Vec<_>>(),
+            TypeOwner::World(world) => self.resolve.worlds[world]
+                .imports
+                .values()
+                .chain(self.resolve.worlds[world].exports.values())
+                .filter_map(|item| match item {
+                    WorldItem::Function(func) => Some(func),
+                    _ => None,
+                })
+                .collect(),
+            TypeOwner::None => Vec::new(),
+        };
+        funcs.iter().any(|func| {
+            matches!(func.kind, FunctionKind::Method(ty) if ty == id) && func.item_name() == name
+        })
+    }
+
     pub(crate) fn field_name(&mut self, field: &Field) -> String {
-        field.name.to_upper_camel_case()
+        self.gen.go_ident(&field.name)
+    }
+
+    /// Returns the Go name of the case `name` of a variant or enum, as used
+    /// in its `Kind` constants and constructors.
+    pub(crate) fn case_name(&self, name: &str) -> String {
+        self.gen.go_ident(name)
     }
 
     pub(crate) fn extract_result_ty(&self, ty: &Type) -> (Option<Type>, Option<Type>) {
@@ -645,6 +773,142 @@ impl InterfaceGenerator<'_> {
         }
     }
 
+    /// Returns whether values of `ty` are plain data, holding no handles,
+    /// futures or streams, so that they can be made up out of thin air.
+    pub(crate) fn is_plain_data(&self, ty: &Type) -> bool {
+        let Type::Id(id) = ty else {
+            return true;
+        };
+        match &self.resolve.types[*id].kind {
+            TypeDefKind::Type(t) | TypeDefKind::List(t) | TypeDefKind::Option(t) => {
+                self.is_plain_data(t)
+            }
+            TypeDefKind::Record(r) => r.fields.iter().all(|f| self.is_plain_data(&f.ty)),
+            TypeDefKind::Tuple(t) => t.types.iter().all(|t| self.is_plain_data(t)),
+            TypeDefKind::Variant(v) => v
+                .cases
+                .iter()
+                .all(|c| c.ty.as_ref().map_or(true, |t| self.is_plain_data(t))),
+            TypeDefKind::Result(r) => {
+                r.ok.as_ref().map_or(true, |t| self.is_plain_data(t))
+                    && r.err.as_ref().map_or(true, |t| self.is_plain_data(t))
+            }
+            TypeDefKind::Enum(_) | TypeDefKind::Flags(_) => true,
+            _ => false,
+        }
+    }
+
+    /// Returns whether lifted values of `ty` alias linear memory, which is
+    /// the case for strings and numeric lists with `--explicit-free`.
+    pub(crate) fn owns_memory(&self, ty: &Type) -> bool {
+        match ty {
+            Type::String => matches!(self.gen.opts.string_encoding, StringEncoding::UTF8),
+            Type::Id(id) => match &self.resolve.types[*id].kind {
+                TypeDefKind::Type(t) => self.owns_memory(t),
+                TypeDefKind::Record(r) => r.fields.iter().any(|f| self.owns_memory(&f.ty)),
+                TypeDefKind::Tuple(t) => t.types.iter().any(|t| self.owns_memory(t)),
+                TypeDefKind::Variant(v) => v
+                    .cases
+                    .iter()
+                    .any(|c| c.ty.as_ref().is_some_and(|t| self.owns_memory(t))),
+                TypeDefKind::Option(t) => self.owns_memory(t),
+                TypeDefKind::Result(r) => {
+                    r.ok.as_ref().is_some_and(|t| self.owns_memory(t))
+                        || r.err.as_ref().is_some_and(|t| self.owns_memory(t))
+                }
+                TypeDefKind::List(t) => bindgen::is_numeric(t) || self.owns_memory(t),
+                _ => false,
+            },
+            _ => false,
+        }
+    }
+
+    /// Returns the statements releasing the linear memory aliased by `value`
+    /// of type `ty`.
+    pub(crate) fn free_value(&self, value: &str, ty: &Type, depth: usize) -> String {
+        if !self.owns_memory(ty) {
+            return String::new();
+        }
+        let mut src = String::new();
+        match ty {
+            Type::String => uwriteln!(src, "FreeString({value})"),
+            Type::Id(id) => match &self.resolve.types[*id].kind {
+                TypeDefKind::Type(t) => src.push_str(&self.free_value(value, t, depth)),
+                TypeDefKind::Variant(v) if self.variant_sealed(v) => {
+                    uwriteln!(
+                        src,
+                        "if v, ok := {value}.(interface{{ Free() }}); ok {{
+                            v.Free()
+                        }}"
+                    )
+                }
+                TypeDefKind::Record(_) | TypeDefKind::Variant(_) => {
+                    uwriteln!(src, "{value}.Free()")
+                }
+                TypeDefKind::Tuple(t) => {
+                    for (i, ty) in t.types.iter().enumerate() {
+                        let field = self.tuple_field(t, value, i);
+                        src.push_str(&self.free_value(&field, ty, depth));
+                    }
+                }
+                TypeDefKind::Option(t) => {
+                    let free = self.free_value(&self.option_unwrap(t, value), t, depth);
+                    uwriteln!(
+                        src,
+                        "if {} {{
+{free}}}",
+                        self.option_is_some(t, value)
+                    );
+                }
+                TypeDefKind::Result(r) => {
+                    let ok = r.ok.as_ref().map_or(String::new(), |t| {
+                        self.free_value(&format!("{value}.Unwrap()"), t, depth)
+                    });
+                    let err = r.err.as_ref().map_or(String::new(), |t| {
+                        self.free_value(&format!("{value}.UnwrapErr()"), t, depth)
+                    });
+                    uwriteln!(
+                        src,
+                        "if {value}.IsOk() {{
+{ok}}} else {{
+{err}}}"
+                    );
+                }
+                TypeDefKind::List(t) if bindgen::is_numeric(t) => {
+                    uwriteln!(src, "FreeList({value})")
+                }
+                TypeDefKind::List(t) => {
+                    let elem = format!("e{depth}");
+                    let free = self.free_value(&elem, t, depth + 1);
+                    uwriteln!(
+                        src,
+                        "for _, {elem} := range {value} {{
+{free}}}"
+                    );
+                }
+                _ => unreachable!(),
+            },
+            _ => unreachable!(),
+        }
+        src
+    }
+
+    /// Prints the `Free()` method of the type `name` releasing the memory
+    /// aliased by the receiver `v` with `body`, if there is any.
+    fn print_free_method(&mut self, name: &str, body: &str) {
+        if !self.gen.opts.explicit_free || body.is_empty() {
+            return;
+        }
+        uwriteln!(
+            self.src,
+            "// Free releases the linear memory borrowed by `v`, which must not be
+            // used afterwards.
+            func (v {name}) Free() {{
+                {body}}}
+            "
+        );
+    }
+
     pub(crate) fn anonymous_type(&mut self, ty: TypeId) {
         let kind = &self.resolve.types[ty].kind;
         match kind {
@@ -657,6 +921,11 @@ impl InterfaceGenerator<'_> {
                 // no anonymous type for these types
                 unreachable!()
             }
+            TypeDefKind::Tuple(t) if self.tuple_as_array(t) => {
+                let ty_name = self.ty_name(&Type::Id(ty));
+                let name = self.type_name(&ty_name, false);
+                self.print_tuple_array(&name, t);
+            }
             TypeDefKind::Tuple(t) => {
                 let ty_name = self.ty_name(&Type::Id(ty));
                 let name = self.type_name(&ty_name, false);
@@ -670,14 +939,16 @@ impl InterfaceGenerator<'_> {
             }
             TypeDefKind::Option(_) | TypeDefKind::Result(_) | TypeDefKind::List(_) => {
                 // no anonymous type needs to be generated here because we are using
-                // Option[T], Result[T, E], and []T in Go
+                // Option[T] (or *T), Result[T, E], and []T in Go
             }
             TypeDefKind::Handle(_) => {
                 // although handles are anonymous types, they are generated in the
                 // `type_resource` function as part of the resource type generation.
             }
-            TypeDefKind::Future(_) => todo!("anonymous_type for future"),
-            TypeDefKind::Stream(_) => todo!("anonymous_type for stream"),
+            TypeDefKind::Future(_) | TypeDefKind::Stream(_) => {
+                // no anonymous type needs to be generated here because we are using
+                // *FutureReader[T] and *StreamReader[T] in Go
+            }
             TypeDefKind::ErrorContext => todo!("anonymous_type for error-context"),
             TypeDefKind::Unknown => unreachable!(),
         }
@@ -721,6 +992,405 @@ impl InterfaceGenerator<'_> {
             }}
             ",
         );
+        uwriteln!(
+            self.src,
+            "// New{name}{case_name} returns a {name} of case {case_name} holding `v`.
+            func New{name}{case_name}(v {ty}) {name} {{
+                return {name}{case_name}(v)
+            }}
+
+            // As{case_name} returns the payload of `n` and true if it's of case
+            // {case_name}, or the zero value and false otherwise.
+            func (n {name}) As{case_name}() ({ty}, bool) {{
+                if n.kind != {name}Kind{case_name} {{
+                    var zero {ty}
+                    return zero, false
+                }}
+                v, _ := n.val.({ty})
+                return v, true
+            }}
+
+            // Must{case_name} returns the payload of `n`, which must be of case
+            // {case_name}.
+            func (n {name}) Must{case_name}() {ty} {{
+                v, ok := n.As{case_name}()
+                if !ok {{
+                    panic(fmt.Sprintf(\"{name} is of case %v, not {case_name}\", n.Kind()))
+                }}
+                return v
+            }}
+            ",
+        );
+    }
+
+    /// Prints a variant as a sealed interface implemented by a struct for
+    /// each of its cases, along with a `Match` function to exhaustively
+    /// handle all cases.
+    pub(crate) fn sealed_variant(&mut self, name: &str, variant: &Variant, docs: &Docs) {
+        self.src.push_str(&format!("type {name}Kind int\n\n"));
+        self.src.push_str("const (\n");
+        for (i, case) in variant.cases.iter().enumerate() {
+            let case_name = self.case_name(&case.name);
+            self.docs(&case.docs);
+            self.print_variant_field(name, &case_name, i);
+        }
+        self.src.push_str(")\n\n");
+
+        let marker = format!("is{name}");
+        let discriminant = discriminants::discriminant_type(variant.tag());
+        if docs.contents.is_some() {
+            self.docs(docs);
+            self.src.push_str("//\n");
+        }
+        uwriteln!(
+            self.src,
+            "// {name} is implemented by the cases of the variant.
+            type {name} interface {{
+                Kind() {name}Kind
+                Discriminant() {discriminant}
+                Equal(other {name}) bool
+                {marker}()
+            }}
+            "
+        );
+
+        let mut match_params = Vec::new();
+        let mut match_cases = String::new();
+        for case in variant.cases.iter() {
+            let case_name = self.case_name(&case.name);
+            let param = format!("on{case_name}");
+            match case.ty.as_ref() {
+                Some(ty) => {
+                    let free = self.free_value("v.Value", ty, 0);
+                    let ty = self.get_ty(ty);
+                    uwriteln!(
+                        self.src,
+                        "type {name}{case_name} struct {{\nValue {ty}\n}}\n"
+                    );
+                    self.print_free_method(&format!("{name}{case_name}"), &free);
+                    self.print_sealed_case_equal(name, &case_name, case.ty.as_ref());
+                    self.print_sealed_case_string(name, &case_name, case.ty.as_ref());
+                    match_params.push(format!("{param} func({ty}) R"));
+                    uwriteln!(
+                        match_cases,
+                        "case {name}{case_name}:
+                            return {param}(v.Value)"
+                    );
+                }
+                None => {
+                    uwriteln!(self.src, "type {name}{case_name} struct{{}}\n");
+                    self.print_sealed_case_equal(name, &case_name, None);
+                    self.print_sealed_case_string(name, &case_name, None);
+                    match_params.push(format!("{param} func() R"));
+                    uwriteln!(
+                        match_cases,
+                        "case {name}{case_name}:
+                            return {param}()"
+                    );
+                }
+            }
+            uwriteln!(
+                self.src,
+                "func ({name}{case_name}) Kind() {name}Kind {{
+                    return {name}Kind{case_name}
+                }}
+
+                func ({name}{case_name}) {marker}() {{}}
+                "
+            );
+        }
+
+        self.gen.with_fmt_import(true);
+        let match_params = match_params.join(", ");
+        uwriteln!(
+            self.src,
+            "// Match{name} calls the function handling the case of `v` and returns its result.
+            func Match{name}[R any](v {name}, {match_params}) R {{
+                switch v := v.(type) {{
+                {match_cases}
+                default:
+                    panic(fmt.Sprintf(\"unknown case %T of {name}\", v))
+                }}
+            }}
+            "
+        );
+    }
+
+    /// Returns whether the variant `v` is bound like an enum with
+    /// `--variants-as-enums`, which is the case when none of its cases has a
+    /// payload.
+    pub(crate) fn variant_as_enum(&self, v: &Variant) -> bool {
+        self.gen.opts.variants_as_enums && v.cases.iter().all(|case| case.ty.is_none())
+    }
+
+    /// Returns whether the variant `v` is bound to an interface implemented
+    /// by a type per case with `--sealed-variants`.
+    pub(crate) fn variant_sealed(&self, v: &Variant) -> bool {
+        self.gen.opts.sealed_variants && !self.variant_as_enum(v)
+    }
+
+    /// Returns the expression accessing the payload of `value`, a variant
+    /// `ty_name` known to be of case `case_name`.
+    pub(crate) fn variant_case_payload(
+        &self,
+        value: &str,
+        ty_name: &str,
+        case_name: &str,
+    ) -> String {
+        if self.gen.opts.sealed_variants {
+            format!("{value}.({ty_name}{case_name}).Value")
+        } else {
+            format!("{value}.Get{case_name}()")
+        }
+    }
+
+    pub(crate) fn print_flags_methods(&mut self, name: &str, flags: &Flags) {
+        let all = flags
+            .flags
+            .iter()
+            .map(|flag| format!("{name}_{}", flag.name.to_upper_camel_case()))
+            .collect::<Vec<_>>();
+        let names = flags
+            .flags
+            .iter()
+            .zip(&all)
+            .map(|(flag, constant)| format!("{{{constant}, \"{}\"}},\n", flag.name))
+            .collect::<String>();
+        let all = if all.is_empty() {
+            "0".to_string()
+        } else {
+            all.join(" | ")
+        };
+        uwriteln!(
+            self.src,
+            "// {name}All returns the set of all flags of {name}.
+            func {name}All() {name} {{
+                return {all}
+            }}
+
+            // Has returns true if all the flags in `f` are set.
+            func (x {name}) Has(f {name}) bool {{
+                return x&f == f
+            }}
+
+            // Set sets the flags in `f`.
+            func (x *{name}) Set(f {name}) {{
+                *x |= f
+            }}
+
+            // Clear clears the flags in `f`.
+            func (x *{name}) Clear(f {name}) {{
+                *x &^= f
+            }}
+
+            // String returns the names of the set flags separated by `|`.
+            func (x {name}) String() string {{
+                var s string
+                for _, f := range [...]struct {{
+                    flag {name}
+                    name string
+                }}{{
+                    {names}
+                }} {{
+                    if x&f.flag != 0 {{
+                        if s != \"\" {{
+                            s += \"|\"
+                        }}
+                        s += f.name
+                    }}
+                }}
+                return s
+            }}
+            "
+        );
+    }
+
+    pub(crate) fn print_enum_methods(&mut self, name: &str, enum_: &Enum) {
+        self.gen.with_fmt_import(true);
+        let names = enum_
+            .cases
+            .iter()
+            .map(|case| format!("\"{}\",\n", case.name))
+            .collect::<String>();
+        let parse_cases = enum_
+            .cases
+            .iter()
+            .map(|case| {
+                format!(
+                    "case \"{}\":\nreturn {name}{}(), nil\n",
+                    case.name,
+                    self.case_name(&case.name)
+                )
+            })
+            .collect::<String>();
+        let count = enum_.cases.len();
+        uwriteln!(
+            self.src,
+            "// IsValid returns true if the value is one of the cases of {name}.
+            func (e {name}) IsValid() bool {{
+                return e.kind >= 0 && e.kind < {count}
+            }}
+
+            // String returns the name of the case.
+            func (e {name}) String() string {{
+                if !e.IsValid() {{
+                    return fmt.Sprintf(\"{name}(%d)\", e.kind)
+                }}
+                return [...]string{{
+                    {names}
+                }}[e.kind]
+            }}
+
+            // Parse{name} returns the case of {name} with the given name.
+            func Parse{name}(s string) ({name}, error) {{
+                switch s {{
+                {parse_cases}
+                }}
+                return {name}{{}}, fmt.Errorf(\"invalid {name}: %q\", s)
+            }}
+            "
+        );
+    }
+
+    /// Returns the Go type of a future or stream payload.
+    ///
+    /// Only payloads whose Go representation matches their canonical ABI
+    /// layout are supported, so that values can be transferred directly
+    /// from and to Go memory.
+    pub(crate) fn async_payload(&mut self, payload: Option<&Type>) -> String {
+        match payload {
+            Some(
+                ty @ (Type::Bool
+                | Type::U8
+                | Type::U16
+                | Type::U32
+                | Type::U64
+                | Type::S8
+                | Type::S16
+                | Type::S32
+                | Type::S64
+                | Type::F32
+                | Type::F64
+                | Type::Char),
+            ) => self.get_ty(ty),
+            _ => unimplemented!(
+                "futures and streams of non-primitive payloads are not yet supported"
+            ),
+        }
+    }
+
+    /// Returns the suffix naming the intrinsics of the future or stream `id`
+    /// used by `func`, e.g. `FooBarUploadStream0`.
+    ///
+    /// The intrinsics are imported per function and per future or stream in
+    /// its signature, so the suffix tells the direction, the function and
+    /// the index of `id` among those of the function apart.
+    pub(crate) fn async_intrinsics(&self, func: &Function, id: TypeId) -> String {
+        let index = func
+            .find_futures_and_streams(self.resolve)
+            .iter()
+            .position(|other| *other == id)
+            .expect("the future or stream should be used by the function");
+        let kind = match &self.resolve.types[id].kind {
+            TypeDefKind::Future(_) => "Future",
+            TypeDefKind::Stream(_) => "Stream",
+            _ => unreachable!(),
+        };
+        let ns = self.namespace();
+        // the namespaces of the exported interfaces are prefixed already
+        let direction = match self.direction {
+            Direction::Export if !ns.starts_with("Exports") => "Exports",
+            _ => "",
+        };
+        let func_name = func.name.to_upper_camel_case();
+        format!("{direction}{ns}{func_name}{kind}{index}")
+    }
+
+    /// Declares the intrinsics for the futures and streams used by `func`.
+    ///
+    /// The intrinsics are generated for each of the futures and streams in
+    /// the signature of the function, whose readers lifted by the function
+    /// use them.
+    pub(crate) fn async_payloads(&mut self, func: &Function) {
+        let module = match self.interface {
+            Some((_, key)) => self.resolve.name_world_key(key),
+            None => "$root".to_string(),
+        };
+        let prefix = match self.direction {
+            Direction::Import => "[import-payload]",
+            Direction::Export => "[export-payload]",
+        };
+        let module = format!("{prefix}{module}");
+        let core_names = self.gen.core_names();
+        let import = |name: String| {
+            let (module, name) = core_names.import(&module, &name);
+            format!("{module} {name}")
+        };
+        let func_name = &func.name;
+
+        for (index, id) in func
+            .find_futures_and_streams(self.resolve)
+            .into_iter()
+            .enumerate()
+        {
+            let (kind, payload, count) = match &self.resolve.types[id].kind {
+                TypeDefKind::Future(payload) => {
+                    self.gen.with_future(true);
+                    ("Future", payload, "")
+                }
+                TypeDefKind::Stream(payload) => {
+                    self.gen.with_stream(true);
+                    ("Stream", payload, ", n uint32")
+                }
+                _ => unreachable!(),
+            };
+            let ty = self.async_payload(payload.as_ref());
+            let suffix = self.async_intrinsics(func, id);
+            if !self.gen.async_payloads.insert(suffix.clone()) {
+                continue;
+            }
+            self.gen.with_import_unsafe(true);
+            let snake = kind.to_snake_case();
+            let new = import(format!("[{snake}-new-{index}]{func_name}"));
+            let read = import(format!("[async][{snake}-read-{index}]{func_name}"));
+            let write = import(format!("[async][{snake}-write-{index}]{func_name}"));
+            let close_readable = import(format!("[{snake}-close-readable-{index}]{func_name}"));
+            let close_writable = import(format!("[{snake}-close-writable-{index}]{func_name}"));
+
+            uwriteln!(
+                self.src,
+                "//go:wasmimport {new}
+                func wasm{kind}New{suffix}() uint32
+
+                //go:wasmimport {read}
+                func wasm{kind}Read{suffix}(handle uint32, ptr unsafe.Pointer{count}) uint32
+
+                //go:wasmimport {write}
+                func wasm{kind}Write{suffix}(handle uint32, ptr unsafe.Pointer{count}) uint32
+
+                //go:wasmimport {close_readable}
+                func wasm{kind}CloseReadable{suffix}(handle uint32)
+
+                //go:wasmimport {close_writable}
+                func wasm{kind}CloseWritable{suffix}(handle uint32, err uint32)
+
+                var {snake}Vtable{suffix} = &{snake}Vtable{{
+                    read:          wasm{kind}Read{suffix},
+                    write:         wasm{kind}Write{suffix},
+                    closeReadable: wasm{kind}CloseReadable{suffix},
+                    closeWritable: wasm{kind}CloseWritable{suffix},
+                }}
+
+                // New{suffix} creates a {snake} of `{ty}` for `{func_name}`, returning the
+                // end to write to and the end to pass to another component.
+                func New{suffix}() (*{kind}Writer[{ty}], *{kind}Reader[{ty}]) {{
+                    handle := wasm{kind}New{suffix}()
+                    return &{kind}Writer[{ty}]{{handle: handle, vtable: {snake}Vtable{suffix}}},
+                        &{kind}Reader[{ty}]{{handle: handle, vtable: {snake}Vtable{suffix}}}
+                }}
+                "
+            );
+        }
     }
 
     pub(crate) fn print_kind_method(&mut self, name: &str) {
@@ -733,6 +1403,10 @@ impl InterfaceGenerator<'_> {
         );
     }
 
+    pub(crate) fn docs(&mut self, docs: &Docs) {
+        self.src.push_str(&docs_comment(docs));
+    }
+
     pub(crate) fn print_variant_field(&mut self, name: &str, case_name: &str, i: usize) {
         if i == 0 {
             self.src
@@ -743,18 +1417,39 @@ impl InterfaceGenerator<'_> {
     }
 
     pub(crate) fn import(&mut self, resolve: &Resolve, func: &Function) {
+        if self.skips(func) {
+            return;
+        }
+        self.facade_func(func);
+        self.src.push_str(&self.func_provenance(func));
+        self.async_payloads(func);
         let mut func_bindgen = bindgen::FunctionBindgen::new(self, func);
         func_bindgen.process_args();
         func_bindgen.process_returns();
         let ret = func_bindgen.args;
         let lower_src = func_bindgen.lower_src;
         let lift_src = func_bindgen.lift_src;
+        let uses_arena = func_bindgen.uses_arena;
 
         // // print function signature
-        self.func_sig(func);
+        self.docs(&func.docs);
+        if !self.swappable_sig(func) {
+            self.func_sig(func);
+        }
+        self.src.push_str(&self.trace_call(func));
+        self.src.push_str(&self.metrics_start(func));
+        self.mock_dispatch(func);
+        self.src.push_str(self.lock_call());
 
         // body
         // prepare args
+        if uses_arena {
+            uwriteln!(
+                self.src,
+                "var cabi_arena cabiArena
+                defer cabi_arena.release()"
+            );
+        }
         self.src.push_str(&lower_src);
 
         self.import_invoke(resolve, func, &lift_src, ret);
@@ -762,6 +1457,7 @@ impl InterfaceGenerator<'_> {
         // return
 
         self.src.push_str("}\n\n");
+        self.print_borrow_method(func);
     }
 
     pub(crate) fn import_invoke(
@@ -771,24 +1467,56 @@ impl InterfaceGenerator<'_> {
         lift_src: &Source,
         ret: Vec<String>,
     ) {
+        let (enter, leave) = self.metrics_callee();
         let invoke = self.c_func_sig(resolve, func, Direction::Import);
         match func.results.len() {
             0 => {
+                self.src.push_str(enter);
                 self.src.push_str(&invoke);
                 self.src.push_str("\n");
+                self.src.push_str(leave);
             }
             1 => {
                 let return_ty = func.results.iter_types().next().unwrap();
                 if is_arg_by_pointer(self.resolve, return_ty) {
                     let c_ret_type = self.gen.get_c_ty(return_ty);
                     self.src.push_str(&format!("var ret {c_ret_type}\n"));
+                    self.src.push_str(enter);
                     self.src.push_str(&invoke);
                     self.src.push_str("\n");
                 } else {
+                    self.src.push_str(enter);
                     self.src.push_str(&format!("ret := {invoke}\n"));
                 }
+                self.src.push_str(leave);
                 self.src.push_str(lift_src);
-                self.src.push_str(&format!("return {ret}\n", ret = ret[0]));
+                match self.error_result(func) {
+                    Some((ok, err)) => {
+                        let ret = &ret[0];
+                        let err = self.optional_ty(err.as_ref());
+                        match ok {
+                            Some(ok) => {
+                                let ok = self.get_ty(&ok);
+                                uwriteln!(
+                                    self.src,
+                                    "if {ret}.IsErr() {{
+                                        var zero {ok}
+                                        return zero, &ResultError[{err}]{{Payload: {ret}.UnwrapErr()}}
+                                    }}
+                                    return {ret}.Unwrap(), nil"
+                                );
+                            }
+                            None => uwriteln!(
+                                self.src,
+                                "if {ret}.IsErr() {{
+                                    return &ResultError[{err}]{{Payload: {ret}.UnwrapErr()}}
+                                }}
+                                return nil"
+                            ),
+                        }
+                    }
+                    None => self.src.push_str(&format!("return {ret}\n", ret = ret[0])),
+                }
             }
             _n => {
                 for (i, ty) in func.results.iter_types().enumerate() {
@@ -796,8 +1524,10 @@ impl InterfaceGenerator<'_> {
                     let var_name = format!("ret{i}");
                     self.src.push_str(&format!("var {var_name} {ty_name}\n"));
                 }
+                self.src.push_str(enter);
                 self.src.push_str(&invoke);
                 self.src.push_str("\n");
+                self.src.push_str(leave);
                 self.src.push_str(lift_src);
                 self.src.push_str("return ");
                 for (i, _) in func.results.iter_types().enumerate() {
@@ -812,42 +1542,54 @@ impl InterfaceGenerator<'_> {
     }
 
     pub(crate) fn export(&mut self, resolve: &Resolve, func: &Function) {
+        if self.skips(func) {
+            self.skipped_export(resolve, func);
+            return;
+        }
+        self.async_payloads(func);
+        self.partial_export(func);
+        self.loopback_export(resolve, func);
         let mut func_bindgen = bindgen::FunctionBindgen::new(self, func);
         func_bindgen.process_args();
         func_bindgen.process_returns();
 
         let args = func_bindgen.args;
         let ret = func_bindgen.c_args;
-        let lift_src = func_bindgen.lift_src;
-        let lower_src = func_bindgen.lower_src;
+        let lift_src = func_bindgen.lift_src.to_string();
+        let lower_src = func_bindgen.lower_src.to_string();
+        let (lift_src, lower_src, profiled) =
+            match self.profiled_export(func, &args, &ret, &lift_src, &lower_src) {
+                Some((lift, lower, helpers)) => (lift, lower, helpers),
+                None => (lift_src, lower_src, String::new()),
+            };
 
         // This variable holds the declaration functions in the exported interface that user
         // needs to implement.
-        let interface_method_decl = self.func_sig_with_no_namespace(func);
+        let interface_method_decl = format!(
+            "{}{}",
+            docs_comment(&func.docs),
+            self.func_sig_with_no_namespace(func)
+        );
         let export_func = {
-            let mut src = String::new();
+            let mut src = self.func_provenance(func);
             // header
             src.push_str("//export ");
-            let name = c_func_name(
-                matches!(self.direction, Direction::Import),
-                self.resolve,
-                &self.gen.world,
-                self.interface.map(|(_, key)| key),
-                func,
-                &Default::default(),
-            );
+            let name = self.export_c_func_name(func);
             src.push_str(&name);
             src.push('\n');
 
             // signature
             src.push_str(&self.c_func_sig(resolve, func, Direction::Export));
             src.push_str(" {\n");
+            src.push_str(self.lifecycle_init());
+            src.push_str(&self.trace_call(func));
+            src.push_str(&self.metrics_start(func));
 
             // free all the parameters
             for (name, ty) in func.params.iter() {
                 // TODO: should test if owns anything
                 if false {
-                    let free = self.free_c_arg(ty, &avoid_keyword(&name.to_snake_case()));
+                    let free = self.free_c_arg(ty, &local_name(&name.to_snake_case()));
                     src.push_str(&free);
                 }
             }
@@ -856,46 +1598,82 @@ impl InterfaceGenerator<'_> {
 
             src.push_str(&lift_src);
 
-            // invoke
-            let invoke = match func.kind {
-                FunctionKind::Method(_) => {
-                    format!(
-                        "lift_self.{}({})",
-                        self.func_name(func),
-                        args.iter()
-                            .enumerate()
-                            .skip(1)
-                            .map(|(i, name)| format!(
-                                "{}{}",
-                                name,
-                                if i < func.params.len() - 1 { ", " } else { "" }
-                            ))
-                            .collect::<String>()
-                    )
+            // the parameters are owned by the callee, so release them after the call
+            if self.gen.opts.explicit_free {
+                for ((_, ty), arg) in func.params.iter().zip(args.iter()) {
+                    let free = self.free_value(arg, ty, 0);
+                    if !free.is_empty() {
+                        uwriteln!(src, "defer func() {{\n{free}}}()");
+                    }
                 }
-                _ => format!(
-                    "{}.{}({})",
-                    &self.get_interface_var_name(),
-                    self.func_name(func),
-                    args.iter()
-                        .enumerate()
-                        .map(|(i, name)| format!(
-                            "{}{}",
-                            name,
-                            if i < func.params.len() - 1 { ", " } else { "" }
-                        ))
-                        .collect::<String>()
-                ),
+            }
+
+            // invoke
+            let mut call_args = func
+                .params
+                .iter()
+                .zip(args.iter())
+                .map(|((_, ty), arg)| {
+                    if self.param_by_pointer(ty) {
+                        format!("&{arg}")
+                    } else {
+                        arg.clone()
+                    }
+                })
+                .collect::<Vec<_>>();
+            let receiver = match func.kind {
+                FunctionKind::Method(_) => call_args.remove(0),
+                _ => self.get_interface_var_name(),
             };
+            if self.gen.opts.context && self.gen.opts.cancellation {
+                call_args.insert(0, "cabiCancelable(cabiContext())".to_string());
+            } else if self.gen.opts.context {
+                call_args.insert(0, "cabiContext()".to_string());
+            }
+            let invoke = format!(
+                "{receiver}.{}({})",
+                self.func_name(func),
+                call_args.join(", ")
+            );
+            let invoke = self.recovered_invoke(func, invoke);
 
             // prepare ret
+            let (enter, leave) = self.metrics_callee();
+            src.push_str(enter);
             match func.results.len() {
                 0 => {
-                    src.push_str(&format!("{invoke}\n"));
+                    src.push_str(&format!("{invoke}\n{leave}"));
                 }
                 1 => {
                     let return_ty = func.results.iter_types().next().unwrap();
-                    src.push_str(&format!("result := {invoke}\n"));
+                    match self.error_result(func) {
+                        // convert the returned error back into the `err` case of the result
+                        Some((ok, err)) => {
+                            let result_ty = self.get_ty(return_ty);
+                            let payload =
+                                if self.gen.converts_from_error(self.resolve, err.as_ref()) {
+                                    let err = self.optional_ty(err.as_ref());
+                                    format!("ResultErrorPayload[{err}](err)")
+                                } else {
+                                    "err.Payload".to_string()
+                                };
+                            let (call, value) = match ok {
+                                Some(_) => ("value, err :=", "value"),
+                                None => ("err :=", "struct{}{}"),
+                            };
+                            uwriteln!(
+                                src,
+                                "{call} {invoke}
+                                {leave}var result {result_ty}
+                                if err != nil {{
+                                    result.SetErr({payload})
+                                }} else {{
+                                    result.Set({value})
+                                }}"
+                            );
+                        }
+                        None => src.push_str(&format!("result := {invoke}\n{leave}")),
+                    }
                     src.push_str(&lower_src);
 
                     let lower_result = &ret[0];
@@ -912,7 +1690,7 @@ impl InterfaceGenerator<'_> {
                         }
                         src.push_str(&format!("result{i}"));
                     }
-                    src.push_str(&format!(" := {invoke}\n"));
+                    src.push_str(&format!(" := {invoke}\n{leave}"));
                     src.push_str(&lower_src);
                     for (i, lower_result) in ret.iter().enumerate() {
                         src.push_str(&format!("*ret{i} = {lower_result}\n"));
@@ -921,6 +1699,35 @@ impl InterfaceGenerator<'_> {
             };
 
             src.push_str("\n}\n");
+            src.push_str(&profiled);
+            src.push_str(&self.bench_harness(resolve, func));
+
+            // the lowered results are kept alive until the host is done with them
+            if abi::guest_export_needs_post_return(resolve, func) {
+                uwriteln!(
+                    src,
+                    "
+                    var {name}_arena cabiArena
+
+                    //export {name}_post_return
+                    func {name}_post_return() {{
+                        {name}_arena.release()
+                    }}"
+                );
+                // so is the return area, which is allocated per call so that the
+                // calls of other exports before the post-return call can't
+                // overwrite it
+                if resolve.wasm_signature(AbiVariant::GuestExport, func).retptr {
+                    uwriteln!(
+                        src,
+                        "
+                        //export {name}_return_area
+                        func {name}_return_area(size, align C.size_t) unsafe.Pointer {{
+                            return {name}_arena.alloc(uintptr(size), uintptr(align))
+                        }}"
+                    );
+                }
+            }
             src
         };
 
@@ -937,13 +1744,26 @@ impl InterfaceGenerator<'_> {
         }
     }
 
+    pub(crate) fn export_c_func_name(&self, func: &Function) -> String {
+        c_func_name(
+            false,
+            self.resolve,
+            &self.gen.world,
+            self.interface.map(|(_, key)| key),
+            func,
+            &Default::default(),
+        )
+    }
+
     pub(crate) fn finish(&mut self) {
         if !self.export_funcs.is_empty() || !self.exported_resources.is_empty() {
             let interface_var_name = &self.get_interface_var_name();
             let interface_name = &self.namespace();
+            let default_impl = self.default_export_impl();
 
-            self.src
-                .push_str(format!("var {interface_var_name} {interface_name} = nil\n").as_str());
+            self.src.push_str(
+                format!("var {interface_var_name} {interface_name} = {default_impl}\n").as_str(),
+            );
             uwriteln!(self.src,
                     "// `Set{interface_name}` sets the `{interface_name}` interface implementation.
                 // This function will need to be called by the init() function from the guest application.
@@ -957,6 +1777,18 @@ impl InterfaceGenerator<'_> {
                 );
 
             self.print_export_interface();
+            self.print_unimplemented_exports();
+            self.print_loopback();
+            self.facade_exports();
+            // the declarations without their doc comments
+            let decls = self
+                .export_funcs
+                .iter()
+                .filter(|(decl, _)| !decl.is_empty())
+                .map(|(decl, _)| decl.rsplit('\n').next().unwrap().to_string());
+            self.gen
+                .export_interfaces
+                .push((interface_name.clone(), decls.collect()));
 
             // print resources and methods
 
@@ -965,6 +1797,8 @@ impl InterfaceGenerator<'_> {
                 // that the guest code needs to implement.
                 let ty_name = self.gen.type_names.get(id).unwrap();
 
+                self.src
+                    .push_str(&docs_comment(&self.resolve.types[*id].docs));
                 self.src.push_str(&format!("type {ty_name} interface {{\n"));
                 if self.methods.get(id).is_none() {
                     // if this resource has no methods, generate an empty interface
@@ -996,9 +1830,12 @@ impl InterfaceGenerator<'_> {
         let interface_name = &self.namespace();
         self.src
             .push_str(format!("type {interface_name} interface {{\n").as_str());
+        // skipped functions have no declaration
         for (interface_func_declaration, _) in &self.export_funcs {
-            self.src
-                .push_str(format!("{interface_func_declaration}\n").as_str());
+            if !interface_func_declaration.is_empty() {
+                self.src
+                    .push_str(format!("{interface_func_declaration}\n").as_str());
+            }
         }
         self.src.push_str("}\n");
     }
@@ -1009,18 +1846,41 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
         self.resolve
     }
 
-    fn type_record(&mut self, _id: TypeId, name: &str, record: &Record, _docs: &Docs) {
+    fn type_record(&mut self, id: TypeId, name: &str, record: &Record, docs: &Docs) {
+        self.facade_type(name, "");
+        let wit_name = name;
         let name = self.type_name(name, true);
+        self.docs(docs);
         self.src.push_str(&format!("type {name} struct {{\n",));
+        if self.gen.opts.sealed_records {
+            self.src
+                .push_str("// rules out unkeyed literals outside of this package\n_ struct{}\n");
+        }
+        let mut free = String::new();
+        let mut fields = Vec::new();
         for field in record.fields.iter() {
             let ty = self.get_ty(&field.ty);
             let name = self.field_name(field);
-            self.src.push_str(&format!("   {name} {ty}\n",));
+            self.docs(&field.docs);
+            let tag = self.json_tag(field);
+            self.src.push_str(&format!("   {name} {ty}{tag}\n",));
+            free.push_str(&self.free_value(&format!("v.{name}"), &field.ty, 0));
+            fields.push((format!(".{name}"), field.ty));
         }
         self.src.push_str("}\n\n");
+        self.print_free_method(&name, &free);
+        self.print_struct_equal(&name, &fields);
+        self.print_record_string(&name, record);
+        self.print_record_error(id, wit_name, &name, record);
+        self.print_binary_marshaler(id, &name);
+        self.print_record_constructor(wit_name, record);
     }
 
-    fn type_resource(&mut self, id: TypeId, name: &str, _docs: &Docs) {
+    fn type_resource(&mut self, id: TypeId, name: &str, docs: &Docs) {
+        self.facade_type(name, "");
+        if self.gen.opts.host {
+            unreachable!("resources are rejected by `check_host_types`");
+        }
         let type_name = self.type_name(name, true);
         let private_type_name = type_name.to_snake_case();
         // for imports, generate a `int32` type for resource handle representation.
@@ -1028,23 +1888,45 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
         // resource interfaces, which are implemented by guest code.
         match self.direction {
             Direction::Import => {
-                self.src.push_str(&format!(
-                    "// {type_name} is a handle to imported resource {name}\n"
-                ));
+                match docs.contents {
+                    Some(_) => self.docs(docs),
+                    None => self.src.push_str(&format!(
+                        "// {type_name} is a handle to imported resource {name}\n"
+                    )),
+                }
                 self.src.push_str(&format!("type {type_name} int32\n\n"));
-                let import_module = self.wasm_import_module.unwrap().to_string();
+                let (import_module, drop_name) = self.gen.core_names().import(
+                    self.wasm_import_module.unwrap(),
+                    &format!("[resource-drop]{name}"),
+                );
 
                 // generate [resource-drop] function
                 uwriteln!(
                     self.src,
-                    "//go:wasmimport {import_module} [resource-drop]{name}
+                    "//go:wasmimport {import_module} {drop_name}
                     func _{type_name}_drop(self {type_name})
 
                     func (self {type_name}) Drop() {{
                         _{type_name}_drop(self)
                     }}
+
                     "
                 );
+
+                // a `close` method of the resource takes precedence over the `io.Closer` helper
+                if !self.has_method(id, "close") {
+                    uwriteln!(
+                        self.src,
+                        "// Close drops the handle, allowing {type_name} to be used as an `io.Closer`.
+                        // The handle must not be used after it has been closed.
+                        func (self {type_name}) Close() error {{
+                            self.Drop()
+                            return nil
+                        }}
+                        "
+                    );
+                }
+                self.print_borrow_type(&type_name, name);
             }
             Direction::Export => {
                 // generate a typedef struct for export resource
@@ -1127,10 +2009,21 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
                 uwriteln!(
                     self.src,
                     "func {func_name}Destructor(self *C.{c_typedef_target}) {{
-                        {private_type_name} := {private_type_name}_pointers[int32(self.__handle)]
-                        {private_type_name}_to_own_handlers.Delete({private_type_name})
+                        {private_type_name}_mu.Lock()
+                        {private_type_name}, ok := {private_type_name}_pointers[int32(self.__handle)]
                         delete({private_type_name}_pointers, int32(self.__handle))
-                        C.free(unsafe.Pointer(self))
+                        {private_type_name}_mu.Unlock()
+                        cabiFree(unsafe.Pointer(self))
+                        if !ok {{
+                            return
+                        }}
+                        {private_type_name}_to_own_handlers.Delete({private_type_name})
+
+                        // give the instance a chance to release its state once the
+                        // host has dropped the last handle to it
+                        if d, ok := {private_type_name}.(interface{{ Destructor() }}); ok {{
+                            d.Destructor()
+                        }}
                     }}
                     ",
                 );
@@ -1156,14 +2049,21 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
         };
     }
 
-    fn type_flags(&mut self, _id: TypeId, name: &str, flags: &Flags, _docs: &Docs) {
+    fn type_flags(&mut self, id: TypeId, name: &str, flags: &Flags, docs: &Docs) {
+        self.facade_type(name, "");
+        for flag in flags.flags.iter() {
+            let flag = flag.name.to_upper_camel_case();
+            self.facade_value("const", name, |name| format!("{name}_{flag}"));
+        }
         let name = self.type_name(name, true);
 
         // TODO: use flags repr to determine how many flags are needed
+        self.docs(docs);
         self.src.push_str(&format!("type {name} uint64\n"));
         self.src.push_str("const (\n");
         for (i, flag) in flags.flags.iter().enumerate() {
             let case_flag = flag.name.to_upper_camel_case();
+            self.docs(&flag.docs);
 
             if i == 0 {
                 self.src.push_str(&format!(
@@ -1180,50 +2080,145 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
             }
         }
         self.src.push_str(")\n\n");
+
+        self.print_flags_methods(&name, flags);
+        self.print_binary_marshaler(id, &name);
     }
 
-    fn type_tuple(&mut self, _id: TypeId, name: &str, tuple: &Tuple, _docs: &Docs) {
+    fn type_tuple(&mut self, _id: TypeId, name: &str, tuple: &Tuple, docs: &Docs) {
+        self.facade_type(name, "");
+        let wit_name = name;
         let name = self.type_name(name, true);
-        self.src.push_str(&format!("type {name} struct {{\n",));
+        self.docs(docs);
+        let as_array = self.tuple_as_array(tuple);
+        if as_array {
+            self.print_tuple_array(&name, tuple);
+            self.facade_value("var", wit_name, |name| format!("{name}FromFields"));
+        } else {
+            self.src.push_str(&format!("type {name} struct {{\n",));
+        }
+        let mut free = String::new();
+        let mut fields = Vec::new();
         for (i, case) in tuple.types.iter().enumerate() {
-            let ty = self.get_ty(case);
-            self.src.push_str(&format!("F{i} {ty}\n",));
+            if !as_array {
+                let ty = self.get_ty(case);
+                self.src.push_str(&format!("F{i} {ty}\n",));
+            }
+            free.push_str(&self.free_value(&self.tuple_field(tuple, "v", i), case, 0));
+            fields.push((self.tuple_field(tuple, "", i), *case));
         }
-        self.src.push_str("}\n\n");
+        if !as_array {
+            self.src.push_str("}\n\n");
+        }
+        self.print_free_method(&name, &free);
+        self.print_struct_equal(&name, &fields);
+        self.print_tuple_string(&name, tuple);
     }
 
-    fn type_variant(&mut self, _id: TypeId, name: &str, variant: &Variant, _docs: &Docs) {
+    fn type_variant(&mut self, id: TypeId, name: &str, variant: &Variant, docs: &Docs) {
+        if self.variant_as_enum(variant) {
+            let enum_ = Enum {
+                cases: variant
+                    .cases
+                    .iter()
+                    .map(|case| EnumCase {
+                        name: case.name.clone(),
+                        docs: case.docs.clone(),
+                    })
+                    .collect(),
+            };
+            self.type_enum(id, name, &enum_, docs);
+            return;
+        }
+        self.facade_type(name, "");
+        self.facade_type(name, "Kind");
+        for case in variant.cases.iter() {
+            let case_name = self.case_name(&case.name);
+            self.facade_value("const", name, |name| format!("{name}Kind{case_name}"));
+            // cases are types of their own in sealed variants
+            let kind = if self.gen.opts.sealed_variants {
+                "type"
+            } else {
+                "var"
+            };
+            self.facade_value(kind, name, |name| format!("{name}{case_name}"));
+            if !self.gen.opts.sealed_variants && case.ty.is_some() {
+                self.facade_value("var", name, |name| format!("New{name}{case_name}"));
+            }
+        }
+        let wit_name = name;
         let name = self.type_name(name, true);
+        let case_names = variant
+            .cases
+            .iter()
+            .map(|case| case.name.as_str())
+            .collect::<Vec<_>>();
+        if self.gen.opts.sealed_variants {
+            self.sealed_variant(&name, variant, docs);
+            self.print_discriminants(wit_name, &name, variant.tag(), &case_names, true);
+            for case in variant.cases.iter() {
+                self.print_sealed_case_error(id, wit_name, &name, &case.name, case.ty.as_ref());
+            }
+            self.print_variant_json(&name, variant);
+            self.print_binary_marshaler(id, &name);
+            return;
+        }
         // TODO: use variant's tag to determine how many cases are needed
         // this will help to optmize the Kind type.
         self.src.push_str(&format!("type {name}Kind int\n\n"));
         self.src.push_str("const (\n");
 
         for (i, case) in variant.cases.iter().enumerate() {
-            let case_name = case.name.to_upper_camel_case();
+            let case_name = self.case_name(&case.name);
+            self.docs(&case.docs);
             self.print_variant_field(&name, &case_name, i);
         }
         self.src.push_str(")\n\n");
 
+        self.docs(docs);
         self.src.push_str(&format!("type {name} struct {{\n"));
         self.src.push_str(&format!("kind {name}Kind\n"));
         self.src.push_str("val any\n");
         self.src.push_str("}\n\n");
 
         self.print_kind_method(&name);
+        self.print_discriminants(wit_name, &name, variant.tag(), &case_names, false);
 
+        let mut free = String::new();
         for case in variant.cases.iter() {
-            let case_name = case.name.to_upper_camel_case();
+            let case_name = self.case_name(&case.name);
             if let Some(ty) = case.ty.as_ref() {
                 self.gen.with_fmt_import(true);
                 self.print_accessor_methods(&name, &case_name, ty);
+                let case_free = self.free_value(&format!("v.Get{case_name}()"), ty, 0);
+                if !case_free.is_empty() {
+                    uwriteln!(free, "case {name}Kind{case_name}:\n{case_free}");
+                }
             } else {
                 self.print_constructor_method_without_value(&name, &case_name);
             }
         }
+        if !free.is_empty() {
+            free = format!("switch v.Kind() {{\n{free}}}\n");
+        }
+        self.print_free_method(&name, &free);
+        self.print_variant_equal(&name, variant);
+        self.print_variant_string(&name, variant);
+        self.print_variant_error(id, wit_name, &name, variant);
+        self.print_variant_json(&name, variant);
+        self.print_binary_marshaler(id, &name);
     }
 
-    fn type_enum(&mut self, _id: TypeId, name: &str, enum_: &Enum, _docs: &Docs) {
+    fn type_enum(&mut self, id: TypeId, name: &str, enum_: &Enum, docs: &Docs) {
+        self.facade_type(name, "");
+        self.facade_type(name, "Kind");
+        for case in enum_.cases.iter() {
+            let case = self.case_name(&case.name);
+            self.facade_value("const", name, |name| format!("{name}Kind{case}"));
+            self.facade_value("var", name, |name| format!("{name}{case}"));
+        }
+        self.facade_value("var", name, |name| format!("Parse{name}"));
+        let wit_name = name;
         let name = self.type_name(name, true);
         // TODO: use variant's tag to determine how many cases are needed
         // this will help to optmize the Kind type.
@@ -1231,26 +2226,43 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
         self.src.push_str("const (\n");
 
         for (i, case) in enum_.cases.iter().enumerate() {
-            let case_name = case.name.to_upper_camel_case();
+            let case_name = self.case_name(&case.name);
+            self.docs(&case.docs);
             self.print_variant_field(&name, &case_name, i);
         }
         self.src.push_str(")\n\n");
 
+        self.docs(docs);
         self.src.push_str(&format!("type {name} struct {{\n"));
         self.src.push_str(&format!("kind {name}Kind\n"));
         self.src.push_str("}\n\n");
 
         self.print_kind_method(&name);
+        let case_names = enum_
+            .cases
+            .iter()
+            .map(|case| case.name.as_str())
+            .collect::<Vec<_>>();
+        self.print_discriminants(wit_name, &name, enum_.tag(), &case_names, false);
+        self.print_enum_from_discriminant(wit_name, &name, enum_.tag(), case_names.len());
 
         for case in enum_.cases.iter() {
-            let case_name = case.name.to_upper_camel_case();
+            let case_name = self.case_name(&case.name);
             self.print_constructor_method_without_value(&name, &case_name);
         }
+
+        self.print_enum_methods(&name, enum_);
+        self.print_enum_error(id, wit_name, &name);
+        self.print_enum_json(&name);
+        self.print_binary_marshaler(id, &name);
+        self.print_enum_constructor(wit_name, enum_);
     }
 
-    fn type_alias(&mut self, _id: TypeId, name: &str, ty: &Type, _docs: &Docs) {
+    fn type_alias(&mut self, _id: TypeId, name: &str, ty: &Type, docs: &Docs) {
+        self.facade_alias(name, ty);
         let name = self.type_name(name, true);
         let ty = self.get_ty(ty);
+        self.docs(docs);
         self.src.push_str(&format!("type {name} = {ty}\n"));
     }
 
@@ -1266,14 +2278,12 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
         // no impl since these types are generated as anonymous types
     }
 
-    fn type_future(&mut self, id: TypeId, name: &str, ty: &Option<Type>, docs: &Docs) {
-        _ = (id, name, ty, docs);
-        todo!()
+    fn type_future(&mut self, _id: TypeId, _name: &str, _ty: &Option<Type>, _docs: &Docs) {
+        // no impl since futures are represented as *FutureReader[T]
     }
 
-    fn type_stream(&mut self, id: TypeId, name: &str, ty: &Option<Type>, docs: &Docs) {
-        _ = (id, name, ty, docs);
-        todo!()
+    fn type_stream(&mut self, _id: TypeId, _name: &str, _ty: &Option<Type>, _docs: &Docs) {
+        // no impl since streams are represented as *StreamReader[T]
     }
 
     fn type_error_context(&mut self, id: TypeId, name: &str, docs: &Docs) {
@@ -1285,3 +2295,33 @@ impl<'a> wit_bindgen_core::InterfaceGenerator<'a> for InterfaceGenerator<'a> {
         todo!("type_builtin")
     }
 }
+
+/// Returns the expression constructing the case `case_name` of the variant
+/// `ty_name` with an optional payload.
+pub(crate) fn variant_case_value(
+    sealed: bool,
+    ty_name: &str,
+    case_name: &str,
+    payload: Option<&str>,
+) -> String {
+    match (sealed, payload) {
+        (true, Some(payload)) => format!("{ty_name}{case_name}{{Value: {payload}}}"),
+        (true, None) => format!("{ty_name}{case_name}{{}}"),
+        (false, Some(payload)) => format!("{ty_name}{case_name}({payload})"),
+        (false, None) => format!("{ty_name}{case_name}()"),
+    }
+}
+
+/// Returns `docs` as a Go comment, one `//` line per line of the docs.
+pub(crate) fn docs_comment(docs: &Docs) -> String {
+    let mut comment = String::new();
+    if let Some(docs) = &docs.contents {
+        for line in docs.trim().lines() {
+            match line.trim_end() {
+                "" => comment.push_str("//\n"),
+                line => uwriteln!(comment, "// {line}"),
+            }
+        }
+    }
+    comment
+}
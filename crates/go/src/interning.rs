@@ -0,0 +1,102 @@
+use wit_component::StringEncoding;
+
+use super::TinyGo;
+
+/// The interned strings of `--intern-strings`, lowered once into linear
+/// memory and passed as is whenever the very same string is lowered again.
+///
+/// Strings are keyed by their data pointer rather than their contents, so
+/// that looking one up costs no more than hashing two words, and so that the
+/// map holding the pointer keeps the string alive, which rules out another
+/// string reusing its memory.
+pub(crate) const INTERNED_STRINGS: &str = r#"
+type cabiInternedKey struct {
+	data *byte
+	len  int
+}
+
+type cabiInternedString struct {
+	ptr  unsafe.Pointer
+	len  uintptr
+	pins int
+}
+
+var cabiInterned = map[cabiInternedKey]*cabiInternedString{}
+
+// `PinString` keeps a copy of `s` lowered into linear memory, passed to the
+// host in place of a fresh copy each time `s` itself is lowered, such as a
+// string literal or a string stored once in a variable. Strings equal to `s`
+// but held in other memory are still copied. Pinning a pinned string again
+// adds a pin, which is released by `UnpinString`.
+func PinString(s string) {
+	if len(s) == 0 {
+		return
+	}
+	key := cabiInternedKey{unsafe.StringData(s), len(s)}
+	if entry, ok := cabiInterned[key]; ok {
+		entry.pins++
+		return
+	}
+	ptr, n := cabiInternEncode(s)
+	cabiInterned[key] = &cabiInternedString{ptr: ptr, len: n, pins: 1}
+}
+
+// `UnpinString` releases a pin of `s` set by `PinString`, freeing its copy
+// once no pin is left. It does nothing if `s` isn't pinned.
+func UnpinString(s string) {
+	key := cabiInternedKey{unsafe.StringData(s), len(s)}
+	entry, ok := cabiInterned[key]
+	if !ok {
+		return
+	}
+	if entry.pins--; entry.pins == 0 {
+		delete(cabiInterned, key)
+		cabiFree(entry.ptr)
+	}
+}
+
+// cabiInternedLookup returns the lowered copy of `s` if it's pinned.
+func cabiInternedLookup(s string) (unsafe.Pointer, uintptr, bool) {
+	if len(cabiInterned) == 0 || len(s) == 0 {
+		return nil, 0, false
+	}
+	entry, ok := cabiInterned[cabiInternedKey{unsafe.StringData(s), len(s)}]
+	if !ok {
+		return nil, 0, false
+	}
+	return entry.ptr, entry.len, true
+}
+"#;
+
+impl TinyGo {
+    /// Returns `cabiInternEncode`, lowering the interned strings with the
+    /// string encoding of the world into memory outliving any call.
+    pub(crate) fn intern_encoder(&self) -> &'static str {
+        match self.opts.string_encoding {
+            StringEncoding::UTF8 => {
+                "
+                func cabiInternEncode(s string) (unsafe.Pointer, uintptr) {
+                    return cabiString(cabiAlloc, s), uintptr(len(s))
+                }
+                "
+            }
+            StringEncoding::UTF16 => {
+                "
+                func cabiInternEncode(s string) (unsafe.Pointer, uintptr) {
+                    ptr, n := encodeUTF16(cabiAlloc, s)
+                    return ptr, uintptr(n)
+                }
+                "
+            }
+            // the length carries the tag of the encoding
+            StringEncoding::CompactUTF16 => {
+                "
+                func cabiInternEncode(s string) (unsafe.Pointer, uintptr) {
+                    ptr, n := encodeCompactUTF16(cabiAlloc, s)
+                    return ptr, uintptr(n)
+                }
+                "
+            }
+        }
+    }
+}
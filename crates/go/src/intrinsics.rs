@@ -0,0 +1,133 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::{uwriteln, Files, Source};
+
+use super::{alloc, encoding, TinyGo};
+
+/// The version of the intrinsics of the runtime package, required by the
+/// generated bindings so that mismatched bindings and runtime packages fail
+/// to build.
+const VERSION: u32 = 1;
+
+/// The identifiers of the allocator, arena and transcoding helpers, renamed
+/// to be exported from the runtime package.
+const EXPORTED: &[(&str, &str)] = &[
+    ("cabiString", "CopyString"),
+    ("cabiArenaChunkSize", "arenaChunkSize"),
+    ("cabiArena", "Arena"),
+    ("*Arena) alloc(", "*Arena) Alloc("),
+    ("*Arena) release(", "*Arena) Release("),
+    ("encodeUTF16", "EncodeUTF16"),
+    ("decodeUTF16", "DecodeUTF16"),
+    ("encodeCompactUTF16", "EncodeCompactUTF16"),
+    ("decodeCompactUTF16", "DecodeCompactUTF16"),
+];
+
+/// Forwards the allocations of the generated bindings to the runtime
+/// package.
+const SHIM: &str = r#"
+var (
+	cabiAlloc  = AllocMemory
+	cabiFree   = FreeMemory
+	cabiString = CopyString
+)
+
+type cabiArena struct{ Arena }
+
+func (a *cabiArena) alloc(size, align uintptr) unsafe.Pointer {
+	return a.Alloc(size, align)
+}
+
+func (a *cabiArena) release() {
+	a.Release()
+}
+"#;
+
+impl TinyGo {
+    /// Whether the helpers of the guest bindings are imported from the
+    /// runtime package with `--shared-intrinsics`.
+    pub(crate) fn shared_intrinsics(&self) -> bool {
+        self.opts.shared_intrinsics && !self.opts.host && self.opts.runtime_package.is_some()
+    }
+
+    /// Generates the allocator, arena and transcoding helpers into the
+    /// runtime package `package`, so that they're linked once however many
+    /// worlds import them. This includes the `cabi_realloc` export.
+    pub(crate) fn generate_intrinsics(&self, package: &str, files: &mut Files) {
+        let mut src = Source::default();
+        wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+        uwriteln!(
+            src,
+            "package {package}
+
+            // #include <stdlib.h>
+            import \"C\"
+
+            import (
+                \"unicode/utf16\"
+                \"unsafe\"
+            )
+
+            // IntrinsicsV{VERSION} is required by the bindings generated for version
+            // {VERSION} of the intrinsics.
+            const IntrinsicsV{VERSION} = true
+
+            // AllocMemory allocates `size` bytes aligned to `align` with the
+            // allocator set with SetAllocator.
+            func AllocMemory(size, align uintptr) unsafe.Pointer {{
+                return cabiAlloc(size, align)
+            }}
+
+            // FreeMemory releases an allocation made by AllocMemory.
+            func FreeMemory(ptr unsafe.Pointer) {{
+                cabiFree(ptr)
+            }}"
+        );
+        let mut helpers = [
+            alloc::ALLOCATOR,
+            encoding::UTF16_HELPERS,
+            encoding::COMPACT_UTF16_HELPERS,
+        ]
+        .concat();
+        for (from, to) in EXPORTED {
+            helpers = helpers.replace(from, to);
+        }
+        src.push_str(&helpers);
+
+        let file = format!("{package}/intrinsics.go");
+        files.push(&file, src.as_bytes());
+        self.gofmt_file(files, &file);
+    }
+
+    /// Prints the forwarders of the helpers to the runtime package, in place
+    /// of the helpers themselves.
+    pub(crate) fn print_intrinsics_shim(&mut self) {
+        uwriteln!(
+            self.src,
+            "
+            // the intrinsics are shared with the other bindings importing the runtime
+            // package
+            const _ = IntrinsicsV{VERSION}"
+        );
+        self.src.push_str(SHIM);
+
+        // transcoding is left to the runtime package
+        let mut transcoders = Vec::new();
+        if self.import_requirements.needs_utf16 {
+            transcoders.extend(["encodeUTF16", "decodeUTF16"]);
+        }
+        if self.import_requirements.needs_compact_utf16 {
+            transcoders.extend(["encodeCompactUTF16", "decodeCompactUTF16"]);
+        }
+        if !transcoders.is_empty() {
+            self.src.push_str("\nvar (\n");
+            for name in transcoders {
+                let exported = EXPORTED.iter().find(|(from, _)| *from == name).unwrap().1;
+                uwriteln!(self.src, "{name} = {exported}");
+            }
+            self.src.push_str(")\n");
+        }
+        self.import_requirements.needs_utf16 = false;
+        self.import_requirements.needs_compact_utf16 = false;
+    }
+}
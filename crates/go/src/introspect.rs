@@ -0,0 +1,275 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{
+    Function, Handle, Resolve, Results, Type, TypeDefKind, TypeId, WorldId, WorldItem, WorldKey,
+};
+
+use super::TinyGo;
+
+/// The types describing the world with `--introspect`.
+const INTROSPECTION_TYPES: &str = r#"
+// `WitWorld` describes the WIT world implemented by the bindings. The
+// functions and types of the world itself are described by an interface with
+// an empty name.
+type WitWorld struct {
+	Name             string
+	Imports, Exports []WitInterface
+}
+
+// `WitInterface` describes a WIT interface, named as in WIT.
+type WitInterface struct {
+	Name      string
+	Types     []WitType
+	Functions []WitFunction
+}
+
+// `WitType` describes a type defined by a WIT interface.
+type WitType struct {
+	Name string
+	// `Kind` is one of "record", "variant", "enum", "flags", "resource", or
+	// "type" for aliases.
+	Kind string
+	// `Members` are the fields of records, the cases of variants, enums and
+	// flags, or the aliased type, along with their types if any.
+	Members []WitField
+}
+
+// `WitFunction` describes a WIT function, such as `[method]file.read` for a
+// method of a resource.
+type WitFunction struct {
+	Name            string
+	Params, Results []WitField
+}
+
+// `WitField` is a named member of a WIT item. Types are spelled as in WIT,
+// such as `list<option<u32>>`.
+type WitField struct {
+	Name, Type string
+}
+"#;
+
+/// Returns the WIT spelling of `ty`.
+fn wit_type(resolve: &Resolve, ty: &Type) -> String {
+    let name = match ty {
+        Type::Bool => "bool",
+        Type::U8 => "u8",
+        Type::U16 => "u16",
+        Type::U32 => "u32",
+        Type::U64 => "u64",
+        Type::S8 => "s8",
+        Type::S16 => "s16",
+        Type::S32 => "s32",
+        Type::S64 => "s64",
+        Type::F32 => "f32",
+        Type::F64 => "f64",
+        Type::Char => "char",
+        Type::String => "string",
+        Type::Id(id) => return wit_type_id(resolve, *id),
+    };
+    name.to_string()
+}
+
+fn wit_type_id(resolve: &Resolve, id: TypeId) -> String {
+    let ty = &resolve.types[id];
+    match &ty.name {
+        Some(name) => name.clone(),
+        None => wit_anonymous_type(resolve, &ty.kind),
+    }
+}
+
+/// Returns the WIT spelling of the type of kind `kind`, regardless of its
+/// name.
+fn wit_anonymous_type(resolve: &Resolve, kind: &TypeDefKind) -> String {
+    let optional = |ty: &Option<Type>| match ty {
+        Some(ty) => wit_type(resolve, ty),
+        None => "_".to_string(),
+    };
+    match kind {
+        TypeDefKind::Type(t) => wit_type(resolve, t),
+        TypeDefKind::List(t) => format!("list<{}>", wit_type(resolve, t)),
+        TypeDefKind::Option(t) => format!("option<{}>", wit_type(resolve, t)),
+        TypeDefKind::Result(r) => match (&r.ok, &r.err) {
+            (None, None) => "result".to_string(),
+            (Some(ok), None) => format!("result<{}>", wit_type(resolve, ok)),
+            _ => format!("result<{}, {}>", optional(&r.ok), optional(&r.err)),
+        },
+        TypeDefKind::Tuple(t) => {
+            let types = t
+                .types
+                .iter()
+                .map(|ty| wit_type(resolve, ty))
+                .collect::<Vec<_>>();
+            format!("tuple<{}>", types.join(", "))
+        }
+        TypeDefKind::Handle(Handle::Own(id)) => wit_type_id(resolve, *id),
+        TypeDefKind::Handle(Handle::Borrow(id)) => {
+            format!("borrow<{}>", wit_type_id(resolve, *id))
+        }
+        TypeDefKind::Future(None) => "future".to_string(),
+        TypeDefKind::Future(Some(t)) => format!("future<{}>", wit_type(resolve, t)),
+        TypeDefKind::Stream(None) => "stream".to_string(),
+        TypeDefKind::Stream(Some(t)) => format!("stream<{}>", wit_type(resolve, t)),
+        TypeDefKind::ErrorContext => "error-context".to_string(),
+        // the other types can't be anonymous
+        _ => unreachable!(),
+    }
+}
+
+/// Returns the Go literal of the `WitField`s `(name, ty)`.
+fn fields<'a>(
+    resolve: &Resolve,
+    fields: impl IntoIterator<Item = (&'a str, Option<&'a Type>)>,
+) -> String {
+    let fields = fields
+        .into_iter()
+        .map(|(name, ty)| {
+            let ty = ty.map(|ty| wit_type(resolve, ty)).unwrap_or_default();
+            format!("{{Name: \"{name}\", Type: \"{ty}\"}}")
+        })
+        .collect::<Vec<_>>();
+    format!("[]WitField{{{}}}", fields.join(", "))
+}
+
+fn type_literal(resolve: &Resolve, id: TypeId) -> String {
+    let ty = &resolve.types[id];
+    let (kind, members) = match &ty.kind {
+        TypeDefKind::Record(r) => (
+            "record",
+            fields(
+                resolve,
+                r.fields.iter().map(|f| (f.name.as_str(), Some(&f.ty))),
+            ),
+        ),
+        TypeDefKind::Variant(v) => (
+            "variant",
+            fields(
+                resolve,
+                v.cases.iter().map(|c| (c.name.as_str(), c.ty.as_ref())),
+            ),
+        ),
+        TypeDefKind::Enum(e) => (
+            "enum",
+            fields(resolve, e.cases.iter().map(|c| (c.name.as_str(), None))),
+        ),
+        TypeDefKind::Flags(f) => (
+            "flags",
+            fields(resolve, f.flags.iter().map(|f| (f.name.as_str(), None))),
+        ),
+        TypeDefKind::Resource => ("resource", "nil".to_string()),
+        _ => (
+            "type",
+            format!(
+                "[]WitField{{{{Type: \"{}\"}}}}",
+                wit_anonymous_type(resolve, &ty.kind)
+            ),
+        ),
+    };
+    format!(
+        "{{Name: \"{}\", Kind: \"{kind}\", Members: {members}}}",
+        ty.name.as_ref().unwrap()
+    )
+}
+
+fn function_literal(resolve: &Resolve, func: &Function) -> String {
+    let params = fields(
+        resolve,
+        func.params
+            .iter()
+            .map(|(name, ty)| (name.as_str(), Some(ty))),
+    );
+    let results = match &func.results {
+        Results::Named(results) => fields(
+            resolve,
+            results.iter().map(|(name, ty)| (name.as_str(), Some(ty))),
+        ),
+        Results::Anon(ty) => fields(resolve, [("", Some(ty))]),
+    };
+    format!(
+        "{{Name: \"{}\", Params: {params}, Results: {results}}}",
+        func.name
+    )
+}
+
+fn interface_literal(name: &str, types: &[String], funcs: &[String]) -> String {
+    let mut src = format!("{{\nName: \"{name}\",\n");
+    if !types.is_empty() {
+        uwriteln!(src, "Types: []WitType{{\n{},\n}},", types.join(",\n"));
+    }
+    if !funcs.is_empty() {
+        uwriteln!(
+            src,
+            "Functions: []WitFunction{{\n{},\n}},",
+            funcs.join(",\n")
+        );
+    }
+    src.push('}');
+    src
+}
+
+/// Returns the Go literal of the `WitInterface`s of the world `items`.
+fn interfaces_literal<'a>(
+    resolve: &Resolve,
+    items: impl Iterator<Item = (&'a WorldKey, &'a WorldItem)>,
+) -> String {
+    let mut interfaces = Vec::new();
+    let (mut types, mut funcs) = (Vec::new(), Vec::new());
+    for (key, item) in items {
+        match item {
+            WorldItem::Interface { id, .. } => {
+                let iface = &resolve.interfaces[*id];
+                let types = iface
+                    .types
+                    .values()
+                    .map(|id| type_literal(resolve, *id))
+                    .collect::<Vec<_>>();
+                let funcs = iface
+                    .functions
+                    .values()
+                    .map(|func| function_literal(resolve, func))
+                    .collect::<Vec<_>>();
+                interfaces.push(interface_literal(
+                    &resolve.name_world_key(key),
+                    &types,
+                    &funcs,
+                ));
+            }
+            WorldItem::Function(func) => funcs.push(function_literal(resolve, func)),
+            WorldItem::Type(id) => types.push(type_literal(resolve, *id)),
+        }
+    }
+    if !types.is_empty() || !funcs.is_empty() {
+        interfaces.insert(0, interface_literal("", &types, &funcs));
+    }
+    if interfaces.is_empty() {
+        return "nil".to_string();
+    }
+    format!("[]WitInterface{{\n{},\n}}", interfaces.join(",\n"))
+}
+
+impl TinyGo {
+    /// Prints `Introspect`, describing the interfaces, functions and types of
+    /// the world for generic tooling such as REPLs or RPC bridges.
+    pub(crate) fn print_introspection(&mut self, resolve: &Resolve, world: WorldId) {
+        let world = &resolve.worlds[world];
+        let imports = interfaces_literal(resolve, world.imports.iter());
+        let exports = interfaces_literal(resolve, world.exports.iter());
+        self.src.push_str(INTROSPECTION_TYPES);
+        uwriteln!(
+            self.src,
+            "
+            var cabiWitWorld = WitWorld{{
+                Name:    \"{name}\",
+                Imports: {imports},
+                Exports: {exports},
+            }}
+
+            // `Introspect` describes the WIT world implemented by the bindings. The
+            // description is shared, and must not be modified.
+            func Introspect() WitWorld {{
+                return cabiWitWorld
+            }}",
+            name = world.name,
+        );
+    }
+}
@@ -0,0 +1,177 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Field, Variant};
+
+use crate::interface::{variant_case_value, InterfaceGenerator};
+
+/// `encoding/json` support for the generated types with `--json`: records
+/// get struct tags with the WIT names of their fields, enums are encoded as
+/// the name of their case and variants as an object holding the name of their
+/// case as `kind` and its payload as `value`.
+impl InterfaceGenerator<'_> {
+    /// Returns the struct tag of the record field `field`.
+    pub(crate) fn json_tag(&self, field: &Field) -> String {
+        if self.gen.opts.json {
+            format!(" `json:\"{}\"`", field.name)
+        } else {
+            String::new()
+        }
+    }
+
+    pub(crate) fn print_enum_json(&mut self, name: &str) {
+        if !self.gen.opts.json {
+            return;
+        }
+        self.gen.with_json_import(true);
+        uwriteln!(
+            self.src,
+            "// MarshalJSON encodes the enum as the name of its case.
+            func (e {name}) MarshalJSON() ([]byte, error) {{
+                if !e.IsValid() {{
+                    return nil, fmt.Errorf(\"invalid {name}: %d\", e.kind)
+                }}
+                return json.Marshal(e.String())
+            }}
+
+            // UnmarshalJSON decodes the enum from the name of its case.
+            func (e *{name}) UnmarshalJSON(data []byte) error {{
+                var s string
+                if err := json.Unmarshal(data, &s); err != nil {{
+                    return err
+                }}
+                v, err := Parse{name}(s)
+                if err != nil {{
+                    return err
+                }}
+                *e = v
+                return nil
+            }}
+            "
+        );
+    }
+
+    pub(crate) fn print_variant_json(&mut self, name: &str, variant: &Variant) {
+        if !self.gen.opts.json {
+            return;
+        }
+        self.gen.with_json_import(true);
+        self.gen.with_fmt_import(true);
+        let sealed = self.gen.opts.sealed_variants;
+
+        let mut decode_cases = String::new();
+        for case in variant.cases.iter() {
+            let case_name = self.case_name(&case.name);
+            let wit_name = &case.name;
+            let value = match &case.ty {
+                Some(ty) => {
+                    let ty = self.get_ty(ty);
+                    let fail = if sealed {
+                        "return nil, err"
+                    } else {
+                        "return err"
+                    };
+                    uwriteln!(
+                        decode_cases,
+                        "case \"{wit_name}\":
+                            var value {ty}
+                            if err := json.Unmarshal(raw.Value, &value); err != nil {{
+                                {fail}
+                            }}"
+                    );
+                    variant_case_value(sealed, name, &case_name, Some("value"))
+                }
+                None => {
+                    uwriteln!(decode_cases, "case \"{wit_name}\":");
+                    variant_case_value(sealed, name, &case_name, None)
+                }
+            };
+            if sealed {
+                uwriteln!(decode_cases, "return {value}, nil");
+
+                // each case encodes itself, along with its name
+                let (field, payload) = match &case.ty {
+                    Some(ty) => (
+                        format!("Value {} `json:\"value\"`\n", self.get_ty(ty)),
+                        ", v.Value",
+                    ),
+                    None => (String::new(), ""),
+                };
+                uwriteln!(
+                    self.src,
+                    "// MarshalJSON encodes the case as an object holding its name as `kind`
+                    // and its payload, if any, as `value`.
+                    func (v {name}{case_name}) MarshalJSON() ([]byte, error) {{
+                        return json.Marshal(struct {{
+                            Kind string `json:\"kind\"`
+                            {field}
+                        }}{{\"{wit_name}\"{payload}}})
+                    }}
+                    "
+                );
+            } else {
+                uwriteln!(decode_cases, "*v = {value}\nreturn nil");
+            }
+        }
+
+        let raw = "var raw struct {
+                Kind  string          `json:\"kind\"`
+                Value json.RawMessage `json:\"value\"`
+            }";
+        if sealed {
+            uwriteln!(
+                self.src,
+                "// Unmarshal{name}JSON decodes a case of {name} encoded by its MarshalJSON
+                // method.
+                func Unmarshal{name}JSON(data []byte) ({name}, error) {{
+                    {raw}
+                    if err := json.Unmarshal(data, &raw); err != nil {{
+                        return nil, err
+                    }}
+                    switch raw.Kind {{
+                    {decode_cases}
+                    }}
+                    return nil, fmt.Errorf(\"invalid {name}: %q\", raw.Kind)
+                }}
+                "
+            );
+            return;
+        }
+
+        let names = variant
+            .cases
+            .iter()
+            .map(|case| format!("\"{}\",\n", case.name))
+            .collect::<String>();
+        let count = variant.cases.len();
+        uwriteln!(
+            self.src,
+            "// MarshalJSON encodes the variant as an object holding the name of its
+            // case as `kind` and its payload, if any, as `value`.
+            func (v {name}) MarshalJSON() ([]byte, error) {{
+                if v.kind < 0 || v.kind >= {count} {{
+                    return nil, fmt.Errorf(\"invalid {name}: %d\", v.kind)
+                }}
+                return json.Marshal(struct {{
+                    Kind  string `json:\"kind\"`
+                    Value any    `json:\"value,omitempty\"`
+                }}{{[...]string{{
+                    {names}
+                }}[v.kind], v.val}})
+            }}
+
+            // UnmarshalJSON decodes the variant encoded by MarshalJSON.
+            func (v *{name}) UnmarshalJSON(data []byte) error {{
+                {raw}
+                if err := json.Unmarshal(data, &raw); err != nil {{
+                    return err
+                }}
+                switch raw.Kind {{
+                {decode_cases}
+                }}
+                return fmt.Errorf(\"invalid {name}: %q\", raw.Kind)
+            }}
+            "
+        );
+    }
+}
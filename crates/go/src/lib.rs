@@ -1,30 +1,704 @@
-use std::collections::{HashMap, HashSet};
+use std::collections::{BTreeMap, HashMap, HashSet};
 use std::io::{Read, Write};
 use std::mem;
+use std::path::PathBuf;
 use std::process::Stdio;
 
-use anyhow::Result;
-use heck::ToSnakeCase;
+use anyhow::{bail, Result};
+use heck::{ToSnakeCase, ToUpperCamelCase};
 use wit_bindgen_c::imported_types_used_by_exported_interfaces;
 use wit_bindgen_core::wit_parser::{
     Function, InterfaceId, LiveTypes, Resolve, SizeAlign, Type, TypeId, WorldId, WorldKey,
 };
 use wit_bindgen_core::{Direction, Files, Source, WorldGenerator};
+use wit_component::StringEncoding;
 
+mod abi_error;
+mod alloc;
+mod async_support;
+mod batch;
+mod bench;
+mod binary;
 mod bindgen;
+mod borrows;
+mod cancel;
+mod client;
+mod constructors;
+mod context;
+mod discriminants;
+mod dispatch;
+mod encoding;
+mod equal;
+mod errors;
+mod facade;
+mod filters;
+mod fuzz;
+mod goroutines;
+mod host;
 mod imports;
+mod instance;
 mod interface;
+mod interning;
+mod intrinsics;
+mod introspect;
+mod json;
+mod lifecycle;
+mod loopback;
+mod metrics;
+mod mocks;
+mod nans;
+mod native;
+mod optional;
+mod options;
+mod outline;
+mod panics;
+mod partial;
+mod percall;
+mod pointers;
+mod pool;
+mod profiling;
+mod provenance;
+mod scaffold;
+mod selftest;
+mod shared;
+mod slog;
+mod stamp;
+mod stringer;
+mod trace;
+mod transcode;
+mod traps;
+mod tuples;
+mod versions;
+mod wasi;
 
 #[derive(Debug, Clone)]
 #[cfg_attr(feature = "clap", derive(clap::Args))]
 pub struct Opts {
     /// Whether or not `gofmt` is executed to format generated code.
-    #[cfg_attr(feature = "clap", arg(long))]
+    ///
+    /// This is on by default so output is gofmt-clean; pass `--gofmt=false`
+    /// to skip it when `gofmt` isn't available.
+    #[cfg_attr(
+        feature = "clap",
+        arg(
+            long,
+            default_value_t = true,
+            num_args = 0..=1,
+            default_missing_value = "true",
+            action = clap::ArgAction::Set,
+        )
+    )]
     pub gofmt: bool,
 
     /// Rename the Go package in the generated source code.
     #[cfg_attr(feature = "clap", arg(long))]
     pub rename_package: Option<String>,
+
+    /// Generate host-side bindings for embedding components instead of guest
+    /// bindings for TinyGo.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub host: bool,
+
+    /// The runtime targeted by host-side bindings.
+    #[cfg_attr(feature = "clap", arg(long, value_enum, default_value_t = HostRuntime::default()))]
+    pub host_runtime: HostRuntime,
+
+    /// Map functions returning a `result` to Go functions returning an `error`
+    /// instead of a `Result` value.
+    ///
+    /// The exports whose `err` case isn't a string, a record, a variant, an
+    /// enum or empty return a `*ResultError[E]` rather than an `error`, since
+    /// other errors couldn't be converted back into it.
+    ///
+    /// This is on by default; pass `--result-as-error=false` to return
+    /// `Result` values instead.
+    #[cfg_attr(
+        feature = "clap",
+        arg(
+            long,
+            default_value_t = true,
+            num_args = 0..=1,
+            default_missing_value = "true",
+            action = clap::ArgAction::Set,
+        )
+    )]
+    pub result_as_error: bool,
+
+    /// Map functions returning a `result` without an `ok` type to Go
+    /// functions returning only an `error`, leaving the other results as
+    /// `Result` values. Only has an effect with `--result-as-error=false`,
+    /// since `--result-as-error` maps all of them.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub unit_result_as_error: bool,
+
+    /// Import the `Option` and `Result` types from the Go package at this
+    /// import path instead of generating them alongside every world. The
+    /// package is generated into a directory named after the last element
+    /// of the path.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub runtime_package: Option<String>,
+
+    /// Generate variants as sealed interfaces implemented by one struct per
+    /// case instead of a struct holding an untyped payload.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub sealed_variants: bool,
+
+    /// Lift string parameters of exported functions with `unsafe.String`
+    /// over linear memory instead of copying them. Such strings are only
+    /// valid until the exported function returns, and must be copied (for
+    /// example with `strings.Clone`) to be retained past the call.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub zero_copy_strings: bool,
+
+    /// Lift numeric list parameters of exported functions with
+    /// `unsafe.Slice` over linear memory instead of copying them. Such
+    /// slices are only valid until the exported function returns, must not
+    /// be retained past the call, and are copied in bulk otherwise.
+    ///
+    /// Numeric lists passed to imported functions are also lowered in place,
+    /// so that a large list doesn't take up twice its size for the duration
+    /// of the call. They must not be modified by other goroutines meanwhile.
+    /// This only covers lists of integers and floats passed to imports: the
+    /// lists returned by exports, which the host reads once the export has
+    /// returned, and lists of other types, whose Go and C layouts differ,
+    /// are still lowered into a single contiguous allocation of their full
+    /// size. Lists aren't lowered in chunks, since the canonical ABI passes
+    /// them in one piece: payloads too large for memory should be passed as
+    /// a `stream<u8>` instead, which is written in chunks.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub zero_copy_lists: bool,
+
+    /// Lift strings and numeric lists over linear memory instead of copying
+    /// them into the Go heap, for guests built with `-gc=leaking`. Such
+    /// values returned by imports are owned by the caller and released with
+    /// `FreeString`, `FreeList` or the `Free()` method of the generated type
+    /// holding them, while the parameters of exports are released once the
+    /// export returns.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub explicit_free: bool,
+
+    /// Set the string encoding of the guest component, transcoding Go strings
+    /// from and to it.
+    #[cfg_attr(feature = "clap", arg(long, default_value_t = StringEncoding::default()))]
+    pub string_encoding: StringEncoding,
+
+    /// Generate a buildable module around the guest bindings: a `go.mod`,
+    /// the bindings in its `gen` package, and a `main.go` registering stub
+    /// implementations of the exports.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub scaffold: bool,
+
+    /// The name of the generated Go package, which defaults to the name of
+    /// the world.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub go_package: Option<String>,
+
+    /// The path of the Go module containing the generated package, used by
+    /// the scaffolding and which defaults to `wit_<world>_go`.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub go_module: Option<String>,
+
+    /// Re-export the bindings of each interface under short names from a
+    /// package of its own, such as `foo/bar/baz` for imports of `foo:bar/baz`
+    /// and `exports/foo/bar/baz` for its exports.
+    ///
+    /// These packages only hold aliases of the declarations, which all stay
+    /// in the single generated package: they shorten the names used by the
+    /// guest, but the generated package is still built as a whole. Splitting
+    /// the declarations themselves isn't supported, as the types, helpers and
+    /// `//export` functions of all interfaces are shared by a single cgo
+    /// package.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub interface_aliases: bool,
+
+    /// Add a `context.Context` as the first parameter of every imported and
+    /// exported function. Exports are passed the context returned by the hook
+    /// set with `SetContextHook`, `context.Background()` by default.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub context: bool,
+
+    /// Generate a `mocks` package implementing the functions imported from
+    /// each interface with stubs recording their calls, installed with the
+    /// generated `Set<Interface>Imports` functions.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub mocks: bool,
+
+    /// Add `<world>_stubs.go` to the generated package, a skeleton
+    /// implementation of the exports to fill in. The file is written only if
+    /// it doesn't exist yet. The scaffolding of `--scaffold` already contains
+    /// these stubs.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub stubs: bool,
+
+    /// Support `encoding/json` in the generated types: records get struct
+    /// tags with the WIT names of their fields, while enums, variants, options
+    /// and results implement `json.Marshaler` and `json.Unmarshaler`.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub json: bool,
+
+    /// Implement `encoding.BinaryMarshaler` and `encoding.BinaryUnmarshaler`
+    /// on the generated types, encoding values with their canonical ABI
+    /// layout. Types holding strings, lists or handles aren't supported since
+    /// their layout points elsewhere into linear memory.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub binary_marshaler: bool,
+
+    /// Adapt the imported `wasi:clocks`, `wasi:random`, `wasi:cli/environment`
+    /// and `wasi:filesystem` interfaces of WASI preview2 to helpers such as
+    /// `WasiWallClock`, `WasiRandom`, `WasiEnviron` and `WasiFS`, mirroring
+    /// the `time`, `crypto/rand`, `os` and `io/fs` packages for guests
+    /// targeting preview2 hosts. `wasi:sockets` isn't adapted, so worlds
+    /// importing it are rejected.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub wasi_adapter: bool,
+
+    /// Rename the Go identifier generated for a WIT type, function, record
+    /// field, variant or enum case or interface, given as `wit-name=GoName`, such as when two names
+    /// collide once converted to Go.
+    #[cfg_attr(
+        feature = "clap",
+        arg(long, value_name = "WIT=GO", value_parser = parse_rename, value_delimiter = ',')
+    )]
+    pub rename: Vec<(String, String)>,
+
+    /// Rename the version of a WIT package in the generated Go identifiers
+    /// and package directories, given as `namespace:package@version=Name`,
+    /// such as `wasi:http@0.2.0=V2` for `WasiHttpV2_Types`. Versions are
+    /// otherwise spelled out with underscores, as in `WasiHttp0_2_0_Types`.
+    #[cfg_attr(
+        feature = "clap",
+        arg(long, value_name = "PACKAGE=GO", value_parser = parse_rename_version, value_delimiter = ',')
+    )]
+    pub rename_version: Vec<(String, String)>,
+
+    /// Prefix the module names of the core wasm imports with the given
+    /// string, for embedders which don't link them by their canonical names.
+    /// Only supported by the guest bindings.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "PREFIX"))]
+    pub core_import_prefix: Option<String>,
+
+    /// Import all core wasm functions from the given module, for hosts
+    /// linking everything from a single module such as `env`. Imports are
+    /// then named `<interface>#<function>`, or `<function>` for functions
+    /// imported by the world itself. Only supported by the guest bindings.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "MODULE"))]
+    pub core_import_module: Option<String>,
+
+    /// Prefix the names of the core wasm exports of the WIT functions and
+    /// resource destructors with the given string. Only supported by the
+    /// guest bindings.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "PREFIX"))]
+    pub core_export_prefix: Option<String>,
+
+    /// Strip the versions of the packages from the names of the core wasm
+    /// imports and exports, for hosts predating versioned WIT packages. Only
+    /// supported by the guest bindings.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub core_unversioned: bool,
+
+    /// Report each call of an imported or exported function to the hook set
+    /// with `SetTraceHook`, on entry and on exit, e.g. to debug ABI issues or
+    /// to measure the latency of calls.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub trace: bool,
+
+    /// Report the duration of each call of an imported or exported function,
+    /// and the part of it spent lifting and lowering values, to the sink set
+    /// with `SetMetricsSink`, e.g. to feed the counters and histograms of an
+    /// existing metrics pipeline.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub metrics: bool,
+
+    /// Report the malformed values received from the other side of the
+    /// component boundary, such as strings of invalid UTF-8 or out-of-range
+    /// discriminants, as an `ABIError` to the handler set with
+    /// `SetABIErrorHandler` instead of lifting them as is or panicking.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub abi_errors: bool,
+
+    /// Skip the validation of the UTF-8 of the strings lifted with
+    /// `--abi-errors`, which is wasted work with trusted hosts. The other
+    /// values are still checked.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub skip_utf8_validation: bool,
+
+    /// Import the allocator, the arenas and the string transcoding helpers
+    /// from the package of `--runtime-package` instead of generating them
+    /// into every world, so that worlds linked together share a single copy
+    /// of them, along with a single allocator.
+    #[cfg_attr(feature = "clap", arg(long, requires = "runtime_package"))]
+    pub shared_intrinsics: bool,
+
+    /// Exchange the values of the functions of an interface through the
+    /// given memory and allocator exported by the guest instead of `memory`
+    /// and `cabi_realloc`, given as `<interface>=<memory>:<realloc>` where
+    /// the interface is named as in WIT, or after the world for its own
+    /// functions. This isolates them with the multi-memory proposal. Only
+    /// supported with `--host`.
+    #[cfg_attr(
+        feature = "clap",
+        arg(
+            long,
+            value_name = "INTERFACE=MEMORY:REALLOC",
+            value_parser = parse_memory,
+            value_delimiter = ','
+        )
+    )]
+    pub memory: Vec<(String, String, String)>,
+
+    /// Generate `Introspect`, describing the interfaces, functions and types
+    /// of the world at runtime for generic tooling such as REPLs, routers or
+    /// RPC bridges.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub introspect: bool,
+
+    /// Generate `<world>_bench_test.go`, benchmarking the lifting and
+    /// lowering of the arguments and results of each exported function
+    /// against a stubbed implementation. The benchmarks are behind the
+    /// `witbench` build tag, e.g. `tinygo test -tags witbench -bench .`, and
+    /// skip functions taking or returning handles, futures or streams.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub benchmarks: bool,
+
+    /// Generate `<world>_fuzz_test.go`, with a fuzz target per type checking
+    /// that arbitrary values of the type come back unchanged once lowered and
+    /// lifted. The targets are behind the `witfuzz` build tag and skip types
+    /// holding handles, futures or streams.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub fuzz: bool,
+
+    /// Make the TinyGo guest bindings safe to call from several goroutines, for
+    /// guests whose hooks may yield to the TinyGo scheduler in the middle of
+    /// a call: the calls of imports are serialized, and the progress of the
+    /// futures and streams waited for by several goroutines at once is
+    /// dispatched to the right one.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub goroutine_safe: bool,
+
+    /// Bind the borrowed handles of imported resources to a `<Resource>Borrow`
+    /// type, obtained with the `Borrow()` method of the owned handle, which
+    /// can't be dropped nor passed where the ownership of the resource is
+    /// transferred.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub borrow_handles: bool,
+
+    /// Generate a `New<Record>` constructor taking every field of each record,
+    /// so that fields added to a record break its callers instead of being
+    /// left unset, and a `New<Enum>` constructor range-checking the kind of the
+    /// case of each enum.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub constructors: bool,
+
+    /// Add an unexported field to records, so that they can only be written
+    /// as keyed literals or with their `New<Record>` constructor outside of
+    /// the generated package.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub sealed_records: bool,
+
+    /// Pass the records taking more than this many bytes in linear memory as
+    /// pointers, rather than copying them into every call. The pointers must
+    /// not be nil, and aren't retained past the call.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "BYTES"))]
+    pub record_pointer_threshold: Option<usize>,
+
+    /// Bind `option<T>` to `*T`, nil being `none`, instead of `Option[T]`.
+    /// Options of options keep the `Option[T]` form, so that `some(none)`
+    /// doesn't take a pointer to nil.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub option_pointers: bool,
+
+    /// Bind variants none of whose cases has a payload like enums, with
+    /// `IsValid`, `String` and `Parse<Type>` and without the payload they'd
+    /// never hold. Variants with payloads keep their form, sealed or not.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub variants_as_enums: bool,
+
+    /// Bind tuples whose elements are all of the same type, such as
+    /// `tuple<f32, f32, f32>`, to arrays like `[3]float32` instead of structs
+    /// with `F0`, `F1`, ... fields. Such tuples get `Fields` and
+    /// `<Tuple>FromFields` converting them from and to the struct form.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub tuples_as_arrays: bool,
+
+    /// Replace NaNs by the canonical NaN when lifting and lowering `f32` and
+    /// `f64` values, as the component model's canonical NaN option does, so
+    /// that hosts meant to execute deterministically get the same bit
+    /// patterns from Go whatever NaN was computed.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub canonicalize_nans: bool,
+
+    /// Emit `<world>_component_type.o`, holding the `component-type` custom
+    /// section describing the world, and link it into the module through
+    /// cgo, so that `wasm-tools component new` can wrap the TinyGo module
+    /// into a component without embedding a copy of the WIT beforehand.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub component_type_object: bool,
+
+    /// Generate `SetOnInit` and `SetOnShutdown`, setting the functions called
+    /// before the first call of an export and when the host calls the
+    /// `_shutdown` core export, so that guests can set up and tear down their
+    /// state outside of `init` functions.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub lifecycle_hooks: bool,
+
+    /// Generate `Canceled`, polling the host to let long-running exports
+    /// return early once the host cancels the call, and the functions adding
+    /// the `wit-bindgen-go` host module it polls with `--host`. With
+    /// `--context`, the context passed to exports reports the cancellation
+    /// through `Err`.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub cancellation: bool,
+
+    /// Generate `PinString` and `UnpinString`, keeping copies of strings
+    /// lowered into linear memory which are passed in place of a fresh copy
+    /// whenever the very same string is lowered again, such as the string
+    /// literals passed on every call.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub intern_strings: bool,
+
+    /// Dispatch the imported functions through a table of functions, so that
+    /// they can be replaced one by one at runtime, e.g. to inject faults. The
+    /// host bindings get an implementation of the interface of each imported
+    /// interface dispatching through such a table.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub swappable_imports: bool,
+
+    /// Names of functions or interfaces to leave out of the bindings, such
+    /// as experimental functions the guest won't implement. Functions are
+    /// named alone or as `<interface>#<function>`. Skipped exports trap
+    /// when called, so that the module still provides the whole world.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "NAME"))]
+    pub skip: Vec<String>,
+
+    /// Names of the only functions or interfaces to generate bindings for,
+    /// with the others left out as with `--skip`.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "NAME"))]
+    pub only: Vec<String>,
+
+    /// Emit a `go:generate` directive running `wit-bindgen tiny-go` with the
+    /// given arguments, so that `go generate` regenerates the bindings.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "ARGS"))]
+    pub go_generate: Option<String>,
+
+    /// Export the hash of the world the guest bindings were generated for
+    /// as the `_world_hash` core export, so that hosts can check it against
+    /// the hash of their own bindings with `GuestWorldHash`.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub export_world_hash: bool,
+
+    /// Names of imported interfaces the host may not provide, for which
+    /// `<Interface>Available` reports whether it does, so that the guest can
+    /// do without them. The host bindings get the functions defining the
+    /// `wit-bindgen-go-imports` host module the guest probes.
+    #[cfg_attr(feature = "clap", arg(long, value_name = "NAME"))]
+    pub optional_imports: Vec<String>,
+
+    /// Generate `Unimplemented<Interface>` for each exported interface,
+    /// trapping with the name of the function for the exports the guest
+    /// doesn't implement, so that guests can implement only a subset of the
+    /// exports by embedding it.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub partial_exports: bool,
+
+    /// Define the named types of the world in the package of
+    /// `--runtime-package` along with `Option` and `Result`, so that the
+    /// guest and host bindings generated against the same runtime package
+    /// share their definitions. The bindings of distinct worlds need
+    /// distinct runtime packages.
+    #[cfg_attr(feature = "clap", arg(long, requires = "runtime_package"))]
+    pub shared_types: bool,
+
+    /// Generate both the TinyGo guest bindings into `guest` and the host
+    /// bindings into `host`, sharing the types of the world as with
+    /// `--shared-types`.
+    #[cfg_attr(feature = "clap", arg(long, requires = "runtime_package"))]
+    pub guest_and_host: bool,
+
+    /// Precede the generated declarations with `//line` directives naming
+    /// the file and line of their WIT definitions, for the Go compiler and
+    /// runtime to report them, e.g. in compile errors and stack traces.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub provenance: bool,
+
+    /// The WIT files the bindings are generated from, as listed by
+    /// `Resolve::push_path`, in which `--provenance` locates the definitions.
+    /// The command line passes on the files of its WIT argument by their
+    /// absolute path.
+    #[cfg_attr(feature = "clap", arg(skip))]
+    pub wit_sources: Vec<PathBuf>,
+
+    /// Write `<world>_source_map.json`, mapping the lines of the declarations
+    /// located with `--provenance` to the WIT definitions they're generated
+    /// from.
+    #[cfg_attr(feature = "clap", arg(long, requires = "provenance"))]
+    pub source_map: bool,
+
+    /// Map WIT `string` to `[]byte` instead of `string`, saving guests which
+    /// handle the strings as bytes anyway the conversions copying them. The
+    /// lifted strings are still validated as UTF-8 with `--abi-errors`.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub strings_as_bytes: bool,
+
+    /// Move the core wasm imports of the guest bindings into
+    /// `<world>_wasm.go`, built for wasm only, and define them with stubs
+    /// panicking when called in `<world>_native.go` and `<world>_native.c`
+    /// for the other architectures. The bindings, and the code importing
+    /// them, then build with a plain `go test` on the developer's machine,
+    /// with `--mocks` or `--swappable-imports` standing in for the host.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub native_stubs: bool,
+
+    /// Generate `<Interface>Loopback` for each exported interface, calling
+    /// the exports of the guest in memory, without a wasm engine, so that
+    /// the implementations can be unit tested along with the lifting and
+    /// lowering of their values. Combine with `--native-stubs` to run the
+    /// tests with a plain `go test`.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub loopback: bool,
+
+    /// Optimize the guest bindings for size rather than speed, for
+    /// microcontroller-class deployments: the compound values are lifted
+    /// and lowered by helpers shared by all the functions exchanging values
+    /// of the same shape rather than inline, and the `String` methods
+    /// formatting the records and variants for debugging are left out.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub opt_size: bool,
+
+    /// Generate `<World>PerCall` in the host bindings, calling each export
+    /// on a fresh instance of the guest with a bounded number of calls at a
+    /// time, along with `<Interface>PerCallClient` for each exported
+    /// interface, so that a single client can be shared by any number of
+    /// goroutines.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub per_call_instances: bool,
+
+    /// Generate `WasiLogHandler`, a `slog.Handler` writing through the
+    /// imported `wasi:logging/logging` interface, and install it as the
+    /// default handler of `log/slog`, so that the logs of the guest, along
+    /// with those of the `log` package, reach the host's logging.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub slog_handler: bool,
+
+    /// Make `New<World>` take a user state of any type implementing all the
+    /// exported interfaces, `<World>State`, rather than an implementation
+    /// per interface, so that the exports are methods of a value carrying
+    /// the configuration and dependencies of the implementation.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub export_state: bool,
+
+    /// Generate a `_self_test` core export in the guest bindings, hidden
+    /// from the world, round-tripping representative values of its types
+    /// and reporting the version of the generator, and a `SelfTest` method
+    /// calling it in the host bindings, so that hosts loading third-party
+    /// guests can detect a skew between their canonical ABIs.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub self_test: bool,
+
+    /// Generate `SetStringTranscoder`, setting a function which transforms
+    /// every string lowered and lifted by the bindings, e.g. to normalize
+    /// them or to repair their invalid UTF-8 sequences before they're
+    /// validated.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub string_transcoder: bool,
+
+    /// Make the bindings easier to profile: the TinyGo guest bindings lift
+    /// the arguments and lower the results of each export in functions of
+    /// their own, `<export>_lift` and `<export>_lower`, and the host
+    /// bindings label the calls of the exports with the WIT interface and
+    /// function they call with `runtime/pprof`.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub profiling: bool,
+
+    /// Generate `<Function>Batcher` in the guest bindings for each imported
+    /// function without results that has a batched variant named
+    /// `<function>-batch`, taking a list of its arguments, or of the tuples
+    /// of its arguments. The batcher queues the calls of the function and
+    /// makes them with a single call of the variant.
+    #[cfg_attr(feature = "clap", arg(long))]
+    pub call_batching: bool,
+
+    /// What the TinyGo guest bindings do when the implementation of an export
+    /// panics: let the panic unwind as is, report it on the standard error
+    /// along with the WIT function before trapping, or convert it into the
+    /// `err` case of the result returned by the function if it's a string,
+    /// and trap like `trap` otherwise.
+    #[cfg_attr(feature = "clap", arg(long, value_enum, default_value_t = ExportPanics::default()))]
+    pub export_panics: ExportPanics,
+}
+
+#[cfg(feature = "clap")]
+fn parse_rename_version(s: &str) -> Result<(String, String), String> {
+    let (package, go) = s.split_once('=').ok_or_else(|| {
+        format!("expected string of form `<namespace>:<package>@<version>=<Name>`; got `{s}`")
+    })?;
+    if !package.contains('@') {
+        return Err(format!("`{package}` is not a versioned WIT package"));
+    }
+    if go.is_empty() || !go.chars().all(|c| c.is_alphanumeric() || c == '_') {
+        return Err(format!("`{go}` can't be part of a Go identifier"));
+    }
+    Ok((package.to_string(), go.to_string()))
+}
+
+#[cfg(feature = "clap")]
+fn parse_rename(s: &str) -> Result<(String, String), String> {
+    let (wit, go) = s
+        .split_once('=')
+        .ok_or_else(|| format!("expected string of form `<wit-name>=<GoName>`; got `{s}`"))?;
+    let mut chars = go.chars();
+    let valid = chars.next().is_some_and(|c| c.is_alphabetic() || c == '_')
+        && chars.all(|c| c.is_alphanumeric() || c == '_');
+    if !valid || GOKEYWORDS.contains(&go) {
+        return Err(format!("`{go}` is not a valid Go identifier"));
+    }
+    Ok((wit.to_string(), go.to_string()))
+}
+
+#[cfg(feature = "clap")]
+fn parse_memory(s: &str) -> Result<(String, String, String), String> {
+    let invalid = || format!("expected string of form `<interface>=<memory>:<realloc>`; got `{s}`");
+    let (iface, exports) = s.rsplit_once('=').ok_or_else(invalid)?;
+    let (memory, realloc) = exports.split_once(':').ok_or_else(invalid)?;
+    if memory.is_empty() || realloc.is_empty() {
+        return Err(invalid());
+    }
+    Ok((iface.to_string(), memory.to_string(), realloc.to_string()))
+}
+
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq)]
+#[cfg_attr(feature = "clap", derive(clap::ValueEnum))]
+pub enum HostRuntime {
+    #[default]
+    Wazero,
+    Wasmtime,
+}
+
+impl std::fmt::Display for HostRuntime {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Wazero => write!(f, "wazero"),
+            Self::Wasmtime => write!(f, "wasmtime"),
+        }
+    }
+}
+
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq)]
+#[cfg_attr(feature = "clap", derive(clap::ValueEnum))]
+pub enum ExportPanics {
+    #[default]
+    Propagate,
+    Trap,
+    Error,
+}
+
+impl std::fmt::Display for ExportPanics {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Propagate => write!(f, "propagate"),
+            Self::Trap => write!(f, "trap"),
+            Self::Error => write!(f, "error"),
+        }
+    }
 }
 
 impl Default for Opts {
@@ -32,12 +706,87 @@ impl Default for Opts {
         Self {
             gofmt: true,
             rename_package: None,
+            host: false,
+            host_runtime: HostRuntime::default(),
+            result_as_error: true,
+            unit_result_as_error: false,
+            runtime_package: None,
+            sealed_variants: false,
+            zero_copy_strings: false,
+            zero_copy_lists: false,
+            explicit_free: false,
+            string_encoding: StringEncoding::default(),
+            scaffold: false,
+            go_package: None,
+            go_module: None,
+            interface_aliases: false,
+            context: false,
+            mocks: false,
+            stubs: false,
+            json: false,
+            binary_marshaler: false,
+            wasi_adapter: false,
+            rename: Vec::new(),
+            rename_version: Vec::new(),
+            core_import_prefix: None,
+            core_import_module: None,
+            core_export_prefix: None,
+            core_unversioned: false,
+            trace: false,
+            metrics: false,
+            abi_errors: false,
+            skip_utf8_validation: false,
+            shared_intrinsics: false,
+            memory: Vec::new(),
+            introspect: false,
+            benchmarks: false,
+            fuzz: false,
+            goroutine_safe: false,
+            borrow_handles: false,
+            constructors: false,
+            sealed_records: false,
+            record_pointer_threshold: None,
+            option_pointers: false,
+            variants_as_enums: false,
+            tuples_as_arrays: false,
+            canonicalize_nans: false,
+            component_type_object: false,
+            lifecycle_hooks: false,
+            cancellation: false,
+            intern_strings: false,
+            swappable_imports: false,
+            skip: Vec::new(),
+            only: Vec::new(),
+            go_generate: None,
+            export_world_hash: false,
+            optional_imports: Vec::new(),
+            partial_exports: false,
+            shared_types: false,
+            guest_and_host: false,
+            provenance: false,
+            wit_sources: Vec::new(),
+            source_map: false,
+            strings_as_bytes: false,
+            native_stubs: false,
+            loopback: false,
+            opt_size: false,
+            per_call_instances: false,
+            slog_handler: false,
+            export_state: false,
+            self_test: false,
+            string_transcoder: false,
+            profiling: false,
+            call_batching: false,
+            export_panics: ExportPanics::default(),
         } // Set the default value of gofmt to true
     }
 }
 
 impl Opts {
     pub fn build(&self) -> Box<dyn WorldGenerator> {
+        if self.guest_and_host {
+            return Box::new(shared::GuestAndHost::new(self));
+        }
         Box::new(TinyGo {
             opts: self.clone(),
             ..TinyGo::default()
@@ -63,6 +812,9 @@ pub struct TinyGo {
     // mapping from interface ID to the name of the interface
     interface_names: HashMap<InterfaceId, WorldKey>,
 
+    // the WIT names of the interfaces bound to each Go namespace
+    namespaces: HashMap<String, String>,
+
     // C type names
     c_type_names: HashMap<TypeId, String>,
 
@@ -78,6 +830,63 @@ pub struct TinyGo {
 
     // the world ID
     world_id: Option<WorldId>,
+
+    // the futures and streams whose intrinsics were generated, by the suffix
+    // naming them
+    async_payloads: HashSet<String>,
+
+    // the exported interfaces and their method declarations, bound together
+    // by `New<World>` and stubbed out by the scaffolding
+    export_interfaces: Vec<(String, Vec<String>)>,
+
+    // the packages re-exporting the bindings of each interface
+    facades: Vec<facade::Facade>,
+
+    // the imported functions of each interface, mocked by the `mocks` package
+    mocks: Vec<mocks::Mock>,
+
+    // the exported functions benchmarked by `<world>_bench_test.go`
+    benchmarks: Vec<bench::Benchmark>,
+
+    // the types round-tripped by `<world>_fuzz_test.go`
+    fuzz_targets: Vec<fuzz::FuzzTarget>,
+
+    // the types round-tripped by the self-test of `--self-test`
+    self_tests: Vec<fuzz::FuzzTarget>,
+
+    // the imported WASI interfaces wrapped by the adapter, and the Go
+    // namespace of their bindings
+    wasi_imports: BTreeMap<String, String>,
+
+    // the Go namespace of the bindings of the logging interface written
+    // through by `WasiLogHandler`
+    slog_import: Option<String>,
+
+    // the Go interfaces implemented by the host for the imports of the guest,
+    // along with the declarations of their methods
+    host_imports: Vec<(String, Vec<String>)>,
+
+    // the hash and the qualified name of the world, stamped on the bindings
+    world_hash: u64,
+    world_qualified_name: String,
+
+    // the types used as the `err` case of results, which implement `error`
+    error_types: HashSet<TypeId>,
+
+    // the types defined in the runtime package with `--shared-types`, and
+    // the imports they need
+    shared_types: Source,
+    shared_requirements: imports::ImportRequirements,
+
+    // the locations of the WIT definitions with `--provenance`
+    wit_locations: provenance::WitLocations,
+
+    // the helpers lifting and lowering values with `--opt-size`
+    outlined: outline::Outlined,
+
+    // the first unsupported combination of options and types, found by
+    // `preprocess` and reported by `finish` instead of generating bindings
+    unsupported: Option<anyhow::Error>,
 }
 
 impl TinyGo {
@@ -98,9 +907,157 @@ impl TinyGo {
             exported_resources: Default::default(),
             methods: Default::default(),
             wasm_import_module,
+            facade: Source::default(),
+            facade_imports: BTreeMap::new(),
+            mock_funcs: Vec::new(),
+            swappable_funcs: Vec::new(),
+            unimplemented_funcs: Vec::new(),
+            loopback_funcs: Vec::new(),
+            per_call_funcs: Vec::new(),
         }
     }
 
+    /// Returns the customizations of the core wasm names set by the options,
+    /// shared by the Go and the C bindings.
+    pub(crate) fn core_names(&self) -> wit_bindgen_c::CoreNames {
+        wit_bindgen_c::CoreNames {
+            import_prefix: self.opts.core_import_prefix.clone(),
+            import_module: self.opts.core_import_module.clone(),
+            export_prefix: self.opts.core_export_prefix.clone(),
+            unversioned: self.opts.core_unversioned,
+        }
+    }
+
+    /// Checks that the options support each other, so that generation can
+    /// fail with an error rather than with bindings that don't work.
+    fn check_support(&self) -> Result<()> {
+        let custom_core_names = self.opts.core_import_prefix.is_some()
+            || self.opts.core_import_module.is_some()
+            || self.opts.core_export_prefix.is_some()
+            || self.opts.core_unversioned;
+        if custom_core_names && self.opts.host {
+            bail!(
+                "`--core-import-prefix`, `--core-import-module`, `--core-export-prefix` and \
+                `--core-unversioned` are only supported by the guest bindings"
+            );
+        }
+        if !self.opts.memory.is_empty() && !self.opts.host {
+            bail!("custom memories are only supported with `--host`");
+        }
+        if (self.opts.benchmarks || self.opts.fuzz) && (self.opts.host || self.opts.explicit_free) {
+            bail!(
+                "benchmarks and fuzz targets are only supported by the guest bindings \
+                without `--explicit-free`"
+            );
+        }
+        if self.opts.goroutine_safe && self.opts.host {
+            bail!("`--goroutine-safe` is only supported by the guest bindings");
+        }
+        if self.opts.record_pointer_threshold.is_some() && self.opts.host {
+            bail!("`--record-pointer-threshold` is only supported by the guest bindings");
+        }
+        if self.opts.component_type_object && self.opts.host {
+            bail!("`--component-type-object` is only supported by the guest bindings");
+        }
+        if self.opts.component_type_object
+            && matches!(self.opts.string_encoding, StringEncoding::CompactUTF16)
+        {
+            bail!(
+                "`--component-type-object` isn't supported with the `latin1+utf16` string \
+                encoding, pass it to `wasm-tools component embed` instead"
+            );
+        }
+        if self.opts.lifecycle_hooks && self.opts.host {
+            bail!("`--lifecycle-hooks` is only supported by the guest bindings");
+        }
+        if self.opts.intern_strings && self.opts.host {
+            bail!("`--intern-strings` is only supported by the guest bindings");
+        }
+        if self.opts.export_world_hash && self.opts.host {
+            bail!("`--export-world-hash` is only supported by the guest bindings");
+        }
+        if self.opts.partial_exports && self.opts.host {
+            bail!("`--partial-exports` is only supported by the guest bindings");
+        }
+        if self.opts.shared_types
+            && (self.opts.interface_aliases
+                || self.opts.scaffold
+                || self.opts.mocks
+                || self.opts.stubs
+                || self.opts.benchmarks
+                || self.opts.fuzz
+                || self.opts.explicit_free)
+        {
+            bail!(
+                "`--shared-types` isn't supported with `--interface-aliases`, `--scaffold`, \
+                `--mocks`, `--stubs`, `--benchmarks`, `--fuzz` or `--explicit-free`"
+            );
+        }
+        if self.opts.source_map && !self.opts.provenance {
+            bail!("`--source-map` requires `--provenance`");
+        }
+        if self.opts.strings_as_bytes
+            && (self.opts.host
+                || !matches!(self.opts.string_encoding, StringEncoding::UTF8)
+                || self.opts.intern_strings
+                || self.opts.explicit_free
+                || self.opts.json
+                || self.opts.wasi_adapter
+                || self.opts.benchmarks
+                || self.opts.fuzz)
+        {
+            bail!(
+                "`--strings-as-bytes` is only supported by the guest bindings with UTF-8 strings, \
+                and not with `--intern-strings`, `--explicit-free`, `--json`, `--wasi-adapter`, \
+                `--benchmarks` or `--fuzz`"
+            );
+        }
+        if self.opts.native_stubs && self.opts.host {
+            bail!("`--native-stubs` is only supported by the guest bindings");
+        }
+        if self.opts.loopback && (self.opts.host || self.opts.explicit_free) {
+            bail!(
+                "`--loopback` is only supported by the guest bindings, and not with \
+                `--explicit-free`"
+            );
+        }
+        if self.opts.opt_size
+            && (self.opts.host
+                || self.opts.zero_copy_strings
+                || self.opts.zero_copy_lists
+                || self.opts.explicit_free
+                || self.opts.record_pointer_threshold.is_some())
+        {
+            bail!(
+                "`--opt-size` is only supported by the guest bindings, and not with \
+                `--zero-copy-strings`, `--zero-copy-lists`, `--explicit-free` or \
+                `--record-pointer-threshold`"
+            );
+        }
+        if self.opts.per_call_instances && !self.opts.host {
+            bail!("`--per-call-instances` is only supported with `--host`");
+        }
+        if self.opts.slog_handler && self.opts.host {
+            bail!("`--slog-handler` is only supported by the guest bindings");
+        }
+        if self.opts.export_state && self.opts.host {
+            bail!("`--export-state` is only supported by the guest bindings");
+        }
+        if self.opts.self_test && !self.opts.host && self.opts.explicit_free {
+            bail!("`--self-test` isn't supported by the guest bindings with `--explicit-free`");
+        }
+        if self.opts.string_transcoder && self.opts.strings_as_bytes {
+            bail!("`--string-transcoder` isn't supported with `--strings-as-bytes`");
+        }
+        if self.opts.call_batching && self.opts.host {
+            bail!("`--call-batching` is only supported by the guest bindings");
+        }
+        if self.opts.export_panics != ExportPanics::Propagate && self.opts.host {
+            bail!("`--export-panics` is only supported by the guest bindings");
+        }
+        Ok(())
+    }
+
     fn get_c_ty(&self, ty: &Type) -> String {
         let res = match ty {
             Type::Bool => "bool".into(),
@@ -147,9 +1104,155 @@ impl TinyGo {
         self.import_requirements.needs_fmt_import = needs_fmt_import;
     }
 
+    fn with_binary_import(&mut self, needs_binary_import: bool) {
+        self.import_requirements.needs_binary_import = needs_binary_import;
+    }
+
+    fn with_json_import(&mut self, needs_json_import: bool) {
+        self.import_requirements.needs_json_import = needs_json_import;
+    }
+
     pub fn with_sync_import(&mut self, needs_sync_import: bool) {
         self.import_requirements.needs_sync_import = needs_sync_import;
     }
+
+    fn with_result_error(&mut self, needs_result_error: bool) {
+        self.import_requirements.needs_result_error = needs_result_error;
+    }
+
+    fn with_math_import(&mut self, needs_math_import: bool) {
+        self.import_requirements.needs_math_import = needs_math_import;
+    }
+
+    fn with_strings_import(&mut self, needs_strings_import: bool) {
+        self.import_requirements.needs_strings_import = needs_strings_import;
+    }
+
+    fn with_utf8_import(&mut self, needs_utf8_import: bool) {
+        self.import_requirements.needs_utf8_import = needs_utf8_import;
+    }
+
+    fn with_utf16(&mut self, needs_utf16: bool) {
+        self.import_requirements.needs_utf16 = needs_utf16;
+    }
+
+    fn with_compact_utf16(&mut self, needs_compact_utf16: bool) {
+        self.import_requirements.needs_compact_utf16 = needs_compact_utf16;
+    }
+
+    fn with_bytes(&mut self, needs_bytes: bool) {
+        self.import_requirements.needs_bytes = needs_bytes;
+    }
+
+    fn with_canonical_nans(&mut self, needs_canonical_nans: bool) {
+        self.import_requirements.needs_canonical_nans = needs_canonical_nans;
+    }
+
+    fn with_future(&mut self, needs_future: bool) {
+        self.import_requirements.needs_future = needs_future;
+    }
+
+    fn with_stream(&mut self, needs_stream: bool) {
+        self.import_requirements.needs_stream = needs_stream;
+    }
+
+    /// Returns the Go identifier of the WIT item `name`, converted to
+    /// UpperCamelCase unless renamed with `--rename`.
+    fn go_ident(&self, name: &str) -> String {
+        match self.opts.rename.iter().rev().find(|(wit, _)| wit == name) {
+            Some((_, go)) => go.clone(),
+            None => name.to_upper_camel_case(),
+        }
+    }
+
+    /// Returns the name of the generated Go package.
+    fn package_name(&self) -> String {
+        match &self.opts.go_package {
+            Some(name) => name.clone(),
+            None => avoid_keyword(&self.world.to_snake_case()),
+        }
+    }
+
+    /// Returns the path of the Go module containing the generated package.
+    fn module_path(&self) -> String {
+        match &self.opts.go_module {
+            Some(path) => path.clone(),
+            None => format!("wit_{}_go", self.world.to_snake_case()),
+        }
+    }
+
+    /// Generates the `Option` and `Result` types used by the world, returning
+    /// the import of the runtime package defining them if there is one.
+    fn generate_types(&mut self, snake: String, files: &mut Files) -> Option<String> {
+        self.import_requirements.result_option_json = self.opts.json;
+        self.import_requirements.result_error_bytes = self.opts.strings_as_bytes;
+        match &self.opts.runtime_package {
+            Some(path) => {
+                let path = path.clone();
+                let package = path.rsplit('/').next().unwrap().to_string();
+                // the imports of the bindings are generated either way
+                let file = format!("{package}/types.go");
+                self.import_requirements
+                    .generate(package.clone(), files, file.clone());
+                self.gofmt_file(files, &file);
+                let shared_types = self.generate_shared_types(&package, files);
+                if self.shared_intrinsics() {
+                    self.generate_intrinsics(&package, files);
+                } else if !self.import_requirements.needs_result_option && !shared_types {
+                    return None;
+                }
+                Some(format!("import . \"{path}\"\n"))
+            }
+            None => {
+                let file = format!("{}_types.go", self.world.to_snake_case());
+                self.import_requirements
+                    .generate(snake, files, file.clone());
+                self.gofmt_file(files, &file);
+                None
+            }
+        }
+    }
+
+    /// Formats the already emitted `file` if `gofmt` is enabled.
+    fn gofmt_file(&self, files: &mut Files, file: &str) {
+        if !self.opts.gofmt {
+            return;
+        }
+        if let Some(contents) = files.remove(file) {
+            files.push(file, gofmt(&contents).as_bytes());
+        }
+    }
+
+    fn gofmt(&mut self) {
+        let formatted = gofmt(self.src.as_bytes());
+        self.src.as_mut_string().truncate(0);
+        self.src.push_str(&formatted);
+    }
+}
+
+/// Runs `src` through `gofmt`, returning the formatted source.
+fn gofmt(src: &[u8]) -> String {
+    let mut child = std::process::Command::new("gofmt")
+        .stdin(Stdio::piped())
+        .stdout(Stdio::piped())
+        .spawn()
+        .expect("failed to spawn gofmt");
+    child
+        .stdin
+        .take()
+        .unwrap()
+        .write_all(src)
+        .expect("failed to write to gofmt");
+    let mut formatted = String::new();
+    child
+        .stdout
+        .take()
+        .unwrap()
+        .read_to_string(&mut formatted)
+        .expect("failed to read from gofmt");
+    let status = child.wait().expect("failed to wait on gofmt");
+    assert!(status.success());
+    formatted
 }
 
 impl WorldGenerator for TinyGo {
@@ -161,6 +1264,16 @@ impl WorldGenerator for TinyGo {
             .unwrap_or_else(|| resolve.worlds[world].name.clone());
         self.sizes.fill(resolve);
         self.world_id = Some(world);
+        self.collect_error_types(resolve);
+        if self.opts.provenance {
+            self.wit_locations = provenance::WitLocations::scan(&self.opts.wit_sources);
+        }
+
+        self.unsupported = self
+            .check_support()
+            .and_then(|()| self.check_host_types(resolve, world))
+            .and_then(|()| self.check_wasi_adapter(resolve, world))
+            .err();
     }
 
     fn import_interface(
@@ -170,23 +1283,54 @@ impl WorldGenerator for TinyGo {
         id: InterfaceId,
         _files: &mut Files,
     ) -> Result<()> {
+        if self.unsupported.is_some() {
+            return Ok(());
+        }
         let name_raw = &resolve.name_world_key(name);
         self.src
             .push_str(&format!("// Import functions from {name_raw}\n"));
         self.interface_names.insert(id, name.clone());
 
+        let host = self.opts.host;
         let mut gen = self.interface(resolve, Direction::Import, Some(name_raw));
         gen.interface = Some((id, name));
         gen.define_interface_types(id);
 
         for (_name, func) in resolve.interfaces[id].functions.iter() {
-            gen.import(resolve, func);
+            if host {
+                gen.host_import(func);
+            } else {
+                gen.import(resolve, func);
+            }
         }
 
+        if host {
+            gen.host_finish_imports();
+        } else {
+            let funcs = resolve.interfaces[id]
+                .functions
+                .values()
+                .collect::<Vec<_>>();
+            gen.print_batchers(&funcs);
+            gen.finish_imports();
+        }
+
+        let namespace = gen.namespace();
         let src = mem::take(&mut gen.src);
         let preamble = mem::take(&mut gen.preamble);
+        let facade = (
+            gen.facade_dir().unwrap(),
+            mem::take(&mut gen.facade_imports),
+            mem::take(&mut gen.facade),
+        );
+        self.claim_namespace(namespace.clone(), name_raw);
         self.src.push_str(&src);
         self.preamble.append_src(&preamble);
+        self.push_facade(facade.0, facade.1, facade.2);
+        if !host {
+            self.slog_import(resolve, id, namespace.clone());
+            self.wasi_import(resolve, id, namespace);
+        }
 
         Ok(())
     }
@@ -198,15 +1342,31 @@ impl WorldGenerator for TinyGo {
         funcs: &[(&str, &Function)],
         _files: &mut Files,
     ) {
+        if self.unsupported.is_some() {
+            return;
+        }
         let name = &resolve.worlds[world].name;
         self.src
             .push_str(&format!("// Import functions from {name}\n"));
 
+        let host = self.opts.host;
         let mut gen = self.interface(resolve, Direction::Import, Some("$root"));
         gen.define_function_types(funcs);
 
         for (_name, func) in funcs.iter() {
-            gen.import(resolve, func);
+            if host {
+                gen.host_import(func);
+            } else {
+                gen.import(resolve, func);
+            }
+        }
+
+        if host {
+            gen.host_finish_imports();
+        } else {
+            let funcs = funcs.iter().map(|(_, func)| *func).collect::<Vec<_>>();
+            gen.print_batchers(&funcs);
+            gen.finish_imports();
         }
         let src = mem::take(&mut gen.src);
         let preamble = mem::take(&mut gen.preamble);
@@ -215,6 +1375,9 @@ impl WorldGenerator for TinyGo {
     }
 
     fn pre_export_interface(&mut self, resolve: &Resolve, _files: &mut Files) -> Result<()> {
+        if self.unsupported.is_some() {
+            return Ok(());
+        }
         let world = self.world_id.unwrap();
         let live_import_types = imported_types_used_by_exported_interfaces(resolve, world);
         self.c_type_namespaces
@@ -232,25 +1395,46 @@ impl WorldGenerator for TinyGo {
         id: InterfaceId,
         _files: &mut Files,
     ) -> Result<()> {
+        if self.unsupported.is_some() {
+            return Ok(());
+        }
         self.interface_names.insert(id, name.clone());
         let name_raw = &resolve.name_world_key(name);
         self.src
             .push_str(&format!("// Export functions from {name_raw}\n"));
 
+        let host = self.opts.host;
         let mut gen = self.interface(resolve, Direction::Export, None);
         gen.interface = Some((id, name));
         gen.define_interface_types(id);
 
         for (_name, func) in resolve.interfaces[id].functions.iter() {
-            gen.export(resolve, func);
+            if host {
+                gen.host_export(func);
+            } else {
+                gen.export(resolve, func);
+            }
         }
 
-        gen.finish();
+        if host {
+            gen.host_finish_exports();
+            gen.host_finish_per_call();
+        } else {
+            gen.finish();
+        }
 
+        let namespace = gen.namespace();
         let src = mem::take(&mut gen.src);
         let preamble = mem::take(&mut gen.preamble);
+        let facade = (
+            gen.facade_dir().unwrap(),
+            mem::take(&mut gen.facade_imports),
+            mem::take(&mut gen.facade),
+        );
+        self.claim_namespace(namespace, name_raw);
         self.src.push_str(&src);
         self.preamble.append_src(&preamble);
+        self.push_facade(facade.0, facade.1, facade.2);
         Ok(())
     }
 
@@ -261,18 +1445,31 @@ impl WorldGenerator for TinyGo {
         funcs: &[(&str, &Function)],
         _files: &mut Files,
     ) -> Result<()> {
+        if self.unsupported.is_some() {
+            return Ok(());
+        }
         let name = &resolve.worlds[world].name;
         self.src
             .push_str(&format!("// Export functions from {name}\n"));
 
+        let host = self.opts.host;
         let mut gen = self.interface(resolve, Direction::Export, None);
         gen.define_function_types(funcs);
 
         for (_name, func) in funcs.iter() {
-            gen.export(resolve, func);
+            if host {
+                gen.host_export(func);
+            } else {
+                gen.export(resolve, func);
+            }
         }
 
-        gen.finish();
+        if host {
+            gen.host_finish_exports();
+            gen.host_finish_per_call();
+        } else {
+            gen.finish();
+        }
 
         let src = mem::take(&mut gen.src);
         let preamble = mem::take(&mut gen.preamble);
@@ -288,6 +1485,9 @@ impl WorldGenerator for TinyGo {
         types: &[(&str, TypeId)],
         _files: &mut Files,
     ) {
+        if self.unsupported.is_some() {
+            return;
+        }
         let mut gen = self.interface(resolve, Direction::Import, Some("$root"));
         let mut live = LiveTypes::default();
         for (_, id) in types {
@@ -299,14 +1499,98 @@ impl WorldGenerator for TinyGo {
     }
 
     fn finish(&mut self, resolve: &Resolve, id: WorldId, files: &mut Files) -> Result<()> {
+        if let Some(err) = self.unsupported.take() {
+            return Err(err);
+        }
+        self.stamp_world(resolve, id);
+        if self.opts.introspect {
+            self.print_introspection(resolve, id);
+        }
+        if self.opts.host {
+            self.finish_host(files);
+            self.finish_provenance(files);
+            return Ok(());
+        }
         // make sure all types are defined on top of the file
         let src = mem::take(&mut self.src);
         self.src.push_str(&src);
+        if self.opts.intern_strings {
+            // the interned strings are encoded with the helpers of the lowered ones
+            match self.opts.string_encoding {
+                StringEncoding::UTF8 => {}
+                StringEncoding::UTF16 => self.with_utf16(true),
+                StringEncoding::CompactUTF16 => {
+                    self.with_utf16(true);
+                    self.with_compact_utf16(true);
+                }
+            }
+            self.src.push_str(interning::INTERNED_STRINGS);
+            self.src.push_str(self.intern_encoder());
+        }
+        if self.shared_intrinsics() {
+            self.print_intrinsics_shim();
+        } else {
+            self.src.push_str(alloc::ALLOCATOR);
+        }
+        if self.opts.context {
+            self.import_requirements.needs_context_import = true;
+            self.src.push_str(context::CONTEXT_HOOK);
+        }
+        if self.opts.string_transcoder {
+            self.src.push_str(transcode::STRING_TRANSCODER);
+        }
+        if self.opts.trace {
+            self.src.push_str(trace::TRACE_HOOK);
+        }
+        if self.opts.metrics {
+            self.import_requirements.needs_time_import = true;
+            self.src.push_str(metrics::METRICS_SINK);
+        }
+        if self.opts.lifecycle_hooks {
+            self.src.push_str(lifecycle::LIFECYCLE_HOOKS);
+        }
+        if self.opts.export_panics != ExportPanics::Propagate {
+            self.with_fmt_import(true);
+            self.import_requirements.needs_os_import = true;
+            self.src.push_str(panics::EXPORT_PANICS);
+        }
+        self.print_self_test();
+        if self.opts.cancellation {
+            self.src.push_str(cancel::CANCEL_HOOK);
+            if self.opts.context {
+                self.src.push_str(cancel::CANCEL_CONTEXT);
+            }
+        }
+        if !self.opts.optional_imports.is_empty() {
+            self.src.push_str(optional::AVAILABILITY_PROBE);
+        }
+        if self.opts.abi_errors {
+            self.src.push_str(abi_error::ABI_ERROR);
+        }
+        if self.opts.goroutine_safe {
+            self.with_sync_import(true);
+            // waiting for futures and streams yields to the other goroutines
+            self.import_requirements.needs_runtime_import =
+                self.import_requirements.needs_future || self.import_requirements.needs_stream;
+            self.src.push_str(goroutines::CALL_MUTEX);
+        }
+        if self.opts.explicit_free {
+            self.src.push_str(alloc::EXPLICIT_FREE);
+            self.src.push_str(match self.opts.string_encoding {
+                StringEncoding::UTF8 => alloc::FREE_STRING,
+                _ => alloc::FREE_TRANSCODED_STRING,
+            });
+        }
+        self.print_wasi_adapter();
+        self.print_slog_handler();
+        self.print_world_hash();
+        self.with_import_unsafe(true);
 
         // prepend package and imports header
         let src = mem::take(&mut self.src);
         wit_bindgen_core::generated_preamble(&mut self.src, env!("CARGO_PKG_VERSION"));
-        let snake = avoid_keyword(self.world.to_snake_case().as_str()).to_owned();
+        self.print_stamp();
+        let snake = self.package_name();
         // add package
         self.src.push_str("package ");
         self.src.push_str(&snake);
@@ -317,49 +1601,97 @@ impl WorldGenerator for TinyGo {
         self.src.push_str(self.world.to_snake_case().as_str());
         self.src.push_str(".h\"\n");
         self.src.push_str("// #include <stdlib.h>\n");
+        if self.opts.component_type_object {
+            // defines the symbol the C bindings reference to have it linked in
+            let arch = if self.opts.native_stubs { "wasm " } else { "" };
+            self.src.push_str(&format!(
+                "// #cgo {arch}LDFLAGS: ${{SRCDIR}}/{}_component_type.o\n",
+                self.world.to_snake_case()
+            ));
+        }
         if self.preamble.len() > 0 {
             self.src.append_src(&self.preamble);
         }
         self.src.push_str("import \"C\"\n");
         let world = self.world.to_snake_case();
 
-        self.import_requirements
-            .generate(snake, files, format!("{}_types.go", world));
+        let runtime_import = self.generate_types(snake, files);
         self.src.push_str(&self.import_requirements.src);
+        if let Some(runtime_import) = runtime_import {
+            self.src.push_str(&runtime_import);
+        }
 
         self.src.push_str(&src);
+        if self.import_requirements.needs_utf16 {
+            self.src.push_str(encoding::UTF16_HELPERS);
+        }
+        if self.import_requirements.needs_compact_utf16 {
+            self.src.push_str(encoding::COMPACT_UTF16_HELPERS);
+        }
+        if self.import_requirements.needs_bytes {
+            self.src.push_str(encoding::BYTES_HELPERS);
+        }
+        if self.import_requirements.needs_canonical_nans {
+            self.src.push_str(nans::NAN_HELPERS);
+        }
+        self.src.push_str(&mem::take(&mut self.outlined.src));
+        if self.import_requirements.needs_future || self.import_requirements.needs_stream {
+            self.src.push_str(async_support::ASYNC_RUNTIME);
+            let (module, name) = self.core_names().import("$root", "[task-wait]");
+            self.src.push_str(&format!(
+                "
+                //go:wasmimport {module} {name}
+                func wasmTaskWait(payload unsafe.Pointer) int32
+                "
+            ));
+            if self.opts.goroutine_safe {
+                self.src.push_str(async_support::ASYNC_WAIT_GOROUTINE_SAFE);
+            } else {
+                self.src.push_str(async_support::ASYNC_WAIT);
+            }
+        }
+        if self.import_requirements.needs_future {
+            self.src.push_str(async_support::FUTURE_RUNTIME);
+        }
+        if self.import_requirements.needs_stream {
+            self.src.push_str(async_support::STREAM_RUNTIME);
+        }
+        self.print_instance();
+        self.split_wasm_imports(files);
 
         if self.opts.gofmt {
-            let mut child = std::process::Command::new("gofmt")
-                .stdin(Stdio::piped())
-                .stdout(Stdio::piped())
-                .spawn()
-                .expect("failed to spawn gofmt");
-            child
-                .stdin
-                .take()
-                .unwrap()
-                .write_all(self.src.as_bytes())
-                .expect("failed to write to gofmt");
-            self.src.as_mut_string().truncate(0);
-            child
-                .stdout
-                .take()
-                .unwrap()
-                .read_to_string(self.src.as_mut_string())
-                .expect("failed to read from gofmt");
-            let status = child.wait().expect("failed to wait on gofmt");
-            assert!(status.success());
+            self.gofmt();
         }
         files.push(&format!("{}.go", world), self.src.as_bytes());
 
         let mut opts = wit_bindgen_c::Opts::default();
         opts.no_sig_flattening = true;
-        opts.no_object_file = true;
+        opts.no_object_file = !self.opts.component_type_object;
         opts.rename_world = self.opts.rename_package.clone();
+        // compact UTF-16 strings are encoded and decoded on the Go side, and
+        // only passed through the C bindings as bytes and tagged lengths
+        opts.string_encoding = match self.opts.string_encoding {
+            StringEncoding::CompactUTF16 => StringEncoding::UTF8,
+            encoding => encoding,
+        };
+        opts.extern_post_return = true;
+        opts.extern_return_area = true;
+        opts.core_names = self.core_names();
         opts.build()
             .generate(resolve, id, files)
             .expect("C generator should be infallible");
+        self.native_c_stubs(files);
+
+        self.finish_facades(files);
+        self.finish_mocks(files);
+        self.finish_benchmarks(files);
+        self.finish_fuzz_targets(files);
+        if self.opts.scaffold {
+            self.scaffold(files);
+        } else if self.opts.stubs {
+            self.stubs(files);
+        }
+        self.finish_provenance(files);
 
         Ok(())
     }
@@ -373,6 +1705,17 @@ fn avoid_keyword(s: &str) -> String {
     }
 }
 
+/// Returns the name of a local variable or parameter named `s` in WIT,
+/// escaped so that it shadows neither a keyword nor the predeclared
+/// identifiers and packages the generated code relies on.
+fn local_name(s: &str) -> String {
+    if GOPREDECLARED.contains(&s) {
+        format!("_{s}")
+    } else {
+        avoid_keyword(s)
+    }
+}
+
 // a list of Go keywords
 const GOKEYWORDS: [&str; 26] = [
     "break",
@@ -404,3 +1747,77 @@ const GOKEYWORDS: [&str; 26] = [
     // it's used as a variable name that passes to C
     "ret",
 ];
+
+// the predeclared identifiers of Go, followed by the names of the packages
+// imported by the generated code, which parameters must not shadow
+const GOPREDECLARED: [&str; 69] = [
+    "any",
+    "append",
+    "bool",
+    "byte",
+    "cap",
+    "clear",
+    "close",
+    "complex",
+    "complex128",
+    "complex64",
+    "comparable",
+    "copy",
+    "delete",
+    "error",
+    "false",
+    "float32",
+    "float64",
+    "imag",
+    "int",
+    "int16",
+    "int32",
+    "int64",
+    "int8",
+    "iota",
+    "len",
+    "make",
+    "max",
+    "min",
+    "new",
+    "nil",
+    "panic",
+    "print",
+    "println",
+    "real",
+    "recover",
+    "rune",
+    "string",
+    "true",
+    "uint",
+    "uint16",
+    "uint32",
+    "uint64",
+    "uint8",
+    "uintptr",
+    "api",
+    "binary",
+    "bytes",
+    "context",
+    "errors",
+    "fmt",
+    "fs",
+    "io",
+    "json",
+    "math",
+    "os",
+    "path",
+    "pprof",
+    "runtime",
+    "slog",
+    "sort",
+    "strings",
+    "sync",
+    "testing",
+    "time",
+    "unsafe",
+    "utf16",
+    "utf8",
+    "wasmtime",
+    "wazero",
+];
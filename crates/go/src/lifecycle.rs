@@ -0,0 +1,61 @@
+use crate::interface::InterfaceGenerator;
+
+/// The hooks called when the guest is instantiated and shut down with
+/// `--lifecycle-hooks`.
+///
+/// The component model has no notion of either, so the init hook runs on the
+/// first call of an export, once all the `init` functions of the program ran,
+/// and the shutdown hook runs when the host calls the `_shutdown` core export,
+/// as the `Shutdown` method of the instances of the generated host bindings
+/// does.
+pub(crate) const LIFECYCLE_HOOKS: &str = r#"
+var (
+	cabiOnInit     func()
+	cabiOnShutdown func()
+	cabiInitDone   bool
+)
+
+// `SetOnInit` sets the function called once the guest is instantiated, before
+// the first call of any of its exports, e.g. to set up state depending on the
+// configuration made by `init` functions.
+func SetOnInit(hook func()) {
+	cabiOnInit = hook
+}
+
+// `SetOnShutdown` sets the function called when the host shuts the guest
+// down, e.g. to flush buffers and close resources. It's called at most once,
+// and only if the host signals the shutdown.
+func SetOnShutdown(hook func()) {
+	cabiOnShutdown = hook
+}
+
+func cabiInit() {
+	if cabiInitDone {
+		return
+	}
+	cabiInitDone = true
+	if cabiOnInit != nil {
+		cabiOnInit()
+	}
+}
+
+//export _shutdown
+func cabiShutdown() {
+	hook := cabiOnShutdown
+	cabiOnShutdown = nil
+	if hook != nil {
+		hook()
+	}
+}
+"#;
+
+impl InterfaceGenerator<'_> {
+    /// Returns the statement running the init hook on the first call of an
+    /// export with `--lifecycle-hooks`.
+    pub(crate) fn lifecycle_init(&self) -> &'static str {
+        if !self.gen.opts.lifecycle_hooks {
+            return "";
+        }
+        "cabiInit()\n"
+    }
+}
@@ -0,0 +1,166 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::{ToLowerCamelCase, ToSnakeCase};
+use wit_bindgen_c::is_arg_by_pointer;
+use wit_bindgen_core::wit_parser::{Function, FunctionKind, Resolve};
+use wit_bindgen_core::{abi, uwriteln, Direction, Source};
+
+use super::{bindgen, local_name};
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Records the method of `<Interface>Loopback` calling the exported
+    /// `func` through its export with `--loopback`.
+    ///
+    /// The arguments are lowered and the results lifted as by an import of
+    /// the function, so that the values take the same path as between the
+    /// guest and the host. Only freestanding functions of plain data are
+    /// supported, since handles, futures and streams would need a host on
+    /// the other end; the others panic when called through the loopback.
+    pub(crate) fn loopback_export(&mut self, resolve: &Resolve, func: &Function) {
+        // the methods of resources aren't part of the exported interface
+        if !self.gen.opts.loopback || matches!(func.kind, FunctionKind::Method(_)) {
+            return;
+        }
+        let decl = self.func_sig_with_no_namespace(func);
+        let supported = matches!(func.kind, FunctionKind::Freestanding)
+            && func
+                .params
+                .iter()
+                .map(|(_, ty)| ty)
+                .chain(func.results.iter_types())
+                .all(|ty| self.is_plain_data(ty));
+        if !supported {
+            let body = format!(
+                "panic(\"`{}` can't be called through the loopback\")\n",
+                func.name
+            );
+            self.loopback_funcs.push((decl, body));
+            return;
+        }
+
+        // the results are copied out of the memory of the export, which is
+        // released by its post-return function, like an import would
+        let direction = mem::replace(&mut self.direction, Direction::Import);
+        let mut bindgen = bindgen::FunctionBindgen::values(self, "cabi_arena");
+        for (name, ty) in func.params.iter() {
+            bindgen.lower(&local_name(&name.to_snake_case()), ty);
+        }
+        match func.results.len() {
+            0 => {}
+            1 => {
+                let ty = func.results.iter_types().next().unwrap();
+                bindgen.lift_value("ret", ty, "lift_ret");
+            }
+            _ => {
+                for (i, ty) in func.results.iter_types().enumerate() {
+                    bindgen.lift_value(&format!("ret{i}"), ty, &format!("lift_ret{i}"));
+                }
+            }
+        }
+        let uses_arena = bindgen.uses_arena;
+        let lower_src = bindgen.lower_src;
+        let lift_src = bindgen.lift_src;
+        self.direction = direction;
+
+        let mut body = Source::default();
+        if uses_arena {
+            body.push_str("var cabi_arena cabiArena\ndefer cabi_arena.release()\n");
+        }
+        body.push_str(&lower_src);
+        let mut call = Source::default();
+        call.push_str(
+            &format!("{}{}", self.namespace(), self.func_name(func)).to_lower_camel_case(),
+        );
+        call.push_str("(");
+        self.c_func_params(&mut call, func, Direction::Import);
+        self.c_func_returns(&mut call, resolve, func, Direction::Import);
+        match func.results.len() {
+            0 => uwriteln!(body, "{}", &*call),
+            1 => {
+                let ty = func.results.iter_types().next().unwrap();
+                if is_arg_by_pointer(self.resolve, ty) {
+                    let c_ty = self.gen.get_c_ty(ty);
+                    uwriteln!(body, "var ret {c_ty}\n{}", &*call);
+                } else {
+                    uwriteln!(body, "ret := {}", &*call);
+                }
+            }
+            _ => {
+                for (i, ty) in func.results.iter_types().enumerate() {
+                    let c_ty = self.gen.get_c_ty(ty);
+                    uwriteln!(body, "var ret{i} {c_ty}");
+                }
+                uwriteln!(body, "{}", &*call);
+            }
+        }
+        body.push_str(&lift_src);
+        if abi::guest_export_needs_post_return(resolve, func) {
+            uwriteln!(body, "{}_post_return()", self.export_c_func_name(func));
+        }
+        match func.results.len() {
+            0 => {}
+            1 => match self.error_result(func) {
+                Some((ok, err)) => {
+                    let err = self.optional_ty(err.as_ref());
+                    match ok {
+                        Some(ok) => {
+                            let ok = self.get_ty(&ok);
+                            uwriteln!(
+                                body,
+                                "if lift_ret.IsErr() {{
+                                    var zero {ok}
+                                    return zero, &ResultError[{err}]{{Payload: lift_ret.UnwrapErr()}}
+                                }}
+                                return lift_ret.Unwrap(), nil"
+                            );
+                        }
+                        None => uwriteln!(
+                            body,
+                            "if lift_ret.IsErr() {{
+                                return &ResultError[{err}]{{Payload: lift_ret.UnwrapErr()}}
+                            }}
+                            return nil"
+                        ),
+                    }
+                }
+                None => uwriteln!(body, "return lift_ret"),
+            },
+            n => {
+                let rets = (0..n)
+                    .map(|i| format!("lift_ret{i}"))
+                    .collect::<Vec<_>>()
+                    .join(", ");
+                uwriteln!(body, "return {rets}");
+            }
+        }
+        self.loopback_funcs.push((decl, body.to_string()));
+    }
+
+    /// Prints `<Interface>Loopback` with `--loopback`, implementing the
+    /// exported interface by calling its exports in memory.
+    pub(crate) fn print_loopback(&mut self) {
+        if !self.gen.opts.loopback {
+            return;
+        }
+        let ns = self.namespace();
+        let funcs = mem::take(&mut self.loopback_funcs);
+        uwriteln!(
+            self.src,
+            "
+            // `{ns}Loopback` implements `{ns}` by calling the exports of the guest
+            // in memory, without a wasm engine: the arguments are lowered and the
+            // results lifted like the host would, and the exports dispatch to the
+            // implementation set with `Set{ns}`. Unit tests can exercise the
+            // implementation along with the canonical ABI of its values this way.
+            type {ns}Loopback struct{{}}
+
+            var _ {ns} = {ns}Loopback{{}}
+            "
+        );
+        for (decl, body) in funcs {
+            uwriteln!(self.src, "func ({ns}Loopback) {decl} {{\n{body}}}\n");
+        }
+    }
+}
@@ -0,0 +1,92 @@
+use wit_bindgen_core::wit_parser::Function;
+
+use crate::interface::InterfaceGenerator;
+
+/// The sink receiving the measurements of the calls across the component
+/// boundary with `--metrics`.
+pub(crate) const METRICS_SINK: &str = r#"
+// `MetricsSink` receives the measurements of the calls across the component
+// boundary, e.g. to feed counters and duration histograms of an existing
+// metrics pipeline.
+type MetricsSink interface {
+	// `ObserveCall` is called once per call of the function `fn` of `iface`,
+	// named as in WIT, with the time spent in the call and the part of it
+	// spent lifting and lowering the values crossing the boundary.
+	ObserveCall(iface, fn string, total, abi time.Duration)
+}
+
+var cabiMetricsSink MetricsSink
+
+// `SetMetricsSink` sets the sink observing each call of an imported or
+// exported function. Passing `nil` removes it.
+func SetMetricsSink(sink MetricsSink) {
+	cabiMetricsSink = sink
+}
+
+type cabiCallMetrics struct {
+	sink               MetricsSink
+	iface, fn          string
+	start, calleeStart time.Time
+	callee             time.Duration
+}
+
+func cabiMetricsStart(iface, fn string) *cabiCallMetrics {
+	if cabiMetricsSink == nil {
+		return nil
+	}
+	return &cabiCallMetrics{sink: cabiMetricsSink, iface: iface, fn: fn, start: time.Now()}
+}
+
+// enter marks the call of the callee, once the arguments are converted
+func (m *cabiCallMetrics) enter() {
+	if m != nil {
+		m.calleeStart = time.Now()
+	}
+}
+
+// leave marks the return of the callee, before its results are converted
+func (m *cabiCallMetrics) leave() {
+	if m != nil {
+		m.callee += time.Since(m.calleeStart)
+		m.calleeStart = time.Time{}
+	}
+}
+
+func (m *cabiCallMetrics) finish() {
+	if m == nil {
+		return
+	}
+	// the callee didn't return normally, or its results needn't be converted
+	if !m.calleeStart.IsZero() {
+		m.leave()
+	}
+	total := time.Since(m.start)
+	m.sink.ObserveCall(m.iface, m.fn, total, total-m.callee)
+}
+"#;
+
+impl InterfaceGenerator<'_> {
+    /// Returns the statements starting the measurement of a call to `func`,
+    /// reported once the call returns.
+    pub(crate) fn metrics_start(&self, func: &Function) -> String {
+        if !self.gen.opts.metrics {
+            return String::new();
+        }
+        format!(
+            "cabi_metrics := cabiMetricsStart(\"{}\", \"{}\")
+            defer cabi_metrics.finish()\n",
+            self.wit_name(),
+            func.name
+        )
+    }
+
+    /// Returns the statements marking the call of the callee and its return,
+    /// which delimit the time spent lifting and lowering values.
+    pub(crate) fn metrics_callee(&self) -> (&'static str, &'static str) {
+        if self.gen.opts.metrics {
+            ("cabi_metrics.enter()\n", "cabi_metrics.leave()\n")
+        } else {
+            ("", "")
+        }
+    }
+}
@@ -0,0 +1,226 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::{ToSnakeCase, ToUpperCamelCase};
+use wit_bindgen_core::wit_parser::{Function, FunctionKind};
+use wit_bindgen_core::{uwriteln, Files, Source};
+
+use super::{local_name, TinyGo};
+use crate::interface::InterfaceGenerator;
+
+/// The functions imported from an interface, mocked by the `mocks` package.
+pub(crate) struct Mock {
+    namespace: String,
+    wit_name: String,
+    funcs: Vec<MockFunc>,
+}
+
+pub(crate) struct MockFunc {
+    name: String,
+    decl: String,
+    // the field, name and type of each parameter
+    params: Vec<(String, String, String)>,
+    has_results: bool,
+}
+
+impl TinyGo {
+    /// Writes the `mocks` package, with a type per imported interface
+    /// implementing its functions with configurable stubs.
+    pub(crate) fn finish_mocks(&mut self, files: &mut Files) {
+        if self.mocks.is_empty() {
+            return;
+        }
+        let path = self.import_path();
+        let decls = self
+            .mocks
+            .iter()
+            .flat_map(|mock| &mock.funcs)
+            .map(|func| &func.decl);
+
+        let mut src = Source::default();
+        wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+        src.push_str("package mocks\n\n");
+        uwriteln!(src, "import (\n. \"{path}\"");
+        if decls.clone().any(|decl| decl.contains("context.Context")) {
+            src.push_str("\"context\"\n");
+        }
+        let uses_types = decls
+            .clone()
+            .any(|decl| decl.contains("Option[") || decl.contains("Result["));
+        if let (Some(path), true) = (&self.opts.runtime_package, uses_types) {
+            uwriteln!(src, ". \"{path}\"");
+        }
+        src.push_str(")\n\n");
+
+        for mock in mem::take(&mut self.mocks) {
+            let Mock {
+                namespace: ns,
+                wit_name,
+                funcs,
+            } = mock;
+            uwriteln!(
+                src,
+                "// `{ns}Mock` mocks the functions imported from `{wit_name}`, recording
+                // the arguments of each call before forwarding it to the matching `Func`
+                // field. Install it with `Set{ns}Imports`.
+                type {ns}Mock struct {{"
+            );
+            for func in &funcs {
+                let sig = &func.decl[func.name.len()..];
+                uwriteln!(
+                    src,
+                    "{name}Func func{sig}
+                    {name}Calls []{ns}{name}Call",
+                    name = func.name,
+                );
+            }
+            src.push_str("}\n\n");
+            uwriteln!(src, "var _ {ns}Imports = (*{ns}Mock)(nil)\n");
+
+            for func in &funcs {
+                let name = &func.name;
+                uwriteln!(
+                    src,
+                    "// `{ns}{name}Call` records a call to `{ns}Mock.{name}`.
+                    type {ns}{name}Call struct {{"
+                );
+                for (field, _, ty) in &func.params {
+                    uwriteln!(src, "{field} {ty}");
+                }
+                let record = func
+                    .params
+                    .iter()
+                    .map(|(field, param, _)| format!("{field}: {param}"))
+                    .collect::<Vec<_>>()
+                    .join(", ");
+                let mut args = func
+                    .params
+                    .iter()
+                    .map(|(_, param, _)| param.clone())
+                    .collect::<Vec<_>>();
+                if self.opts.context {
+                    args.insert(0, "ctx".to_string());
+                }
+                let ret = if func.has_results { "return " } else { "" };
+                uwriteln!(
+                    src,
+                    "}}
+
+                    func (self *{ns}Mock) {decl} {{
+                        self.{name}Calls = append(self.{name}Calls, {ns}{name}Call{{{record}}})
+                        if self.{name}Func == nil {{
+                            panic(\"mocks: unexpected call to {ns}Mock.{name}\")
+                        }}
+                        {ret}self.{name}Func({args})
+                    }}
+                    ",
+                    decl = func.decl,
+                    args = args.join(", "),
+                );
+            }
+        }
+
+        let src = mem::replace(&mut self.src, src);
+        if self.opts.gofmt {
+            self.gofmt();
+        }
+        let src = mem::replace(&mut self.src, src);
+        files.push("mocks/mocks.go", src.as_bytes());
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    fn mocks_var_name(&self) -> String {
+        format!("{}_imports", self.namespace().to_snake_case())
+    }
+
+    /// Starts the body of the imported `func` by forwarding the call to the
+    /// mock installed with `Set<Interface>Imports`, if any.
+    pub(crate) fn mock_dispatch(&mut self, func: &Function) {
+        if !self.gen.opts.mocks || !matches!(func.kind, FunctionKind::Freestanding) {
+            return;
+        }
+        let name = self.func_name(func);
+        let decl = self.func_sig_with_no_namespace(func);
+        let params = func
+            .params
+            .iter()
+            .map(|(param, ty)| {
+                (
+                    param.to_upper_camel_case(),
+                    local_name(&param.to_snake_case()),
+                    self.param_ty(ty),
+                )
+            })
+            .collect::<Vec<_>>();
+
+        let mut args = params
+            .iter()
+            .map(|(_, param, _)| param.clone())
+            .collect::<Vec<_>>();
+        if self.gen.opts.context {
+            args.insert(0, "ctx".to_string());
+        }
+        let call = format!("{}.{name}({})", self.mocks_var_name(), args.join(", "));
+        let has_results = func.results.len() > 0;
+        let call = if has_results {
+            format!("return {call}")
+        } else {
+            format!("{call}\nreturn")
+        };
+        uwriteln!(
+            self.src,
+            "if {var} != nil {{
+                {call}
+            }}",
+            var = self.mocks_var_name(),
+        );
+        self.mock_funcs.push(MockFunc {
+            name,
+            decl,
+            params,
+            has_results,
+        });
+    }
+
+    /// Prints the interface of the imported functions implemented by the
+    /// mocks, and the function installing one.
+    pub(crate) fn finish_imports(&mut self) {
+        self.print_import_table();
+        self.print_available();
+        if self.mock_funcs.is_empty() {
+            return;
+        }
+        let ns = self.namespace();
+        let var = self.mocks_var_name();
+        let wit_name = self.wit_name();
+        uwriteln!(
+            self.src,
+            "// `{ns}Imports` holds the functions imported from `{wit_name}`.
+            type {ns}Imports interface {{"
+        );
+        for func in &self.mock_funcs {
+            uwriteln!(self.src, "{}", func.decl);
+        }
+        uwriteln!(
+            self.src,
+            "}}
+
+            var {var} {ns}Imports
+
+            // `Set{ns}Imports` replaces the functions imported from `{wit_name}` with
+            // `imports`, such as a mock of the `mocks` package to test the guest
+            // without a host. Passing `nil` restores the imports.
+            func Set{ns}Imports(imports {ns}Imports) {{
+                {var} = imports
+            }}
+            "
+        );
+        let funcs = mem::take(&mut self.mock_funcs);
+        self.gen.mocks.push(Mock {
+            namespace: ns,
+            wit_name,
+            funcs,
+        });
+    }
+}
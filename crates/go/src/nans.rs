@@ -0,0 +1,43 @@
+use wit_bindgen_core::wit_parser::Type;
+
+use crate::interface::InterfaceGenerator;
+
+/// Replaces NaNs by the canonical NaN of the component model with
+/// `--canonicalize-nans`, whatever their sign and payload.
+pub(crate) const NAN_HELPERS: &str = r#"
+// cabiCanonicalF32 replaces NaNs by the canonical NaN, so that the other side
+// of a call gets the same bit pattern whatever NaN was computed.
+func cabiCanonicalF32(f float32) float32 {
+	if f != f {
+		return math.Float32frombits(0x7fc00000)
+	}
+	return f
+}
+
+// cabiCanonicalF64 replaces NaNs by the canonical NaN, so that the other side
+// of a call gets the same bit pattern whatever NaN was computed.
+func cabiCanonicalF64(f float64) float64 {
+	if f != f {
+		return math.Float64frombits(0x7ff8000000000000)
+	}
+	return f
+}
+"#;
+
+impl InterfaceGenerator<'_> {
+    /// Returns `value` of type `ty`, canonicalizing it if it's a float
+    /// crossing the boundary with `--canonicalize-nans`.
+    pub(crate) fn canonical_nan(&mut self, ty: &Type, value: &str) -> String {
+        let helper = match ty {
+            Type::F32 => "cabiCanonicalF32",
+            Type::F64 => "cabiCanonicalF64",
+            _ => return value.to_string(),
+        };
+        if !self.gen.opts.canonicalize_nans {
+            return value.to_string();
+        }
+        self.gen.with_math_import(true);
+        self.gen.with_canonical_nans(true);
+        format!("{helper}({value})")
+    }
+}
@@ -0,0 +1,165 @@
+use std::fmt::Write as _;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::{uwriteln, Files, Source};
+
+use super::TinyGo;
+
+/// The directive binding the core wasm imports, which only the wasm
+/// architecture supports.
+const WASM_IMPORT: &str = "//go:wasmimport ";
+
+/// A core wasm import declared by the bindings.
+struct WasmImport {
+    module: String,
+    name: String,
+    // the declaration of the Go function, without a body
+    decl: String,
+}
+
+impl TinyGo {
+    /// Moves the core wasm imports declared with `//go:wasmimport` out of the
+    /// bindings with `--native-stubs`, into `<world>_wasm.go` built only for
+    /// wasm, and writes `<world>_native.go` defining them for the other
+    /// architectures with functions panicking when called.
+    ///
+    /// This has to run before the bindings are formatted, while each
+    /// directive is directly followed by its declaration.
+    pub(crate) fn split_wasm_imports(&mut self, files: &mut Files) {
+        if !self.opts.native_stubs {
+            return;
+        }
+        let mut kept = String::new();
+        let mut imports = Vec::new();
+        let mut lines = self.src.as_str().lines();
+        while let Some(line) = lines.next() {
+            let Some(directive) = line.trim_start().strip_prefix(WASM_IMPORT) else {
+                kept.push_str(line);
+                kept.push('\n');
+                continue;
+            };
+            let (module, name) = directive.split_once(' ').unwrap();
+            let decl = lines.next().unwrap().trim().to_string();
+            imports.push(WasmImport {
+                module: module.to_string(),
+                name: name.trim().to_string(),
+                decl,
+            });
+        }
+        *self.src.as_mut_string() = kept;
+        if imports.is_empty() {
+            return;
+        }
+
+        let world = self.world.to_snake_case();
+        let uses_unsafe = imports.iter().any(|import| import.decl.contains("unsafe."));
+        let header = |tag: &str| {
+            let mut src = Source::default();
+            wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+            uwriteln!(src, "//go:build {tag}\n");
+            uwriteln!(src, "package {}\n", self.package_name());
+            if uses_unsafe {
+                src.push_str("import \"unsafe\"\n\n");
+            }
+            src
+        };
+
+        let mut wasm = header("wasm");
+        for import in &imports {
+            uwriteln!(wasm, "{WASM_IMPORT}{} {}", import.module, import.name);
+            uwriteln!(wasm, "{}\n", import.decl);
+        }
+        let mut native = header("!wasm");
+        for import in &imports {
+            uwriteln!(
+                native,
+                "{} {{
+                    panic(\"the wasm import `{}` of `{}` isn't available outside of wasm\")
+                }}
+                ",
+                import.decl,
+                import.name,
+                import.module,
+            );
+        }
+        for (file, src) in [
+            (format!("{world}_wasm.go"), wasm),
+            (format!("{world}_native.go"), native),
+        ] {
+            files.push(&file, src.as_bytes());
+            self.gofmt_file(files, &file);
+        }
+    }
+
+    /// Writes `<world>_native.c` with `--native-stubs`, defining the core wasm
+    /// imports the C bindings call for the other architectures, so that the
+    /// cgo package links. The stubs abort when called.
+    pub(crate) fn native_c_stubs(&self, files: &mut Files) {
+        if !self.opts.native_stubs {
+            return;
+        }
+        let world = self.world.to_snake_case();
+        let Some((_, bindings)) = files.iter().find(|(name, _)| *name == format!("{world}.c"))
+        else {
+            return;
+        };
+        let bindings = String::from_utf8_lossy(bindings).into_owned();
+
+        let mut src = Source::default();
+        wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+        src.push_str("//go:build !wasm\n\n");
+        src.push_str("#include <stdint.h>\n#include <stdio.h>\n#include <stdlib.h>\n\n");
+        let mut stubs = 0;
+        let mut lines = bindings.lines();
+        while let Some(line) = lines.next() {
+            // the symbol linking in the component type, defined by its object
+            // file which is only built for wasm
+            if let Some(symbol) = line
+                .trim()
+                .strip_prefix("extern void __component_type_object")
+            {
+                uwriteln!(
+                    src,
+                    "void __component_type_object{} {{}}\n",
+                    symbol.trim_end_matches(';')
+                );
+                continue;
+            }
+            let Some(attr) = line.split("__import_name__(\"").nth(1) else {
+                continue;
+            };
+            let name = attr.split('"').next().unwrap();
+            let Some(decl) = lines
+                .next()
+                .and_then(|decl| decl.trim().strip_prefix("extern "))
+            else {
+                continue;
+            };
+            let (sig, params) = decl.trim_end_matches(");").split_once('(').unwrap();
+            // the parameters of the declarations aren't always named
+            let params = params
+                .split(',')
+                .map(str::trim)
+                .enumerate()
+                .map(|(i, param)| match param {
+                    "void" => param.to_string(),
+                    _ if param.ends_with('*') || !param.contains(' ') => format!("{param} p{i}"),
+                    _ => param.to_string(),
+                })
+                .collect::<Vec<_>>()
+                .join(", ");
+            uwriteln!(
+                src,
+                "{sig}({params}) {{
+                    fputs(\"the wasm import `{name}` isn't available outside of wasm\\n\", stderr);
+                    abort();
+                }}
+                "
+            );
+            stubs += 1;
+        }
+        if stubs > 0 {
+            files.push(&format!("{world}_native.c"), src.as_bytes());
+        }
+    }
+}
@@ -0,0 +1,121 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+
+use super::TinyGo;
+use crate::interface::InterfaceGenerator;
+
+/// The probe of the imports marked optional with `--optional-imports`.
+///
+/// Core modules can't leave imports unresolved, so rather than probing for
+/// the functions themselves, the guest asks the host through the
+/// `available` core import of `wit-bindgen-go-imports`, which the generated
+/// host bindings define.
+pub(crate) const AVAILABILITY_PROBE: &str = r#"
+//go:wasmimport wit-bindgen-go-imports available
+func cabiAvailableImport(name unsafe.Pointer, len uint32) int32
+
+// the availability of the optional imports, which doesn't change once the
+// guest is instantiated
+var cabiAvailability = map[string]bool{}
+
+func cabiAvailable(name string) bool {
+	available, ok := cabiAvailability[name]
+	if !ok {
+		available = cabiAvailableImport(unsafe.Pointer(unsafe.StringData(name)), uint32(len(name))) != 0
+		cabiAvailability[name] = available
+	}
+	return available
+}
+"#;
+
+/// Defines the `available` import of the guests generated with
+/// `--optional-imports` for the wazero host bindings.
+pub(crate) const WAZERO_AVAILABILITY: &str = r#"
+// `AddAvailabilityToRuntime` instantiates the host module
+// `wit-bindgen-go-imports`, reporting to guests generated with
+// `--optional-imports` whether the host provides the interface named as in
+// the WIT, e.g. `wasi:cli/environment`, according to `available`. The
+// functions of the unavailable interfaces still need to be defined for the
+// guest to instantiate, e.g. by adding them with a nil implementation, and
+// fail when called.
+// This function needs to be called before the guest is instantiated.
+func AddAvailabilityToRuntime(ctx context.Context, r wazero.Runtime, available func(name string) bool) error {
+	_, err := r.NewHostModuleBuilder("wit-bindgen-go-imports").
+		NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			ptr, length := api.DecodeU32(stack[0]), api.DecodeU32(stack[1])
+			stack[0] = 0
+			if memory := mod.Memory(); memory != nil {
+				if name, ok := memory.Read(ptr, length); ok && available(string(name)) {
+					stack[0] = 1
+				}
+			}
+		}), []api.ValueType{api.ValueTypeI32, api.ValueTypeI32}, []api.ValueType{api.ValueTypeI32}).
+		Export("available").
+		Instantiate(ctx)
+	return err
+}
+"#;
+
+/// Defines the `available` import of the guests generated with
+/// `--optional-imports` for the wasmtime host bindings.
+pub(crate) const WASMTIME_AVAILABILITY: &str = r#"
+// `AddAvailabilityToLinker` defines the function `available` of
+// `wit-bindgen-go-imports` in the linker, reporting to guests generated with
+// `--optional-imports` whether the host provides the interface named as in
+// the WIT, e.g. `wasi:cli/environment`, according to `available`. The
+// functions of the unavailable interfaces still need to be defined for the
+// guest to instantiate, e.g. with `DefineUnknownImportsAsTraps`.
+// This function needs to be called before the guest is instantiated.
+func AddAvailabilityToLinker(linker *wasmtime.Linker, available func(name string) bool) error {
+	return linker.FuncWrap("wit-bindgen-go-imports", "available", func(caller *wasmtime.Caller, ptr, length int32) int32 {
+		export := caller.GetExport("memory")
+		if export == nil || export.Memory() == nil {
+			return 0
+		}
+		data := export.Memory().UnsafeData(caller)
+		end := uint64(uint32(ptr)) + uint64(uint32(length))
+		if end <= uint64(len(data)) && available(string(data[uint32(ptr):end])) {
+			return 1
+		}
+		return 0
+	})
+}
+"#;
+
+impl TinyGo {
+    /// Returns whether the imported interface `name` is marked optional with
+    /// `--optional-imports`.
+    pub(crate) fn optional_import(&self, name: &str) -> bool {
+        self.opts
+            .optional_imports
+            .iter()
+            .any(|filter| filter == name)
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Prints `<Interface>Available` for the imported interface if it's
+    /// marked optional, so that the guest can check whether the host
+    /// provides it before calling its functions.
+    pub(crate) fn print_available(&mut self) {
+        if self.interface.is_none() {
+            return;
+        }
+        let wit_name = self.wit_name();
+        if !self.gen.optional_import(&wit_name) {
+            return;
+        }
+        let ns = self.namespace();
+        uwriteln!(
+            self.src,
+            "// `{ns}Available` reports whether the host provides `{wit_name}`. Its
+            // functions fail when called if it doesn't.
+            func {ns}Available() bool {{
+                return cabiAvailable(\"{wit_name}\")
+            }}
+            "
+        );
+    }
+}
@@ -0,0 +1,97 @@
+use wit_bindgen_core::dealias;
+use wit_bindgen_core::wit_parser::{Type, TypeDefKind};
+
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Returns whether `option<payload>` is bound to `*payload` with
+    /// `--option-pointers`, nil being `none`. Options of options keep the
+    /// `Option[T]` form instead, where `some(none)` reads better than a
+    /// pointer to nil.
+    pub(crate) fn option_pointer(&self, payload: &Type) -> bool {
+        if !self.gen.opts.option_pointers {
+            return false;
+        }
+        match payload {
+            Type::Id(id) => !matches!(
+                self.resolve.types[dealias(self.resolve, *id)].kind,
+                TypeDefKind::Option(_)
+            ),
+            _ => true,
+        }
+    }
+
+    /// Returns the Go type of `option<payload>`.
+    pub(crate) fn option_ty(&mut self, payload: &Type) -> String {
+        let payload_ty = self.get_ty(payload);
+        if self.option_pointer(payload) {
+            format!("*{payload_ty}")
+        } else {
+            self.gen.with_result_option(true);
+            format!("Option[{payload_ty}]")
+        }
+    }
+
+    /// Returns the expression of whether the `option<payload>` `value` is
+    /// `some`.
+    pub(crate) fn option_is_some(&self, payload: &Type, value: &str) -> String {
+        if self.option_pointer(payload) {
+            format!("{value} != nil")
+        } else {
+            format!("{value}.IsSome()")
+        }
+    }
+
+    /// Returns the expression of whether the `option<payload>` `value` is
+    /// `none`.
+    pub(crate) fn option_is_none(&self, payload: &Type, value: &str) -> String {
+        if self.option_pointer(payload) {
+            format!("{value} == nil")
+        } else {
+            format!("{value}.IsNone()")
+        }
+    }
+
+    /// Returns the expression of the payload of the `option<payload>`
+    /// `value`, which must be `some`.
+    pub(crate) fn option_unwrap(&self, payload: &Type, value: &str) -> String {
+        if self.option_pointer(payload) {
+            format!("(*{value})")
+        } else {
+            format!("{value}.Unwrap()")
+        }
+    }
+
+    /// Returns the statement setting the `option<payload>` variable `target`
+    /// to `some` of the variable `value`.
+    pub(crate) fn option_set(&self, payload: &Type, target: &str, value: &str) -> String {
+        if self.option_pointer(payload) {
+            format!("{target} = &{value}")
+        } else {
+            format!("{target}.Set({value})")
+        }
+    }
+
+    /// Returns the expression of `some` of the expression `value` if any, or
+    /// of `none`.
+    pub(crate) fn option_value(&mut self, payload: &Type, value: Option<&str>) -> String {
+        let payload_ty = self.get_ty(payload);
+        match (self.option_pointer(payload), value) {
+            (true, Some(value)) => pointer_to(&payload_ty, value),
+            (true, None) => "nil".to_string(),
+            (false, Some(value)) => format!("Some[{payload_ty}]({value})"),
+            (false, None) => format!("None[{payload_ty}]()"),
+        }
+    }
+}
+
+/// Returns the expression of a pointer to a copy of the expression `value`
+/// of the Go type `ty`.
+pub(crate) fn pointer_to(ty: &str, value: &str) -> String {
+    format!(
+        "func() *{ty} {{
+            v := {value}
+            return &v
+        }}()"
+    )
+}
@@ -0,0 +1,66 @@
+use std::collections::HashMap;
+
+use wit_bindgen_core::wit_parser::{Type, TypeDefKind};
+use wit_bindgen_core::Source;
+
+use super::TinyGo;
+use crate::interface::InterfaceGenerator;
+
+/// The name standing for the helper in its definition until it's named.
+pub(crate) const HELPER: &str = "cabiOutlinedHelper";
+
+/// The helpers lifting and lowering the compound values with `--opt-size`,
+/// shared by every function exchanging values of the same shape.
+#[derive(Default)]
+pub(crate) struct Outlined {
+    /// the name of each helper, keyed by its definition, so that the values
+    /// of types with the same Go and C representation share a helper
+    names: HashMap<String, String>,
+    pub(crate) src: Source,
+}
+
+impl TinyGo {
+    /// Returns the name of the helper defined by `def`, in which `HELPER`
+    /// stands for its name, defining it unless a helper of the same shape
+    /// already is.
+    pub(crate) fn outline(&mut self, prefix: &str, def: String) -> String {
+        if let Some(name) = self.outlined.names.get(&def) {
+            return name.clone();
+        }
+        let name = format!("{prefix}{}", self.outlined.names.len());
+        self.outlined.src.push_str(&def.replacen(HELPER, &name, 1));
+        self.outlined.src.push_str("\n");
+        self.outlined.names.insert(def, name.clone());
+        name
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns whether the values of `ty` are lifted and lowered by shared
+    /// helpers rather than inline with `--opt-size`, which is the case of
+    /// the compound values of plain data. Values holding futures or streams
+    /// aren't plain data: their intrinsics are imported per function, so the
+    /// helpers lifting them couldn't be shared.
+    pub(crate) fn outlines(&self, ty: &Type) -> bool {
+        let Type::Id(id) = ty else {
+            return false;
+        };
+        self.gen.opts.opt_size
+            && matches!(
+                self.resolve.types[*id].kind,
+                TypeDefKind::Record(_)
+                    | TypeDefKind::Tuple(_)
+                    | TypeDefKind::Variant(_)
+                    | TypeDefKind::Option(_)
+                    | TypeDefKind::Result(_)
+                    | TypeDefKind::List(_)
+            )
+            && self.is_plain_data(ty)
+    }
+
+    /// Whether the `String` methods formatting values for debugging are
+    /// generated, which `--opt-size` leaves out.
+    pub(crate) fn debug_strings(&self) -> bool {
+        !self.gen.opts.opt_size
+    }
+}
@@ -0,0 +1,130 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Function, Type, TypeDefKind};
+use wit_bindgen_core::{dealias, Source};
+
+use super::ExportPanics;
+use crate::interface::InterfaceGenerator;
+
+/// The helpers recovering the panics of the implementations of the exports
+/// with `--export-panics`.
+pub(crate) const EXPORT_PANICS: &str = r#"
+// cabiPanicMessage describes the panic `r` of the implementation of the
+// export `name`.
+func cabiPanicMessage(name string, r any) string {
+	return fmt.Sprintf("`%s` panicked: %v", name, r)
+}
+
+// cabiTrapPanic reports the panic of the implementation of the export `name`
+// on the standard error if it panicked, and traps by panicking again, so that
+// the message isn't lost by the builds trapping on panics without printing
+// them, e.g. with `-panic=trap`.
+func cabiTrapPanic(name string) {
+	if r := recover(); r != nil {
+		fmt.Fprintln(os.Stderr, cabiPanicMessage(name, r))
+		panic(r)
+	}
+}
+"#;
+
+impl InterfaceGenerator<'_> {
+    /// Returns the expression calling the implementation of the exported
+    /// `func` with `invoke` while recovering its panics per
+    /// `--export-panics`: the panic is turned into the `err` case of the
+    /// result returned by the function if its payload is a string, and
+    /// reported before trapping otherwise.
+    pub(crate) fn recovered_invoke(&mut self, func: &Function, invoke: String) -> String {
+        let policy = self.gen.opts.export_panics;
+        if policy == ExportPanics::Propagate {
+            return invoke;
+        }
+        let name = match self.interface {
+            Some(_) => format!("{}#{}", self.wit_name(), func.name),
+            None => func.name.clone(),
+        };
+        let ret = if func.results.len() > 0 {
+            "return "
+        } else {
+            ""
+        };
+        let recover = match policy {
+            ExportPanics::Error => self.panic_error(func, &name),
+            _ => None,
+        };
+        let mut src = Source::default();
+        match recover {
+            Some((results, set)) => {
+                uwriteln!(
+                    src,
+                    "func() {results} {{
+                        defer func() {{
+                            if r := recover(); r != nil {{
+                                {set}
+                            }}
+                        }}()
+                        {ret}{invoke}
+                    }}()"
+                );
+            }
+            None => {
+                let results = self.func_results(func);
+                uwriteln!(
+                    src,
+                    "func(){results}{{
+                        defer cabiTrapPanic(\"{name}\")
+                        {ret}{invoke}
+                    }}()"
+                );
+            }
+        }
+        src.to_string().trim_end().to_string()
+    }
+
+    /// Returns the named results of the closure calling the exported `func`
+    /// and the statement setting them to the error of a panic of the export
+    /// `name`, if the function returns a result whose `err` case is a
+    /// string.
+    fn panic_error(&mut self, func: &Function, name: &str) -> Option<(String, String)> {
+        if func.results.len() != 1 {
+            return None;
+        }
+        let ty = func.results.iter_types().next().unwrap();
+        let Type::Id(id) = ty else {
+            return None;
+        };
+        let TypeDefKind::Result(r) = &self.resolve.types[dealias(self.resolve, *id)].kind else {
+            return None;
+        };
+        let is_string = |ty: &Type| match ty {
+            Type::String => true,
+            Type::Id(id) => matches!(
+                self.resolve.types[dealias(self.resolve, *id)].kind,
+                TypeDefKind::Type(Type::String)
+            ),
+            _ => false,
+        };
+        if !r.err.as_ref().is_some_and(is_string) {
+            return None;
+        }
+        let message = format!("cabiPanicMessage(\"{name}\", r)");
+        Some(match self.error_result(func) {
+            // converted into the `err` case as any other error
+            Some((ok, _)) => {
+                let results = match ok {
+                    Some(ok) => format!("(value {}, err error)", self.get_ty(&ok)),
+                    None => "(err error)".to_string(),
+                };
+                (results, format!("err = fmt.Errorf(\"%s\", {message})"))
+            }
+            None => {
+                let result_ty = self.get_ty(ty);
+                let err_ty = self.get_ty(&Type::String);
+                (
+                    format!("(result {result_ty})"),
+                    format!("result.SetErr({err_ty}({message}))"),
+                )
+            }
+        })
+    }
+}
@@ -0,0 +1,67 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Function, FunctionKind};
+
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Records the exported `func` for the default implementation of the
+    /// interface with `--partial-exports`. The methods of resources aren't
+    /// recorded, since the resources are implemented by the guest anyway.
+    pub(crate) fn partial_export(&mut self, func: &Function) {
+        if !self.gen.opts.partial_exports || matches!(func.kind, FunctionKind::Method(_)) {
+            return;
+        }
+        let decl = self.func_sig_with_no_namespace(func);
+        let name = match self.interface {
+            Some(_) => format!("{}#{}", self.wit_name(), func.name),
+            None => func.name.clone(),
+        };
+        self.unimplemented_funcs.push((decl, name));
+    }
+
+    /// Returns the implementation the exports of this interface dispatch to
+    /// before the guest sets its own.
+    pub(crate) fn default_export_impl(&self) -> String {
+        if self.gen.opts.partial_exports {
+            format!("Unimplemented{}{{}}", self.namespace())
+        } else {
+            "nil".to_string()
+        }
+    }
+
+    /// Prints `Unimplemented<Interface>`, implementing the interface with
+    /// functions trapping with the name of the function, so that guests
+    /// embedding it in their implementation only need to implement the
+    /// exports they support.
+    pub(crate) fn print_unimplemented_exports(&mut self) {
+        if !self.gen.opts.partial_exports {
+            return;
+        }
+        let ns = self.namespace();
+        let funcs = mem::take(&mut self.unimplemented_funcs);
+        uwriteln!(
+            self.src,
+            "
+            // `Unimplemented{ns}` implements `{ns}` with functions trapping when
+            // called, naming the function the guest doesn't implement. Embedding it
+            // in an implementation of `{ns}` lets the guest implement only a subset
+            // of the exports. It's the implementation used until `Set{ns}` is called.
+            type Unimplemented{ns} struct{{}}
+
+            var _ {ns} = Unimplemented{ns}{{}}
+            "
+        );
+        for (decl, name) in funcs {
+            uwriteln!(
+                self.src,
+                "func (Unimplemented{ns}) {decl}{{
+                    panic(\"`{name}` isn't implemented by the guest\")
+                }}
+                "
+            );
+        }
+    }
+}
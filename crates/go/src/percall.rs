@@ -0,0 +1,159 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::ToUpperCamelCase;
+use wit_bindgen_core::uwriteln;
+
+use super::{HostRuntime, TinyGo};
+use crate::interface::InterfaceGenerator;
+
+impl TinyGo {
+    /// Prints the strategy calling each export on a fresh instance of the
+    /// guest with `--per-call-instances`, with a bounded number of calls
+    /// running at a time.
+    ///
+    /// Unlike the pool, no instance outlives its call, so that the calls
+    /// share no state and the bindings can be called from any goroutine.
+    pub(crate) fn print_per_call(&mut self) {
+        if !self.opts.per_call_instances {
+            return;
+        }
+        let world = self.world.to_upper_camel_case();
+        let (ctx_param, acquire, close) = match self.opts.host_runtime {
+            HostRuntime::Wazero => (
+                "ctx context.Context, ",
+                "select {
+                case p.slots <- struct{}{}:
+                case <-ctx.Done():
+                    return ctx.Err()
+                }",
+                "defer i.Close(ctx)\n",
+            ),
+            // the instances of wasmtime are released along with their store
+            HostRuntime::Wasmtime => ("", "p.slots <- struct{}{}", ""),
+        };
+        let instantiate_doc = match self.opts.host_runtime {
+            HostRuntime::Wazero => {
+                "Since wazero requires the names of the modules of a runtime to be unique,
+                // the instances are best left anonymous with `config.WithName(\"\")`."
+            }
+            HostRuntime::Wasmtime => {
+                "Since stores can't be used concurrently, each instance needs its own
+                // store."
+            }
+        };
+        uwriteln!(
+            self.src,
+            "// `{world}PerCall` calls the exports of the guest on a fresh instance per
+            // call, so that any number of goroutines can call them concurrently without
+            // sharing any state between the calls.
+            type {world}PerCall struct {{
+                slots       chan struct{{}}
+                instantiate func() (*{world}Instance, error)
+            }}
+
+            // `New{world}PerCall` runs up to `parallelism` calls at a time, each on an
+            // instance returned by `instantiate` and discarded once the call returns.
+            // `instantiate` typically calls `Instantiate{world}` with the compiled
+            // module, whose machine code the instances share so that only their memory
+            // and globals are created anew, but it may as well restore a snapshot of an
+            // initialized instance where the engine supports it.
+            // {instantiate_doc}
+            func New{world}PerCall(parallelism int, instantiate func() (*{world}Instance, error)) *{world}PerCall {{
+                return &{world}PerCall{{slots: make(chan struct{{}}, parallelism), instantiate: instantiate}}
+            }}
+
+            // `Do` calls `f` with a fresh instance, waiting until fewer than the maximum
+            // number of calls are running.
+            func (p *{world}PerCall) Do({ctx_param}f func(i *{world}Instance) error) error {{
+                {acquire}
+                defer func() {{ <-p.slots }}()
+                i, err := p.instantiate()
+                if err != nil {{
+                    return err
+                }}
+                {close}return f(i)
+            }}
+            "
+        );
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Records the method `decl` of the per-call client of this interface
+    /// with `--per-call-instances`, calling the instance method `method` with
+    /// `args` on a fresh instance and returning its `results`.
+    pub(crate) fn host_per_call_method(
+        &mut self,
+        decl: &str,
+        method: &str,
+        args: &str,
+        results: &[String],
+    ) {
+        if !self.gen.opts.per_call_instances {
+            return;
+        }
+        let world = self.gen.world.to_upper_camel_case();
+        let ctx = match self.gen.opts.host_runtime {
+            HostRuntime::Wazero => "ctx, ",
+            HostRuntime::Wasmtime => "",
+        };
+        let assignments = results
+            .iter()
+            .map(|result| format!("{result}, "))
+            .collect::<String>();
+        // the results are assigned from the closure, having been copied out of
+        // the memory of the instance before it's discarded
+        let body = format!(
+            "err = i.calls.Do({ctx}func(i *{world}Instance) (err error) {{
+                {assignments}err = i.{method}({args})
+                return err
+            }})
+            return"
+        );
+        self.per_call_funcs.push((decl.to_string(), body));
+    }
+
+    /// Prints the per-call client of the functions exported by the guest for
+    /// this interface with `--per-call-instances`, implementing the same Go
+    /// interface as the client owning an instance.
+    pub(crate) fn host_finish_per_call(&mut self) {
+        if self.per_call_funcs.is_empty() {
+            return;
+        }
+        let ns = self.namespace();
+        let world = self.gen.world.to_upper_camel_case();
+        let wit_name = match self.interface {
+            Some(_) => format!("`{}`", self.wit_name()),
+            None => format!("the `{}` world", self.gen.world),
+        };
+        let funcs = mem::take(&mut self.per_call_funcs);
+
+        uwriteln!(
+            self.src,
+            "// `{ns}PerCallClient` calls the functions exported by the guest for
+            // {wit_name} on a fresh instance per call, and can be shared by any number
+            // of goroutines.
+            type {ns}PerCallClient struct {{
+                calls *{world}PerCall
+            }}
+
+            var _ {ns}Exports = (*{ns}PerCallClient)(nil)
+
+            // `New{ns}PerCallClient` returns a client making each call through `calls`.
+            func New{ns}PerCallClient(calls *{world}PerCall) *{ns}PerCallClient {{
+                return &{ns}PerCallClient{{calls: calls}}
+            }}
+            "
+        );
+        for (decl, body) in funcs {
+            uwriteln!(
+                self.src,
+                "func (i *{ns}PerCallClient) {decl} {{
+                    {body}
+                }}
+                "
+            );
+        }
+    }
+}
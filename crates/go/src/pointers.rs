@@ -0,0 +1,28 @@
+use wit_bindgen_core::dealias;
+use wit_bindgen_core::wit_parser::{Type, TypeDefKind};
+
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Returns whether a parameter of type `ty` is passed as a pointer to its
+    /// Go type with `--record-pointer-threshold`, which is the case of the
+    /// records whose size exceeds the threshold.
+    pub(crate) fn param_by_pointer(&self, ty: &Type) -> bool {
+        let (Some(threshold), Type::Id(id)) = (self.gen.opts.record_pointer_threshold, ty) else {
+            return false;
+        };
+        let id = dealias(self.resolve, *id);
+        matches!(self.resolve.types[id].kind, TypeDefKind::Record(_))
+            && self.gen.sizes.size(ty).size_wasm32() > threshold
+    }
+
+    /// Returns the Go type of a parameter of type `ty`.
+    pub(crate) fn param_ty(&mut self, ty: &Type) -> String {
+        let go_ty = self.get_ty(ty);
+        if self.param_by_pointer(ty) {
+            format!("*{go_ty}")
+        } else {
+            go_ty
+        }
+    }
+}
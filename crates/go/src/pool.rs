@@ -0,0 +1,121 @@
+use std::fmt::Write as _;
+
+use heck::ToUpperCamelCase;
+use wit_bindgen_core::uwriteln;
+
+use super::{HostRuntime, TinyGo};
+
+impl TinyGo {
+    /// Prints a pool of instances of the guest, checked out by one caller at
+    /// a time so that servers can call the exports concurrently.
+    ///
+    /// Instances are only tainted by a trap or an ABI violation, after which
+    /// they're re-instantiated on their next checkout.
+    pub(crate) fn print_pool(&mut self) {
+        let world = self.world.to_upper_camel_case();
+        let (ctx_param, wait, close) = match self.opts.host_runtime {
+            HostRuntime::Wazero => (
+                "ctx context.Context, ",
+                format!(
+                    "var i *{world}Instance
+                    select {{
+                    case i = <-p.instances:
+                    case <-ctx.Done():
+                        return ctx.Err()
+                    }}"
+                ),
+                "i.Close(ctx)\n",
+            ),
+            HostRuntime::Wasmtime => ("", "i := <-p.instances".to_string(), ""),
+        };
+        // the instances of wasmtime are released along with their store
+        let cleanup = match self.opts.host_runtime {
+            HostRuntime::Wazero => {
+                "close(p.instances)
+                for i := range p.instances {
+                    i.Close(ctx)
+                }"
+            }
+            HostRuntime::Wasmtime => "",
+        };
+        let instantiate_doc = match self.opts.host_runtime {
+            HostRuntime::Wazero => {
+                "Since wazero requires the names of the modules of a runtime to be unique,
+                // the instances are best left anonymous with `config.WithName(\"\")`."
+            }
+            HostRuntime::Wasmtime => {
+                "Since stores can't be used concurrently, each instance needs its own
+                // store."
+            }
+        };
+        uwriteln!(
+            self.src,
+            "// `{world}Pool` hands out instances of the guest to one caller at a time,
+            // so that its exports can be called concurrently.
+            type {world}Pool struct {{
+                // nil for the instances to re-instantiate
+                instances   chan *{world}Instance
+                instantiate func() (*{world}Instance, error)
+            }}
+
+            // `New{world}Pool` pre-instantiates `size` instances of the guest with
+            // `instantiate`, typically a closure calling `Instantiate{world}`.
+            // {instantiate_doc}
+            func New{world}Pool({ctx_param}size int, instantiate func() (*{world}Instance, error)) (*{world}Pool, error) {{
+                p := &{world}Pool{{instances: make(chan *{world}Instance, size), instantiate: instantiate}}
+                for n := 0; n < size; n++ {{
+                    i, err := instantiate()
+                    if err != nil {{
+                        {cleanup}
+                        return nil, err
+                    }}
+                    p.instances <- i
+                }}
+                return p, nil
+            }}
+
+            // `Do` calls `f` with an instance checked out of the pool, waiting until
+            // one is available. An instance which trapped, violated the canonical ABI
+            // or panicked during the call is discarded, and replaced with a new one
+            // on its next checkout.
+            func (p *{world}Pool) Do({ctx_param}f func(i *{world}Instance) error) (err error) {{
+                {wait}
+                if i == nil {{
+                    if i, err = p.instantiate(); err != nil {{
+                        p.instances <- nil
+                        return err
+                    }}
+                }}
+                tainted := true
+                defer func() {{
+                    if tainted {{
+                        {close}i = nil
+                    }}
+                    p.instances <- i
+                }}()
+                err = f(i)
+                var fault *ABIError
+                tainted = i.trapped || errors.As(err, &fault)
+                return err
+            }}
+            "
+        );
+        if let HostRuntime::Wazero = self.opts.host_runtime {
+            uwriteln!(
+                self.src,
+                "// `Close` closes the instances of the pool, waiting until they're all
+                // returned to it.
+                func (p *{world}Pool) Close(ctx context.Context) error {{
+                    var errs []error
+                    for n := 0; n < cap(p.instances); n++ {{
+                        if i := <-p.instances; i != nil {{
+                            errs = append(errs, i.Close(ctx))
+                        }}
+                    }}
+                    return errors.Join(errs...)
+                }}
+                "
+            );
+        }
+    }
+}
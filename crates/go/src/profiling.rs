@@ -0,0 +1,155 @@
+use std::fmt::Write as _;
+
+use heck::{ToLowerCamelCase, ToSnakeCase, ToUpperCamelCase};
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Function, FunctionKind};
+use wit_bindgen_core::Direction;
+
+use super::{local_name, HostRuntime};
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Splits the lifting of the arguments and the lowering of the results
+    /// of the exported `func` out of its export with `--profiling`, into the
+    /// functions `<export>_lift` and `<export>_lower` kept from being
+    /// inlined, so that the profiles of the guest tell the time spent in the
+    /// bindings apart from the time spent in the implementation, for each
+    /// WIT function.
+    ///
+    /// Returns the statements calling them in place of `lift_src` and
+    /// `lower_src`, along with their definitions, or `None` if `func` isn't a
+    /// freestanding function of plain data, whose values can be passed
+    /// between functions as is.
+    pub(crate) fn profiled_export(
+        &mut self,
+        func: &Function,
+        args: &[String],
+        rets: &[String],
+        lift_src: &str,
+        lower_src: &str,
+    ) -> Option<(String, String, String)> {
+        let supported = matches!(func.kind, FunctionKind::Freestanding)
+            && func
+                .params
+                .iter()
+                .map(|(_, ty)| ty)
+                .chain(func.results.iter_types())
+                .all(|ty| self.is_plain_data(ty));
+        if !self.gen.opts.profiling || !supported {
+            return None;
+        }
+        let export = format!("{}{}", self.namespace(), self.func_name(func)).to_lower_camel_case();
+        let mut helpers = String::new();
+
+        let mut lift = String::new();
+        if !func.params.is_empty() {
+            let mut params = wit_bindgen_core::Source::default();
+            self.c_func_params(&mut params, func, Direction::Export);
+            let names = func
+                .params
+                .iter()
+                .map(|(name, _)| local_name(&name.to_snake_case()))
+                .collect::<Vec<_>>()
+                .join(", ");
+            let tys = func
+                .params
+                .iter()
+                .map(|(_, ty)| self.get_ty(ty))
+                .collect::<Vec<_>>()
+                .join(", ");
+            let args = args.join(", ");
+            uwriteln!(
+                helpers,
+                "
+                // `{export}_lift` lifts the arguments of `{name}`.
+                //
+                //go:noinline
+                func {export}_lift({params}) ({tys}) {{
+                    {lift_src}return {args}
+                }}",
+                name = func.name,
+                params = &*params,
+            );
+            uwriteln!(lift, "{args} := {export}_lift({names})");
+        }
+
+        let mut lower = String::new();
+        if func.results.len() > 0 {
+            let (results, tys) = match func.results.len() {
+                1 => {
+                    let ty = func.results.iter_types().next().unwrap();
+                    (vec!["result".to_string()], vec![ty])
+                }
+                n => (
+                    (0..n).map(|i| format!("result{i}")).collect(),
+                    func.results.iter_types().collect(),
+                ),
+            };
+            let params = results
+                .iter()
+                .zip(&tys)
+                .map(|(result, ty)| format!("{result} {}", self.get_ty(ty)))
+                .collect::<Vec<_>>()
+                .join(", ");
+            let c_tys = tys
+                .iter()
+                .map(|ty| self.gen.get_c_ty(ty))
+                .collect::<Vec<_>>()
+                .join(", ");
+            let rets = rets.join(", ");
+            uwriteln!(
+                helpers,
+                "
+                // `{export}_lower` lowers the results of `{name}`.
+                //
+                //go:noinline
+                func {export}_lower({params}) ({c_tys}) {{
+                    {lower_src}return {rets}
+                }}",
+                name = func.name,
+            );
+            uwriteln!(lower, "{rets} := {export}_lower({})", results.join(", "));
+        }
+        Some((lift, lower, helpers))
+    }
+
+    /// Prints the method `method` of the host instances with `--profiling`,
+    /// calling `cabi<method>` with the pprof labels of the exported `func`,
+    /// so that CPU profiles of the host attribute the time spent in the
+    /// guest to the WIT function called. Its declaration takes `params` and
+    /// returns the named `results` along with `err`.
+    pub(crate) fn host_profiled_export(
+        &mut self,
+        func: &Function,
+        method: &str,
+        params: &str,
+        results: &str,
+        result_names: &[String],
+        args: &str,
+    ) {
+        self.gen.import_requirements.needs_pprof_import = true;
+        let world = self.gen.world.to_upper_camel_case();
+        let iface = self.wit_name();
+        // wasmtime calls take no context, so the labels of the goroutine
+        // aren't inherited
+        let ctx = match self.gen.opts.host_runtime {
+            HostRuntime::Wazero => "ctx",
+            HostRuntime::Wasmtime => "context.Background()",
+        };
+        let assignments = result_names
+            .iter()
+            .map(|result| format!("{result}, "))
+            .collect::<String>();
+        uwriteln!(
+            self.src,
+            "func (i *{world}Instance) {method}({params}) ({results}err error) {{
+                pprof.Do({ctx}, pprof.Labels(\"wit-interface\", \"{iface}\", \"wit-function\", \"{name}\"), func(ctx context.Context) {{
+                    {assignments}err = i.cabi{method}({args})
+                }})
+                return
+            }}
+            ",
+            name = func.name,
+        );
+    }
+}
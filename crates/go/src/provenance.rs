@@ -0,0 +1,354 @@
+use std::collections::HashMap;
+use std::fmt::Write as _;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::wit_parser::{Function, PackageId, TypeId, TypeOwner};
+use wit_bindgen_core::{uwrite, uwriteln, Files};
+
+use super::TinyGo;
+use crate::interface::InterfaceGenerator;
+
+/// The prefix of the comments marking the generated declarations with the
+/// location of their WIT definition, which `finish_provenance` turns into
+/// `//line` directives once the files are formatted.
+const MARKER: &str = "// wit: ";
+
+/// The locations of the definitions of the WIT sources the bindings are
+/// generated from, `Opts::wit_sources`.
+///
+/// The `Resolve` doesn't keep the spans of its items, so the sources are
+/// scanned for the declarations, which is enough to locate the interfaces,
+/// worlds, types and functions of formatted WIT.
+#[derive(Default)]
+pub(crate) struct WitLocations {
+    /// the file and line of the declarations, keyed by their package, their
+    /// interface or world, and their name, which is empty for the interfaces
+    /// and worlds themselves
+    decls: HashMap<(String, String, String), (PathBuf, usize)>,
+}
+
+/// The block of WIT a line is declared in.
+enum Scope {
+    /// an interface or world
+    Item(String),
+    /// a resource of an interface or world
+    Resource(String, String),
+    Other,
+}
+
+impl WitLocations {
+    /// Scans the WIT files `files`, as listed by the `PackageSourceMap` of
+    /// `Resolve::push_path`.
+    pub(crate) fn scan(files: &[PathBuf]) -> WitLocations {
+        let mut locations = WitLocations::default();
+        let sources = files
+            .iter()
+            .map(|file| {
+                let src = fs::read_to_string(file).unwrap_or_else(|e| {
+                    panic!("failed to read the WIT source `{}`: {e}", file.display())
+                });
+                let package = src.lines().find_map(package_decl);
+                (file, src, package)
+            })
+            .collect::<Vec<_>>();
+        for (file, src, package) in sources.iter() {
+            // the package of a directory only needs to be declared by one of
+            // its files
+            let package = package.clone().unwrap_or_else(|| {
+                sources
+                    .iter()
+                    .filter(|(other, ..)| other.parent() == file.parent())
+                    .find_map(|(_, _, package)| package.clone())
+                    .unwrap_or_default()
+            });
+            locations.scan_file(&package, file, src);
+        }
+        locations
+    }
+
+    fn scan_file(&mut self, package: &str, file: &Path, src: &str) {
+        let mut scopes = Vec::new();
+        for (i, line) in src.lines().enumerate() {
+            let line = line.split("//").next().unwrap_or_default().trim();
+            let mut decl = line;
+            // attributes such as `@since(version = 0.2.0)` precede the declarations
+            while decl.starts_with('@') {
+                match decl.find(')') {
+                    Some(end) => decl = decl[end + 1..].trim_start(),
+                    None => break,
+                }
+            }
+            let mut opened = self.declare(package, file, i + 1, scopes.last(), decl);
+            for c in line.chars() {
+                match c {
+                    '{' => scopes.push(opened.take().unwrap_or(Scope::Other)),
+                    '}' => {
+                        scopes.pop();
+                    }
+                    _ => {}
+                }
+            }
+        }
+    }
+
+    /// Records the declaration `decl` at `line` of `file` in `scope`,
+    /// returning the scope of the block it opens if any.
+    fn declare(
+        &mut self,
+        package: &str,
+        file: &Path,
+        line: usize,
+        scope: Option<&Scope>,
+        decl: &str,
+    ) -> Option<Scope> {
+        let words = decl
+            .split(|c: char| c.is_whitespace() || "{}();:,<>=".contains(c))
+            .filter(|word| !word.is_empty())
+            .collect::<Vec<_>>();
+        // keywords used as names are escaped with `%`
+        let unescape = |name: &str| name.trim_start_matches('%').to_string();
+        let (scope, name, opens) = match (scope, &words[..]) {
+            (None, ["interface" | "world", name, ..]) => (
+                String::new(),
+                unescape(name),
+                Some(Scope::Item(unescape(name))),
+            ),
+            (Some(Scope::Item(scope)), ["resource", name, ..]) => {
+                let resource = Scope::Resource(scope.clone(), unescape(name));
+                (scope.clone(), unescape(name), Some(resource))
+            }
+            (
+                Some(Scope::Item(scope)),
+                ["record" | "variant" | "enum" | "flags" | "type", name, ..]
+                | ["import" | "export", name, "func" | "async", ..]
+                | [name, "func" | "async", ..],
+            ) => (scope.clone(), unescape(name), None),
+            (Some(Scope::Resource(scope, resource)), ["constructor", ..]) => {
+                (scope.clone(), format!("[constructor]{resource}"), None)
+            }
+            (Some(Scope::Resource(scope, resource)), ["static", name, "func" | "async", ..]) => (
+                scope.clone(),
+                format!("[static]{resource}.{}", unescape(name)),
+                None,
+            ),
+            (Some(Scope::Resource(scope, resource)), [name, "func" | "async", ..]) => (
+                scope.clone(),
+                format!("[method]{resource}.{}", unescape(name)),
+                None,
+            ),
+            _ => return None,
+        };
+        self.decls.insert(
+            (package.to_string(), scope, name),
+            (file.to_path_buf(), line),
+        );
+        opens
+    }
+}
+
+/// Returns the name of the package declared by `line`, if any.
+fn package_decl(line: &str) -> Option<String> {
+    let name = line.trim().strip_prefix("package ")?;
+    Some(
+        name.trim_end_matches(|c: char| c == ';' || c == '{' || c.is_whitespace())
+            .to_string(),
+    )
+}
+
+/// Returns the WIT file and line of the marker `line`, if it is one.
+fn marker(line: &str) -> Option<(&str, usize)> {
+    let (wit, wit_line) = line.strip_prefix(MARKER)?.rsplit_once(':')?;
+    Some((wit, wit_line.parse().ok()?))
+}
+
+/// Returns the index of the last line of the top-level declaration starting
+/// at `lines[start]`, which is closed at the beginning of a line if it
+/// spans several.
+fn declaration_end(lines: &[&str], start: usize) -> usize {
+    if !lines[start].ends_with(['{', '(']) {
+        return start;
+    }
+    (start + 1..lines.len())
+        .take_while(|i| marker(lines[*i]).is_none())
+        .find(|i| matches!(lines[*i].trim_end(), "}" | ")"))
+        .unwrap_or(start)
+}
+
+/// The generated declaration of a WIT definition.
+struct Mapping {
+    go: String,
+    start: usize,
+    end: usize,
+    wit: String,
+    line: usize,
+}
+
+impl TinyGo {
+    /// Turns the markers of `--provenance` into `//line` directives, which
+    /// make the Go compiler and runtime report the positions of the generated
+    /// declarations at their WIT definitions, each followed by a directive
+    /// restoring the positions of the Go file. With `--source-map`, also
+    /// writes `<world>_source_map.json`, mapping the lines of these
+    /// declarations to their WIT definitions.
+    pub(crate) fn finish_provenance(&self, files: &mut Files) {
+        if !self.opts.provenance {
+            return;
+        }
+        let mut rewritten = Vec::new();
+        let mut mappings = Vec::new();
+        for (name, contents) in files.iter() {
+            if !name.ends_with(".go") {
+                continue;
+            }
+            let src = String::from_utf8_lossy(contents);
+            if !src.contains(MARKER) {
+                continue;
+            }
+            let lines = src.lines().collect::<Vec<_>>();
+            // the directives restoring the position name the Go file relative
+            // to its own directory
+            let file = Path::new(name).file_name().unwrap().to_string_lossy();
+            let mut out = Vec::new();
+            let mut i = 0;
+            while i < lines.len() {
+                let Some((wit, line)) = marker(lines[i]) else {
+                    out.push(lines[i].to_string());
+                    i += 1;
+                    continue;
+                };
+                i += 1;
+                // the directive goes right before the declaration, for the
+                // declaration rather than its doc comment to be reported at the
+                // definition
+                while i < lines.len()
+                    && marker(lines[i]).is_none()
+                    && (lines[i].trim().is_empty() || lines[i].starts_with("//"))
+                {
+                    out.push(lines[i].to_string());
+                    i += 1;
+                }
+                if i == lines.len() || marker(lines[i]).is_some() {
+                    continue;
+                }
+                let end = declaration_end(&lines, i);
+                out.push(format!("//line {wit}:{line}"));
+                let start = out.len() + 1;
+                out.extend(lines[i..=end].iter().map(|line| line.to_string()));
+                mappings.push(Mapping {
+                    go: name.to_string(),
+                    start,
+                    end: out.len(),
+                    wit: wit.to_string(),
+                    line,
+                });
+                out.push(format!("//line {file}:{}", out.len() + 2));
+                i = end + 1;
+            }
+            let mut src = out.join("\n");
+            src.push('\n');
+            rewritten.push((name.to_string(), src));
+        }
+        for (name, src) in rewritten {
+            files.remove(&name);
+            files.push(&name, src.as_bytes());
+        }
+
+        if !self.opts.source_map {
+            return;
+        }
+        let mappings = mappings
+            .iter()
+            .map(|m| {
+                format!(
+                    "{{\"go\": {}, \"start\": {}, \"end\": {}, \"wit\": {}, \"line\": {}}}",
+                    json_string(&m.go),
+                    m.start,
+                    m.end,
+                    json_string(&m.wit),
+                    m.line,
+                )
+            })
+            .collect::<Vec<_>>();
+        let mut src = String::new();
+        uwriteln!(src, "{{\n  \"version\": 1,\n  \"mappings\": [");
+        for (i, mapping) in mappings.iter().enumerate() {
+            let sep = if i + 1 < mappings.len() { "," } else { "" };
+            uwriteln!(src, "    {mapping}{sep}");
+        }
+        uwriteln!(src, "  ]\n}}");
+        let file = format!("{}_source_map.json", self.world.to_snake_case());
+        files.push(&file, src.as_bytes());
+    }
+}
+
+/// Returns `s` quoted as a JSON string.
+fn json_string(s: &str) -> String {
+    let mut quoted = String::from("\"");
+    for c in s.chars() {
+        match c {
+            '"' => quoted.push_str("\\\""),
+            '\\' => quoted.push_str("\\\\"),
+            c if c.is_control() => {
+                uwrite!(quoted, "\\u{:04x}", c as u32);
+            }
+            c => quoted.push(c),
+        }
+    }
+    quoted.push('"');
+    quoted
+}
+
+impl InterfaceGenerator<'_> {
+    /// Returns the marker of a declaration with the location of `name`,
+    /// defined in the interface or world `scope` of `package`, with
+    /// `--provenance`.
+    fn provenance(&self, package: Option<PackageId>, scope: Option<&str>, name: &str) -> String {
+        let (Some(package), Some(scope)) = (package, scope) else {
+            return String::new();
+        };
+        let package = self.resolve.packages[package].name.to_string();
+        let key = (package, scope.to_string(), name.to_string());
+        match self.gen.wit_locations.decls.get(&key) {
+            Some((file, line)) => format!("{MARKER}{}:{line}\n\n", file.display()),
+            None => String::new(),
+        }
+    }
+
+    /// Prints the marker of the definition of the type `id` with its
+    /// location.
+    pub(crate) fn print_type_provenance(&mut self, id: TypeId) {
+        let ty = &self.resolve.types[id];
+        let Some(name) = ty.name.as_deref() else {
+            return;
+        };
+        let comment = match ty.owner {
+            TypeOwner::Interface(iface) => {
+                let iface = &self.resolve.interfaces[iface];
+                self.provenance(iface.package, iface.name.as_deref(), name)
+            }
+            TypeOwner::World(world) => {
+                let world = &self.resolve.worlds[world];
+                self.provenance(world.package, Some(&world.name), name)
+            }
+            TypeOwner::None => return,
+        };
+        self.src.push_str(&comment);
+    }
+
+    /// Returns the marker of the bindings of `func`, of the current
+    /// interface or world, with its location.
+    pub(crate) fn func_provenance(&self, func: &Function) -> String {
+        match self.interface {
+            Some((iface, _)) => {
+                let iface = &self.resolve.interfaces[iface];
+                self.provenance(iface.package, iface.name.as_deref(), &func.name)
+            }
+            None => {
+                let world = &self.resolve.worlds[self.gen.world_id.unwrap()];
+                self.provenance(world.package, Some(&world.name), &func.name)
+            }
+        }
+    }
+}
@@ -0,0 +1,111 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::ToSnakeCase;
+use wit_bindgen_core::{uwriteln, Files, Source};
+
+use super::TinyGo;
+
+impl TinyGo {
+    /// Moves the generated bindings to the `gen` package of a new module and
+    /// adds a `go.mod` and a `main.go` stubbing out the exports.
+    pub(crate) fn scaffold(&mut self, files: &mut Files) {
+        let names = files
+            .iter()
+            .map(|(name, _)| name.to_string())
+            .collect::<Vec<_>>();
+        for name in names {
+            let contents = files.remove(&name).unwrap();
+            files.push(&format!("gen/{name}"), &contents);
+        }
+
+        let module = self.module_path();
+        files.push("go.mod", format!("module {module}\n\ngo 1.20\n").as_bytes());
+
+        let mut src = Source::default();
+        src.push_str("package main\n\n");
+        if self.export_interfaces.is_empty() {
+            uwriteln!(src, "import _ \"{module}/gen\"\n");
+        } else {
+            uwriteln!(src, "import (\n. \"{module}/gen\"");
+            self.stub_imports(&mut src);
+            src.push_str(")\n\n");
+            self.export_stubs(&mut src);
+        }
+        src.push_str("func main() {}\n");
+
+        let bindings = mem::replace(&mut self.src, src);
+        if self.opts.gofmt {
+            self.gofmt();
+        }
+        let src = mem::replace(&mut self.src, bindings);
+        files.push("main.go", src.as_bytes());
+    }
+
+    /// Adds `{world}_stubs.go` to the generated package, a skeleton
+    /// implementation of the exports which isn't overwritten once it exists.
+    pub(crate) fn stubs(&mut self, files: &mut Files) {
+        if self.export_interfaces.is_empty() {
+            return;
+        }
+        let mut src = Source::default();
+        uwriteln!(src, "package {}\n", self.package_name());
+        let mut imports = Source::default();
+        self.stub_imports(&mut imports);
+        if imports.len() > 0 {
+            uwriteln!(src, "import (\n{})\n", &*imports);
+        }
+        self.export_stubs(&mut src);
+
+        let bindings = mem::replace(&mut self.src, src);
+        if self.opts.gofmt {
+            self.gofmt();
+        }
+        let src = mem::replace(&mut self.src, bindings);
+        let name = format!("{}_stubs.go", self.world.to_snake_case());
+        files.push_skeleton(&name, src.as_bytes());
+    }
+
+    /// Writes the imports needed by the signatures of the stubs.
+    fn stub_imports(&self, src: &mut Source) {
+        let mut decls = self.export_interfaces.iter().flat_map(|(_, decls)| decls);
+        if decls.clone().any(|decl| decl.contains("context.Context")) {
+            src.push_str("\"context\"\n");
+        }
+        let uses_types = decls.any(|decl| {
+            decl.contains("Option[") || decl.contains("Result[") || decl.contains("ResultError[")
+        });
+        if let (Some(path), true) = (&self.opts.runtime_package, uses_types) {
+            uwriteln!(src, ". \"{path}\"");
+        }
+    }
+
+    /// Writes an `init()` function setting an implementation of each exported
+    /// interface whose methods panic until they're filled in.
+    fn export_stubs(&self, src: &mut Source) {
+        src.push_str("func init() {\n");
+        for (name, _) in &self.export_interfaces {
+            uwriteln!(src, "Set{name}({name}Impl{{}})");
+        }
+        src.push_str("}\n\n");
+
+        for (name, decls) in &self.export_interfaces {
+            uwriteln!(
+                src,
+                "// {name}Impl implements the `{name}` interface.
+                type {name}Impl struct{{}}
+                "
+            );
+            for decl in decls {
+                let method = decl.split('(').next().unwrap();
+                uwriteln!(
+                    src,
+                    "func ({name}Impl) {decl} {{
+                        panic(\"TODO: implement {name}.{method}\")
+                    }}
+                    "
+                );
+            }
+        }
+    }
+}
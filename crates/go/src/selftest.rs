@@ -0,0 +1,166 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use heck::ToUpperCamelCase;
+use wit_bindgen_core::uwriteln;
+
+use super::{fuzz, HostRuntime, TinyGo};
+
+/// The checking of the report of the self-test of a guest, shared by the
+/// host bindings of all runtimes.
+const SELF_TEST_REPORT: &str = r#"
+// `ErrNoSelfTest` is returned by `SelfTest` for guests whose bindings weren't
+// generated with `--self-test`.
+var ErrNoSelfTest = errors.New("the guest doesn't export a self-test")
+
+// `SelfTestError` reports the failure of the self-test of a guest: either its
+// bindings were generated by another version of wit-bindgen-go than those of
+// the host, or they don't preserve the values of some types, which both point
+// at a skew between the canonical ABI of the guest and that of the host.
+type SelfTestError struct {
+	// the version of wit-bindgen-go which generated the guest bindings
+	GuestVersion string
+	// the Go names of the types whose values the guest bindings don't preserve
+	Mismatches []string
+}
+
+func (e *SelfTestError) Error() string {
+	if len(e.Mismatches) == 0 {
+		return fmt.Sprintf("the guest bindings were generated by wit-bindgen-go %s rather than %s", e.GuestVersion, cabiGeneratorVersion)
+	}
+	return fmt.Sprintf("the guest bindings generated by wit-bindgen-go %s don't preserve the values of %s", e.GuestVersion, strings.Join(e.Mismatches, ", "))
+}
+
+// checkSelfTest parses the report of the self-test of a guest, made of the
+// version of the generator of its bindings followed by the types whose values
+// weren't preserved, a line each.
+func checkSelfTest(report string) error {
+	lines := strings.Split(report, "\n")
+	if lines[0] == cabiGeneratorVersion && len(lines) == 1 {
+		return nil
+	}
+	return &SelfTestError{GuestVersion: lines[0], Mismatches: lines[1:]}
+}
+"#;
+
+impl TinyGo {
+    /// Prints the `_self_test` core export of the guest with `--self-test`,
+    /// lowering and lifting back representative values of every type of the
+    /// world which the bindings round-trip, as for the fuzz targets.
+    ///
+    /// The values are made up by a `cabiFuzzReader` out of a fixed seed, so
+    /// that every run checks the same values.
+    pub(crate) fn print_self_test(&mut self) {
+        if !self.opts.self_test {
+            return;
+        }
+        let version = env!("CARGO_PKG_VERSION");
+        let mut checks = String::new();
+        let tests = mem::take(&mut self.self_tests);
+        if !tests.is_empty() {
+            self.with_binary_import(true);
+            self.import_requirements.needs_math_import = true;
+            self.import_requirements.needs_utf8_import = true;
+            self.src.push_str(fuzz::FUZZ_READER);
+            self.src.push_str(
+                "
+                // cabiSelfTestSeed is the source of the representative values of the
+                // types round-tripped by the self-test.
+                var cabiSelfTestSeed = func() []byte {
+                    seed := make([]byte, 4096)
+                    for i := range seed {
+                        seed[i] = byte(i*151 + 7)
+                    }
+                    return seed
+                }()
+                ",
+            );
+            checks.push_str("r := &cabiFuzzReader{data: cabiSelfTestSeed}\n");
+        }
+        for fuzz::FuzzTarget { name, value } in tests {
+            uwriteln!(
+                checks,
+                "for n := 0; n < 4; n++ {{
+                    if !cabiRoundTrip{name}({value}) {{
+                        report += \"\\n{name}\"
+                        break
+                    }}
+                }}"
+            );
+        }
+        uwriteln!(
+            self.src,
+            "
+            // cabiSelfTestReport holds the report of the last self-test, until the
+            // host reads it out of linear memory.
+            var cabiSelfTestReport string
+
+            // cabiSelfTest is the `_self_test` core export, called by the `SelfTest`
+            // method of the instances of the generated host bindings. It lowers and
+            // lifts back representative values of the types of the world, and returns
+            // the pointer and length of a report packed as `ptr<<32 | len`, made of
+            // the version of the generator of the bindings followed by the types
+            // whose values weren't preserved, a line each.
+            //
+            //export _self_test
+            func cabiSelfTest() uint64 {{
+                report := \"{version}\"
+                {checks}cabiSelfTestReport = report
+                return uint64(uintptr(unsafe.Pointer(unsafe.StringData(report))))<<32 | uint64(len(report))
+            }}
+            "
+        );
+    }
+
+    /// Prints the `SelfTest` method of the instances of the host bindings
+    /// with `--self-test`, calling the `_self_test` core export of the guest
+    /// and checking its report, e.g. as a handshake when loading guests built
+    /// by third parties.
+    pub(crate) fn print_self_test_host(&mut self) {
+        if !self.opts.self_test {
+            return;
+        }
+        let world = self.world.to_upper_camel_case();
+        let version = env!("CARGO_PKG_VERSION");
+        let (params, lookup, call, packed, guest) = match self.opts.host_runtime {
+            HostRuntime::Wazero => (
+                "ctx context.Context",
+                "i.module.ExportedFunction(\"_self_test\")",
+                "f.Call(ctx)",
+                "results[0]",
+                "i.guest(ctx)",
+            ),
+            HostRuntime::Wasmtime => (
+                "",
+                "i.instance.GetFunc(i.store, \"_self_test\")",
+                "f.Call(i.store)",
+                "uint64(results.(int64))",
+                "i.guest()",
+            ),
+        };
+        uwriteln!(
+            self.src,
+            "// `SelfTest` runs the self-test of the guest, which round-trips representative
+            // values of the types of the world through its bindings, returning a
+            // `*SelfTestError` if they don't preserve them or weren't generated by the
+            // same version of wit-bindgen-go as the host bindings, and `ErrNoSelfTest` if
+            // the guest doesn't export a self-test.
+            func (i *{world}Instance) SelfTest({params}) (err error) {{
+                defer catchFault(&err)
+                f := {lookup}
+                if f == nil {{
+                    return ErrNoSelfTest
+                }}
+                results, err := {call}
+                if err != nil {{
+                    return err
+                }}
+                packed := {packed}
+                return checkSelfTest({guest}.loadString(uint32(packed>>32), uint32(packed)))
+            }}
+
+            const cabiGeneratorVersion = \"{version}\"
+            {SELF_TEST_REPORT}"
+        );
+    }
+}
@@ -0,0 +1,226 @@
+use std::fmt::Write as _;
+use std::mem;
+
+use anyhow::Result;
+use heck::ToSnakeCase;
+use wit_bindgen_core::wit_parser::{
+    Function, InterfaceId, Resolve, TypeDefKind, TypeId, WorldId, WorldKey,
+};
+use wit_bindgen_core::{uwriteln, Files, Source, WorldGenerator};
+
+use super::{Opts, TinyGo};
+use crate::interface::InterfaceGenerator;
+
+impl TinyGo {
+    /// Whether the named types are defined in the runtime package with
+    /// `--shared-types`.
+    pub(crate) fn shares_types(&self) -> bool {
+        self.opts.shared_types && self.opts.runtime_package.is_some()
+    }
+
+    /// Generates the types shared with `--shared-types` into the runtime
+    /// package `package`, returning whether there were any.
+    pub(crate) fn generate_shared_types(&mut self, package: &str, files: &mut Files) -> bool {
+        if self.shared_types.is_empty() {
+            return false;
+        }
+        let mut src = Source::default();
+        wit_bindgen_core::generated_preamble(&mut src, env!("CARGO_PKG_VERSION"));
+        uwriteln!(src, "package {package}\n");
+        let imports = self.shared_requirements.imports();
+        if !imports.is_empty() {
+            src.push_str("import (\n");
+            for import in imports {
+                uwriteln!(src, "\"{import}\"");
+            }
+            src.push_str(")\n\n");
+        }
+        src.push_str(&mem::take(&mut self.shared_types));
+
+        let file = format!("{package}/{}_types.go", self.world.to_snake_case());
+        files.push(&file, src.as_bytes());
+        self.gofmt_file(files, &file);
+        true
+    }
+}
+
+impl InterfaceGenerator<'_> {
+    /// Defines the type `id` with `define`, in the runtime package rather
+    /// than in the bindings with `--shared-types`.
+    ///
+    /// The imports needed by the definition are tracked apart from the ones
+    /// of the bindings, which use the types through the dot import of the
+    /// runtime package.
+    pub(crate) fn define_shared(&mut self, id: TypeId, define: impl FnOnce(&mut Self)) {
+        if !self.gen.shares_types() {
+            return define(self);
+        }
+        if let TypeDefKind::Resource = self.resolve.types[id].kind {
+            unimplemented!(
+                "resources can't be defined in the runtime package with `--shared-types`"
+            );
+        }
+        let src = mem::take(&mut self.src);
+        let shared = mem::take(&mut self.gen.shared_requirements);
+        let requirements = mem::replace(&mut self.gen.import_requirements, shared);
+        define(self);
+        let types = mem::replace(&mut self.src, src);
+        let shared = mem::replace(&mut self.gen.import_requirements, requirements);
+        self.gen.shared_types.push_str(&types);
+        // the `Option` and `Result` types are generated into the runtime
+        // package along with the bindings
+        self.gen.import_requirements.needs_result_option |= shared.needs_result_option;
+        self.gen.shared_requirements = shared;
+    }
+}
+
+/// The guest and host bindings of a world generated at once with
+/// `--guest-and-host`, into the `guest` and `host` directories.
+///
+/// Both share the types defined in the runtime package, so that a Go host
+/// and a TinyGo guest exchange the very same values and their definitions
+/// can't drift apart.
+pub(crate) struct GuestAndHost {
+    guest: TinyGo,
+    host: TinyGo,
+    guest_files: Files,
+    host_files: Files,
+}
+
+impl GuestAndHost {
+    pub(crate) fn new(opts: &Opts) -> GuestAndHost {
+        let bindings = |host: bool| TinyGo {
+            opts: Opts {
+                host,
+                shared_types: true,
+                guest_and_host: false,
+                native_stubs: opts.native_stubs && !host,
+                per_call_instances: opts.per_call_instances && host,
+                ..opts.clone()
+            },
+            ..TinyGo::default()
+        };
+        GuestAndHost {
+            guest: bindings(false),
+            host: bindings(true),
+            guest_files: Files::default(),
+            host_files: Files::default(),
+        }
+    }
+}
+
+impl WorldGenerator for GuestAndHost {
+    fn preprocess(&mut self, resolve: &Resolve, world: WorldId) {
+        self.guest.preprocess(resolve, world);
+        self.host.preprocess(resolve, world);
+    }
+
+    fn import_interface(
+        &mut self,
+        resolve: &Resolve,
+        name: &WorldKey,
+        iface: InterfaceId,
+        _files: &mut Files,
+    ) -> Result<()> {
+        self.guest
+            .import_interface(resolve, name, iface, &mut self.guest_files)?;
+        self.host
+            .import_interface(resolve, name, iface, &mut self.host_files)
+    }
+
+    fn finish_imports(&mut self, resolve: &Resolve, world: WorldId, _files: &mut Files) {
+        self.guest
+            .finish_imports(resolve, world, &mut self.guest_files);
+        self.host
+            .finish_imports(resolve, world, &mut self.host_files);
+    }
+
+    fn pre_export_interface(&mut self, resolve: &Resolve, _files: &mut Files) -> Result<()> {
+        self.guest
+            .pre_export_interface(resolve, &mut self.guest_files)?;
+        self.host
+            .pre_export_interface(resolve, &mut self.host_files)
+    }
+
+    fn export_interface(
+        &mut self,
+        resolve: &Resolve,
+        name: &WorldKey,
+        iface: InterfaceId,
+        _files: &mut Files,
+    ) -> Result<()> {
+        self.guest
+            .export_interface(resolve, name, iface, &mut self.guest_files)?;
+        self.host
+            .export_interface(resolve, name, iface, &mut self.host_files)
+    }
+
+    fn import_funcs(
+        &mut self,
+        resolve: &Resolve,
+        world: WorldId,
+        funcs: &[(&str, &Function)],
+        _files: &mut Files,
+    ) {
+        self.guest
+            .import_funcs(resolve, world, funcs, &mut self.guest_files);
+        self.host
+            .import_funcs(resolve, world, funcs, &mut self.host_files);
+    }
+
+    fn export_funcs(
+        &mut self,
+        resolve: &Resolve,
+        world: WorldId,
+        funcs: &[(&str, &Function)],
+        _files: &mut Files,
+    ) -> Result<()> {
+        self.guest
+            .export_funcs(resolve, world, funcs, &mut self.guest_files)?;
+        self.host
+            .export_funcs(resolve, world, funcs, &mut self.host_files)
+    }
+
+    fn import_types(
+        &mut self,
+        resolve: &Resolve,
+        world: WorldId,
+        types: &[(&str, TypeId)],
+        _files: &mut Files,
+    ) {
+        self.guest
+            .import_types(resolve, world, types, &mut self.guest_files);
+        self.host
+            .import_types(resolve, world, types, &mut self.host_files);
+    }
+
+    fn finish(&mut self, resolve: &Resolve, world: WorldId, files: &mut Files) -> Result<()> {
+        self.guest.finish(resolve, world, &mut self.guest_files)?;
+        self.host.finish(resolve, world, &mut self.host_files)?;
+
+        let package = self
+            .guest
+            .opts
+            .runtime_package
+            .as_deref()
+            .map(|path| format!("{}/", path.rsplit('/').next().unwrap()));
+        let in_runtime = |name: &str| package.as_deref().is_some_and(|dir| name.starts_with(dir));
+        for (name, contents) in self.guest_files.iter() {
+            if in_runtime(name) {
+                files.push(name, contents);
+            } else {
+                files.push(&format!("guest/{name}"), contents);
+            }
+        }
+        // the runtime package of the guest holds everything the host needs,
+        // along with the helpers only the guest uses
+        for (name, contents) in self.host_files.iter() {
+            if !in_runtime(name) {
+                files.push(&format!("host/{name}"), contents);
+            } else if self.guest_files.get_size(name).is_none() {
+                files.push(name, contents);
+            }
+        }
+        Ok(())
+    }
+}
@@ -0,0 +1,159 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{InterfaceId, Resolve, TypeDefKind};
+
+use super::TinyGo;
+use crate::wasi::interface_name;
+
+/// The logging interface the `slog.Handler` of `--slog-handler` writes to.
+const LOGGING: &str = "wasi:logging/logging";
+
+impl TinyGo {
+    /// Records the imported interface `id`, bound under the Go namespace
+    /// `namespace`, if it's the logging interface with the `log` function
+    /// and `level` enum the handler of `--slog-handler` writes through.
+    pub(crate) fn slog_import(&mut self, resolve: &Resolve, id: InterfaceId, namespace: String) {
+        if !self.opts.slog_handler || interface_name(resolve, id).as_deref() != Some(LOGGING) {
+            return;
+        }
+        let iface = &resolve.interfaces[id];
+        let has_levels = iface.types.get("level").is_some_and(
+            |ty| matches!(&resolve.types[*ty].kind, TypeDefKind::Enum(e) if e.cases.len() == 6),
+        );
+        if has_levels && iface.functions.contains_key("log") {
+            self.slog_import = Some(namespace);
+        }
+    }
+
+    /// Prints `WasiLogHandler`, implementing `slog.Handler` over the imported
+    /// logging interface, and installs it as the default handler of
+    /// `log/slog`, which the `log` package writes through as well.
+    pub(crate) fn print_slog_handler(&mut self) {
+        let Some(ns) = self.slog_import.clone() else {
+            return;
+        };
+        self.with_fmt_import(true);
+        self.import_requirements.needs_context_import = true;
+        self.import_requirements.needs_slog_import = true;
+        self.import_requirements.needs_strings_import = true;
+        let ctx = if self.opts.context { "ctx, " } else { "" };
+        let string = |s: &str| {
+            if self.opts.strings_as_bytes {
+                format!("[]byte({s})")
+            } else {
+                s.to_string()
+            }
+        };
+        let (log_context, message) = (string("h.context"), string("b.String()"));
+        uwriteln!(
+            self.src,
+            "// WasiLogHandler is a `slog.Handler` writing the records through the `log`
+            // function of `{LOGGING}`, with their attributes appended to the message
+            // in the manner of `slog.TextHandler`. The time of the records is left to
+            // the host.
+            //
+            // A handler logging the records of at least `slog.LevelInfo` is installed
+            // as the default handler of `log/slog`, which the `log` package writes
+            // through as well, so that the logs of the guest reach the host.
+            type WasiLogHandler struct {{
+                context string
+                level   slog.Leveler
+                // the attributes added with WithAttrs, formatted
+                attrs string
+                // the prefix of the keys of the attributes, for the groups opened with
+                // WithGroup
+                group string
+            }}
+
+            // NewWasiLogHandler returns a handler logging the records of at least
+            // `level` with `logContext` as their context.
+            func NewWasiLogHandler(logContext string, level slog.Leveler) *WasiLogHandler {{
+                return &WasiLogHandler{{context: logContext, level: level}}
+            }}
+
+            func init() {{
+                slog.SetDefault(slog.New(NewWasiLogHandler(\"\", slog.LevelInfo)))
+            }}
+
+            func (h *WasiLogHandler) Enabled(_ context.Context, level slog.Level) bool {{
+                return level >= h.level.Level()
+            }}
+
+            func (h *WasiLogHandler) Handle(ctx context.Context, r slog.Record) error {{
+                var b strings.Builder
+                b.WriteString(r.Message)
+                b.WriteString(h.attrs)
+                r.Attrs(func(a slog.Attr) bool {{
+                    wasiLogAttr(&b, h.group, a)
+                    return true
+                }})
+                {ns}Log({ctx}wasiLogLevel(r.Level), {log_context}, {message})
+                return nil
+            }}
+
+            func (h *WasiLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {{
+                var b strings.Builder
+                b.WriteString(h.attrs)
+                for _, a := range attrs {{
+                    wasiLogAttr(&b, h.group, a)
+                }}
+                with := *h
+                with.attrs = b.String()
+                return &with
+            }}
+
+            func (h *WasiLogHandler) WithGroup(name string) slog.Handler {{
+                if name == \"\" {{
+                    return h
+                }}
+                with := *h
+                with.group += name + \".\"
+                return &with
+            }}
+
+            // wasiLogLevel returns the level of `{LOGGING}` of the records of `level`,
+            // the levels between those of `log/slog` rounded down.
+            func wasiLogLevel(level slog.Level) {ns}Level {{
+                switch {{
+                case level < slog.LevelDebug:
+                    return {ns}LevelTrace()
+                case level < slog.LevelInfo:
+                    return {ns}LevelDebug()
+                case level < slog.LevelWarn:
+                    return {ns}LevelInfo()
+                case level < slog.LevelError:
+                    return {ns}LevelWarn()
+                case level < slog.LevelError+4:
+                    return {ns}LevelError()
+                default:
+                    return {ns}LevelCritical()
+                }}
+            }}
+
+            // wasiLogAttr appends ` key=value` to `b` for the attribute `a`, the keys of
+            // groups prefixed with their name, and the values quoted if need be.
+            func wasiLogAttr(b *strings.Builder, group string, a slog.Attr) {{
+                a.Value = a.Value.Resolve()
+                if a.Equal(slog.Attr{{}}) {{
+                    return
+                }}
+                if a.Value.Kind() == slog.KindGroup {{
+                    if a.Key != \"\" {{
+                        group += a.Key + \".\"
+                    }}
+                    for _, a := range a.Value.Group() {{
+                        wasiLogAttr(b, group, a)
+                    }}
+                    return
+                }}
+                value := a.Value.String()
+                if value == \"\" || strings.ContainsAny(value, \" \\\"=\") {{
+                    value = fmt.Sprintf(\"%q\", value)
+                }}
+                fmt.Fprintf(b, \" %s%s=%s\", group, a.Key, value)
+            }}
+            "
+        );
+    }
+}
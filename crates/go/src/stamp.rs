@@ -0,0 +1,110 @@
+use std::fmt::Write as _;
+
+use heck::ToUpperCamelCase;
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Resolve, WorldId};
+use wit_component::StringEncoding;
+
+use super::{HostRuntime, TinyGo};
+
+/// Returns the 64-bit FNV-1a hash of the `component-type` encoding of
+/// `world`, which changes along with any type or function of the world but
+/// not with the options of the bindings, so that guest and host bindings
+/// generated for the same world have the same hash.
+fn world_hash(resolve: &Resolve, world: WorldId) -> u64 {
+    let encoded = wit_component::metadata::encode(resolve, world, StringEncoding::UTF8, None)
+        .expect("the world can be encoded");
+    encoded.iter().fold(0xcbf29ce484222325, |hash, byte| {
+        (hash ^ u64::from(*byte)).wrapping_mul(0x100000001b3)
+    })
+}
+
+impl TinyGo {
+    /// Computes the hash and the qualified name of the world stamped on the
+    /// bindings.
+    pub(crate) fn stamp_world(&mut self, resolve: &Resolve, world: WorldId) {
+        self.world_hash = world_hash(resolve, world);
+        let world = &resolve.worlds[world];
+        self.world_qualified_name = match world.package {
+            Some(package) => format!("{}/{}", resolve.packages[package].name, world.name),
+            None => world.name.clone(),
+        };
+    }
+
+    /// Prints the header stamping the bindings with the version of the
+    /// generator and the hash of the world, followed by the `go:generate`
+    /// directive regenerating them with `--go-generate`.
+    pub(crate) fn print_stamp(&mut self) {
+        uwriteln!(
+            self.src,
+            "//wit-bindgen:stamp version={} world={} hash=0x{:016x}",
+            env!("CARGO_PKG_VERSION"),
+            self.world_qualified_name,
+            self.world_hash,
+        );
+        if let Some(args) = &self.opts.go_generate {
+            uwriteln!(self.src, "//go:generate wit-bindgen tiny-go {args}");
+        }
+        self.src.push_str("\n");
+    }
+
+    /// Prints `<World>WorldHash`, along with the `_world_hash` core export
+    /// returning it with `--export-world-hash` for the guest, or the
+    /// instance method returning the one of the guest for the host.
+    pub(crate) fn print_world_hash(&mut self) {
+        let world = self.world.to_upper_camel_case();
+        uwriteln!(
+            self.src,
+            "
+            // `{world}WorldHash` is the hash of the `{name}` world the bindings were
+            // generated for, which guest and host bindings for the same world share.
+            const {world}WorldHash uint64 = 0x{hash:016x}
+            ",
+            name = self.world_qualified_name,
+            hash = self.world_hash,
+        );
+        if self.opts.host {
+            let (ctx_param, get, call, result) = match self.opts.host_runtime {
+                HostRuntime::Wazero => (
+                    "ctx context.Context",
+                    "i.module.ExportedFunction(\"_world_hash\")",
+                    "f.Call(ctx)",
+                    "results[0]",
+                ),
+                HostRuntime::Wasmtime => (
+                    "",
+                    "i.instance.GetFunc(i.store, \"_world_hash\")",
+                    "f.Call(i.store)",
+                    "uint64(results.(int64))",
+                ),
+            };
+            uwriteln!(
+                self.src,
+                "// `GuestWorldHash` returns the hash of the world the guest bindings were
+                // generated for, if the guest exports it as `_world_hash`, which is equal
+                // to `{world}WorldHash` unless the guest and host disagree on the world.
+                func (i *{world}Instance) GuestWorldHash({ctx_param}) (hash uint64, ok bool, err error) {{
+                    f := {get}
+                    if f == nil {{
+                        return 0, false, nil
+                    }}
+                    results, err := {call}
+                    if err != nil {{
+                        return 0, false, err
+                    }}
+                    return {result}, true, nil
+                }}
+                "
+            );
+        } else if self.opts.export_world_hash {
+            uwriteln!(
+                self.src,
+                "//export _world_hash
+                func cabiWorldHash() uint64 {{
+                    return {world}WorldHash
+                }}
+                "
+            );
+        }
+    }
+}
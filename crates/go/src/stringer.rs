@@ -0,0 +1,207 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{Record, Tuple, Type, TypeDefKind, Variant};
+
+use crate::interface::InterfaceGenerator;
+
+/// The number of elements of a list after which `String` methods elide the
+/// rest of the list.
+const MAX_LIST_ELEMS: usize = 16;
+
+/// `String` methods formatting the generated types for debugging, so that
+/// logging a value shows its fields and payloads rather than the untyped
+/// payload pointers variants hold.
+impl InterfaceGenerator<'_> {
+    /// Returns the statements formatting `value` of type `ty` into the
+    /// `*strings.Builder` named `b`.
+    pub(crate) fn format_value(&mut self, value: &str, ty: &Type, depth: usize) -> String {
+        self.gen.with_fmt_import(true);
+        let id = match ty {
+            Type::Char | Type::String => return format!("fmt.Fprintf(b, \"%q\", {value})\n"),
+            Type::Id(id) => *id,
+            _ => return format!("fmt.Fprint(b, {value})\n"),
+        };
+        let resolve = self.resolve;
+        let ty_def = &resolve.types[id];
+        match &ty_def.kind {
+            TypeDefKind::Type(t) => self.format_value(value, t, depth),
+            // anonymous tuples have no methods of their own
+            TypeDefKind::Tuple(t) if ty_def.name.is_none() => {
+                let name = self.get_ty(ty);
+                let fields = self.format_tuple_fields(t, value, depth);
+                format!("b.WriteString(\"{name}{{\")\n{fields}b.WriteString(\"}}\")\n")
+            }
+            TypeDefKind::Option(t) => {
+                let none = self.option_is_none(t, value);
+                let some = self.format_value(&self.option_unwrap(t, value), t, depth);
+                format!(
+                    "if {none} {{
+                        b.WriteString(\"None\")
+                    }} else {{
+                        b.WriteString(\"Some(\")
+                        {some}b.WriteString(\")\")
+                    }}
+                    "
+                )
+            }
+            TypeDefKind::Result(r) => {
+                let mut payload = |ty: &Option<Type>, get: &str| match ty {
+                    Some(t) => self.format_value(&format!("{value}.{get}()"), t, depth),
+                    None => String::new(),
+                };
+                let (ok, err) = (payload(&r.ok, "Unwrap"), payload(&r.err, "UnwrapErr"));
+                format!(
+                    "if {value}.IsOk() {{
+                        b.WriteString(\"Ok(\")
+                        {ok}b.WriteString(\")\")
+                    }} else {{
+                        b.WriteString(\"Err(\")
+                        {err}b.WriteString(\")\")
+                    }}
+                    "
+                )
+            }
+            TypeDefKind::List(t) => {
+                let (i, elem) = (format!("i{depth}"), format!("e{depth}"));
+                let format_elem = self.format_value(&elem, t, depth + 1);
+                format!(
+                    "b.WriteString(\"[\")
+                    for {i}, {elem} := range {value} {{
+                        if {i} == {MAX_LIST_ELEMS} {{
+                            fmt.Fprintf(b, \", ... (%d more)\", len({value})-{i})
+                            break
+                        }}
+                        if {i} > 0 {{
+                            b.WriteString(\", \")
+                        }}
+                        {format_elem}}}
+                    b.WriteString(\"]\")
+                    "
+                )
+            }
+            TypeDefKind::Future(_) | TypeDefKind::Stream(_) => {
+                format!("fmt.Fprintf(b, \"%p\", {value})\n")
+            }
+            // the named types have `String` methods of their own, while
+            // handles are formatted as is
+            _ => format!("fmt.Fprint(b, {value})\n"),
+        }
+    }
+
+    /// Returns the statements formatting the elements of `value`, a value of
+    /// the tuple `tuple`, separated by commas.
+    fn format_tuple_fields(&mut self, tuple: &Tuple, value: &str, depth: usize) -> String {
+        let mut src = String::new();
+        for (i, ty) in tuple.types.iter().enumerate() {
+            if i > 0 {
+                src.push_str("b.WriteString(\", \")\n");
+            }
+            src.push_str(&self.format_value(&self.tuple_field(tuple, value, i), ty, depth));
+        }
+        src
+    }
+
+    /// Prints the `String` method `name` with the statements `body`
+    /// formatting `v` into `b`.
+    fn print_string_method(&mut self, name: &str, body: &str) {
+        self.gen.with_strings_import(true);
+        uwriteln!(
+            self.src,
+            "// String formats `v` for debugging, eliding the elements of long lists.
+            func (v {name}) String() string {{
+                b := &strings.Builder{{}}
+                {body}return b.String()
+            }}
+            "
+        );
+    }
+
+    /// Prints the `String` method of the record `name`, formatting its fields
+    /// like a keyed composite literal.
+    pub(crate) fn print_record_string(&mut self, name: &str, record: &Record) {
+        if !self.debug_strings() {
+            return;
+        }
+        let mut body = format!("b.WriteString(\"{name}{{\")\n");
+        for (i, field) in record.fields.iter().enumerate() {
+            let field_name = self.field_name(field);
+            // the method would collide with a field of the same name
+            if field_name == "String" {
+                return;
+            }
+            let sep = if i > 0 { ", " } else { "" };
+            uwriteln!(body, "b.WriteString(\"{sep}{field_name}: \")");
+            body.push_str(&self.format_value(&format!("v.{field_name}"), &field.ty, 0));
+        }
+        body.push_str("b.WriteString(\"}\")\n");
+        self.print_string_method(name, &body);
+    }
+
+    /// Prints the `String` method of the tuple `name`, formatting its
+    /// elements like an unkeyed composite literal.
+    pub(crate) fn print_tuple_string(&mut self, name: &str, tuple: &Tuple) {
+        if !self.debug_strings() {
+            return;
+        }
+        let fields = self.format_tuple_fields(tuple, "v", 0);
+        let body = format!("b.WriteString(\"{name}{{\")\n{fields}b.WriteString(\"}}\")\n");
+        self.print_string_method(name, &body);
+    }
+
+    /// Prints the `String` method of the variant `name`, formatting the case
+    /// along with its payload if any.
+    pub(crate) fn print_variant_string(&mut self, name: &str, variant: &Variant) {
+        if !self.debug_strings() {
+            return;
+        }
+        let mut cases = String::new();
+        for case in variant.cases.iter() {
+            let case_name = self.case_name(&case.name);
+            let payload = match &case.ty {
+                Some(ty) => {
+                    let value = self.variant_case_payload("v", name, &case_name);
+                    let payload = self.format_value(&value, ty, 0);
+                    format!("b.WriteString(\"(\")\n{payload}b.WriteString(\")\")\n")
+                }
+                None => String::new(),
+            };
+            uwriteln!(
+                cases,
+                "case {name}Kind{case_name}:
+                    b.WriteString(\"{name}{case_name}\")
+                    {payload}"
+            );
+        }
+        let body = format!(
+            "switch v.kind {{
+            {cases}default:
+                fmt.Fprintf(b, \"{name}(%d)\", v.kind)
+            }}
+            "
+        );
+        self.print_string_method(name, &body);
+    }
+
+    /// Prints the `String` method of the case `case_name` of the sealed
+    /// variant `name`, holding a payload of type `ty` if any.
+    pub(crate) fn print_sealed_case_string(
+        &mut self,
+        name: &str,
+        case_name: &str,
+        ty: Option<&Type>,
+    ) {
+        if !self.debug_strings() {
+            return;
+        }
+        let payload = match ty {
+            Some(ty) => {
+                let payload = self.format_value("v.Value", ty, 0);
+                format!("b.WriteString(\"(\")\n{payload}b.WriteString(\")\")\n")
+            }
+            None => String::new(),
+        };
+        let body = format!("b.WriteString(\"{name}{case_name}\")\n{payload}");
+        self.print_string_method(&format!("{name}{case_name}"), &body);
+    }
+}
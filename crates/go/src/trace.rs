@@ -0,0 +1,52 @@
+use wit_bindgen_core::wit_parser::Function;
+
+use crate::interface::InterfaceGenerator;
+
+/// The hook notified of the calls across the component boundary with
+/// `--trace`.
+pub(crate) const TRACE_HOOK: &str = r#"
+// `Phase` is the phase of a call across the component boundary reported to
+// the trace hook.
+type Phase int
+
+const (
+	// `PhaseEnter` is reported before the call is made.
+	PhaseEnter Phase = iota
+	// `PhaseExit` is reported once the call returned, or panicked.
+	PhaseExit
+)
+
+var cabiTraceHook func(iface, fn string, phase Phase)
+
+// `SetTraceHook` sets the function called on entry and exit of each imported
+// and exported function, with the WIT names of its interface and itself, e.g.
+// to log the calls or to measure their latency. Passing `nil` removes it.
+func SetTraceHook(hook func(iface, fn string, phase Phase)) {
+	cabiTraceHook = hook
+}
+
+func cabiTrace(iface, fn string) func() {
+	hook := cabiTraceHook
+	if hook == nil {
+		return cabiTraceNop
+	}
+	hook(iface, fn, PhaseEnter)
+	return func() {
+		hook(iface, fn, PhaseExit)
+	}
+}
+
+func cabiTraceNop() {}
+"#;
+
+impl InterfaceGenerator<'_> {
+    /// Returns the statement reporting the call to `func` to the trace hook
+    /// on entry, and on exit once deferred.
+    pub(crate) fn trace_call(&self, func: &Function) -> String {
+        if !self.gen.opts.trace {
+            return String::new();
+        }
+        let iface = self.wit_name();
+        format!("defer cabiTrace(\"{iface}\", \"{}\")()\n", func.name)
+    }
+}
@@ -0,0 +1,32 @@
+/// The hook transforming the strings exchanged across the component boundary
+/// with `--string-transcoder`.
+pub(crate) const STRING_TRANSCODER: &str = r#"
+// `Transcoding` is the way a string passed to the string transcoder crosses
+// the component boundary.
+type Transcoding int
+
+const (
+	// `TranscodeLower` is a string about to be lowered to the other side.
+	TranscodeLower Transcoding = iota
+	// `TranscodeLift` is a string just lifted from the other side.
+	TranscodeLift
+)
+
+var cabiStringTranscoder func(s string, t Transcoding) string
+
+// `SetStringTranscoder` sets the function transforming every string lowered
+// and lifted by the bindings, e.g. to normalize them to NFC with
+// `golang.org/x/text/unicode/norm`, or to replace their invalid UTF-8
+// sequences with `strings.ToValidUTF8` rather than passing them on. Passing
+// `nil` removes it.
+func SetStringTranscoder(transcoder func(s string, t Transcoding) string) {
+	cabiStringTranscoder = transcoder
+}
+
+func cabiTranscode(s string, t Transcoding) string {
+	if cabiStringTranscoder == nil {
+		return s
+	}
+	return cabiStringTranscoder(s, t)
+}
+"#;
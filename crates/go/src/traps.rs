@@ -0,0 +1,143 @@
+/// The error reporting the traps of the guest, shared by all runtimes.
+pub(crate) const TRAP_ERROR: &str = r#"
+// `TrapKind` classifies the traps of a guest.
+type TrapKind int
+
+const (
+	// `TrapUnknown` is a trap the runtime doesn't classify, such as one raised
+	// by a host function.
+	TrapUnknown TrapKind = iota
+	TrapUnreachable
+	TrapMemoryOutOfBounds
+	TrapStackExhausted
+	TrapIntegerDivideByZero
+	TrapIntegerOverflow
+	TrapInvalidConversion
+	TrapIndirectCall
+)
+
+func (k TrapKind) String() string {
+	switch k {
+	case TrapUnreachable:
+		return "unreachable"
+	case TrapMemoryOutOfBounds:
+		return "out of bounds memory access"
+	case TrapStackExhausted:
+		return "stack exhausted"
+	case TrapIntegerDivideByZero:
+		return "integer divide by zero"
+	case TrapIntegerOverflow:
+		return "integer overflow"
+	case TrapInvalidConversion:
+		return "invalid conversion to integer"
+	case TrapIndirectCall:
+		return "invalid indirect call"
+	default:
+		return "unknown trap"
+	}
+}
+
+// `TrapError` reports a trap of the guest while it ran one of its exports,
+// which is a bug of the guest rather than a violation of the canonical ABI
+// while exchanging values with it, reported as an `ABIError`. The instance
+// can't be relied upon after a trap.
+type TrapError struct {
+	// the name of the core export trapping, e.g. `my:pkg/iface#func`
+	Func string
+	Kind TrapKind
+	// the frames of the guest when it trapped, innermost first, if the
+	// runtime provides them
+	Backtrace []string
+	// the error reported by the runtime
+	Err error
+}
+
+func (e *TrapError) Error() string {
+	return fmt.Sprintf("guest trapped in `%s`: %v", e.Func, e.Err)
+}
+
+func (e *TrapError) Unwrap() error {
+	return e.Err
+}
+"#;
+
+/// The conversion of the errors of wazero into `TrapError`s, which wazero
+/// only describes through their message.
+pub(crate) const WAZERO_TRAP: &str = r#"
+// trapError converts the error of the export `name` into a `TrapError`,
+// unless it's an ABI violation or the guest exiting.
+func trapError(name string, err error) error {
+	var abiErr *ABIError
+	var exitErr interface{ ExitCode() uint32 }
+	if errors.As(err, &abiErr) || errors.As(err, &exitErr) {
+		return err
+	}
+	msg := err.Error()
+	trap := &TrapError{Func: name, Err: err}
+	switch {
+	case strings.Contains(msg, "wasm error: unreachable"):
+		trap.Kind = TrapUnreachable
+	case strings.Contains(msg, "wasm error: out of bounds memory access"):
+		trap.Kind = TrapMemoryOutOfBounds
+	case strings.Contains(msg, "wasm error: stack overflow"):
+		trap.Kind = TrapStackExhausted
+	case strings.Contains(msg, "wasm error: integer divide by zero"):
+		trap.Kind = TrapIntegerDivideByZero
+	case strings.Contains(msg, "wasm error: integer overflow"):
+		trap.Kind = TrapIntegerOverflow
+	case strings.Contains(msg, "wasm error: invalid conversion to integer"):
+		trap.Kind = TrapInvalidConversion
+	case strings.Contains(msg, "wasm error: invalid table access"),
+		strings.Contains(msg, "wasm error: indirect call type mismatch"):
+		trap.Kind = TrapIndirectCall
+	}
+	if _, frames, ok := strings.Cut(msg, "wasm stack trace:\n"); ok {
+		for _, line := range strings.Split(frames, "\n") {
+			// the frames are indented by one tab, their source locations by more
+			if strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "\t ") && !strings.HasPrefix(line, "\t\t") {
+				trap.Backtrace = append(trap.Backtrace, strings.TrimSpace(line))
+			}
+		}
+	}
+	return trap
+}
+"#;
+
+/// The conversion of the traps of wasmtime into `TrapError`s.
+pub(crate) const WASMTIME_TRAP: &str = r#"
+// trapError converts the error of the export `name` into a `TrapError` if
+// it's a trap.
+func trapError(name string, err error) error {
+	var wasmTrap *wasmtime.Trap
+	if !errors.As(err, &wasmTrap) {
+		return err
+	}
+	trap := &TrapError{Func: name, Err: err}
+	if code := wasmTrap.Code(); code != nil {
+		switch *code {
+		case wasmtime.UnreachableCodeReached:
+			trap.Kind = TrapUnreachable
+		case wasmtime.MemoryOutOfBounds, wasmtime.HeapMisaligned:
+			trap.Kind = TrapMemoryOutOfBounds
+		case wasmtime.StackOverflow:
+			trap.Kind = TrapStackExhausted
+		case wasmtime.IntegerDivisionByZero:
+			trap.Kind = TrapIntegerDivideByZero
+		case wasmtime.IntegerOverflow:
+			trap.Kind = TrapIntegerOverflow
+		case wasmtime.BadConversionToInteger:
+			trap.Kind = TrapInvalidConversion
+		case wasmtime.TableOutOfBounds, wasmtime.IndirectCallToNull, wasmtime.BadSignature:
+			trap.Kind = TrapIndirectCall
+		}
+	}
+	for _, frame := range wasmTrap.Frames() {
+		name := fmt.Sprintf("<wasm function %d>", frame.FuncIndex())
+		if funcName := frame.FuncName(); funcName != nil {
+			name = *funcName
+		}
+		trap.Backtrace = append(trap.Backtrace, fmt.Sprintf("%s+%#x", name, frame.FuncOffset()))
+	}
+	return trap
+}
+"#;
@@ -0,0 +1,75 @@
+use std::fmt::Write as _;
+
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::Tuple;
+
+use crate::interface::InterfaceGenerator;
+
+impl InterfaceGenerator<'_> {
+    /// Returns whether `tuple` is bound to a Go array with
+    /// `--tuples-as-arrays`, which is the case of the non-empty tuples whose
+    /// elements are all of the same type.
+    pub(crate) fn tuple_as_array(&self, tuple: &Tuple) -> bool {
+        self.gen.opts.tuples_as_arrays
+            && tuple
+                .types
+                .split_first()
+                .is_some_and(|(first, rest)| rest.iter().all(|ty| ty == first))
+    }
+
+    /// Returns the expression accessing the element `i` of `value`, a value
+    /// of the tuple `tuple`.
+    pub(crate) fn tuple_field(&self, tuple: &Tuple, value: &str, i: usize) -> String {
+        if self.tuple_as_array(tuple) {
+            format!("{value}[{i}]")
+        } else {
+            format!("{value}.F{i}")
+        }
+    }
+
+    /// Returns the key of the element `i` in a composite literal of the tuple
+    /// `tuple`.
+    pub(crate) fn tuple_key(&self, tuple: &Tuple, i: usize) -> String {
+        if self.tuple_as_array(tuple) {
+            i.to_string()
+        } else {
+            format!("F{i}")
+        }
+    }
+
+    /// Prints the tuple `name` bound to an array, along with `Fields` and
+    /// `<Tuple>FromFields` converting it from and to the struct it's bound to
+    /// otherwise. The struct is unnamed, so that a tuple generated without
+    /// `--tuples-as-arrays` is assignable to it.
+    pub(crate) fn print_tuple_array(&mut self, name: &str, tuple: &Tuple) {
+        let elem = self.get_ty(&tuple.types[0]);
+        let len = tuple.types.len();
+        let fields = (0..len)
+            .map(|i| format!("F{i} {elem}"))
+            .collect::<Vec<_>>()
+            .join("; ");
+        let to_fields = (0..len)
+            .map(|i| format!("v[{i}]"))
+            .collect::<Vec<_>>()
+            .join(", ");
+        let from_fields = (0..len)
+            .map(|i| format!("f.F{i}"))
+            .collect::<Vec<_>>()
+            .join(", ");
+        uwriteln!(
+            self.src,
+            "type {name} [{len}]{elem}
+
+            // Fields returns the elements of `v` as the fields of a struct.
+            func (v {name}) Fields() struct{{ {fields} }} {{
+                return struct{{ {fields} }}{{{to_fields}}}
+            }}
+
+            // {name}FromFields returns the tuple of the fields of `f`.
+            func {name}FromFields(f struct{{ {fields} }}) {name} {{
+                return {name}{{{from_fields}}}
+            }}
+            "
+        );
+    }
+}
@@ -0,0 +1,50 @@
+use heck::ToSnakeCase;
+use wit_bindgen_core::wit_parser::PackageName;
+
+use super::TinyGo;
+
+impl TinyGo {
+    /// Returns the fragment of the Go identifiers standing for the version of
+    /// `package`, if versioned, as given with `--rename-version` or made of
+    /// the version with its separators replaced by underscores otherwise.
+    pub(crate) fn version_ident(&self, package: &PackageName) -> Option<String> {
+        let version = package.version.as_ref()?;
+        let package = package.to_string();
+        match self
+            .opts
+            .rename_version
+            .iter()
+            .rev()
+            .find(|(p, _)| *p == package)
+        {
+            Some((_, go)) => Some(go.clone()),
+            None => Some(version.to_string().replace(['.', '-', '+'], "_")),
+        }
+    }
+
+    /// Returns the directory standing for the version of `package` in the
+    /// directories of the packages re-exporting interfaces, such as `v0_2_0`
+    /// for `0.2.0`.
+    pub(crate) fn version_dir(&self, package: &PackageName) -> Option<String> {
+        let ident = self.version_ident(package)?.to_snake_case();
+        if ident.starts_with(|c: char| c.is_ascii_digit()) {
+            Some(format!("v{ident}"))
+        } else {
+            Some(ident)
+        }
+    }
+
+    /// Records the Go namespace of the interface `wit_name`, panicking if
+    /// another interface of the world is bound to the same namespace, such
+    /// as two versions of a package whose versions only differ by their
+    /// separators.
+    pub(crate) fn claim_namespace(&mut self, namespace: String, wit_name: &str) {
+        if let Some(other) = self.namespaces.get(&namespace) {
+            panic!(
+                "the WIT interfaces `{other}` and `{wit_name}` are both named `{namespace}` \
+                in Go, rename one of them with `--rename` or `--rename-version`"
+            );
+        }
+        self.namespaces.insert(namespace, wit_name.to_string());
+    }
+}
@@ -0,0 +1,456 @@
+use std::fmt::Write as _;
+
+use anyhow::{bail, Result};
+use wit_bindgen_core::uwriteln;
+use wit_bindgen_core::wit_parser::{InterfaceId, Resolve, WorldId, WorldItem};
+
+use super::{Opts, TinyGo};
+
+/// The standard WASI preview2 interfaces adapted to the Go standard library
+/// with `--wasi-adapter`, along with the functions the adapter calls.
+///
+/// `wasi:sockets` isn't adapted: a `net.Conn` would have to be built over
+/// the pollables and streams of `wasi:io`, which TinyGo's `net` package
+/// couldn't use anyway. The worlds importing it are rejected instead.
+const ADAPTED: &[(&str, &[&str])] = &[
+    ("wasi:clocks/wall-clock", &["now"]),
+    ("wasi:clocks/monotonic-clock", &["now"]),
+    ("wasi:random/random", &["get-random-bytes"]),
+    (
+        "wasi:cli/environment",
+        &["get-environment", "get-arguments"],
+    ),
+    ("wasi:filesystem/preopens", &["get-directories"]),
+    (
+        "wasi:filesystem/types",
+        &[
+            "[method]descriptor.open-at",
+            "[method]descriptor.read",
+            "[method]descriptor.stat",
+            "[method]descriptor.stat-at",
+            "[method]descriptor.read-directory",
+            "[method]directory-entry-stream.read-directory-entry",
+        ],
+    ),
+];
+
+/// Returns the unversioned name of the interface `id`, such as
+/// `wasi:clocks/wall-clock`, if its package has a name.
+pub(crate) fn interface_name(resolve: &Resolve, id: InterfaceId) -> Option<String> {
+    let iface = &resolve.interfaces[id];
+    let pkg = &resolve.packages[iface.package?].name;
+    Some(format!(
+        "{}:{}/{}",
+        pkg.namespace,
+        pkg.name,
+        iface.name.as_ref()?
+    ))
+}
+
+impl TinyGo {
+    /// Records the imported interface `id`, bound under the Go namespace
+    /// `namespace`, if the WASI adapter wraps it.
+    pub(crate) fn wasi_import(&mut self, resolve: &Resolve, id: InterfaceId, namespace: String) {
+        if !self.opts.wasi_adapter {
+            return;
+        }
+        let Some(name) = interface_name(resolve, id) else {
+            return;
+        };
+        let funcs = &resolve.interfaces[id].functions;
+        let adapted = ADAPTED
+            .iter()
+            .any(|(iface, needs)| *iface == name && needs.iter().all(|f| funcs.contains_key(*f)));
+        if adapted {
+            self.wasi_imports.insert(name, namespace);
+        }
+    }
+
+    /// Rejects the worlds importing `wasi:sockets` with `--wasi-adapter`,
+    /// rather than leaving the guest with sockets the adapter doesn't cover.
+    pub(crate) fn check_wasi_adapter(&self, resolve: &Resolve, world: WorldId) -> Result<()> {
+        if !self.opts.wasi_adapter {
+            return Ok(());
+        }
+        for (_, item) in resolve.worlds[world].imports.iter() {
+            let WorldItem::Interface { id, .. } = item else {
+                continue;
+            };
+            let Some(name) = interface_name(resolve, *id) else {
+                continue;
+            };
+            if name.starts_with("wasi:sockets/") {
+                bail!(
+                    "`--wasi-adapter` doesn't support `wasi:sockets`, imported as `{name}`, \
+                    which it can't adapt to the `net` package"
+                );
+            }
+        }
+        Ok(())
+    }
+
+    /// Prints helpers adapting the imported WASI interfaces to the manner of
+    /// the `os`, `time` and `crypto/rand` packages, which aren't backed by
+    /// preview2 hosts in TinyGo.
+    pub(crate) fn print_wasi_adapter(&mut self) {
+        let ctx = if self.opts.context {
+            "context.Background()"
+        } else {
+            ""
+        };
+        let mut src = String::new();
+        for (name, ns) in &self.wasi_imports {
+            match name.as_str() {
+                "wasi:clocks/wall-clock" => {
+                    self.import_requirements.needs_time_import = true;
+                    uwriteln!(
+                        src,
+                        "// WasiWallClock returns the current time, read from `{name}`.
+                        func WasiWallClock() time.Time {{
+                            now := {ns}Now({ctx})
+                            return time.Unix(int64(now.Seconds), int64(now.Nanoseconds))
+                        }}
+                        "
+                    );
+                }
+                "wasi:clocks/monotonic-clock" => {
+                    self.import_requirements.needs_time_import = true;
+                    uwriteln!(
+                        src,
+                        "// WasiMonotonicClock returns the time elapsed since an arbitrary point
+                        // in the past, read from `{name}`. The difference between two readings
+                        // measures the time elapsed between them.
+                        func WasiMonotonicClock() time.Duration {{
+                            return time.Duration({ns}Now({ctx}))
+                        }}
+                        "
+                    );
+                }
+                "wasi:random/random" => {
+                    self.import_requirements.needs_io_import = true;
+                    let ctx = if ctx.is_empty() {
+                        String::new()
+                    } else {
+                        format!("{ctx}, ")
+                    };
+                    uwriteln!(
+                        src,
+                        "// WasiRandom reads cryptographically secure random bytes from `{name}`,
+                        // in the manner of `crypto/rand.Reader`.
+                        var WasiRandom io.Reader = wasiRandomReader{{}}
+
+                        type wasiRandomReader struct{{}}
+
+                        func (wasiRandomReader) Read(p []byte) (int, error) {{
+                            return copy(p, {ns}GetRandomBytes({ctx}uint64(len(p)))), nil
+                        }}
+                        "
+                    );
+                }
+                "wasi:cli/environment" => {
+                    uwriteln!(
+                        src,
+                        "// WasiEnviron returns the environment variables of `{name}` in the
+                        // form \"key=value\", like `os.Environ`.
+                        func WasiEnviron() []string {{
+                            vars := {ns}GetEnvironment({ctx})
+                            env := make([]string, len(vars))
+                            for i, v := range vars {{
+                                env[i] = v.F0 + \"=\" + v.F1
+                            }}
+                            return env
+                        }}
+
+                        // WasiGetenv returns the value of the environment variable `key` of
+                        // `{name}`, like `os.Getenv`.
+                        func WasiGetenv(key string) string {{
+                            for _, v := range {ns}GetEnvironment({ctx}) {{
+                                if v.F0 == key {{
+                                    return v.F1
+                                }}
+                            }}
+                            return \"\"
+                        }}
+
+                        // WasiArgs returns the command-line arguments of `{name}`, like
+                        // `os.Args`.
+                        func WasiArgs() []string {{
+                            return {ns}GetArguments({ctx})
+                        }}
+                        "
+                    );
+                }
+                "wasi:filesystem/preopens" => {
+                    // the descriptors are used through `wasi:filesystem/types`
+                    let Some(types) = self.wasi_imports.get("wasi:filesystem/types") else {
+                        continue;
+                    };
+                    self.import_requirements.needs_fs_import = true;
+                    self.import_requirements.needs_time_import = true;
+                    src.push_str(&wasi_fs(&self.opts, ns, types, ctx));
+                }
+                // adapted along with `wasi:filesystem/preopens`
+                "wasi:filesystem/types" => {}
+                _ => unreachable!(),
+            }
+        }
+        self.src.push_str(&src);
+    }
+}
+
+/// Returns the `fs.FS` adapter over the directories preopened through
+/// `wasi:filesystem/preopens`, bound under the Go namespace `preopens`, and
+/// read through `wasi:filesystem/types`, bound under `types`.
+///
+/// The adapter is read-only, as `fs.FS` is.
+fn wasi_fs(opts: &Opts, preopens: &str, types: &str, ctx: &str) -> String {
+    let arg = if ctx.is_empty() {
+        String::new()
+    } else {
+        format!("{ctx}, ")
+    };
+    // every call returns an `error` rather than a `Result` with `--result-as-error`
+    let result = if opts.result_as_error {
+        format!(
+            "func wasiFSResult[T any](v T, err error) (T, error) {{
+                if err != nil {{
+                    return v, wasiFSError(ResultErrorPayload[{types}ErrorCode](err))
+                }}
+                return v, nil
+            }}"
+        )
+    } else {
+        format!(
+            "func wasiFSResult[T any](r Result[T, {types}ErrorCode]) (T, error) {{
+                if r.IsErr() {{
+                    var zero T
+                    return zero, wasiFSError(r.UnwrapErr())
+                }}
+                return r.Unwrap(), nil
+            }}"
+        )
+    };
+    let (entry_none, entry) = if opts.option_pointers {
+        ("entry == nil", "*entry")
+    } else {
+        ("entry.IsNone()", "entry.Unwrap()")
+    };
+    let (mtime_some, mtime) = if opts.option_pointers {
+        ("mtime != nil", "*mtime")
+    } else {
+        ("mtime.IsSome()", "mtime.Unwrap()")
+    };
+    let preopens_name = "wasi:filesystem/preopens";
+    format!(
+        "// WasiFS returns the directory `name` preopened by the host through
+        // `{preopens_name}` as a read-only `fs.FS`, like `os.DirFS`, or nil if the host
+        // didn't preopen it.
+        func WasiFS(name string) fs.FS {{
+            var fsys fs.FS
+            for _, dir := range {preopens}GetDirectories({ctx}) {{
+                if fsys == nil && dir.F1 == name {{
+                    fsys = wasiFS{{dir.F0}}
+                }} else {{
+                    dir.F0.Drop()
+                }}
+            }}
+            return fsys
+        }}
+
+        // wasiFSResult converts the result of a filesystem function into an error
+        // of `io/fs` if it failed.
+        {result}
+
+        // wasiFSError converts `code` into the matching error of `io/fs`, or returns
+        // it as is if there's none.
+        func wasiFSError(code {types}ErrorCode) error {{
+            switch code.Kind() {{
+            case {types}ErrorCodeKindNoEntry:
+                return fs.ErrNotExist
+            case {types}ErrorCodeKindExist:
+                return fs.ErrExist
+            case {types}ErrorCodeKindAccess, {types}ErrorCodeKindNotPermitted:
+                return fs.ErrPermission
+            case {types}ErrorCodeKindInvalid:
+                return fs.ErrInvalid
+            }}
+            return code
+        }}
+
+        type wasiFS struct {{
+            dir {types}Descriptor
+        }}
+
+        func (f wasiFS) Open(name string) (fs.File, error) {{
+            if !fs.ValidPath(name) {{
+                return nil, &fs.PathError{{Op: "open", Path: name, Err: fs.ErrInvalid}}
+            }}
+            fd, err := wasiFSResult(f.dir.OpenAt({arg}{types}PathFlags_SymlinkFollow, name, 0, {types}DescriptorFlags_Read))
+            if err != nil {{
+                return nil, &fs.PathError{{Op: "open", Path: name, Err: err}}
+            }}
+            return &wasiFile{{fd: fd, name: name}}, nil
+        }}
+
+        // wasiFile is a file or a directory opened by `wasiFS`.
+        type wasiFile struct {{
+            fd     {types}Descriptor
+            name   string
+            offset int64
+            // the entries of the directory left to read by ReadDir, once it started
+            entries  {types}DirectoryEntryStream
+            listing  bool
+        }}
+
+        func (f *wasiFile) Stat() (fs.FileInfo, error) {{
+            stat, err := wasiFSResult(f.fd.Stat({ctx}))
+            if err != nil {{
+                return nil, &fs.PathError{{Op: "stat", Path: f.name, Err: err}}
+            }}
+            return wasiFileInfo{{name: path.Base(f.name), stat: stat}}, nil
+        }}
+
+        func (f *wasiFile) Read(p []byte) (int, error) {{
+            n, err := f.ReadAt(p, f.offset)
+            f.offset += int64(n)
+            return n, err
+        }}
+
+        func (f *wasiFile) ReadAt(p []byte, off int64) (int, error) {{
+            if off < 0 {{
+                return 0, &fs.PathError{{Op: "read", Path: f.name, Err: fs.ErrInvalid}}
+            }}
+            n := 0
+            for n < len(p) {{
+                chunk, err := wasiFSResult(f.fd.Read({arg}uint64(len(p)-n), uint64(off)+uint64(n)))
+                if err != nil {{
+                    return n, &fs.PathError{{Op: "read", Path: f.name, Err: err}}
+                }}
+                n += copy(p[n:], chunk.F0)
+                // the second element reports the end of the file
+                if chunk.F1 || len(chunk.F0) == 0 {{
+                    return n, io.EOF
+                }}
+            }}
+            return n, nil
+        }}
+
+        func (f *wasiFile) ReadDir(n int) ([]fs.DirEntry, error) {{
+            if !f.listing {{
+                entries, err := wasiFSResult(f.fd.ReadDirectory({ctx}))
+                if err != nil {{
+                    return nil, &fs.PathError{{Op: "readdir", Path: f.name, Err: err}}
+                }}
+                f.entries, f.listing = entries, true
+            }}
+            var list []fs.DirEntry
+            for n <= 0 || len(list) < n {{
+                entry, err := wasiFSResult(f.entries.ReadDirectoryEntry({ctx}))
+                if err != nil {{
+                    return list, &fs.PathError{{Op: "readdir", Path: f.name, Err: err}}
+                }}
+                if {entry_none} {{
+                    break
+                }}
+                list = append(list, wasiDirEntry{{dir: f.fd, entry: {entry}}})
+            }}
+            if n > 0 && len(list) == 0 {{
+                return nil, io.EOF
+            }}
+            return list, nil
+        }}
+
+        func (f *wasiFile) Close() error {{
+            if f.listing {{
+                f.entries.Drop()
+                f.listing = false
+            }}
+            f.fd.Drop()
+            return nil
+        }}
+
+        type wasiDirEntry struct {{
+            dir   {types}Descriptor
+            entry {types}DirectoryEntry
+        }}
+
+        func (e wasiDirEntry) Name() string {{
+            return e.entry.Name
+        }}
+
+        func (e wasiDirEntry) IsDir() bool {{
+            return e.Type().IsDir()
+        }}
+
+        func (e wasiDirEntry) Type() fs.FileMode {{
+            return wasiFileMode(e.entry.Type).Type()
+        }}
+
+        func (e wasiDirEntry) Info() (fs.FileInfo, error) {{
+            stat, err := wasiFSResult(e.dir.StatAt({arg}0, e.entry.Name))
+            if err != nil {{
+                return nil, &fs.PathError{{Op: "stat", Path: e.entry.Name, Err: err}}
+            }}
+            return wasiFileInfo{{name: e.entry.Name, stat: stat}}, nil
+        }}
+
+        // wasiFileInfo describes a file of `wasiFS`. Its `Sys` returns the
+        // `{types}DescriptorStat` it's read from.
+        type wasiFileInfo struct {{
+            name string
+            stat {types}DescriptorStat
+        }}
+
+        func (i wasiFileInfo) Name() string {{
+            return i.name
+        }}
+
+        func (i wasiFileInfo) Size() int64 {{
+            return int64(i.stat.Size)
+        }}
+
+        func (i wasiFileInfo) Mode() fs.FileMode {{
+            return wasiFileMode(i.stat.Type)
+        }}
+
+        func (i wasiFileInfo) ModTime() time.Time {{
+            mtime := i.stat.DataModificationTimestamp
+            if {mtime_some} {{
+                t := {mtime}
+                return time.Unix(int64(t.Seconds), int64(t.Nanoseconds))
+            }}
+            return time.Time{{}}
+        }}
+
+        func (i wasiFileInfo) IsDir() bool {{
+            return i.Mode().IsDir()
+        }}
+
+        func (i wasiFileInfo) Sys() any {{
+            return i.stat
+        }}
+
+        // wasiFileMode returns the mode of the files of type `ty`, which are all
+        // readable since WASI doesn't expose the permissions of files.
+        func wasiFileMode(ty {types}DescriptorType) fs.FileMode {{
+            switch ty.Kind() {{
+            case {types}DescriptorTypeKindDirectory:
+                return fs.ModeDir | 0o555
+            case {types}DescriptorTypeKindSymbolicLink:
+                return fs.ModeSymlink | 0o777
+            case {types}DescriptorTypeKindRegularFile:
+                return 0o444
+            case {types}DescriptorTypeKindBlockDevice:
+                return fs.ModeDevice | 0o444
+            case {types}DescriptorTypeKindCharacterDevice:
+                return fs.ModeDevice | fs.ModeCharDevice | 0o444
+            case {types}DescriptorTypeKindFifo:
+                return fs.ModeNamedPipe | 0o444
+            case {types}DescriptorTypeKindSocket:
+                return fs.ModeSocket | 0o444
+            }}
+            return fs.ModeIrregular | 0o444
+        }}
+        "
+    )
+}
@@ -1,16 +1,22 @@
 use std::io::prelude::*;
 use std::io::BufReader;
-use std::path::Path;
+use std::path::{Path, PathBuf};
 use std::process::Command;
 
 use heck::*;
+use wit_bindgen_core::wit_parser::{
+    Resolve, TypeDefKind, UnresolvedPackageGroup, WorldId, WorldItem,
+};
+use wit_bindgen_core::Files;
+use wit_bindgen_go::{ExportPanics, HostRuntime, Opts};
+use wit_component::StringEncoding;
 
 macro_rules! codegen_test {
     (issue668 $name:tt $test:tt) => {};
     (multiversion $name:tt $test:tt) => {};
 
-    // TODO: implement support for stream, future, and error-context, and then
-    // remove these lines:
+    // TODO: implement support for non-primitive stream and future payloads, and
+    // for error-context, and then remove these lines:
     (streams $name:tt $test:tt) => {};
     (futures $name:tt $test:tt) => {};
     (resources_with_streams $name:tt $test:tt) => {};
@@ -20,23 +26,805 @@ macro_rules! codegen_test {
     ($id:ident $name:tt $test:tt) => {
         #[test]
         fn $id() {
-            test_helpers::run_world_codegen_test(
-                "guest-go",
-                $test.as_ref(),
-                |resolve, world, files| {
-                    wit_bindgen_go::Opts::default()
-                        .build()
-                        .generate(resolve, world, files)
-                        .unwrap()
-                },
-                verify,
-            )
+            run_codegen_tests($test.as_ref());
         }
     };
 }
 
 test_helpers::codegen_tests!();
 
+/// Generates the guest and host bindings of the shared test `test` with each
+/// set of options of `guest_opts` and `host_opts`, checking that they build.
+fn run_codegen_tests(test: &Path) {
+    for (suffix, opts) in guest_opts(test) {
+        codegen_test(&format!("guest-go{suffix}"), test, opts, verify);
+    }
+    for (suffix, opts) in host_opts() {
+        test_helpers::run_world_codegen_test(
+            &format!("host-go{suffix}"),
+            test,
+            |resolve, world, files| {
+                if !uses_resources(resolve) {
+                    generate(&opts, resolve, world, files);
+                }
+            },
+            verify_host,
+        );
+    }
+}
+
+/// Generates the bindings of the world of `wit` with `opts` into the directory
+/// of the test `name`, and checks them with `verify`.
+fn codegen_test(name: &str, wit: impl AsRef<Path>, opts: Opts, verify: fn(&Path, &str)) {
+    test_helpers::run_world_codegen_test(
+        name,
+        wit.as_ref(),
+        |resolve, world, files| generate(&opts, resolve, world, files),
+        verify,
+    );
+}
+
+fn generate(opts: &Opts, resolve: &Resolve, world: WorldId, files: &mut Files) {
+    let mut opts = opts.clone();
+    // `verify` moves the runtime package into the `option` package of the
+    // module named after the world
+    let name = resolve.worlds[world].name.to_snake_case();
+    opts.runtime_package = opts.runtime_package.map(|p| p.replace("{name}", &name));
+    opts.build().generate(resolve, world, files).unwrap()
+}
+
+/// The options the guest bindings of the shared tests are generated with,
+/// along with the suffix of the directory they're generated into.
+///
+/// The options which don't interact are combined into representative sets,
+/// so that each of them is covered without generating every test once per
+/// option.
+fn guest_opts(test: &Path) -> Vec<(&'static str, Opts)> {
+    let runtime_package = || Some("{name}/option".to_string());
+    let imports = imported_interfaces(test);
+    vec![
+        ("", Opts::default()),
+        (
+            "-result-values",
+            Opts {
+                result_as_error: false,
+                ..Default::default()
+            },
+        ),
+        (
+            "-runtime-package",
+            Opts {
+                runtime_package: runtime_package(),
+                shared_intrinsics: true,
+                shared_types: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-representations",
+            Opts {
+                sealed_variants: true,
+                variants_as_enums: true,
+                constructors: true,
+                sealed_records: true,
+                option_pointers: true,
+                tuples_as_arrays: true,
+                record_pointer_threshold: Some(16),
+                borrow_handles: true,
+                result_as_error: false,
+                unit_result_as_error: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-zero-copy",
+            Opts {
+                zero_copy_strings: true,
+                zero_copy_lists: true,
+                canonicalize_nans: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-utf16",
+            Opts {
+                string_encoding: StringEncoding::UTF16,
+                string_transcoder: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-compact-utf16",
+            Opts {
+                string_encoding: StringEncoding::CompactUTF16,
+                intern_strings: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-explicit-free",
+            Opts {
+                explicit_free: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-hooks",
+            Opts {
+                context: true,
+                cancellation: true,
+                trace: true,
+                metrics: true,
+                abi_errors: true,
+                lifecycle_hooks: true,
+                profiling: true,
+                export_panics: ExportPanics::Error,
+                ..Default::default()
+            },
+        ),
+        (
+            "-marshalers",
+            Opts {
+                json: true,
+                binary_marshaler: true,
+                introspect: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-testing",
+            Opts {
+                benchmarks: true,
+                fuzz: true,
+                self_test: true,
+                loopback: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-imports",
+            Opts {
+                swappable_imports: true,
+                optional_imports: imports.clone(),
+                partial_exports: true,
+                goroutine_safe: true,
+                ..Default::default()
+            },
+        ),
+        // the exports and the other imports are left out
+        (
+            "-only",
+            Opts {
+                only: imports.into_iter().take(1).collect(),
+                ..Default::default()
+            },
+        ),
+        (
+            "-component-type-object",
+            Opts {
+                component_type_object: true,
+                export_world_hash: true,
+                go_generate: Some("--out-dir . ../wit".to_string()),
+                ..Default::default()
+            },
+        ),
+        (
+            "-provenance",
+            Opts {
+                provenance: true,
+                wit_sources: wit_sources(test),
+                source_map: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-strings-as-bytes",
+            Opts {
+                strings_as_bytes: true,
+                abi_errors: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-native-stubs",
+            Opts {
+                native_stubs: true,
+                ..Default::default()
+            },
+        ),
+        (
+            "-opt-size",
+            Opts {
+                opt_size: true,
+                ..Default::default()
+            },
+        ),
+    ]
+}
+
+/// The options the host bindings of the shared tests are generated with, on
+/// top of `--host`, combined as in `guest_opts`. The tests using resources
+/// are skipped, as the host generator doesn't support them.
+fn host_opts() -> Vec<(&'static str, Opts)> {
+    let host = |opts: Opts| Opts { host: true, ..opts };
+    vec![
+        ("", host(Opts::default())),
+        (
+            "-features",
+            host(Opts {
+                swappable_imports: true,
+                self_test: true,
+                profiling: true,
+                ..Default::default()
+            }),
+        ),
+        (
+            "-wasmtime",
+            host(Opts {
+                host_runtime: HostRuntime::Wasmtime,
+                per_call_instances: true,
+                string_transcoder: true,
+                ..Default::default()
+            }),
+        ),
+    ]
+}
+
+/// Returns the names of the interfaces imported by the world of the shared
+/// test `test`, as the options naming interfaces spell them.
+fn imported_interfaces(test: &Path) -> Vec<String> {
+    let mut resolve = Resolve::default();
+    let (pkg, _) = resolve.push_path(test).unwrap();
+    // the world picked by `test_helpers::run_world_codegen_test`
+    let world = resolve
+        .select_world(pkg, None)
+        .or_else(|_| resolve.select_world(pkg, Some("imports")))
+        .unwrap();
+    resolve.worlds[world]
+        .imports
+        .iter()
+        .filter(|(_, item)| matches!(item, WorldItem::Interface { .. }))
+        .map(|(key, _)| resolve.name_world_key(key))
+        .collect()
+}
+
+// Futures and streams of arbitrary payloads aren't supported yet, so the
+// shared tests are skipped above and only primitive payloads are covered here.
+#[test]
+fn primitive_futures_and_streams() {
+    codegen_test(
+        "guest-go",
+        "tests/wit/primitive-futures-and-streams.wit",
+        Opts::default(),
+        verify,
+    );
+    // the records holding futures and streams are lifted inline, since the
+    // intrinsics they use are those of their function
+    codegen_test(
+        "guest-go-opt-size",
+        "tests/wit/primitive-futures-and-streams.wit",
+        Opts {
+            opt_size: true,
+            ..Default::default()
+        },
+        verify,
+    );
+}
+
+// The intrinsics of futures and streams are imported per function, so an
+// import and an export sharing a payload each get their own.
+#[test]
+fn shared_stream() {
+    codegen_test(
+        "guest-go",
+        "tests/wit/shared-stream.wit",
+        Opts::default(),
+        verify_shared_stream,
+    );
+}
+
+fn verify_shared_stream(dir: &Path, name: &str) {
+    let src = std::fs::read_to_string(dir.join(format!("{}.go", name.to_snake_case()))).unwrap();
+    for expected in [
+        "//go:wasmimport [import-payload]foo:foo/sink [stream-new-0]consume",
+        "//go:wasmimport [export-payload]foo:foo/source [stream-new-0]produce",
+        "func NewFooFooSinkConsumeStream0()",
+        "func NewExportsFooFooSourceProduceStream0()",
+    ] {
+        assert!(src.contains(expected), "missing `{expected}`");
+    }
+    verify(dir, name);
+}
+
+#[test]
+fn wasi_adapter() {
+    codegen_test(
+        "guest-go-wasi-adapter",
+        "tests/wit/wasi-adapter.wit",
+        Opts {
+            wasi_adapter: true,
+            context: true,
+            ..Default::default()
+        },
+        verify,
+    );
+}
+
+// Sockets aren't adapted, which fails the generation rather than leaving them
+// to the regular bindings.
+#[test]
+fn wasi_adapter_sockets() {
+    let mut resolve = Resolve::default();
+    let pkg = resolve
+        .push_group(
+            UnresolvedPackageGroup::parse(
+                "input.wit",
+                r#"
+                package test:wasi-sockets;
+
+                world the-wasi-sockets {
+                    import wasi:sockets/instance-network@0.2.0;
+                }
+
+                package wasi:sockets@0.2.0 {
+                    interface network {
+                        resource network;
+                    }
+
+                    interface instance-network {
+                        use network.{network};
+
+                        instance-network: func() -> network;
+                    }
+                }
+                "#,
+            )
+            .unwrap(),
+        )
+        .unwrap();
+    let world = resolve.select_world(pkg, None).unwrap();
+    let mut files = Files::default();
+    let err = Opts {
+        wasi_adapter: true,
+        ..Default::default()
+    }
+    .build()
+    .generate(&resolve, world, &mut files)
+    .unwrap_err();
+    assert_eq!(
+        err.to_string(),
+        "`--wasi-adapter` doesn't support `wasi:sockets`, imported as \
+        `wasi:sockets/network`, which it can't adapt to the `net` package"
+    );
+    assert_eq!(files.iter().count(), 0);
+}
+
+#[test]
+fn slog_handler() {
+    codegen_test(
+        "guest-go-slog-handler",
+        "tests/wit/wasi-logging.wit",
+        Opts {
+            slog_handler: true,
+            ..Default::default()
+        },
+        verify,
+    );
+}
+
+#[test]
+fn export_state() {
+    codegen_test(
+        "guest-go-export-state",
+        "tests/wit/export-state.wit",
+        Opts {
+            export_state: true,
+            ..Default::default()
+        },
+        verify,
+    );
+}
+
+#[test]
+fn call_batching() {
+    codegen_test(
+        "guest-go-call-batching",
+        "tests/wit/call-batching.wit",
+        Opts {
+            call_batching: true,
+            ..Default::default()
+        },
+        verify,
+    );
+}
+
+// Worlds made of other worlds are flattened by the parser, interfaces pulled
+// in by several of them included once.
+#[test]
+fn world_include() {
+    codegen_test(
+        "guest-go",
+        "tests/wit/world-include/wit",
+        Opts::default(),
+        verify,
+    );
+    codegen_test(
+        "host-go",
+        "tests/wit/world-include/wit",
+        Opts {
+            host: true,
+            ..Default::default()
+        },
+        verify_host,
+    );
+}
+
+// Variant and enum cases are renamed like any other identifier, including in
+// the glue lifting and lowering them.
+#[test]
+fn rename_cases() {
+    let opts = |host| Opts {
+        host,
+        rename: vec![
+            ("none".to_string(), "NoShape".to_string()),
+            ("red".to_string(), "Crimson".to_string()),
+        ],
+        ..Default::default()
+    };
+    codegen_test(
+        "guest-go-rename-cases",
+        "tests/wit/rename-cases.wit",
+        opts(false),
+        |dir, name| {
+            verify_rename_cases(dir, name);
+            verify(dir, name);
+        },
+    );
+    codegen_test(
+        "host-go-rename-cases",
+        "tests/wit/rename-cases.wit",
+        opts(true),
+        |dir, name| {
+            verify_rename_cases(dir, name);
+            verify_host(dir, name);
+        },
+    );
+}
+
+fn verify_rename_cases(dir: &Path, name: &str) {
+    let src = std::fs::read_to_string(dir.join(format!("{}.go", name.to_snake_case()))).unwrap();
+    for renamed in ["ShapeKindNoShape", "ToneCrimson()"] {
+        assert!(src.contains(renamed), "missing `{renamed}`");
+    }
+    for original in ["ShapeKindNone", "ToneRed"] {
+        assert!(!src.contains(original), "`{original}` isn't renamed");
+    }
+}
+
+#[test]
+fn predeclared() {
+    codegen_test(
+        "guest-go-predeclared",
+        "tests/wit/predeclared.wit",
+        Opts::default(),
+        |dir, name| {
+            verify_predeclared(dir, name);
+            verify(dir, name);
+        },
+    );
+    codegen_test(
+        "host-go-predeclared",
+        "tests/wit/predeclared.wit",
+        Opts {
+            host: true,
+            ..Default::default()
+        },
+        |dir, name| {
+            verify_predeclared(dir, name);
+            verify_host(dir, name);
+        },
+    );
+}
+
+fn verify_predeclared(dir: &Path, name: &str) {
+    let src = std::fs::read_to_string(dir.join(format!("{}.go", name.to_snake_case()))).unwrap();
+    for param in [
+        "_len string",
+        "_utf8 string",
+        "_unsafe uint32",
+        "_wazero string",
+    ] {
+        assert!(src.contains(param), "missing escaped parameter `{param}`");
+    }
+}
+
+#[test]
+fn core_names() {
+    codegen_test(
+        "guest-go-core-names-prefixed",
+        "tests/wit/core-names.wit",
+        Opts {
+            core_import_prefix: Some("legacy:".to_string()),
+            core_export_prefix: Some("plugin_".to_string()),
+            core_unversioned: true,
+            ..Default::default()
+        },
+        |dir, name| {
+            verify_core_names(
+                dir,
+                name,
+                &[
+                    "//go:wasmimport legacy:foo:names/store [resource-drop]entry",
+                    "__import_module__(\"legacy:foo:names/store\"), __import_name__(\"open\")",
+                    "__import_module__(\"legacy:$root\"), __import_name__(\"log\")",
+                    "__export_name__(\"plugin_foo:names/handler#handle\")",
+                    "__export_name__(\"cabi_post_plugin_foo:names/handler#handle\")",
+                ],
+            );
+            verify(dir, name);
+        },
+    );
+    codegen_test(
+        "guest-go-core-names-single-module",
+        "tests/wit/core-names.wit",
+        Opts {
+            core_import_module: Some("env".to_string()),
+            ..Default::default()
+        },
+        |dir, name| {
+            verify_core_names(
+                dir,
+                name,
+                &[
+                    "//go:wasmimport env foo:names/store@0.1.0#[resource-drop]entry",
+                    "__import_module__(\"env\"), __import_name__(\"foo:names/store@0.1.0#open\")",
+                    "__import_module__(\"env\"), __import_name__(\"log\")",
+                    "__export_name__(\"foo:names/handler@0.1.0#handle\")",
+                ],
+            );
+            verify(dir, name);
+        },
+    );
+}
+
+fn verify_core_names(dir: &Path, name: &str, expected: &[&str]) {
+    let snake = name.to_snake_case();
+    let go = std::fs::read_to_string(dir.join(format!("{snake}.go"))).unwrap();
+    let c = std::fs::read_to_string(dir.join(format!("{snake}.c"))).unwrap();
+    for name in expected {
+        assert!(
+            go.contains(name) || c.contains(name),
+            "missing core wasm name `{name}`"
+        );
+    }
+}
+
+// The host bindings don't support resources yet, which is reported as an
+// error up front rather than halfway through the generation.
+#[test]
+fn host_resources() {
+    let mut resolve = Resolve::default();
+    let pkg = resolve
+        .push_group(
+            UnresolvedPackageGroup::parse(
+                "input.wit",
+                r#"
+                package foo:foo;
+
+                interface blobs {
+                    resource blob {
+                        read: func() -> list<u8>;
+                    }
+                }
+
+                world the-host-resources {
+                    import blobs;
+                }
+                "#,
+            )
+            .unwrap(),
+        )
+        .unwrap();
+    let world = resolve.select_world(pkg, None).unwrap();
+    let mut files = Files::default();
+    let err = Opts {
+        host: true,
+        ..Default::default()
+    }
+    .build()
+    .generate(&resolve, world, &mut files)
+    .unwrap_err();
+    assert_eq!(
+        err.to_string(),
+        "resources are not yet supported by the Go host generator, found `blob` in `blobs`"
+    );
+    assert_eq!(files.iter().count(), 0);
+}
+
+// The options which don't work together are reported as an error, and no
+// bindings are generated.
+#[test]
+fn unsupported_options() {
+    let mut resolve = Resolve::default();
+    let pkg = resolve.push_path("tests/wit/rename-cases.wit").unwrap().0;
+    let world = resolve.select_world(pkg, None).unwrap();
+    let mut files = Files::default();
+    let err = Opts {
+        source_map: true,
+        ..Default::default()
+    }
+    .build()
+    .generate(&resolve, world, &mut files)
+    .unwrap_err();
+    assert_eq!(err.to_string(), "`--source-map` requires `--provenance`");
+    assert_eq!(files.iter().count(), 0);
+}
+
+#[test]
+fn host_multi_memory() {
+    codegen_test(
+        "host-go-multi-memory",
+        "tests/wit/multi-memory.wit",
+        Opts {
+            host: true,
+            memory: vec![(
+                "foo:scratch/plugin".to_string(),
+                "scratch".to_string(),
+                "scratch_realloc".to_string(),
+            )],
+            ..Default::default()
+        },
+        verify_host,
+    );
+}
+
+#[test]
+fn scaffold() {
+    codegen_test(
+        "guest-go-scaffold",
+        "tests/wit/scalars.wit",
+        Opts {
+            scaffold: true,
+            go_package: Some("bindings".to_string()),
+            go_module: Some("example.com/scalars".to_string()),
+            interface_aliases: true,
+            mocks: true,
+            ..Default::default()
+        },
+        verify_scaffold,
+    );
+}
+
+// The strings and lists lifted by copying them into the Go heap, whether
+// returned by imports or passed to exports, release their linear memory.
+#[test]
+fn lifted_values() {
+    codegen_test(
+        "guest-go",
+        "tests/wit/lifted-values.wit",
+        Opts::default(),
+        verify_lifted_values,
+    );
+}
+
+fn verify_lifted_values(dir: &Path, name: &str) {
+    let src = std::fs::read_to_string(dir.join(format!("{}.go", name.to_snake_case()))).unwrap();
+    let lines = src.lines().collect::<Vec<_>>();
+    let mut copies = 0;
+    for (i, line) in lines.iter().enumerate() {
+        let copied = line.contains("C.GoStringN(")
+            || (line.contains("copy(") && line.contains(", unsafe.Slice("));
+        if !copied {
+            continue;
+        }
+        copies += 1;
+        let freed = lines[i + 1..]
+            .iter()
+            .take(3)
+            .any(|line| line.contains("cabiFree(unsafe.Pointer("));
+        assert!(freed, "the memory copied by `{}` isn't freed", line.trim());
+    }
+    // the results of both imports and the parameters of both exports
+    assert!(copies >= 4, "only {copies} copies of lifted values");
+    verify(dir, name);
+}
+
+// The strings lifted with `--abi-errors` are checked to be valid UTF-8, unless
+// `--skip-utf8-validation` trusts the other side to only send valid ones, which
+// still leaves the other checks in place.
+#[test]
+fn skip_utf8_validation() {
+    codegen_test(
+        "guest-go-abi-errors",
+        "tests/wit/lifted-values.wit",
+        Opts {
+            abi_errors: true,
+            ..Default::default()
+        },
+        |dir, name| verify_utf8_validation(dir, name, true),
+    );
+    codegen_test(
+        "guest-go-skip-utf8-validation",
+        "tests/wit/lifted-values.wit",
+        Opts {
+            abi_errors: true,
+            skip_utf8_validation: true,
+            ..Default::default()
+        },
+        |dir, name| verify_utf8_validation(dir, name, false),
+    );
+}
+
+fn verify_utf8_validation(dir: &Path, name: &str, validated: bool) {
+    let src = std::fs::read_to_string(dir.join(format!("{}.go", name.to_snake_case()))).unwrap();
+    for check in ["utf8.ValidString(", "\"invalid UTF-8 string\""] {
+        assert_eq!(src.contains(check), validated, "`{check}` in {name}");
+    }
+    assert!(
+        src.contains("\"null pointer\""),
+        "missing the null pointer check"
+    );
+    verify(dir, name);
+}
+
+// The generated declarations are positioned at their WIT definitions by
+// `//line` directives, followed by directives restoring the positions of the
+// Go file.
+#[test]
+fn line_directives() {
+    codegen_test(
+        "guest-go-line-directives",
+        "tests/wit/scalars.wit",
+        Opts {
+            provenance: true,
+            wit_sources: wit_sources("tests/wit/scalars.wit".as_ref()),
+            ..Default::default()
+        },
+        verify_line_directives,
+    );
+}
+
+fn verify_line_directives(dir: &Path, name: &str) {
+    let file = format!("{}.go", name.to_snake_case());
+    let src = std::fs::read_to_string(dir.join(&file)).unwrap();
+    let lines = src.lines().collect::<Vec<_>>();
+    let wit = Path::new("tests/wit/scalars.wit").canonicalize().unwrap();
+    for (line, decl) in [
+        (6, "func FooFooNumbersAdd("),
+        (17, "type FooFooStatsTotals struct {"),
+        (26, "func TheScalarsLog("),
+    ] {
+        let directive = format!("//line {}:{line}", wit.display());
+        let i = lines
+            .iter()
+            .position(|l| *l == directive)
+            .unwrap_or_else(|| panic!("missing `{directive}`"));
+        assert!(
+            lines[i + 1].starts_with(decl),
+            "`{directive}` precedes {}",
+            lines[i + 1]
+        );
+    }
+    for (i, line) in lines.iter().enumerate() {
+        if let Some(next) = line.strip_prefix(&format!("//line {file}:")) {
+            assert_eq!(
+                next.parse::<usize>().unwrap(),
+                i + 2,
+                "`{line}` at line {}",
+                i + 1
+            );
+        }
+    }
+    verify(dir, name);
+}
+
+/// Returns the WIT files of `test`, which the command line passes on with
+/// `--provenance`.
+fn wit_sources(test: &Path) -> Vec<PathBuf> {
+    let (_, sources) = Resolve::default().push_path(test).unwrap();
+    sources.paths().map(|p| p.canonicalize().unwrap()).collect()
+}
+
 fn verify(dir: &Path, name: &str) {
     let name = name.to_snake_case();
     let main = dir.join(format!("{name}.go"));
@@ -96,3 +884,61 @@ fn verify(dir: &Path, name: &str) {
     cmd.current_dir(dir);
     test_helpers::run_command(&mut cmd);
 }
+
+// The scaffolding is a complete module, so it is built as is.
+fn verify_scaffold(dir: &Path, _name: &str) {
+    let mut cmd = Command::new("tinygo");
+    cmd.arg("build");
+    cmd.arg("-target=wasi");
+    cmd.arg("-o");
+    cmd.arg("go.wasm");
+    cmd.arg(".");
+    cmd.current_dir(dir);
+    test_helpers::run_command(&mut cmd);
+}
+
+// TODO: remove once the host generator supports resources.
+fn uses_resources(resolve: &Resolve) -> bool {
+    resolve
+        .types
+        .iter()
+        .any(|(_, ty)| matches!(ty.kind, TypeDefKind::Resource | TypeDefKind::Handle(_)))
+}
+
+fn verify_host(dir: &Path, name: &str) {
+    let name = name.to_snake_case();
+    let Ok(src) = std::fs::read_to_string(dir.join(format!("{name}.go"))) else {
+        return;
+    };
+    let (module, version) = if src.contains("github.com/bytecodealliance/wasmtime-go") {
+        ("github.com/bytecodealliance/wasmtime-go/v25", "v25.0.0")
+    } else {
+        ("github.com/tetratelabs/wazero", "v1.8.2")
+    };
+
+    let mod_file = dir.join("go.mod");
+    let mut file = std::fs::File::create(mod_file).expect("Failed to create file go.mod");
+    file.write_all(format!("module {name}\n\ngo 1.21\n\nrequire {module} {version}\n").as_bytes())
+        .expect("Failed to write to file");
+
+    // The runtime is only looked up in the module cache, which already
+    // verified it, so that the tests don't need the network. `go.sum` is
+    // then filled in from the cache.
+    let go = |args: &[&str]| {
+        let mut cmd = Command::new("go");
+        cmd.args(args)
+            .env("GOPROXY", "off")
+            .env("GOSUMDB", "off")
+            .env("GOFLAGS", "-mod=mod")
+            .current_dir(dir);
+        cmd
+    };
+    let cached = go(&["mod", "download", &format!("{module}@{version}")])
+        .output()
+        .is_ok_and(|output| output.status.success());
+    if !cached {
+        eprintln!("skipping `go vet` of {name}: {module}@{version} isn't in the Go module cache");
+        return;
+    }
+    test_helpers::run_command(&mut go(&["vet", "./..."]));
+}
@@ -59,7 +59,7 @@ stderr ---
 pub fn run_world_codegen_test(
     gen_name: &str,
     wit_path: &Path,
-    generate: fn(&Resolve, WorldId, &mut Files),
+    generate: impl Fn(&Resolve, WorldId, &mut Files),
     verify: fn(&Path, &str),
 ) {
     let (resolve, world) = parse_wit(wit_path);
@@ -98,14 +98,31 @@ struct Common {
     /// This option can also use the fully qualified syntax such as
     /// `wasi:http/proxy` to select a world from a dependency of the main WIT
     /// package.
+    ///
+    /// This option can be passed multiple times to generate bindings for
+    /// several worlds at once, such as a component implementing both a plugin
+    /// API and a logging API. The worlds are merged into the first one, so
+    /// that the interfaces and types they share are only generated once.
     #[clap(short, long)]
-    world: Option<String>,
+    world: Vec<String>,
 
     /// Indicates that no files are written and instead files are checked if
     /// they're up-to-date with the source files.
+    ///
+    /// Every stale or missing file is reported along with its first
+    /// differing line, and the command fails if there are any, for use in
+    /// pre-merge checks and Makefiles.
     #[clap(long)]
     check: bool,
 
+    /// Leave the generated files whose contents didn't change untouched,
+    /// rather than writing them again.
+    ///
+    /// Their modification times are then preserved, so that they don't
+    /// invalidate the caches of the builds depending on them.
+    #[clap(long)]
+    skip_unchanged: bool,
+
     /// Comma-separated list of features that should be enabled when processing
     /// WIT files.
     ///
@@ -134,43 +151,59 @@ fn main() -> Result<()> {
         #[cfg(feature = "teavm-java")]
         Opt::TeavmJava { opts, args } => (opts.build(), args),
         #[cfg(feature = "go")]
-        Opt::TinyGo { opts, args } => (opts.build(), args),
+        Opt::TinyGo { mut opts, args } => {
+            if opts.provenance {
+                opts.wit_sources = wit_sources(&args.wit)?;
+            }
+            (opts.build(), args)
+        }
         #[cfg(feature = "csharp")]
         Opt::CSharp { opts, args } => (opts.build(), args),
     };
 
     gen_world(generator, &opt, &mut files).map_err(attach_with_context)?;
+    write_files(&files, &opt)
+}
 
+/// Writes the generated `files`, or checks them with `--check`.
+fn write_files(files: &Files, opt: &Common) -> Result<()> {
+    let mut stale = Vec::new();
     for (name, contents) in files.iter() {
         let dst = match &opt.out_dir {
             Some(path) => path.join(name),
             None => name.into(),
         };
-        eprintln!("Generating {:?}", dst);
+
+        // skeletons are edited by hand once generated, so they're neither
+        // overwritten nor checked
+        if files.is_skeleton(name) && (opt.check || dst.exists()) {
+            eprintln!("Skipping {:?}", dst);
+            continue;
+        }
 
         if opt.check {
-            let prev = std::fs::read(&dst).with_context(|| format!("failed to read {:?}", dst))?;
-            if prev != contents {
-                // The contents differ. If it looks like textual contents, do a
-                // line-by-line comparison so that we can tell users what the
-                // problem is directly.
-                if let (Ok(utf8_prev), Ok(utf8_contents)) =
-                    (str::from_utf8(&prev), str::from_utf8(contents))
-                {
-                    if !utf8_prev
-                        .chars()
-                        .any(|c| c.is_control() && !matches!(c, '\n' | '\r' | '\t'))
-                        && utf8_prev.lines().eq(utf8_contents.lines())
-                    {
-                        bail!("{} differs only in line endings (CRLF vs. LF). If this is a text file, configure git to mark the file as `text eol=lf`.", dst.display());
-                    }
+            eprintln!("Checking {:?}", dst);
+            // every stale file is reported before failing, so that they can
+            // all be fixed at once
+            match std::fs::read(&dst) {
+                Ok(prev) if prev == contents => {}
+                Ok(prev) => {
+                    eprintln!("not up to date: {}", dst.display());
+                    explain_difference(&prev, contents);
+                    stale.push(dst);
                 }
-                // The contents are binary or there are other differences; just
-                // issue a generic error.
-                bail!("not up to date: {}", dst.display());
+                Err(e) if e.kind() == std::io::ErrorKind::NotFound => {
+                    eprintln!("missing: {}", dst.display());
+                    stale.push(dst);
+                }
+                Err(e) => return Err(e).with_context(|| format!("failed to read {:?}", dst)),
             }
             continue;
         }
+        if opt.skip_unchanged && std::fs::read(&dst).is_ok_and(|prev| prev == contents) {
+            continue;
+        }
+        eprintln!("Generating {:?}", dst);
 
         if let Some(parent) = dst.parent() {
             std::fs::create_dir_all(parent)
@@ -178,10 +211,47 @@ fn main() -> Result<()> {
         }
         std::fs::write(&dst, contents).with_context(|| format!("failed to write {:?}", dst))?;
     }
+    if !stale.is_empty() {
+        bail!(
+            "{} generated file(s) not up to date, regenerate them without `--check`",
+            stale.len()
+        );
+    }
 
     Ok(())
 }
 
+/// Reports how the file on disk `prev` differs from the generated `contents`.
+fn explain_difference(prev: &[u8], contents: &[u8]) {
+    // The contents are binary, so there's nothing more to tell.
+    let (Ok(prev), Ok(contents)) = (str::from_utf8(prev), str::from_utf8(contents)) else {
+        return;
+    };
+    if !prev
+        .chars()
+        .any(|c| c.is_control() && !matches!(c, '\n' | '\r' | '\t'))
+        && prev.lines().eq(contents.lines())
+    {
+        eprintln!("  it differs only in line endings (CRLF vs. LF). If this is a text file, configure git to mark the file as `text eol=lf`.");
+        return;
+    }
+    // point at the first differing line, as a hint of what changed
+    let mut prev_lines = prev.lines();
+    let mut lines = contents.lines();
+    for n in 1.. {
+        match (prev_lines.next(), lines.next()) {
+            (Some(a), Some(b)) if a == b => continue,
+            (None, None) => break,
+            (a, b) => {
+                eprintln!("  first difference at line {n}:");
+                eprintln!("  - {}", a.unwrap_or("<end of file>"));
+                eprintln!("  + {}", b.unwrap_or("<end of file>"));
+                break;
+            }
+        }
+    }
+}
+
 fn attach_with_context(err: Error) -> Error {
     #[cfg(feature = "rust")]
     if let Some(e) = err.downcast_ref::<wit_bindgen_rust::MissingWith>() {
@@ -193,6 +263,20 @@ fn attach_with_context(err: Error) -> Error {
     err
 }
 
+/// Returns the absolute paths of the WIT files `wit` is parsed from, for the
+/// generators pointing the generated code at its WIT definitions.
+#[cfg(feature = "go")]
+fn wit_sources(wit: &std::path::Path) -> Result<Vec<PathBuf>> {
+    let (_, sources) = Resolve::default().push_path(wit)?;
+    sources
+        .paths()
+        .map(|path| {
+            path.canonicalize()
+                .with_context(|| format!("failed to resolve `{}`", path.display()))
+        })
+        .collect()
+}
+
 fn gen_world(
     mut generator: Box<dyn WorldGenerator>,
     opts: &Common,
@@ -210,7 +294,20 @@ fn gen_world(
         }
     }
     let (pkg, _files) = resolve.push_path(&opts.wit)?;
-    let world = resolve.select_world(pkg, opts.world.as_deref())?;
+    let (first, rest) = match opts.world.split_first() {
+        Some((first, rest)) => (Some(first.as_str()), rest),
+        None => (None, &[][..]),
+    };
+    let world = resolve.select_world(pkg, first)?;
+    for name in rest {
+        let other = resolve.select_world(pkg, Some(name))?;
+        if other == world {
+            continue;
+        }
+        resolve
+            .merge_worlds(other, world)
+            .with_context(|| format!("failed to merge world `{name}` into the other worlds"))?;
+    }
     generator.generate(&resolve, world, files)?;
 
     Ok(())
@@ -221,3 +318,120 @@ fn verify_cli() {
     use clap::CommandFactory;
     Opt::command().debug_assert()
 }
+
+/// Creates a directory for the test `name` which no other test, or run of
+/// the tests, shares.
+#[cfg(test)]
+fn test_dir(name: &str) -> Result<PathBuf> {
+    use std::sync::atomic::{AtomicUsize, Ordering};
+
+    static NEXT: AtomicUsize = AtomicUsize::new(0);
+    let dir = std::env::temp_dir().join(format!(
+        "wit-bindgen-{name}-{}-{}",
+        std::process::id(),
+        NEXT.fetch_add(1, Ordering::Relaxed)
+    ));
+    std::fs::create_dir_all(&dir)?;
+    Ok(dir)
+}
+
+// Worlds passed with several `--world` share the interfaces they both use,
+// whose types are only generated once.
+#[cfg(feature = "go")]
+#[test]
+fn merged_worlds() -> Result<()> {
+    let dir = test_dir("merged-worlds")?;
+    let wit = dir.join("worlds.wit");
+    std::fs::write(
+        &wit,
+        r#"
+        package foo:foo;
+
+        interface types {
+            record entry {
+                key: string,
+                value: u32,
+            }
+        }
+
+        interface plugin {
+            use types.{entry};
+
+            handle: func(e: entry) -> entry;
+        }
+
+        interface logging {
+            use types.{entry};
+
+            log: func(e: entry);
+        }
+
+        world plugin-api {
+            import plugin;
+        }
+
+        world logging-api {
+            import logging;
+        }
+        "#,
+    )?;
+    let opts = Common::parse_from([
+        "wit-bindgen",
+        wit.to_str().unwrap(),
+        "--world",
+        "plugin-api",
+        "--world",
+        "logging-api",
+    ]);
+    let mut files = Files::default();
+    gen_world(wit_bindgen_go::Opts::default().build(), &opts, &mut files)?;
+    std::fs::remove_dir_all(&dir)?;
+
+    let mut src = String::new();
+    for (name, contents) in files.iter() {
+        if name.ends_with(".go") {
+            src.push_str(str::from_utf8(contents)?);
+        }
+    }
+    assert_eq!(src.matches("type FooFooTypesEntry struct").count(), 1);
+    assert!(src.contains("func FooFooPluginHandle("));
+    assert!(src.contains("func FooFooLoggingLog("));
+    Ok(())
+}
+
+// With `--skip-unchanged`, the files are only written if their contents
+// changed, keeping their modification times otherwise.
+#[test]
+fn skip_unchanged() -> Result<()> {
+    use std::time::{Duration, SystemTime};
+
+    let dir = test_dir("skip-unchanged")?;
+    let opts = Common::parse_from([
+        "wit-bindgen",
+        "world.wit",
+        "--out-dir",
+        dir.to_str().unwrap(),
+        "--skip-unchanged",
+    ]);
+    let mut files = Files::default();
+    files.push("unchanged.txt", b"unchanged");
+    files.push("changed.txt", b"changed");
+    std::fs::write(dir.join("unchanged.txt"), "unchanged")?;
+    std::fs::write(dir.join("changed.txt"), "previous")?;
+    let past = SystemTime::now() - Duration::from_secs(3600);
+    for name in ["unchanged.txt", "changed.txt"] {
+        std::fs::File::options()
+            .write(true)
+            .open(dir.join(name))?
+            .set_modified(past)?;
+    }
+
+    write_files(&files, &opts)?;
+
+    let modified = |name: &str| std::fs::metadata(dir.join(name))?.modified();
+    assert_eq!(modified("unchanged.txt")?, past);
+    assert_ne!(modified("changed.txt")?, past);
+    assert_eq!(std::fs::read_to_string(dir.join("changed.txt"))?, "changed");
+    std::fs::remove_dir_all(&dir)?;
+    Ok(())
+}
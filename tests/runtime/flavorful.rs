@@ -107,7 +107,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: Flavorful, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &Flavorful, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     exports.call_test_imports(&mut *store)?;
     let exports = exports.test_flavorful_test();
 
@@ -83,6 +83,15 @@ func (f FlavorfulImpl) TestImports() {
 	if v3[1].Kind() != TestFlavorfulTestMyErrnoKindB {
 		panic("TestFlavorfulTestListOfVariants")
 	}
+	if v3[1].String() != "b" || !v3[1].IsValid() {
+		panic("TestFlavorfulTestMyErrno.String")
+	}
+	if e, err := ParseTestFlavorfulTestMyErrno("a"); err != nil || e != TestFlavorfulTestMyErrnoA() {
+		panic("ParseTestFlavorfulTestMyErrno")
+	}
+	if _, err := ParseTestFlavorfulTestMyErrno("c"); err == nil {
+		panic("ParseTestFlavorfulTestMyErrno")
+	}
 
 }
 
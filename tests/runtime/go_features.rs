@@ -0,0 +1,49 @@
+use anyhow::Result;
+use wasmtime::Store;
+
+wasmtime::component::bindgen!(in "tests/runtime/go_features");
+
+#[derive(Default)]
+pub struct MyImports {
+    logged: Vec<u32>,
+    batches: Vec<Vec<u32>>,
+}
+
+impl test::go_features::values::Host for MyImports {
+    fn log(&mut self, value: u32) {
+        self.logged.push(value);
+    }
+
+    fn log_batch(&mut self, values: Vec<u32>) {
+        self.batches.push(values);
+    }
+}
+
+#[test]
+fn run() -> Result<()> {
+    crate::run_test(
+        "go_features",
+        |linker| GoFeatures::add_to_linker(linker, |x| &mut x.0),
+        |store, component, linker| GoFeatures::instantiate(store, component, linker),
+        run_test,
+    )
+}
+
+fn run_test(exports: &GoFeatures, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+    exports.call_test_values(&mut *store)?;
+
+    exports.call_test_batching(&mut *store, 10)?;
+    let imports = &mut store.data_mut().0;
+    assert!(imports.logged.is_empty());
+    assert_eq!(
+        std::mem::take(&mut imports.batches),
+        [vec![0, 1, 2, 3], vec![4, 5, 6, 7], vec![8, 9]]
+    );
+
+    assert_eq!(
+        exports.call_fail(&mut *store, "boom")?,
+        Err("`fail` panicked: boom".to_string())
+    );
+
+    Ok(())
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "wit_go_features_go/gen"
+)
+
+func init() {
+	SetGoFeatures(&GoFeaturesImpl{})
+}
+
+type GoFeaturesImpl struct{}
+
+func (i *GoFeaturesImpl) TestValues() {
+	label := TestGoFeaturesValuesLabel{
+		Name:  "origin",
+		Tags:  []string{"a", "b"},
+		Size:  Some[uint32](3),
+		Shape: TestGoFeaturesValuesShapeCircle(1.5),
+	}
+
+	// Equal compares the slices and the payloads of the variants
+	other := label
+	other.Tags = []string{"a", "b"}
+	if !label.Equal(other) {
+		panic("Equal")
+	}
+	other.Tags = []string{"a", "c"}
+	if label.Equal(other) {
+		panic("Equal")
+	}
+	other = label
+	other.Shape = TestGoFeaturesValuesShapeCircle(2)
+	if label.Equal(other) {
+		panic("Equal")
+	}
+	other.Shape = TestGoFeaturesValuesShapeEmpty()
+	if label.Equal(other) {
+		panic("Equal")
+	}
+	other.Size = None[uint32]()
+	if label.Equal(other) {
+		panic("Equal")
+	}
+
+	data, err := json.Marshal(label)
+	if err != nil {
+		panic(err)
+	}
+	want := `{"name":"origin","tags":["a","b"],"size":3,"shape":{"kind":"circle","value":1.5}}`
+	if string(data) != want {
+		panic("MarshalJSON: " + string(data))
+	}
+	var decoded TestGoFeaturesValuesLabel
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		panic(err)
+	}
+	if !decoded.Equal(label) {
+		panic("UnmarshalJSON: " + string(data))
+	}
+
+	data, err = json.Marshal(TestGoFeaturesValuesLabel{Tags: []string{}, Shape: TestGoFeaturesValuesShapeEmpty()})
+	if err != nil {
+		panic(err)
+	}
+	want = `{"name":"","tags":[],"size":null,"shape":{"kind":"empty"}}`
+	if string(data) != want {
+		panic("MarshalJSON: " + string(data))
+	}
+	decoded = TestGoFeaturesValuesLabel{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		panic(err)
+	}
+	if decoded.Size.IsSome() || decoded.Shape.Kind() != TestGoFeaturesValuesShapeKindEmpty {
+		panic("UnmarshalJSON: " + string(data))
+	}
+
+	data, err = json.Marshal(TestGoFeaturesValuesColorGreen())
+	if err != nil || string(data) != `"green"` {
+		panic("MarshalJSON: " + string(data))
+	}
+	var color TestGoFeaturesValuesColor
+	if err := json.Unmarshal([]byte(`"blue"`), &color); err != nil || color != TestGoFeaturesValuesColorBlue() {
+		panic("UnmarshalJSON")
+	}
+	if json.Unmarshal([]byte(`"purple"`), &color) == nil {
+		panic("UnmarshalJSON")
+	}
+
+	// the canonical ABI layout: `x` and `y`, `color` padded to 4 bytes, then
+	// the discriminant of `shape` and its payload
+	pixel := TestGoFeaturesValuesPixel{
+		X:     1,
+		Y:     2,
+		Color: TestGoFeaturesValuesColorBlue(),
+		Shape: TestGoFeaturesValuesShapeSquare(7),
+	}
+	data, err = pixel.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	if !bytes.Equal(data, []byte{1, 0, 2, 0, 2, 0, 0, 0, 1, 0, 0, 0, 7, 0, 0, 0}) {
+		panic("MarshalBinary")
+	}
+	var decodedPixel TestGoFeaturesValuesPixel
+	if err := decodedPixel.UnmarshalBinary(data); err != nil {
+		panic(err)
+	}
+	if !decodedPixel.Equal(pixel) {
+		panic("UnmarshalBinary")
+	}
+	if decodedPixel.UnmarshalBinary(data[:4]) == nil {
+		panic("UnmarshalBinary")
+	}
+}
+
+func (i *GoFeaturesImpl) TestBatching(count uint32) {
+	batcher := NewTestGoFeaturesValuesLogBatcher(4)
+	for v := uint32(0); v < count; v++ {
+		batcher.Add(v)
+	}
+	batcher.Flush()
+	// flushing an empty batcher doesn't call the import
+	batcher.Flush()
+}
+
+func (i *GoFeaturesImpl) Fail(message string) Result[uint32, string] {
+	panic(message)
+}
+
+func main() {}
@@ -116,7 +116,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(lists: Lists, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(lists: &Lists, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     let bytes = lists.call_allocated_bytes(&mut *store)?;
     lists.call_test_imports(&mut *store)?;
     let exports = lists.test_lists_test();
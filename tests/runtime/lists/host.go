@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+
+	. "wit_lists_host/gen"
+)
+
+type MyImports struct{}
+
+func (*MyImports) EmptyListParam(ctx context.Context, a []uint8) {
+	assertEq(len(a), 0)
+}
+
+func (*MyImports) EmptyStringParam(ctx context.Context, a string) {
+	assertEq(a, "")
+}
+
+func (*MyImports) EmptyListResult(ctx context.Context) []uint8 {
+	return []uint8{}
+}
+
+func (*MyImports) EmptyStringResult(ctx context.Context) string {
+	return ""
+}
+
+func (*MyImports) ListParam(ctx context.Context, a []uint8) {
+	assertEq(slices.Equal(a, []uint8{1, 2, 3, 4}), true)
+}
+
+func (*MyImports) ListParam2(ctx context.Context, a string) {
+	assertEq(a, "foo")
+}
+
+func (*MyImports) ListParam3(ctx context.Context, a []string) {
+	assertEq(slices.Equal(a, []string{"foo", "bar", "baz"}), true)
+}
+
+func (*MyImports) ListParam4(ctx context.Context, a [][]string) {
+	assertEq(fmt.Sprint(a), fmt.Sprint([][]string{{"foo", "bar"}, {"baz"}}))
+}
+
+func (*MyImports) ListParam5(ctx context.Context, a []TestListsTestTuple3U8U32U8T) {
+	assertEq(slices.Equal(a, []TestListsTestTuple3U8U32U8T{{1, 2, 3}, {4, 5, 6}}), true)
+}
+
+func (*MyImports) ListParamLarge(ctx context.Context, a []string) {
+	assertEq(len(a), 1000)
+}
+
+func (*MyImports) ListResult(ctx context.Context) []uint8 {
+	return []uint8{1, 2, 3, 4, 5}
+}
+
+func (*MyImports) ListResult2(ctx context.Context) string {
+	return "hello!"
+}
+
+func (*MyImports) ListResult3(ctx context.Context) []string {
+	return []string{"hello,", "world!"}
+}
+
+func (*MyImports) ListMinmax8(ctx context.Context, a []uint8, b []int8) TestListsTestTuple2ListU8TListS8TT {
+	assertEq(slices.Equal(a, []uint8{0, math.MaxUint8}), true)
+	assertEq(slices.Equal(b, []int8{math.MinInt8, math.MaxInt8}), true)
+	return TestListsTestTuple2ListU8TListS8TT{a, b}
+}
+
+func (*MyImports) ListMinmax16(ctx context.Context, a []uint16, b []int16) TestListsTestTuple2ListU16TListS16TT {
+	assertEq(slices.Equal(a, []uint16{0, math.MaxUint16}), true)
+	assertEq(slices.Equal(b, []int16{math.MinInt16, math.MaxInt16}), true)
+	return TestListsTestTuple2ListU16TListS16TT{a, b}
+}
+
+func (*MyImports) ListMinmax32(ctx context.Context, a []uint32, b []int32) TestListsTestTuple2ListU32TListS32TT {
+	assertEq(slices.Equal(a, []uint32{0, math.MaxUint32}), true)
+	assertEq(slices.Equal(b, []int32{math.MinInt32, math.MaxInt32}), true)
+	return TestListsTestTuple2ListU32TListS32TT{a, b}
+}
+
+func (*MyImports) ListMinmax64(ctx context.Context, a []uint64, b []int64) TestListsTestTuple2ListU64TListS64TT {
+	assertEq(slices.Equal(a, []uint64{0, math.MaxUint64}), true)
+	assertEq(slices.Equal(b, []int64{math.MinInt64, math.MaxInt64}), true)
+	return TestListsTestTuple2ListU64TListS64TT{a, b}
+}
+
+func (*MyImports) ListMinmaxFloat(ctx context.Context, a []float32, b []float64) TestListsTestTuple2ListF32TListF64TT {
+	assertEq(slices.Equal(a, []float32{-math.MaxFloat32, math.MaxFloat32, float32(math.Inf(-1)), float32(math.Inf(1))}), true)
+	assertEq(slices.Equal(b, []float64{-math.MaxFloat64, math.MaxFloat64, math.Inf(-1), math.Inf(1)}), true)
+	return TestListsTestTuple2ListF32TListF64TT{a, b}
+}
+
+func (*MyImports) ListRoundtrip(ctx context.Context, a []uint8) []uint8 {
+	return slices.Clone(a)
+}
+
+func (*MyImports) StringRoundtrip(ctx context.Context, a string) string {
+	return a
+}
+
+func runTest(ctx context.Context, i *ListsInstance, imports *MyImports) {
+	bytes := must(i.ListsAllocatedBytes(ctx))
+	check(i.ListsTestImports(ctx))
+
+	check(i.ExportsTestListsTestEmptyListParam(ctx, []uint8{}))
+	check(i.ExportsTestListsTestEmptyStringParam(ctx, ""))
+	assertEq(len(must(i.ExportsTestListsTestEmptyListResult(ctx))), 0)
+	assertEq(must(i.ExportsTestListsTestEmptyStringResult(ctx)), "")
+	check(i.ExportsTestListsTestListParam(ctx, []uint8{1, 2, 3, 4}))
+	check(i.ExportsTestListsTestListParam2(ctx, "foo"))
+	check(i.ExportsTestListsTestListParam3(ctx, []string{"foo", "bar", "baz"}))
+	check(i.ExportsTestListsTestListParam4(ctx, [][]string{{"foo", "bar"}, {"baz"}}))
+	check(i.ExportsTestListsTestListParam5(ctx, []ExportsTestListsTestTuple3U8U32U8T{{1, 2, 3}, {4, 5, 6}}))
+	large := make([]string, 1000)
+	for j := range large {
+		large[j] = "string"
+	}
+	check(i.ExportsTestListsTestListParamLarge(ctx, large))
+	assertEq(slices.Equal(must(i.ExportsTestListsTestListResult(ctx)), []uint8{1, 2, 3, 4, 5}), true)
+	assertEq(must(i.ExportsTestListsTestListResult2(ctx)), "hello!")
+	assertEq(slices.Equal(must(i.ExportsTestListsTestListResult3(ctx)), []string{"hello,", "world!"}), true)
+
+	u8s, s8s := []uint8{0, math.MaxUint8}, []int8{math.MinInt8, math.MaxInt8}
+	minmax8 := must(i.ExportsTestListsTestListMinmax8(ctx, u8s, s8s))
+	assertEq(slices.Equal(minmax8.F0, u8s) && slices.Equal(minmax8.F1, s8s), true)
+	u64s, s64s := []uint64{0, math.MaxUint64}, []int64{math.MinInt64, math.MaxInt64}
+	minmax64 := must(i.ExportsTestListsTestListMinmax64(ctx, u64s, s64s))
+	assertEq(slices.Equal(minmax64.F0, u64s) && slices.Equal(minmax64.F1, s64s), true)
+	f32s := []float32{-math.MaxFloat32, math.MaxFloat32, float32(math.Inf(-1)), float32(math.Inf(1))}
+	f64s := []float64{-math.MaxFloat64, math.MaxFloat64, math.Inf(-1), math.Inf(1)}
+	floats := must(i.ExportsTestListsTestListMinmaxFloat(ctx, f32s, f64s))
+	assertEq(slices.Equal(floats.F0, f32s) && slices.Equal(floats.F1, f64s), true)
+
+	assertEq(slices.Equal(must(i.ExportsTestListsTestListRoundtrip(ctx, []uint8{1, 2, 3})), []uint8{1, 2, 3}), true)
+	assertEq(must(i.ExportsTestListsTestStringRoundtrip(ctx, "x")), "x")
+	assertEq(must(i.ExportsTestListsTestStringRoundtrip(ctx, "")), "")
+	assertEq(must(i.ExportsTestListsTestStringRoundtrip(ctx, "hello ⚑ world")), "hello ⚑ world")
+
+	// the imports and exports leave nothing allocated behind
+	assertEq(must(i.ListsAllocatedBytes(ctx)), bytes)
+}
@@ -14,6 +14,7 @@ use wit_component::{ComponentEncoder, StringEncoding};
 use wit_parser::{Resolve, WorldId, WorldItem};
 
 mod flavorful;
+mod go_features;
 mod lists;
 mod many_arguments;
 mod numbers;
@@ -59,7 +60,7 @@ fn run_test<T, U>(
     name: &str,
     add_to_linker: fn(&mut Linker<Wasi<T>>) -> Result<()>,
     instantiate: fn(&mut Store<Wasi<T>>, &Component, &Linker<Wasi<T>>) -> Result<U>,
-    test: fn(U, &mut Store<Wasi<T>>) -> Result<()>,
+    test: fn(&U, &mut Store<Wasi<T>>) -> Result<()>,
 ) -> Result<()>
 where
     T: Default,
@@ -73,7 +74,7 @@ fn run_test_from_dir<T, U>(
     name: &str,
     add_to_linker: fn(&mut Linker<Wasi<T>>) -> Result<()>,
     instantiate: fn(&mut Store<Wasi<T>>, &Component, &Linker<Wasi<T>>) -> Result<U>,
-    test: fn(U, &mut Store<Wasi<T>>) -> Result<()>,
+    test: fn(&U, &mut Store<Wasi<T>>) -> Result<()>,
 ) -> Result<()>
 where
     T: Default,
@@ -106,12 +107,264 @@ where
         let exports = instantiate(&mut store, &component, &linker)?;
 
         println!("testing {wasm:?}");
-        test(exports, &mut store)?;
+        // Go guests built for the leak check are tested repeatedly on the same
+        // instance, for their memory to grow if anything isn't freed.
+        let iterations = match go_leak_check_iterations() {
+            Some(n) if is_go_component(&wasm) => n,
+            _ => 1,
+        };
+        for _ in 0..iterations {
+            test(&exports, &mut store)?;
+        }
     }
 
     Ok(())
 }
 
+/// The leak check built into the Go guests with `WIT_BINDGEN_GO_LEAK_CHECK`,
+/// which counts the bytes allocated for the values passed across the
+/// component boundary and panics on entry to an export once more of them
+/// are still allocated than after the warmup calls, plus a budget for the
+/// resources legitimately kept alive.
+const GO_LEAK_CHECK: &str = r#"package main
+
+import (
+	"unsafe"
+
+	. "wit_{snake}_go/gen"
+)
+
+const (
+	leakCheckWarmup = 100
+	leakCheckBudget = 64 << 10
+)
+
+type leakCheckAllocation struct {
+	mem  []byte
+	size uintptr
+}
+
+var (
+	// the allocations are kept alive by the Go heap until they are freed
+	leakCheckAllocations = map[uintptr]leakCheckAllocation{}
+	leakCheckLive        uintptr
+	leakCheckBaseline    uintptr
+	leakCheckCalls       int
+	leakCheckDepth       int
+)
+
+func init() {
+	SetAllocator(leakCheckAlloc, leakCheckRealloc, leakCheckFree)
+	SetTraceHook(leakCheckTrace)
+}
+
+func leakCheckAlloc(size, align uintptr) unsafe.Pointer {
+	mem := make([]byte, size+align)
+	base := uintptr(unsafe.Pointer(unsafe.SliceData(mem)))
+	ptr := unsafe.Add(unsafe.Pointer(unsafe.SliceData(mem)), (align-base%align)%align)
+	leakCheckAllocations[uintptr(ptr)] = leakCheckAllocation{mem, size}
+	leakCheckLive += size
+	return ptr
+}
+
+func leakCheckRealloc(ptr unsafe.Pointer, oldSize, align, newSize uintptr) unsafe.Pointer {
+	ret := leakCheckAlloc(newSize, align)
+	if oldSize > newSize {
+		oldSize = newSize
+	}
+	copy(unsafe.Slice((*byte)(ret), newSize), unsafe.Slice((*byte)(ptr), oldSize))
+	leakCheckFree(ptr)
+	return ret
+}
+
+func leakCheckFree(ptr unsafe.Pointer) {
+	if ptr == nil {
+		return
+	}
+	a, ok := leakCheckAllocations[uintptr(ptr)]
+	if !ok {
+		panic("leak check: freeing memory which isn't allocated")
+	}
+	delete(leakCheckAllocations, uintptr(ptr))
+	leakCheckLive -= a.size
+}
+
+// leakCheckTrace checks the allocated bytes on entry to the exports called by
+// the host, by when everything from the previous calls should be freed.
+func leakCheckTrace(iface, fn string, phase Phase) {
+	if phase == PhaseExit {
+		leakCheckDepth--
+		return
+	}
+	leakCheckDepth++
+	if leakCheckDepth > 1 {
+		return
+	}
+	leakCheckCalls++
+	if leakCheckCalls == leakCheckWarmup {
+		leakCheckBaseline = leakCheckLive
+	} else if leakCheckCalls > leakCheckWarmup && leakCheckLive > leakCheckBaseline+leakCheckBudget {
+		println("leak check:", leakCheckLive-leakCheckBaseline, "bytes leaked after", leakCheckCalls, "calls, entering", iface, fn)
+		panic("leak check: memory grows unbounded")
+	}
+}
+"#;
+
+/// Returns the number of times the tests of Go guests are repeated for the
+/// leak check, if enabled with `WIT_BINDGEN_GO_LEAK_CHECK=<iterations>`.
+fn go_leak_check_iterations() -> Option<usize> {
+    let iterations = env::var("WIT_BINDGEN_GO_LEAK_CHECK").ok()?;
+    Some(
+        iterations
+            .parse()
+            .expect("WIT_BINDGEN_GO_LEAK_CHECK must be a number of iterations"),
+    )
+}
+
+/// Returns the options the Go guest of the test `name` is generated with, the
+/// tests of the opt-in features of the Go bindings enabling them.
+///
+/// The guests are written against `Result` values, so they are all generated
+/// with `result_as_error` turned off.
+#[cfg(feature = "go")]
+fn go_opts(name: &str) -> wit_bindgen_go::Opts {
+    match name {
+        "go_features" => wit_bindgen_go::Opts {
+            json: true,
+            binary_marshaler: true,
+            call_batching: true,
+            export_panics: wit_bindgen_go::ExportPanics::Error,
+            result_as_error: false,
+            ..Default::default()
+        },
+        _ => wit_bindgen_go::Opts {
+            result_as_error: false,
+            ..Default::default()
+        },
+    }
+}
+
+/// Returns whether `wasm` is a component built from a Go guest by `tests`.
+fn is_go_component(wasm: &Path) -> bool {
+    wasm.parent()
+        .and_then(|dir| dir.file_name())
+        .and_then(|name| name.to_str())
+        .map_or(false, |name| name.starts_with("go-"))
+}
+
+/// The harness of the Go hosts, instantiating the guest module passed as its
+/// argument with wazero, with the imports implemented by `MyImports`, and
+/// calling its exports from `runTest`, both defined by the `host.go` of the
+/// test like the `run_test` of the Rust hosts.
+const GO_HOST: &str = r#"package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	. "wit_{snake}_host/gen"
+)
+
+func main() {
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+
+	imports := &MyImports{}
+	check(Add{world}ImportsToRuntime(ctx, r, imports))
+	guest := must(os.ReadFile(os.Args[1]))
+	compiled := must(r.CompileModule(ctx, guest))
+	config := wazero.NewModuleConfig().WithStdout(os.Stdout).WithStderr(os.Stderr)
+	i := must(Instantiate{world}(ctx, r, compiled, config))
+	runTest(ctx, i, imports)
+}
+
+// check fails the test if `err` is set, e.g. by a call of an export.
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// must returns the result `v` of a call, failing the test if `err` is set.
+func must[T any](v T, err error) T {
+	check(err)
+	return v
+}
+
+// assertEq fails the test unless `got` equals `want`.
+func assertEq[T comparable](got, want T) {
+	if got != want {
+		panic(fmt.Sprintf("assertion failed: got %v, want %v", got, want))
+	}
+}
+"#;
+
+/// Runs the Go host `host` of a test against the core module `guest` built
+/// from its Go guest, through the wazero host bindings of `world` generated
+/// in `out_dir`.
+#[cfg(feature = "go")]
+fn run_go_host(resolve: &Resolve, world: WorldId, out_dir: &Path, host: &Path, guest: &Path) {
+    let world_name = &resolve.worlds[world].name;
+    let snake = world_name.replace("-", "_");
+    drop(fs::remove_dir_all(out_dir));
+
+    let mut files = Default::default();
+    wit_bindgen_go::Opts {
+        host: true,
+        ..Default::default()
+    }
+    .build()
+    .generate(resolve, world, &mut files)
+    .unwrap();
+    let gen_dir = out_dir.join("gen");
+    fs::create_dir_all(&gen_dir).unwrap();
+    for (file, contents) in files.iter() {
+        let dst = gen_dir.join(file);
+        fs::write(dst, contents).unwrap();
+    }
+    fs::copy(host, out_dir.join("host.go")).unwrap();
+    let src = GO_HOST
+        .replace("{snake}", &snake)
+        .replace("{world}", &world_name.to_upper_camel_case());
+    fs::write(out_dir.join("main.go"), src).unwrap();
+
+    let go_mod = format!(
+        "module wit_{snake}_host\n\ngo 1.21\n\nrequire github.com/tetratelabs/wazero v1.8.2\n"
+    );
+    fs::write(out_dir.join("go.mod"), go_mod).unwrap();
+
+    for args in [&["mod", "tidy"][..], &["run", "."]] {
+        let mut cmd = Command::new("go");
+        cmd.args(args);
+        if args[0] == "run" {
+            cmd.arg(guest);
+        }
+        cmd.current_dir(out_dir);
+        let command = format!("{cmd:?}");
+        let output = match cmd.output() {
+            Ok(output) => output,
+            Err(e) => panic!("failed to spawn go: {e}; command was `{command}`"),
+        };
+
+        if !output.status.success() {
+            println!("dir: {}", out_dir.display());
+            println!("status: {}", output.status);
+            println!("stdout: ------------------------------------------");
+            println!("{}", String::from_utf8_lossy(&output.stdout));
+            println!("stderr: ------------------------------------------");
+            println!("{}", String::from_utf8_lossy(&output.stderr));
+            panic!("failed to run the Go host");
+        }
+    }
+    println!("tested {guest:?} with the Go host");
+}
+
 fn tests(name: &str, dir_name: &str) -> Result<Vec<PathBuf>> {
     let mut result = Vec::new();
 
@@ -122,6 +375,7 @@ fn tests(name: &str, dir_name: &str) -> Result<Vec<PathBuf>> {
     let mut c = Vec::new();
     let mut java = Vec::new();
     let mut go = Vec::new();
+    let mut go_host = Vec::new();
     let mut c_sharp: Vec<PathBuf> = Vec::new();
     for file in dir.read_dir()? {
         let path = file?.path();
@@ -129,6 +383,9 @@ fn tests(name: &str, dir_name: &str) -> Result<Vec<PathBuf>> {
             Some("c") => c.push(path),
             Some("java") => java.push(path),
             Some("rs") => rust.push(path),
+            Some("go") if path.file_stem().and_then(|s| s.to_str()) == Some("host") => {
+                go_host.push(path)
+            }
             Some("go") => go.push(path),
             Some("cs") => c_sharp.push(path),
             _ => {}
@@ -274,11 +531,16 @@ fn tests(name: &str, dir_name: &str) -> Result<Vec<PathBuf>> {
         let snake = world_name.replace("-", "_");
         drop(fs::remove_dir_all(&out_dir));
 
+        // the leak check hooks the calls of the exports
+        let leak_check = go_leak_check_iterations().is_some();
         let mut files = Default::default();
-        wit_bindgen_go::Opts::default()
-            .build()
-            .generate(&resolve, world, &mut files)
-            .unwrap();
+        wit_bindgen_go::Opts {
+            trace: leak_check,
+            ..go_opts(name)
+        }
+        .build()
+        .generate(&resolve, world, &mut files)
+        .unwrap();
         let gen_dir = out_dir.join("gen");
         fs::create_dir_all(&gen_dir).unwrap();
         for (file, contents) in files.iter() {
@@ -289,6 +551,11 @@ fn tests(name: &str, dir_name: &str) -> Result<Vec<PathBuf>> {
             fs::copy(&go_impl, out_dir.join(format!("{snake}.go"))).unwrap();
         }
 
+        if leak_check {
+            let src = GO_LEAK_CHECK.replace("{snake}", &snake);
+            fs::write(out_dir.join("leak_check.go"), src).unwrap();
+        }
+
         let go_mod = format!("module wit_{snake}_go\n\ngo 1.20");
         fs::write(out_dir.join("go.mod"), go_mod).unwrap();
 
@@ -300,6 +567,9 @@ fn tests(name: &str, dir_name: &str) -> Result<Vec<PathBuf>> {
         cmd.arg("-o");
         cmd.arg(&out_wasm);
         cmd.arg(format!("{snake}.go"));
+        if leak_check {
+            cmd.arg("leak_check.go");
+        }
         cmd.current_dir(&out_dir);
         let command = format!("{cmd:?}");
         let output = match cmd.output() {
@@ -344,6 +614,16 @@ fn tests(name: &str, dir_name: &str) -> Result<Vec<PathBuf>> {
         fs::write(&component_path, component).expect("write component to disk");
 
         result.push(component_path);
+
+        // the guest module is also run by the Go host bindings with
+        // `WIT_BINDGEN_GO_HOST` set, checking both directions of the Go bindings
+        // against each other, which needs network access to fetch wazero
+        if env::var_os("WIT_BINDGEN_GO_HOST").is_some() {
+            for host in &go_host {
+                let host_dir = out_dir.with_file_name(format!("go-host-{world_name}"));
+                run_go_host(&resolve, world, &host_dir, host, &out_wasm);
+            }
+        }
     }
 
     #[cfg(feature = "teavm-java")]
@@ -55,7 +55,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: ManyArguments, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &ManyArguments, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     exports.call_many_arguments(
         &mut *store,
         1,
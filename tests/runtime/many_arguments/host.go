@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	. "wit_many_arguments_host/gen"
+)
+
+type MyImports struct{}
+
+func (*MyImports) ManyArguments(ctx context.Context, a1 uint64, a2 uint64, a3 uint64, a4 uint64, a5 uint64, a6 uint64, a7 uint64, a8 uint64, a9 uint64, a10 uint64, a11 uint64, a12 uint64, a13 uint64, a14 uint64, a15 uint64, a16 uint64) {
+	assertEq(a1, 1)
+	assertEq(a2, 2)
+	assertEq(a3, 3)
+	assertEq(a4, 4)
+	assertEq(a5, 5)
+	assertEq(a6, 6)
+	assertEq(a7, 7)
+	assertEq(a8, 8)
+	assertEq(a9, 9)
+	assertEq(a10, 10)
+	assertEq(a11, 11)
+	assertEq(a12, 12)
+	assertEq(a13, 13)
+	assertEq(a14, 14)
+	assertEq(a15, 15)
+	assertEq(a16, 16)
+}
+
+func runTest(ctx context.Context, i *ManyArgumentsInstance, imports *MyImports) {
+	check(i.ManyArgumentsManyArguments(ctx, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16))
+}
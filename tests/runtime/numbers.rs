@@ -72,7 +72,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: Numbers, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &Numbers, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     exports.call_test_imports(&mut *store)?;
     let exports = exports.test_numbers_test();
     assert_eq!(exports.call_roundtrip_u8(&mut *store, 1)?, 1);
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	. "wit_numbers_host/gen"
+)
+
+type MyImports struct {
+	scalar uint32
+}
+
+func (*MyImports) RoundtripU8(ctx context.Context, a uint8) uint8 {
+	return a
+}
+
+func (*MyImports) RoundtripS8(ctx context.Context, a int8) int8 {
+	return a
+}
+
+func (*MyImports) RoundtripU16(ctx context.Context, a uint16) uint16 {
+	return a
+}
+
+func (*MyImports) RoundtripS16(ctx context.Context, a int16) int16 {
+	return a
+}
+
+func (*MyImports) RoundtripU32(ctx context.Context, a uint32) uint32 {
+	return a
+}
+
+func (*MyImports) RoundtripS32(ctx context.Context, a int32) int32 {
+	return a
+}
+
+func (*MyImports) RoundtripU64(ctx context.Context, a uint64) uint64 {
+	return a
+}
+
+func (*MyImports) RoundtripS64(ctx context.Context, a int64) int64 {
+	return a
+}
+
+func (*MyImports) RoundtripF32(ctx context.Context, a float32) float32 {
+	return a
+}
+
+func (*MyImports) RoundtripF64(ctx context.Context, a float64) float64 {
+	return a
+}
+
+func (*MyImports) RoundtripChar(ctx context.Context, a rune) rune {
+	return a
+}
+
+func (i *MyImports) SetScalar(ctx context.Context, a uint32) {
+	i.scalar = a
+}
+
+func (i *MyImports) GetScalar(ctx context.Context) uint32 {
+	return i.scalar
+}
+
+func runTest(ctx context.Context, i *NumbersInstance, imports *MyImports) {
+	check(i.NumbersTestImports(ctx))
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU8(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU8(ctx, 0)), 0)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU8(ctx, math.MaxUint8)), math.MaxUint8)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS8(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS8(ctx, math.MinInt8)), math.MinInt8)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS8(ctx, math.MaxInt8)), math.MaxInt8)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU16(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU16(ctx, 0)), 0)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU16(ctx, math.MaxUint16)), math.MaxUint16)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS16(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS16(ctx, math.MinInt16)), math.MinInt16)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS16(ctx, math.MaxInt16)), math.MaxInt16)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU32(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU32(ctx, 0)), 0)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU32(ctx, math.MaxUint32)), math.MaxUint32)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS32(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS32(ctx, math.MinInt32)), math.MinInt32)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS32(ctx, math.MaxInt32)), math.MaxInt32)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU64(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU64(ctx, 0)), 0)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripU64(ctx, math.MaxUint64)), math.MaxUint64)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS64(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS64(ctx, math.MinInt64)), math.MinInt64)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripS64(ctx, math.MaxInt64)), math.MaxInt64)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripF32(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripF32(ctx, float32(math.Inf(1)))), float32(math.Inf(1)))
+	assertEq(must(i.ExportsTestNumbersTestRoundtripF32(ctx, float32(math.Inf(-1)))), float32(math.Inf(-1)))
+	assertEq(math.IsNaN(float64(must(i.ExportsTestNumbersTestRoundtripF32(ctx, float32(math.NaN()))))), true)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripF64(ctx, 1)), 1)
+	assertEq(must(i.ExportsTestNumbersTestRoundtripF64(ctx, math.Inf(1))), math.Inf(1))
+	assertEq(must(i.ExportsTestNumbersTestRoundtripF64(ctx, math.Inf(-1))), math.Inf(-1))
+	assertEq(math.IsNaN(must(i.ExportsTestNumbersTestRoundtripF64(ctx, math.NaN()))), true)
+
+	assertEq(must(i.ExportsTestNumbersTestRoundtripChar(ctx, 'a')), 'a')
+	assertEq(must(i.ExportsTestNumbersTestRoundtripChar(ctx, ' ')), ' ')
+	assertEq(must(i.ExportsTestNumbersTestRoundtripChar(ctx, '🚩')), '🚩')
+
+	check(i.ExportsTestNumbersTestSetScalar(ctx, 2))
+	assertEq(must(i.ExportsTestNumbersTestGetScalar(ctx)), 2)
+	check(i.ExportsTestNumbersTestSetScalar(ctx, 4))
+	assertEq(must(i.ExportsTestNumbersTestGetScalar(ctx)), 4)
+}
@@ -42,7 +42,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: Options, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &Options, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     exports.call_test_imports(&mut *store)?;
     let exports = exports.test_options_test();
     assert!(exports.call_option_none_result(&mut *store)?.is_none());
@@ -75,7 +75,7 @@ fn run() -> Result<()> {
     Ok(())
 }
 
-fn run_test(exports: Ownership, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &Ownership, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     exports.call_foo(&mut *store)?;
 
     assert!(store.data().0.called_foo);
@@ -60,7 +60,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: Records, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &Records, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     use exports::test::records::test::*;
 
     exports.call_test_imports(&mut *store)?;
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+
+	. "wit_records_host/gen"
+)
+
+type MyImports struct{}
+
+func (*MyImports) MultipleResults(ctx context.Context) TestRecordsTestTuple2U8U16T {
+	return TestRecordsTestTuple2U8U16T{4, 5}
+}
+
+func (*MyImports) SwapTuple(ctx context.Context, a TestRecordsTestTuple2U8U32T) TestRecordsTestTuple2U32U8T {
+	return TestRecordsTestTuple2U32U8T{a.F1, a.F0}
+}
+
+func (*MyImports) RoundtripFlags1(ctx context.Context, a TestRecordsTestF1) TestRecordsTestF1 {
+	return a
+}
+
+func (*MyImports) RoundtripFlags2(ctx context.Context, a TestRecordsTestF2) TestRecordsTestF2 {
+	return a
+}
+
+func (*MyImports) RoundtripFlags3(ctx context.Context, a TestRecordsTestFlag8, b TestRecordsTestFlag16, c TestRecordsTestFlag32) TestRecordsTestTuple3Flag8Flag16Flag32T {
+	return TestRecordsTestTuple3Flag8Flag16Flag32T{a, b, c}
+}
+
+func (*MyImports) RoundtripRecord1(ctx context.Context, a TestRecordsTestR1) TestRecordsTestR1 {
+	return a
+}
+
+func (*MyImports) Tuple1(ctx context.Context, a TestRecordsTestTuple1U8T) TestRecordsTestTuple1U8T {
+	return a
+}
+
+func runTest(ctx context.Context, i *RecordsInstance, imports *MyImports) {
+	check(i.RecordsTestImports(ctx))
+
+	assertEq(must(i.ExportsTestRecordsTestMultipleResults(ctx)), ExportsTestRecordsTestTuple2U8U16T{100, 200})
+	assertEq(must(i.ExportsTestRecordsTestSwapTuple(ctx, ExportsTestRecordsTestTuple2U8U32T{1, 2})), ExportsTestRecordsTestTuple2U32U8T{2, 1})
+
+	var noF1 ExportsTestRecordsTestF1
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags1(ctx, ExportsTestRecordsTestF1_A)), ExportsTestRecordsTestF1_A)
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags1(ctx, noF1)), noF1)
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags1(ctx, ExportsTestRecordsTestF1_B)), ExportsTestRecordsTestF1_B)
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags1(ctx, ExportsTestRecordsTestF1_A|ExportsTestRecordsTestF1_B)), ExportsTestRecordsTestF1_A|ExportsTestRecordsTestF1_B)
+
+	var noF2 ExportsTestRecordsTestF2
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags2(ctx, ExportsTestRecordsTestF2_C)), ExportsTestRecordsTestF2_C)
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags2(ctx, noF2)), noF2)
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags2(ctx, ExportsTestRecordsTestF2_D)), ExportsTestRecordsTestF2_D)
+	assertEq(must(i.ExportsTestRecordsTestRoundtripFlags2(ctx, ExportsTestRecordsTestF2_C|ExportsTestRecordsTestF2_E)), ExportsTestRecordsTestF2_C|ExportsTestRecordsTestF2_E)
+
+	r := must(i.ExportsTestRecordsTestRoundtripRecord1(ctx, ExportsTestRecordsTestR1{A: 8, B: noF1}))
+	assertEq(r.A, 8)
+	assertEq(r.B, noF1)
+
+	r = must(i.ExportsTestRecordsTestRoundtripRecord1(ctx, ExportsTestRecordsTestR1{A: 0, B: ExportsTestRecordsTestF1_A | ExportsTestRecordsTestF1_B}))
+	assertEq(r.A, 0)
+	assertEq(r.B, ExportsTestRecordsTestF1_A|ExportsTestRecordsTestF1_B)
+
+	assertEq(must(i.ExportsTestRecordsTestTuple1(ctx, ExportsTestRecordsTestTuple1U8T{1})), ExportsTestRecordsTestTuple1U8T{1})
+}
@@ -33,6 +33,19 @@ func (r *RecordImpl) TestImports() {
 		panic("TestRecordsTestRoundtripFlags1")
 	}
 
+	f1 := TestRecordsTestRoundtripFlags1(TestRecordsTestF1All())
+	if !f1.Has(TestRecordsTestF1_A) || !f1.Has(TestRecordsTestF1_B) || f1.String() != "a|b" {
+		panic("TestRecordsTestF1All")
+	}
+	f1.Clear(TestRecordsTestF1_A)
+	if f1.Has(TestRecordsTestF1_A) || f1 != TestRecordsTestF1_B {
+		panic("TestRecordsTestF1.Clear")
+	}
+	f1.Set(TestRecordsTestF1_A)
+	if f1 != TestRecordsTestF1All() {
+		panic("TestRecordsTestF1.Set")
+	}
+
 	if TestRecordsTestRoundtripFlags2(TestRecordsTestF2_C) != TestRecordsTestF2_C {
 		panic("TestRecordsTestRoundtripFlags2")
 	}
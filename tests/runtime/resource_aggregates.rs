@@ -90,7 +90,7 @@ fn run() -> Result<()> {
 }
 
 fn run_test(
-    instance: ResourceAggregates,
+    instance: &ResourceAggregates,
     store: &mut Store<crate::Wasi<MyHostThing>>,
 ) -> Result<()> {
     let mut things = vec![];
@@ -15,7 +15,7 @@ fn run() -> anyhow::Result<()> {
     )
 }
 
-fn run_test(instance: ResourceAlias, store: &mut Store<crate::Wasi<()>>) -> anyhow::Result<()> {
+fn run_test(instance: &ResourceAlias, store: &mut Store<crate::Wasi<()>>) -> anyhow::Result<()> {
     let foo_e1 = Foo1 {
         x: instance
             .test_resource_alias_e1()
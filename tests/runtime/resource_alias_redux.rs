@@ -65,7 +65,7 @@ fn run() -> anyhow::Result<()> {
 }
 
 fn run_test(
-    instance: ResourceAliasRedux,
+    instance: &ResourceAliasRedux,
     store: &mut Store<crate::Wasi<MyHost>>,
 ) -> anyhow::Result<()> {
     let mut thing = MyHost::default();
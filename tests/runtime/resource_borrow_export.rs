@@ -16,7 +16,7 @@ fn run() -> anyhow::Result<()> {
     )
 }
 
-fn run_test(instance: Guest, store: &mut Store<crate::Wasi<()>>) -> anyhow::Result<()> {
+fn run_test(instance: &Guest, store: &mut Store<crate::Wasi<()>>) -> anyhow::Result<()> {
     let thing = instance.thing().call_constructor(&mut *store, 42)?;
     let res = instance.call_foo(&mut *store, thing)?;
     assert_eq!(res, 42 + 1 + 2);
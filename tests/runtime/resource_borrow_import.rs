@@ -45,7 +45,7 @@ fn run() -> anyhow::Result<()> {
 }
 
 fn run_test(
-    instance: ResourceBorrowImport,
+    instance: &ResourceBorrowImport,
     store: &mut Store<crate::Wasi<MyHostThing>>,
 ) -> anyhow::Result<()> {
     let res = instance.call_test(&mut *store, 42)?;
@@ -13,7 +13,7 @@ type Import struct{}
 
 func (e Import) Test(v uint32) uint32 {
 	thing := NewThing(v + 1)
-	defer thing.Drop()
+	defer thing.Close()
 	return TestResourceBorrowImportTestFoo(thing) + 4
 	
 }
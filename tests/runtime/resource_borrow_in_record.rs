@@ -65,7 +65,7 @@ fn run() -> anyhow::Result<()> {
     )
 }
 
-fn run_test(instance: Guest, store: &mut Store<crate::Wasi<MyHostThing>>) -> anyhow::Result<()> {
+fn run_test(instance: &Guest, store: &mut Store<crate::Wasi<MyHostThing>>) -> anyhow::Result<()> {
     let thing1 = instance.thing().call_constructor(&mut *store, "Bonjour")?;
     let thing2 = instance.thing().call_constructor(&mut *store, "mon cher")?;
     let foo1 = ImportFoo { thing: thing1 };
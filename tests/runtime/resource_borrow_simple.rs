@@ -36,7 +36,7 @@ fn run() -> anyhow::Result<()> {
 }
 
 fn run_test(
-    instance: ResourceBorrowSimple,
+    instance: &ResourceBorrowSimple,
     store: &mut Store<crate::Wasi<MyHostRImpl>>,
 ) -> anyhow::Result<()> {
     instance.call_test_imports(&mut *store)?;
@@ -77,7 +77,7 @@ fn run() -> anyhow::Result<()> {
 }
 
 fn run_test(
-    instance: ResourceFloats,
+    instance: &ResourceFloats,
     store: &mut Store<crate::Wasi<MyHostFloats>>,
 ) -> anyhow::Result<()> {
     // let mut float1 = MyHostFloats::default();
@@ -63,7 +63,7 @@ fn run() -> anyhow::Result<()> {
     )
 }
 
-fn run_test(instance: Guest, store: &mut Store<crate::Wasi<MyHostThing>>) -> anyhow::Result<()> {
+fn run_test(instance: &Guest, store: &mut Store<crate::Wasi<MyHostThing>>) -> anyhow::Result<()> {
     let thing1 = instance.thing().call_constructor(&mut *store, 42)?;
 
     // 42 + 1 (constructor) + 1 (constructor) + 2 (foo) + 2 (foo)
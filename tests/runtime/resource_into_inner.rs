@@ -16,6 +16,6 @@ fn run() -> anyhow::Result<()> {
     )
 }
 
-fn run_test(instance: Guest, store: &mut Store<crate::Wasi<()>>) -> anyhow::Result<()> {
+fn run_test(instance: &Guest, store: &mut Store<crate::Wasi<()>>) -> anyhow::Result<()> {
     instance.call_test(&mut *store)
 }
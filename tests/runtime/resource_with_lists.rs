@@ -63,7 +63,7 @@ fn run() -> anyhow::Result<()> {
     )
 }
 
-fn run_test(exports: Guest, store: &mut Store<crate::Wasi<MyHostThing>>) -> anyhow::Result<()> {
+fn run_test(exports: &Guest, store: &mut Store<crate::Wasi<MyHostThing>>) -> anyhow::Result<()> {
     let thing = exports.thing();
 
     let hi_encoded = "Hi".as_bytes().to_vec();
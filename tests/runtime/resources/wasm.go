@@ -52,8 +52,14 @@ func (z *MyZ) MethodZGetA() int32 {
 	return z.a
 }
 
+var numDroppedZs uint32
+
+func (z *MyZ) Destructor() {
+	numDroppedZs++
+}
+
 func (e ExportsImpl) StaticZNumDropped() uint32 {
-        return 0
+	return numDroppedZs
 }
 
 func (e ExportsImpl) Add(z ExportsZ, b ExportsZ) ExportsZ {
@@ -89,7 +89,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(results: Results, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(results: &Results, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     use exports::test::results::test::{E, E2, E3};
 
     assert_eq!(
@@ -52,7 +52,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: C, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &C, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     exports.call_b(&mut *store)?;
 
     let x = exports.an_exported_interface().x();
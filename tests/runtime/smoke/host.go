@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+
+	. "wit_smoke_host/gen"
+)
+
+type MyImports struct {
+	hit bool
+}
+
+func (i *MyImports) Thunk(ctx context.Context) {
+	i.hit = true
+	println("in the host")
+}
+
+func runTest(ctx context.Context, i *SmokeInstance, imports *MyImports) {
+	check(i.SmokeThunk(ctx))
+
+	assertEq(imports.hit, true)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	. "wit_strings_host/gen"
+)
+
+type MyImports struct{}
+
+func (*MyImports) TakeBasic(ctx context.Context, s string) {
+	assertEq(s, "latin utf16")
+}
+
+func (*MyImports) ReturnUnicode(ctx context.Context) string {
+	return "🚀🚀🚀 𠈄𓀀"
+}
+
+func runTest(ctx context.Context, i *StringsInstance, imports *MyImports) {
+	check(i.StringsTestImports(ctx))
+	assertEq(must(i.StringsReturnEmpty(ctx)), "")
+	assertEq(must(i.StringsRoundtrip(ctx, "str")), "str")
+	assertEq(must(i.StringsRoundtrip(ctx, "🚀🚀🚀 𠈄𓀀")), "🚀🚀🚀 𠈄𓀀")
+}
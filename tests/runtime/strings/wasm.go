@@ -0,0 +1,29 @@
+package main
+
+import (
+	. "wit_strings_go/gen"
+)
+
+func init() {
+	n := &StringsImpl{}
+	SetStrings(n)
+}
+
+type StringsImpl struct{}
+
+func (s *StringsImpl) TestImports() {
+	TestStringsImportsTakeBasic("latin utf16")
+	if TestStringsImportsReturnUnicode() != "🚀🚀🚀 𠈄𓀀" {
+		panic("TestStringsImportsReturnUnicode")
+	}
+}
+
+func (s *StringsImpl) ReturnEmpty() string {
+	return ""
+}
+
+func (s *StringsImpl) Roundtrip(a string) string {
+	return a
+}
+
+func main() {}
@@ -26,7 +26,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: RequiredExports, store: &mut Store<crate::Wasi<MyFoo>>) -> Result<()> {
+fn run_test(exports: &RequiredExports, store: &mut Store<crate::Wasi<MyFoo>>) -> Result<()> {
     exports.call_run(&mut *store)?;
     Ok(())
 }
@@ -62,7 +62,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: Variants, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
+fn run_test(exports: &Variants, store: &mut Store<crate::Wasi<MyImports>>) -> Result<()> {
     use exports::test::variants::test::*;
 
     exports.call_test_imports(&mut *store)?;
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+
+	. "wit_variants_host/gen"
+)
+
+type MyImports struct{}
+
+func (*MyImports) RoundtripOption(ctx context.Context, a Option[float32]) Option[uint8] {
+	if a.IsNone() {
+		return None[uint8]()
+	}
+	return Some[uint8](uint8(a.Unwrap()))
+}
+
+func (*MyImports) RoundtripResult(ctx context.Context, a Result[uint32, float32]) Result[float64, uint8] {
+	if a.IsErr() {
+		return Err[float64, uint8](uint8(a.UnwrapErr()))
+	}
+	return Ok[float64, uint8](float64(a.Unwrap()))
+}
+
+func (*MyImports) RoundtripEnum(ctx context.Context, a TestVariantsTestE1) TestVariantsTestE1 {
+	return a
+}
+
+func (*MyImports) InvertBool(ctx context.Context, a bool) bool {
+	return !a
+}
+
+func (*MyImports) VariantCasts(ctx context.Context, a TestVariantsTestCasts) TestVariantsTestCasts {
+	return a
+}
+
+func (*MyImports) VariantZeros(ctx context.Context, a TestVariantsTestZeros) TestVariantsTestZeros {
+	return a
+}
+
+func (*MyImports) VariantTypedefs(ctx context.Context, a Option[uint32], b TestVariantsTestBoolTypedef, c Result[uint32, struct{}]) {
+}
+
+func (*MyImports) VariantEnums(ctx context.Context, a bool, b Result[struct{}, struct{}], c TestVariantsTestMyErrno) TestVariantsTestTuple3BoolResultEmptyEmptyTMyErrnoT {
+	assertEq(a, true)
+	assertEq(b.IsOk(), true)
+	assertEq(c, TestVariantsTestMyErrnoSuccess())
+	return TestVariantsTestTuple3BoolResultEmptyEmptyTMyErrnoT{false, Err[struct{}, struct{}](struct{}{}), TestVariantsTestMyErrnoA()}
+}
+
+func runTest(ctx context.Context, i *VariantsInstance, imports *MyImports) {
+	check(i.VariantsTestImports(ctx))
+
+	o := must(i.ExportsTestVariantsTestRoundtripOption(ctx, Some[float32](1)))
+	assertEq(o.IsSome() && o.Unwrap() == 1, true)
+	assertEq(must(i.ExportsTestVariantsTestRoundtripOption(ctx, None[float32]())).IsNone(), true)
+	o = must(i.ExportsTestVariantsTestRoundtripOption(ctx, Some[float32](2)))
+	assertEq(o.IsSome() && o.Unwrap() == 2, true)
+
+	r := must(i.ExportsTestVariantsTestRoundtripResult(ctx, Ok[uint32, float32](2)))
+	assertEq(r.IsOk() && r.Unwrap() == 2, true)
+	r = must(i.ExportsTestVariantsTestRoundtripResult(ctx, Ok[uint32, float32](4)))
+	assertEq(r.IsOk() && r.Unwrap() == 4, true)
+	r = must(i.ExportsTestVariantsTestRoundtripResult(ctx, Err[uint32, float32](5.3)))
+	assertEq(r.IsErr() && r.UnwrapErr() == 5, true)
+
+	assertEq(must(i.ExportsTestVariantsTestRoundtripEnum(ctx, ExportsTestVariantsTestE1A())), ExportsTestVariantsTestE1A())
+	assertEq(must(i.ExportsTestVariantsTestRoundtripEnum(ctx, ExportsTestVariantsTestE1B())), ExportsTestVariantsTestE1B())
+
+	assertEq(must(i.ExportsTestVariantsTestInvertBool(ctx, true)), false)
+	assertEq(must(i.ExportsTestVariantsTestInvertBool(ctx, false)), true)
+
+	casts := ExportsTestVariantsTestCasts{
+		ExportsTestVariantsTestC1A(1),
+		ExportsTestVariantsTestC2A(2),
+		ExportsTestVariantsTestC3A(3),
+		ExportsTestVariantsTestC4A(4),
+		ExportsTestVariantsTestC5A(5),
+		ExportsTestVariantsTestC6A(6),
+	}
+	assertEq(must(i.ExportsTestVariantsTestVariantCasts(ctx, casts)).Equal(casts), true)
+	casts = ExportsTestVariantsTestCasts{
+		ExportsTestVariantsTestC1B(1),
+		ExportsTestVariantsTestC2B(2),
+		ExportsTestVariantsTestC3B(3),
+		ExportsTestVariantsTestC4B(4),
+		ExportsTestVariantsTestC5B(5),
+		ExportsTestVariantsTestC6B(6),
+	}
+	c := must(i.ExportsTestVariantsTestVariantCasts(ctx, casts))
+	assertEq(c.F0.GetB(), 1)
+	assertEq(c.F1.GetB(), 2)
+	assertEq(c.F2.GetB(), 3)
+	assertEq(c.F3.GetB(), 4)
+	assertEq(c.F4.GetB(), 5)
+	assertEq(c.F5.GetB(), 6)
+
+	zeros := ExportsTestVariantsTestZeros{
+		ExportsTestVariantsTestZ1A(1),
+		ExportsTestVariantsTestZ2A(2),
+		ExportsTestVariantsTestZ3A(3),
+		ExportsTestVariantsTestZ4A(4),
+	}
+	assertEq(must(i.ExportsTestVariantsTestVariantZeros(ctx, zeros)).Equal(zeros), true)
+
+	check(i.ExportsTestVariantsTestVariantTypedefs(ctx, None[uint32](), false, Err[uint32, struct{}](struct{}{})))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	. "wit_variants_go/gen"
+)
+
+func init() {
+	n := &VariantsImpl{}
+	SetVariants(n)
+	SetExportsTestVariantsTest(n)
+}
+
+type VariantsImpl struct{}
+
+func (v *VariantsImpl) TestImports() {
+	if r := TestVariantsTestRoundtripOption(Some[float32](1)); r.IsNone() || r.Unwrap() != 1 {
+		panic("TestVariantsTestRoundtripOption")
+	}
+	if TestVariantsTestRoundtripOption(None[float32]()).IsSome() {
+		panic("TestVariantsTestRoundtripOption")
+	}
+	if r := TestVariantsTestRoundtripOption(Some[float32](2)); r.IsNone() || r.Unwrap() != 2 {
+		panic("TestVariantsTestRoundtripOption")
+	}
+
+	if r := TestVariantsTestRoundtripResult(Ok[uint32, float32](2)); r.IsErr() || r.Unwrap() != 2 {
+		panic("TestVariantsTestRoundtripResult")
+	}
+	if r := TestVariantsTestRoundtripResult(Ok[uint32, float32](4)); r.IsErr() || r.Unwrap() != 4 {
+		panic("TestVariantsTestRoundtripResult")
+	}
+	if r := TestVariantsTestRoundtripResult(Err[uint32, float32](5.3)); r.IsOk() || r.UnwrapErr() != 5 {
+		panic("TestVariantsTestRoundtripResult")
+	}
+
+	if TestVariantsTestRoundtripEnum(TestVariantsTestE1A()) != TestVariantsTestE1A() {
+		panic("TestVariantsTestRoundtripEnum")
+	}
+	if TestVariantsTestRoundtripEnum(TestVariantsTestE1B()) != TestVariantsTestE1B() {
+		panic("TestVariantsTestRoundtripEnum")
+	}
+
+	if TestVariantsTestInvertBool(true) != false || TestVariantsTestInvertBool(false) != true {
+		panic("TestVariantsTestInvertBool")
+	}
+
+	casts := TestVariantsTestCasts{
+		TestVariantsTestC1A(1),
+		TestVariantsTestC2A(2),
+		TestVariantsTestC3A(3),
+		TestVariantsTestC4A(4),
+		TestVariantsTestC5A(5),
+		TestVariantsTestC6A(6),
+	}
+	if !TestVariantsTestVariantCasts(casts).Equal(casts) {
+		panic("TestVariantsTestVariantCasts")
+	}
+	casts = TestVariantsTestCasts{
+		TestVariantsTestC1B(1),
+		TestVariantsTestC2B(2),
+		TestVariantsTestC3B(3),
+		TestVariantsTestC4B(4),
+		TestVariantsTestC5B(5),
+		TestVariantsTestC6B(6),
+	}
+	ret := TestVariantsTestVariantCasts(casts)
+	if ret.F0.GetB() != 1 || ret.F1.GetB() != 2 || ret.F2.GetB() != 3 ||
+		ret.F3.GetB() != 4 || ret.F4.GetB() != 5 || ret.F5.GetB() != 6 {
+		panic("TestVariantsTestVariantCasts")
+	}
+
+	zeros := TestVariantsTestZeros{
+		TestVariantsTestZ1A(1),
+		TestVariantsTestZ2A(2),
+		TestVariantsTestZ3A(3),
+		TestVariantsTestZ4A(4),
+	}
+	if !TestVariantsTestVariantZeros(zeros).Equal(zeros) {
+		panic("TestVariantsTestVariantZeros")
+	}
+	zeros = TestVariantsTestZeros{
+		TestVariantsTestZ1B(),
+		TestVariantsTestZ2B(),
+		TestVariantsTestZ3B(),
+		TestVariantsTestZ4B(),
+	}
+	z := TestVariantsTestVariantZeros(zeros)
+	if z.F0.Kind() != TestVariantsTestZ1KindB || z.F1.Kind() != TestVariantsTestZ2KindB ||
+		z.F2.Kind() != TestVariantsTestZ3KindB || z.F3.Kind() != TestVariantsTestZ4KindB {
+		panic("TestVariantsTestVariantZeros")
+	}
+
+	TestVariantsTestVariantTypedefs(None[uint32](), false, Err[uint32, struct{}](struct{}{}))
+
+	e := TestVariantsTestVariantEnums(true, Ok[struct{}, struct{}](struct{}{}), TestVariantsTestMyErrnoSuccess())
+	if e.F0 != false || !e.F1.IsErr() || e.F2 != TestVariantsTestMyErrnoA() {
+		panic("TestVariantsTestVariantEnums")
+	}
+}
+
+func (v *VariantsImpl) RoundtripOption(a Option[float32]) Option[uint8] {
+	if a.IsNone() {
+		return None[uint8]()
+	}
+	return Some[uint8](uint8(a.Unwrap()))
+}
+
+func (v *VariantsImpl) RoundtripResult(a Result[uint32, float32]) Result[float64, uint8] {
+	if a.IsErr() {
+		return Err[float64, uint8](uint8(a.UnwrapErr()))
+	}
+	return Ok[float64, uint8](float64(a.Unwrap()))
+}
+
+func (v *VariantsImpl) RoundtripEnum(a ExportsTestVariantsTestE1) ExportsTestVariantsTestE1 {
+	return a
+}
+
+func (v *VariantsImpl) InvertBool(a bool) bool {
+	return !a
+}
+
+func (v *VariantsImpl) VariantCasts(a ExportsTestVariantsTestCasts) ExportsTestVariantsTestCasts {
+	return a
+}
+
+func (v *VariantsImpl) VariantZeros(a ExportsTestVariantsTestZeros) ExportsTestVariantsTestZeros {
+	return a
+}
+
+func (v *VariantsImpl) VariantTypedefs(a Option[uint32], b ExportsTestVariantsTestBoolTypedef, c Result[uint32, struct{}]) {
+}
+
+func (v *VariantsImpl) VariantEnums(a bool, b Result[struct{}, struct{}], c ExportsTestVariantsTestMyErrno) ExportsTestVariantsTestTuple3BoolResultEmptyEmptyTMyErrnoT {
+	return ExportsTestVariantsTestTuple3BoolResultEmptyEmptyTMyErrnoT{a, b, c}
+}
+
+func main() {}
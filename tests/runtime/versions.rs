@@ -38,7 +38,7 @@ fn run() -> Result<()> {
     )
 }
 
-fn run_test(exports: Foo, store: &mut Store<crate::Wasi<MyFoo>>) -> Result<()> {
+fn run_test(exports: &Foo, store: &mut Store<crate::Wasi<MyFoo>>) -> Result<()> {
     // test version 1
     assert_eq!(exports.test_dep0_1_0_test().call_x(&mut *store)?, 1.0);
     assert_eq!(exports.test_dep0_1_0_test().call_y(&mut *store, 1.0)?, 2.0);